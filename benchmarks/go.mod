@@ -1,14 +1,38 @@
 module github.com/drakos74/lachesis/benchmarks
 
-go 1.15
+go 1.18
 
 require (
 	gioui.org v0.0.0-20210127212131-b698c8ed8229
 	github.com/boltdb/bolt v1.3.1
 	github.com/dgraph-io/badger/v2 v2.2007.2
 	github.com/drakos74/lachesis/store v0.0.0-20210130093135-2f8391df8409
+	github.com/drakos74/lachesis/store/store v0.0.0
 	github.com/drakos74/oremi v0.1.0
 	github.com/google/uuid v1.2.0
 	github.com/rs/zerolog v1.20.0
 	github.com/stretchr/testify v1.7.0
 )
+
+require (
+	github.com/DataDog/zstd v1.4.1 // indirect
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgraph-io/ristretto v0.0.3-0.20200630154024-f66de99634de // indirect
+	github.com/dgryski/go-farm v0.0.0-20190423205320-6a90982ecee2 // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/golang/protobuf v1.3.1 // indirect
+	github.com/golang/snappy v0.0.1 // indirect
+	github.com/google/btree v1.0.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/exp v0.0.0-20191002040644-a1355ae1e2c3 // indirect
+	golang.org/x/image v0.0.0-20200618115811-c13761719519 // indirect
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
+	golang.org/x/sys v0.0.0-20200124204421-9fbb57f87de9 // indirect
+	golang.org/x/text v0.3.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
+
+// the current store module of this repository, alongside the published version the benchmarks were written against
+replace github.com/drakos74/lachesis/store/store => ../store
@@ -11,11 +11,13 @@ type WorldClock struct {
 	tick      chan struct{}
 	tock      chan Event
 	eventPool *Events
+	faults    *faults
 	cycles    int
 }
 
 func (wc WorldClock) startTicking() {
 	for range wc.tick {
+		wc.faults.tick()
 		wc.cycles++
 		// leave some time to warm up, and use the same amount to move to the next events
 		if wc.cycles > wc.eventPool.warmUp {
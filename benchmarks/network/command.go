@@ -1,6 +1,10 @@
 package network
 
 import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/store/app/storage"
 )
 
@@ -14,6 +18,17 @@ const (
 	Put
 )
 
+// String returns a humanly readable representation of the command type
+func (t CmdType) String() string {
+	switch t {
+	case Get:
+		return "get"
+	case Put:
+		return "put"
+	}
+	return ""
+}
+
 // Command is the interface for every command object
 type Command interface {
 	Type() CmdType
@@ -24,6 +39,9 @@ type Command interface {
 type Response struct {
 	storage.Element
 	Err error
+	// Leader is the id of the leader of the cluster, as known to the node that served the command
+	// it is only set by the protocols that have a leader, so that the switch can route the next commands to it.
+	Leader uint32
 }
 
 // PutCommand represents a put action
@@ -65,3 +83,48 @@ func (p GetCommand) Type() CmdType {
 func (p GetCommand) Element() storage.Element {
 	return storage.NewElement(p.key, storage.NilBytes)
 }
+
+// commandHeaderSize is the size of the header of an encoded command
+// [type:1][key size:4]
+const commandHeaderSize = 5
+
+// EncodeCommand serializes the command, e.g. for storing it in a file WAL
+// a nil command, as the ones of the empty states of a protocol, is encoded as an empty slice.
+func EncodeCommand(cmd Command) []byte {
+	if cmd == nil {
+		return []byte{}
+	}
+	element := cmd.Element()
+	value := element.Value
+	if cmd.Type() != Put {
+		value = nil
+	}
+	b := make([]byte, commandHeaderSize+len(element.Key)+len(value))
+	b[0] = byte(cmd.Type())
+	binary.BigEndian.PutUint32(b[1:commandHeaderSize], uint32(len(element.Key)))
+	copy(b[commandHeaderSize:], element.Key)
+	copy(b[commandHeaderSize+len(element.Key):], value)
+	return b
+}
+
+// DecodeCommand de-serializes a command, that was serialized with EncodeCommand
+func DecodeCommand(b []byte) (Command, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < commandHeaderSize {
+		return nil, fmt.Errorf("%w: cannot read command header from %d bytes", store.ErrCorrupted, len(b))
+	}
+	keySize := int(binary.BigEndian.Uint32(b[1:commandHeaderSize]))
+	if keySize > len(b)-commandHeaderSize {
+		return nil, fmt.Errorf("%w: command key of size %d exceeds %d bytes", store.ErrCorrupted, keySize, len(b))
+	}
+	key := storage.Key(b[commandHeaderSize : commandHeaderSize+keySize])
+	switch CmdType(b[0]) {
+	case Put:
+		return NewPut(storage.NewElement(key, storage.Value(b[commandHeaderSize+keySize:]))), nil
+	case Get:
+		return NewGet(key), nil
+	}
+	return nil, fmt.Errorf("%w: unknown command type %d", store.ErrCorrupted, b[0])
+}
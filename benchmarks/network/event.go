@@ -2,6 +2,7 @@ package network
 
 import (
 	"fmt"
+	"sync"
 )
 
 // Events is a collection of Events
@@ -21,7 +22,9 @@ type Event interface {
 
 // NodeDown emulates the case where a node is not responsive
 type NodeDown struct {
-	index      int
+	index int
+	// mutex guards the iterations, as the requests are routed concurrently
+	mutex      sync.Mutex
 	iterations int
 	duration   int
 	Switch
@@ -59,6 +62,8 @@ func (u *NodeDown) Index() int {
 // Route returns the node responsible for serving the current request
 func (u *NodeDown) Route(key Key) ([]int, error) {
 	ids, err := u.Switch.Route(key)
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
 	liveIds := make([]int, 0)
 	for _, id := range ids {
 		if u.index >= 0 && u.index == id && (u.duration == 0 || u.iterations < u.duration) {
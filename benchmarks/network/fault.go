@@ -0,0 +1,450 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/drakos74/lachesis/store/app/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Delivery is the fate of a message on its way from one node to another
+// every entry of Delays delivers a copy of the message after the given delay,
+// so that a delivery without any delays drops the message, and one with more than one duplicates it.
+type Delivery struct {
+	From    int
+	To      int
+	Message Message
+	Delays  []time.Duration
+}
+
+// Control gives the faults access to the nodes of the network
+type Control interface {
+	// Reset replaces the storage and the protocol state of the node with new ones, as after a loss of its state
+	Reset(index int)
+	// Restart replaces the protocol state of the node with the one restored from its WAL, as after a restart of its process
+	Restart(index int)
+	// Decorate replaces the storage of the node with the result of the given function
+	Decorate(index int, decorate func(store storage.Storage) storage.Storage)
+	// Sleep blocks for the given duration, in real or simulated time
+	Sleep(d time.Duration)
+}
+
+// Fault represents a failure injected into the network
+// contrary to an Event, which acts on the Switch, a fault acts on the internal message path and on the nodes themselves.
+type Fault interface {
+	// Start is called when the fault becomes active
+	Start(control Control)
+	// Stop is called when the fault is no longer active
+	Stop(control Control)
+	// Deliver decides on the fate of the messages, while the fault is active
+	Deliver(delivery *Delivery, rand *rand.Rand)
+	// Down returns true for the nodes that are not reachable, while the fault is active
+	Down(index int) bool
+}
+
+// NoFault is a fault without any effect
+// it can be embedded by the faults that only need part of the Fault interface
+type NoFault struct {
+}
+
+// Start does nothing
+func (NoFault) Start(control Control) {}
+
+// Stop does nothing
+func (NoFault) Stop(control Control) {}
+
+// Deliver leaves the delivery as is
+func (NoFault) Deliver(delivery *Delivery, rand *rand.Rand) {}
+
+// Down returns false for all nodes
+func (NoFault) Down(index int) bool {
+	return false
+}
+
+// Timed is a fault that is active for a window of cycles of the world clock
+type Timed struct {
+	Fault
+	At       int
+	Duration int
+}
+
+// At schedules the fault to start at the given cycle of the world clock
+// i.e. after the given number of client operations. It lasts until the end of the run, unless a duration is set.
+func At(cycle int, fault Fault) Timed {
+	return Timed{Fault: fault, At: cycle}
+}
+
+// For sets the number of cycles the fault lasts
+func (t Timed) For(cycles int) Timed {
+	t.Duration = cycles
+	return t
+}
+
+// partition drops the messages between nodes of different groups
+type partition struct {
+	NoFault
+	groups map[int]int
+}
+
+// Partition splits the network into the given groups of nodes
+// messages are only delivered within a group, and the nodes that are not part of any group form a group of their own.
+func Partition(groups ...[]int) Fault {
+	p := &partition{groups: make(map[int]int)}
+	for i, group := range groups {
+		for _, index := range group {
+			p.groups[index] = i + 1
+		}
+	}
+	return p
+}
+
+// Deliver drops the message if the nodes are in different groups
+func (p *partition) Deliver(delivery *Delivery, rand *rand.Rand) {
+	if p.groups[delivery.From] != p.groups[delivery.To] {
+		delivery.Delays = nil
+	}
+}
+
+// String returns a humanly readable representation of the fault
+func (p *partition) String() string {
+	return fmt.Sprintf("partition%v", p.groups)
+}
+
+// oneWayPartition drops the messages from one group of nodes to another, but not the other way around
+type oneWayPartition struct {
+	NoFault
+	from map[int]bool
+	to   map[int]bool
+}
+
+// OneWayPartition creates an asymmetric partition
+// messages from the nodes in from to the nodes in to are dropped, while the ones in the opposite direction are delivered.
+func OneWayPartition(from, to []int) Fault {
+	p := &oneWayPartition{from: make(map[int]bool), to: make(map[int]bool)}
+	for _, index := range from {
+		p.from[index] = true
+	}
+	for _, index := range to {
+		p.to[index] = true
+	}
+	return p
+}
+
+// Deliver drops the message if it crosses the partition in the blocked direction
+func (p *oneWayPartition) Deliver(delivery *Delivery, rand *rand.Rand) {
+	if p.from[delivery.From] && p.to[delivery.To] {
+		delivery.Delays = nil
+	}
+}
+
+// drop loses messages at random
+type drop struct {
+	NoFault
+	probability float64
+}
+
+// Drop loses every copy of a message with the given probability
+func Drop(probability float64) Fault {
+	return &drop{probability: probability}
+}
+
+// Deliver drops the copies of the message at random
+func (d *drop) Deliver(delivery *Delivery, rand *rand.Rand) {
+	delays := make([]time.Duration, 0, len(delivery.Delays))
+	for _, delay := range delivery.Delays {
+		if rand.Float64() >= d.probability {
+			delays = append(delays, delay)
+		}
+	}
+	delivery.Delays = delays
+}
+
+// delay slows down the delivery of the messages
+type delay struct {
+	NoFault
+	min time.Duration
+	max time.Duration
+}
+
+// Delay adds a random delay within [min, max] to every copy of a message
+// messages sent close to each other are reordered, if the range is wide enough.
+func Delay(min, max time.Duration) Fault {
+	return &delay{min: min, max: max}
+}
+
+// Deliver adds the delay to the copies of the message
+func (d *delay) Deliver(delivery *Delivery, rand *rand.Rand) {
+	for i := range delivery.Delays {
+		delivery.Delays[i] += d.min
+		if d.max > d.min {
+			delivery.Delays[i] += time.Duration(rand.Int63n(int64(d.max - d.min + 1)))
+		}
+	}
+}
+
+// duplicate delivers messages more than once
+type duplicate struct {
+	NoFault
+	probability float64
+}
+
+// Duplicate delivers a second copy of a message with the given probability
+func Duplicate(probability float64) Fault {
+	return &duplicate{probability: probability}
+}
+
+// Deliver adds the extra copies of the message
+func (d *duplicate) Deliver(delivery *Delivery, rand *rand.Rand) {
+	for _, delay := range delivery.Delays {
+		if rand.Float64() < d.probability {
+			delivery.Delays = append(delivery.Delays, delay)
+		}
+	}
+}
+
+// crash takes a node out of the network, and brings it back without its state
+type crash struct {
+	NoFault
+	index int
+}
+
+// Crash makes the node unreachable, both for the clients and the other nodes, while the fault is active
+// when the fault stops, the node restarts with a new storage and protocol state, as if it had lost its disk.
+func Crash(index int) Fault {
+	return &crash{index: index}
+}
+
+// Stop restarts the node without its previous state
+func (c *crash) Stop(control Control) {
+	control.Reset(c.index)
+}
+
+// Down returns true for the crashed node
+func (c *crash) Down(index int) bool {
+	return index == c.index
+}
+
+// restart takes a node out of the network, and brings it back with its storage and log
+type restart struct {
+	NoFault
+	index int
+}
+
+// Restart makes the node unreachable, both for the clients and the other nodes, while the fault is active
+// when the fault stops, the node restarts with its storage, and the protocol state it restores from its WAL.
+// The in-memory WAL does not survive the restart, so the node comes back with an empty log, unless it has a durable one.
+func Restart(index int) Fault {
+	return &restart{index: index}
+}
+
+// Stop restarts the node with its storage and its log
+func (r *restart) Stop(control Control) {
+	control.Restart(r.index)
+}
+
+// Down returns true for the restarted node
+func (r *restart) Down(index int) bool {
+	return index == r.index
+}
+
+// slowDisk delays the storage operations of a node
+type slowDisk struct {
+	NoFault
+	index int
+	delay time.Duration
+}
+
+// SlowDisk delays every storage operation of the node by the given duration
+func SlowDisk(index int, delay time.Duration) Fault {
+	return &slowDisk{index: index, delay: delay}
+}
+
+// Start wraps the storage of the node
+func (s *slowDisk) Start(control Control) {
+	control.Decorate(s.index, func(store storage.Storage) storage.Storage {
+		return &SlowStorage{Storage: store, delay: s.delay, sleep: control.Sleep}
+	})
+}
+
+// Stop restores the storage of the node
+func (s *slowDisk) Stop(control Control) {
+	control.Decorate(s.index, func(store storage.Storage) storage.Storage {
+		if slow, ok := store.(*SlowStorage); ok {
+			return slow.Storage
+		}
+		return store
+	})
+}
+
+// SlowStorage is a storage decorator that delays all operations
+type SlowStorage struct {
+	storage.Storage
+	delay time.Duration
+	sleep func(d time.Duration)
+}
+
+// Put stores the element after the delay
+func (s *SlowStorage) Put(element storage.Element) error {
+	s.sleep(s.delay)
+	return s.Storage.Put(element)
+}
+
+// Get retrieves the element after the delay
+func (s *SlowStorage) Get(key storage.Key) (storage.Element, error) {
+	s.sleep(s.delay)
+	return s.Storage.Get(key)
+}
+
+// faults keeps track of the scheduled faults and applies the active ones
+type faults struct {
+	mutex    sync.Mutex
+	schedule []Timed
+	active   []bool
+	cycle    int
+	rand     *rand.Rand
+	control  Control
+}
+
+func newFaults(schedule []Timed, rand *rand.Rand, control Control) *faults {
+	return &faults{
+		schedule: schedule,
+		active:   make([]bool, len(schedule)),
+		rand:     rand,
+		control:  control,
+	}
+}
+
+// tick moves the faults to the next cycle of the world clock, starting and stopping them according to the schedule
+func (f *faults) tick() {
+	f.mutex.Lock()
+	f.cycle++
+	start := make([]Fault, 0)
+	stop := make([]Fault, 0)
+	for i, timed := range f.schedule {
+		if !f.active[i] && f.cycle == timed.At {
+			f.active[i] = true
+			start = append(start, timed.Fault)
+		} else if f.active[i] && timed.Duration > 0 && f.cycle == timed.At+timed.Duration {
+			f.active[i] = false
+			stop = append(stop, timed.Fault)
+		}
+	}
+	cycle := f.cycle
+	f.mutex.Unlock()
+
+	// act on the nodes outside of the lock, as this might need to wait for them
+	for _, fault := range stop {
+		log.Info().Str("Type", "FAULT").Msg(fmt.Sprintf("stop fault at %d = %v", cycle, fault))
+		fault.Stop(f.control)
+	}
+	for _, fault := range start {
+		log.Info().Str("Type", "FAULT").Msg(fmt.Sprintf("start fault at %d = %v", cycle, fault))
+		fault.Start(f.control)
+	}
+}
+
+// deliver decides on the delays of the copies of the message from one node to another
+func (f *faults) deliver(from, to int, msg Message) []time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delivery := &Delivery{
+		From:    from,
+		To:      to,
+		Message: msg,
+		Delays:  []time.Duration{0},
+	}
+	if f.isDown(from) || f.isDown(to) {
+		return nil
+	}
+	for i, timed := range f.schedule {
+		if f.active[i] {
+			timed.Deliver(delivery, f.rand)
+		}
+	}
+	return delivery.Delays
+}
+
+// down returns true if the node is unreachable
+func (f *faults) down(index int) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.isDown(index)
+}
+
+func (f *faults) isDown(index int) bool {
+	for i, timed := range f.schedule {
+		if f.active[i] && timed.Down(index) {
+			return true
+		}
+	}
+	return false
+}
+
+// route filters out the nodes that are down from the routing decision of the switch
+func (f *faults) route(route func(key Key) ([]int, error)) func(key Key) ([]int, error) {
+	return func(key Key) ([]int, error) {
+		ids, err := route(key)
+		if err != nil {
+			return ids, err
+		}
+		live := make([]int, 0, len(ids))
+		for _, id := range ids {
+			if !f.down(id) {
+				live = append(live, id)
+			}
+		}
+		if len(live) == 0 {
+			return live, fmt.Errorf("nodes %v are not responding", ids)
+		}
+		return live, nil
+	}
+}
+
+// nodeControl implements the Control over the nodes of a network
+type nodeControl struct {
+	storage storage.StorageFactory
+	// run executes the action for the node, without interfering with its operations
+	run   func(index int, action func(node *StorageNode))
+	sleep func(d time.Duration)
+}
+
+// Reset replaces the storage and the protocol state of the node with new ones
+func (c nodeControl) Reset(index int) {
+	c.run(index, func(node *StorageNode) {
+		node.processor.Store = c.storage()
+		// the log is lost along with the storage
+		if wal, ok := node.processor.State.WAL.(interface{ Remove() error }); ok {
+			if err := wal.Remove(); err != nil {
+				log.Error().Err(err).Int("index", index).Msg("could not remove WAL")
+			}
+		}
+		node.processor.State = node.processor.newState(node.Cluster().ID)
+	})
+}
+
+// Restart replaces the protocol state of the node with the one restored from its WAL
+func (c nodeControl) Restart(index int) {
+	c.run(index, func(node *StorageNode) {
+		if wal, ok := node.processor.State.WAL.(interface{ Close() error }); ok {
+			if err := wal.Close(); err != nil {
+				log.Error().Err(err).Int("index", index).Msg("could not close WAL")
+			}
+		}
+		node.processor.State = node.processor.newState(node.Cluster().ID)
+	})
+}
+
+// Decorate replaces the storage of the node with the result of the given function
+func (c nodeControl) Decorate(index int, decorate func(store storage.Storage) storage.Storage) {
+	c.run(index, func(node *StorageNode) {
+		node.processor.Store = decorate(node.processor.Store)
+	})
+}
+
+// Sleep blocks for the given duration
+func (c nodeControl) Sleep(d time.Duration) {
+	c.sleep(d)
+}
@@ -0,0 +1,149 @@
+package network
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/app/storage"
+	mem2 "github.com/drakos74/lachesis/store/io/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func delays(fault Fault, from, to int) []time.Duration {
+	delivery := &Delivery{From: from, To: to, Delays: []time.Duration{0}}
+	fault.Deliver(delivery, rand.New(rand.NewSource(1)))
+	return delivery.Delays
+}
+
+func TestFault_Partition(t *testing.T) {
+	partition := Partition([]int{0, 1}, []int{2, 3})
+
+	assert.Equal(t, 1, len(delays(partition, 0, 1)))
+	assert.Equal(t, 1, len(delays(partition, 3, 2)))
+	assert.Equal(t, 0, len(delays(partition, 1, 2)))
+	assert.Equal(t, 0, len(delays(partition, 2, 1)))
+	// the nodes that are not part of any group form a group of their own
+	assert.Equal(t, 1, len(delays(partition, 4, 5)))
+	assert.Equal(t, 0, len(delays(partition, 4, 0)))
+}
+
+func TestFault_OneWayPartition(t *testing.T) {
+	partition := OneWayPartition([]int{0}, []int{1, 2})
+
+	assert.Equal(t, 0, len(delays(partition, 0, 1)))
+	assert.Equal(t, 0, len(delays(partition, 0, 2)))
+	assert.Equal(t, 1, len(delays(partition, 1, 0)))
+	assert.Equal(t, 1, len(delays(partition, 0, 3)))
+}
+
+func TestFault_Drop(t *testing.T) {
+	assert.Equal(t, 0, len(delays(Drop(1), 0, 1)))
+	assert.Equal(t, 1, len(delays(Drop(0), 0, 1)))
+}
+
+func TestFault_Duplicate(t *testing.T) {
+	assert.Equal(t, 2, len(delays(Duplicate(1), 0, 1)))
+	assert.Equal(t, 1, len(delays(Duplicate(0), 0, 1)))
+}
+
+func TestFault_Delay(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := delays(Delay(10*time.Millisecond, 20*time.Millisecond), 0, 1)
+		assert.Equal(t, 1, len(d))
+		assert.True(t, d[0] >= 10*time.Millisecond)
+		assert.True(t, d[0] <= 20*time.Millisecond)
+	}
+}
+
+// recorder records the actions of the faults on the nodes
+type recorder struct {
+	resets     []int
+	restarts   []int
+	decorated  map[int]storage.Storage
+	storage    storage.StorageFactory
+	sleepTotal time.Duration
+}
+
+func (c *recorder) Reset(index int) {
+	c.resets = append(c.resets, index)
+}
+
+func (c *recorder) Restart(index int) {
+	c.restarts = append(c.restarts, index)
+}
+
+func (c *recorder) Decorate(index int, decorate func(store storage.Storage) storage.Storage) {
+	store, ok := c.decorated[index]
+	if !ok {
+		store = c.storage()
+	}
+	c.decorated[index] = decorate(store)
+}
+
+func (c *recorder) Sleep(d time.Duration) {
+	c.sleepTotal += d
+}
+
+func TestFaults_Schedule(t *testing.T) {
+	ctrl := &recorder{decorated: make(map[int]storage.Storage), storage: mem2.CacheFactory}
+
+	f := newFaults([]Timed{
+		At(2, Partition([]int{0}, []int{1, 2})).For(2),
+		At(3, Crash(2)).For(3),
+		At(3, SlowDisk(1, time.Second)),
+		At(5, Restart(3)).For(1),
+	}, rand.New(rand.NewSource(1)), ctrl)
+
+	// partitioned, crashed and reachable to the crashed node
+	active := func() []bool {
+		return []bool{
+			len(f.deliver(0, 1, Message{})) == 0,
+			f.down(2),
+			len(f.deliver(1, 2, Message{})) == 0,
+		}
+	}
+
+	expected := [][]bool{
+		{false, false, false},
+		{true, false, false},
+		{true, true, true},
+		{false, true, true},
+		{false, true, true},
+		{false, false, false},
+		{false, false, false},
+	}
+
+	for i, e := range expected {
+		f.tick()
+		assert.Equal(t, e, active(), "cycle %d", i+1)
+	}
+
+	// the crashed node restarted without its state
+	assert.Equal(t, []int{2}, ctrl.resets)
+	// the restarted node came back with its state
+	assert.Equal(t, []int{3}, ctrl.restarts)
+
+	// the slow disk stays for the rest of the run
+	slow, ok := ctrl.decorated[1].(*SlowStorage)
+	assert.True(t, ok)
+	err := slow.Put(storage.NewElement([]byte("key"), []byte("value")))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, ctrl.sleepTotal)
+}
+
+func TestFaults_Route(t *testing.T) {
+	f := newFaults([]Timed{At(1, Crash(1)).For(1)}, rand.New(rand.NewSource(1)), &recorder{})
+
+	route := f.route(func(key Key) ([]int, error) {
+		return []int{1}, nil
+	})
+
+	ids, err := route(Key("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, ids)
+
+	f.tick()
+	_, err = route(Key("key"))
+	assert.Error(t, err)
+}
@@ -1,17 +1,22 @@
 package lb
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"github.com/drakos74/lachesis/benchmarks/network"
 )
 
 // LeaderFollowerPartition creates new leader follower switch
 func LeaderFollowerPartition() network.Switch {
-	return &LeaderFollower{Cluster: network.NewCluster()}
+	return &LeaderFollower{Cluster: network.NewCluster(), leader: -1}
 }
 
 // LeaderFollower emulates a leader-follower cluster network switch
 type LeaderFollower struct {
 	network.Cluster
+	// leader is the index of the leader, as reported by the nodes, or -1 if not known yet
+	leader int64
 }
 
 // Register registers a new node to the cluster
@@ -19,8 +24,47 @@ func (c *LeaderFollower) Register(id int) {
 	c.Cluster.Register(id)
 }
 
+// Lead sets the leader of the cluster, as discovered by the network
+func (c *LeaderFollower) Lead(index int) {
+	atomic.StoreInt64(&c.leader, int64(index))
+}
+
+// Skip moves on to the next member, if the node that does not respond is the one the requests are routed to
+func (c *LeaderFollower) Skip(index int) {
+	leader := atomic.LoadInt64(&c.leader)
+	members := c.Members()
+	routed, ok := route(members, int(leader))
+	if !ok || routed != index {
+		return
+	}
+	for i, member := range members {
+		if member == index {
+			atomic.CompareAndSwapInt64(&c.leader, leader, int64(members[(i+1)%len(members)]))
+			return
+		}
+	}
+}
+
 // Route returns always the leader of the cluster to route requests to
 func (c *LeaderFollower) Route(key network.Key) ([]int, error) {
-	// leader will always be the 'first' node
-	return c.Members()[:1], nil
+	routed, ok := route(c.Members(), int(atomic.LoadInt64(&c.leader)))
+	if !ok {
+		return []int{}, fmt.Errorf("no members to route to")
+	}
+	return []int{routed}, nil
+}
+
+// route returns the leader, if it is one of the members
+// until the leader is known, or while it is not reachable, it falls back to the 'first' node
+// which should pass the request on to the leader
+func route(members []int, leader int) (int, bool) {
+	if len(members) == 0 {
+		return 0, false
+	}
+	for _, member := range members {
+		if member == leader {
+			return leader, true
+		}
+	}
+	return members[0], true
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/drakos74/lachesis/store/io/mem"
 	"github.com/drakos74/lachesis/store/test"
+	"github.com/stretchr/testify/assert"
 )
 
 func newLeaderNetwork(event ...network.Event) storage.StorageFactory {
@@ -42,3 +43,44 @@ func testNetworkLeaderNodeDownEvent(t *testing.T) {
 	// Note : we know from the routing strategy, that the leader is always the '0th' element
 	new(test.FailureRate).Run(t, newLeaderNetwork(network.NewNodeDownEvent(0, 30)), test.Limit{})
 }
+
+func TestLeaderFollower_Route(t *testing.T) {
+	sw := LeaderFollowerPartition()
+	for i := 0; i < 3; i++ {
+		sw.Register(i)
+	}
+	l, ok := sw.(network.Leader)
+	assert.True(t, ok)
+
+	route := func() int {
+		ids, err := sw.Route(network.Key{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(ids))
+		return ids[0]
+	}
+
+	assert.Equal(t, 0, route())
+
+	l.Lead(2)
+	assert.Equal(t, 2, route())
+
+	// another node going down does not change the leader
+	l.Skip(1)
+	assert.Equal(t, 2, route())
+
+	l.Skip(2)
+	assert.Equal(t, 0, route())
+}
+
+func TestLeaderFollower_NoMembers(t *testing.T) {
+	sw := LeaderFollowerPartition()
+	sw.Register(0)
+	sw.DeRegister(0)
+
+	_, err := sw.Route(network.Key{})
+	assert.Error(t, err)
+
+	l, ok := sw.(network.Leader)
+	assert.True(t, ok)
+	l.Skip(0)
+}
@@ -14,6 +14,12 @@ func RandomPartition() network.Switch {
 // RandomSwitch emulates a network switch logic based on randomness
 type RandomSwitch struct {
 	parallelism int
+	rand        *rand.Rand
+}
+
+// Randomize sets the source of randomness for the routing decisions, instead of the global one
+func (r *RandomSwitch) Randomize(rand *rand.Rand) {
+	r.rand = rand
 }
 
 // Register registers a node to the network emulation switch
@@ -28,6 +34,9 @@ func (r *RandomSwitch) DeRegister(id int) {
 
 // Route returns the appropriate node to which the request should be routed based on the given key
 func (r RandomSwitch) Route(key network.Key) ([]int, error) {
+	if r.rand != nil {
+		return []int{r.rand.Intn(r.parallelism)}, nil
+	}
 	return []int{rand.Intn(r.parallelism)}, nil
 }
 
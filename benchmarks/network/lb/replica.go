@@ -1,6 +1,7 @@
 package lb
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
@@ -22,9 +23,13 @@ func (c *ReplicaSwitch) DeRegister(id int) {
 }
 
 // Route returns the appropriate node to which the request should be routed based on the given key
-func (r ReplicaSwitch) Route(key network.Key) ([]int, error) {
+func (r *ReplicaSwitch) Route(key network.Key) ([]int, error) {
+	members := len(r.Members())
+	if members == 0 {
+		return nil, fmt.Errorf("no members to route to")
+	}
 	var i big.Int
 	// convert to int
 	hash := i.SetBytes(key).Uint64()
-	return []int{mod(hash, len(r.Members())), mod(hash+1, len(r.Members())), mod(hash+2, len(r.Members()))}, nil
+	return []int{mod(hash, members), mod(hash+1, members), mod(hash+2, members)}, nil
 }
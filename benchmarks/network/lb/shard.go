@@ -1,6 +1,7 @@
 package lb
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
@@ -17,9 +18,13 @@ type ShardedSwitch struct {
 }
 
 // Route returns the appropriate node to which the request should be routed based on the given key
-func (s ShardedSwitch) Route(key network.Key) ([]int, error) {
+func (s *ShardedSwitch) Route(key network.Key) ([]int, error) {
+	members := len(s.Members())
+	if members == 0 {
+		return nil, fmt.Errorf("no members to route to")
+	}
 	var i big.Int
 	// convert to int
 	hash := i.SetBytes(key).Uint64()
-	return []int{int(hash % uint64(len(s.Members())))}, nil
+	return []int{int(hash % uint64(members))}, nil
 }
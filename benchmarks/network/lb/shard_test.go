@@ -7,6 +7,7 @@ import (
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/drakos74/lachesis/store/io/mem"
 	"github.com/drakos74/lachesis/store/test"
+	"github.com/stretchr/testify/assert"
 )
 
 // simple Sharded network
@@ -45,9 +46,21 @@ func TestShardedNetwork_Failure(t *testing.T) {
 	new(test.Consistency).Run(t, newShardedNetwork(network.NewNodeDownEvent(5, 30)))
 }
 
-// Note : we have intermittent failures if we choose limit{Read:0.0,Write:0.0}
-// this is because of the randomisation of sharding and node down event
-// but this should be enough to signify that a sharded network fails in cases of node outages
+// the sharded network runs deterministically in a simulation, so that the failure rate can be replayed from its seed
+// it should signify that a sharded network fails in cases of node outages
 func TestShardedNetwork_NodeDownEventFailureRate(t *testing.T) {
-	new(test.FailureRate).Run(t, newShardedNetwork(network.NewNodeDownEvent(5, 30)), test.Limit{Write: 2, Read: 1})
+	seed := network.Seed()
+
+	report := network.Factory(network.NewNodeDownEvent(5, 30)).
+		Router(ShardedPartition).
+		Storage(mem.CacheFactory).
+		Nodes(10).
+		Simulate(seed).
+		Run(network.Workload{Clients: 1000, KeySize: 10, ValueSize: 100, Interval: 1000})
+	t.Log(report)
+
+	// only the operations routed to the node while it is down fail
+	assert.True(t, report.WriteErrors+report.ReadErrors > 0, "replay with %s=%d", network.SeedVariable, seed)
+	assert.True(t, report.WriteErrorRate() <= 1, "replay with %s=%d", network.SeedVariable, seed)
+	assert.True(t, report.ReadErrorRate() <= 1, "replay with %s=%d", network.SeedVariable, seed)
 }
@@ -0,0 +1,274 @@
+package linearizability
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of a linearizability check
+type Result struct {
+	Ok bool
+	// Key is the key of the register that could not be linearized
+	Key string
+	// Counterexample is a minimal sub-history of the key that cannot be linearized
+	// i.e. removing any one of its operations makes it linearizable.
+	Counterexample []Operation
+}
+
+// String returns a humanly readable representation of the result
+func (r Result) String() string {
+	if r.Ok {
+		return "history is linearizable"
+	}
+	lines := make([]string, 0, len(r.Counterexample)+1)
+	lines = append(lines, fmt.Sprintf("history for key %q is not linearizable", r.Key))
+	for _, op := range r.Counterexample {
+		lines = append(lines, "\t"+op.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check verifies that the operations can be linearized, treating every key as an independent register
+// if not, it returns a minimal counterexample for the first key that fails.
+func Check(operations []Operation) Result {
+	keys := make([]string, 0)
+	partitions := make(map[string][]Operation)
+	for _, op := range prune(operations) {
+		if _, ok := partitions[op.Key]; !ok {
+			keys = append(keys, op.Key)
+		}
+		partitions[op.Key] = append(partitions[op.Key], op)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !linearizable(partitions[key]) {
+			return Result{
+				Key:            key,
+				Counterexample: minimize(partitions[key]),
+			}
+		}
+	}
+	return Result{Ok: true}
+}
+
+// prune removes the pending writes, whose values are never read
+// such a write can always be linearized after all the other operations, where it has no effect,
+// while keeping it would only make the search more expensive, as it is concurrent with everything after its call.
+func prune(operations []Operation) []Operation {
+	read := make(map[string]bool)
+	for _, op := range operations {
+		if op.Kind == Get && op.Found {
+			read[op.Key+"/"+op.Value] = true
+		}
+	}
+	ops := make([]Operation, 0, len(operations))
+	for _, op := range operations {
+		if op.Kind == Put && op.Return == Pending && !read[op.Key+"/"+op.Value] {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// minimize removes operations from a history that is not linearizable, as long as it stays so
+// it removes ever smaller chunks of operations, down to single ones, so that the result is 1-minimal.
+// The writes of the values that are read are never removed on their own,
+// as a read of a value that was never written is a trivial, and useless, counterexample.
+func minimize(operations []Operation) []Operation {
+	ops := append(make([]Operation, 0, len(operations)), operations...)
+	size := len(ops) / 2
+	for size >= 1 {
+		removed := false
+		for i := 0; i+size <= len(ops); {
+			candidate := append(append(make([]Operation, 0, len(ops)-size), ops[:i]...), ops[i+size:]...)
+			if observed(candidate) && !linearizable(candidate) {
+				ops = candidate
+				removed = true
+			} else {
+				i += size
+			}
+		}
+		// removing an operation might allow for others to be removed, so repeat the last pass until nothing changes
+		if size > 1 || !removed {
+			size /= 2
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].Call < ops[j].Call
+	})
+	return ops
+}
+
+// observed returns true if every value that is read has been written by an operation of the history
+func observed(operations []Operation) bool {
+	written := make(map[string]bool)
+	for _, op := range operations {
+		if op.Kind == Put {
+			written[op.Value] = true
+		}
+	}
+	for _, op := range operations {
+		if op.Kind == Get && op.Found && !written[op.Value] {
+			return false
+		}
+	}
+	return true
+}
+
+// register is the state of the model for a single key
+type register struct {
+	found bool
+	value string
+}
+
+// step applies the operation on the register
+// it returns false if the operation is not valid for the current state.
+func step(state register, op Operation) (bool, register) {
+	switch op.Kind {
+	case Put:
+		return true, register{found: true, value: op.Value}
+	case Get:
+		if op.Found != state.found {
+			return false, state
+		}
+		return !op.Found || op.Value == state.value, state
+	}
+	return false, state
+}
+
+// entry is an element of the doubly linked list of call and return events
+// the call entries point to their matching return.
+type entry struct {
+	op    int
+	time  int64
+	match *entry
+	prev  *entry
+	next  *entry
+}
+
+// events creates the list of the call and return events of the operations, in time order
+// it returns the head of the list, which is a sentinel entry.
+func events(operations []Operation) *entry {
+	entries := make([]*entry, 0, 2*len(operations))
+	for i, op := range operations {
+		ret := &entry{op: i, time: op.Return}
+		entries = append(entries, &entry{op: i, time: op.Call, match: ret}, ret)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].time == entries[j].time {
+			// calls go first, so that operations touching at the edges are considered concurrent
+			return entries[i].match != nil && entries[j].match == nil
+		}
+		return entries[i].time < entries[j].time
+	})
+	head := &entry{op: -1}
+	last := head
+	for _, e := range entries {
+		last.next = e
+		e.prev = last
+		last = e
+	}
+	return head
+}
+
+// lift removes the call entry and its return from the list
+func lift(call *entry) {
+	call.prev.next = call.next
+	call.next.prev = call.prev
+	ret := call.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift puts back the call entry and its return to the list
+func unlift(call *entry) {
+	ret := call.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+	call.prev.next = call
+	call.next.prev = call
+}
+
+// frame is the state of the search before an operation was linearized
+type frame struct {
+	call  *entry
+	state register
+}
+
+// linearizable searches for a linearization of the operations on a single register
+// it follows the algorithm of Wing and Gong, with the improvements of Lowe, as in Porcupine:
+// operations are linearized in a depth-first search over the list of events,
+// remembering the visited combinations of linearized operations and state, so that they are not explored twice.
+func linearizable(operations []Operation) bool {
+	head := events(operations)
+	linearized := make(bitset, (len(operations)+63)/64)
+	visited := make(map[string]bool)
+	calls := make([]frame, 0)
+	state := register{}
+
+	e := head.next
+	for head.next != nil {
+		if e.match != nil {
+			// try to linearize the operation at this point
+			ok, next := step(state, operations[e.op])
+			if ok {
+				linearized.set(e.op)
+				key := linearized.key(next)
+				if !visited[key] {
+					visited[key] = true
+					calls = append(calls, frame{call: e, state: state})
+					state = next
+					lift(e)
+					e = head.next
+					continue
+				}
+				linearized.clear(e.op)
+			}
+			e = e.next
+			continue
+		}
+		// we reached the return of an operation that is not linearized yet, so we need to backtrack
+		if len(calls) == 0 {
+			return false
+		}
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		state = top.state
+		linearized.clear(top.call.op)
+		unlift(top.call)
+		e = top.call.next
+	}
+	return true
+}
+
+// bitset keeps track of the linearized operations
+type bitset []uint64
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) clear(i int) {
+	b[i/64] &^= 1 << uint(i%64)
+}
+
+// key creates the cache key for the combination of linearized operations and state
+func (b bitset) key(state register) string {
+	buf := make([]byte, 0, 8*len(b)+len(state.value)+1)
+	for _, w := range b {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	if state.found {
+		buf = append(buf, '|')
+		buf = append(buf, state.value...)
+	}
+	return string(buf)
+}
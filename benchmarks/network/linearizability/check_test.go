@@ -0,0 +1,134 @@
+package linearizability
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func put(client int, value string, call, ret int64) Operation {
+	return Operation{Client: client, Kind: Put, Key: "key", Value: value, Call: call, Return: ret}
+}
+
+func get(client int, value string, call, ret int64) Operation {
+	return Operation{Client: client, Kind: Get, Key: "key", Value: value, Found: value != "", Call: call, Return: ret}
+}
+
+func TestCheck_Linearizable(t *testing.T) {
+	result := Check([]Operation{
+		get(0, "", 1, 2),
+		put(0, "a", 3, 4),
+		get(1, "a", 5, 6),
+		put(1, "b", 7, 10),
+		// concurrent with the write, so both values are valid
+		get(0, "a", 8, 9),
+		get(2, "b", 9, 12),
+		get(0, "b", 13, 14),
+	})
+	assert.True(t, result.Ok, result.String())
+}
+
+func TestCheck_ConcurrentWrites(t *testing.T) {
+	// the reads fix the order of the writes, which overlap
+	result := Check([]Operation{
+		put(0, "a", 1, 10),
+		put(1, "b", 2, 9),
+		get(2, "a", 3, 4),
+		get(2, "b", 5, 6),
+	})
+	assert.True(t, result.Ok, result.String())
+
+	// the order of the writes cannot be observed differently by later reads
+	result = Check([]Operation{
+		put(0, "a", 1, 10),
+		put(1, "b", 2, 9),
+		get(2, "a", 11, 12),
+		get(3, "b", 13, 14),
+	})
+	assert.False(t, result.Ok)
+}
+
+func TestCheck_StaleRead(t *testing.T) {
+	result := Check([]Operation{
+		put(0, "a", 1, 2),
+		put(0, "b", 3, 4),
+		get(1, "a", 5, 6),
+	})
+	assert.False(t, result.Ok)
+	assert.Equal(t, "key", result.Key)
+}
+
+func TestCheck_LostWrite(t *testing.T) {
+	result := Check([]Operation{
+		put(0, "a", 1, 2),
+		get(1, "", 3, 4),
+	})
+	assert.False(t, result.Ok)
+}
+
+func TestCheck_PendingWrite(t *testing.T) {
+	// a failed write might take effect at any point after its call
+	result := Check([]Operation{
+		put(0, "a", 1, 2),
+		put(1, "b", 3, Pending),
+		get(2, "a", 4, 5),
+		get(2, "b", 100, 101),
+	})
+	assert.True(t, result.Ok, result.String())
+
+	// but not before it
+	result = Check([]Operation{
+		get(2, "b", 1, 2),
+		put(1, "b", 3, Pending),
+	})
+	assert.False(t, result.Ok)
+
+	// and not more than once
+	result = Check([]Operation{
+		put(0, "a", 1, 2),
+		put(1, "b", 3, Pending),
+		get(2, "b", 4, 5),
+		get(2, "a", 6, 7),
+	})
+	assert.False(t, result.Ok)
+}
+
+func TestCheck_Keys(t *testing.T) {
+	other := func(op Operation) Operation {
+		op.Key = "other"
+		return op
+	}
+	// every key is a register of its own
+	result := Check([]Operation{
+		put(0, "a", 1, 2),
+		other(put(0, "b", 3, 4)),
+		get(1, "a", 5, 6),
+		other(get(1, "b", 7, 8)),
+		other(get(1, "a", 9, 10)),
+	})
+	assert.False(t, result.Ok)
+	assert.Equal(t, "other", result.Key)
+}
+
+func TestCheck_MinimalCounterexample(t *testing.T) {
+	operations := []Operation{
+		put(0, "a", 1, 2),
+		get(1, "a", 3, 4),
+		put(0, "b", 5, 6),
+		get(1, "b", 7, 8),
+		put(2, "c", 9, 10),
+		get(0, "c", 11, 12),
+		get(1, "b", 13, 14),
+		put(2, "d", 15, 16),
+		get(0, "d", 17, 18),
+	}
+
+	result := Check(operations)
+	assert.False(t, result.Ok)
+	// the stale read, along with the write it read and the write it missed
+	assert.Equal(t, []Operation{
+		put(0, "b", 5, 6),
+		put(2, "c", 9, 10),
+		get(1, "b", 13, 14),
+	}, result.Counterexample)
+}
@@ -0,0 +1,161 @@
+// Package linearizability records the histories of concurrent operations on a key-value store,
+// and checks whether they are linearizable for a model of one register per key,
+// in the style of Knossos and Porcupine.
+package linearizability
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/drakos74/lachesis/benchmarks/store"
+	"github.com/drakos74/lachesis/store/app/storage"
+)
+
+// Kind is the type of an operation on the register of a key
+type Kind int
+
+const (
+	// Put writes a value to the register
+	Put Kind = iota + 1
+	// Get reads the value of the register
+	Get
+)
+
+// String returns a humanly readable representation of the operation kind
+func (k Kind) String() string {
+	switch k {
+	case Put:
+		return "put"
+	case Get:
+		return "get"
+	}
+	return ""
+}
+
+// Pending is the return time of the operations that did not complete
+// a failed write might or might not have taken effect, so it could be linearized at any point after its call.
+const Pending = math.MaxInt64
+
+// Operation is an operation of the history, along with the times it was called and returned
+type Operation struct {
+	Client int
+	Kind   Kind
+	Key    string
+	Value  string
+	// Found is false for the reads that did not find any value for the key
+	Found  bool
+	Call   int64
+	Return int64
+}
+
+// String returns a humanly readable representation of the operation
+func (o Operation) String() string {
+	ret := fmt.Sprintf("%d", o.Return)
+	if o.Return == Pending {
+		ret = "pending"
+	}
+	switch o.Kind {
+	case Put:
+		return fmt.Sprintf("client %d : put(%q, %q) [%d, %s]", o.Client, o.Key, o.Value, o.Call, ret)
+	case Get:
+		if !o.Found {
+			return fmt.Sprintf("client %d : get(%q) -> not found [%d, %s]", o.Client, o.Key, o.Call, ret)
+		}
+		return fmt.Sprintf("client %d : get(%q) -> %q [%d, %s]", o.Client, o.Key, o.Value, o.Call, ret)
+	}
+	return ""
+}
+
+// Store is the part of the storage interface that the history records
+type Store interface {
+	Put(element storage.Element) error
+	Get(key storage.Key) (storage.Element, error)
+}
+
+// History is a thread-safe record of the operations of many clients on a store
+// the times are taken from a logical clock, which follows the real time order of the calls and returns.
+type History struct {
+	mutex      sync.Mutex
+	clock      int64
+	operations []Operation
+}
+
+// NewHistory creates a new empty history
+func NewHistory() *History {
+	return &History{operations: make([]Operation, 0)}
+}
+
+// now returns the next tick of the logical clock
+func (h *History) now() int64 {
+	return atomic.AddInt64(&h.clock, 1)
+}
+
+func (h *History) add(op Operation) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.operations = append(h.operations, op)
+}
+
+// Operations returns the operations recorded so far
+func (h *History) Operations() []Operation {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	operations := make([]Operation, len(h.operations))
+	copy(operations, h.operations)
+	return operations
+}
+
+// Client wraps the store, so that the operations of the client are recorded in the history
+func (h *History) Client(id int, store Store) Store {
+	return &client{id: id, store: store, history: h}
+}
+
+// client records the operations of a single client
+type client struct {
+	id      int
+	store   Store
+	history *History
+}
+
+// Put writes the element and records the operation
+// a failed write is recorded as pending, as it might still have taken effect.
+func (c *client) Put(element storage.Element) error {
+	call := c.history.now()
+	err := c.store.Put(element)
+	ret := c.history.now()
+	if err != nil {
+		ret = Pending
+	}
+	c.history.add(Operation{
+		Client: c.id,
+		Kind:   Put,
+		Key:    string(element.Key),
+		Value:  string(element.Value),
+		Call:   call,
+		Return: ret,
+	})
+	return err
+}
+
+// Get reads the element and records the operation
+// a read that failed for any other reason than a missing key carries no information, and is left out of the history.
+func (c *client) Get(key storage.Key) (storage.Element, error) {
+	call := c.history.now()
+	element, err := c.store.Get(key)
+	ret := c.history.now()
+	if err != nil && !store.IsNotFound(err) {
+		return element, err
+	}
+	c.history.add(Operation{
+		Client: c.id,
+		Kind:   Get,
+		Key:    string(key),
+		Value:  string(element.Value),
+		Found:  err == nil,
+		Call:   call,
+		Return: ret,
+	})
+	return element, err
+}
@@ -0,0 +1,86 @@
+package linearizability
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/drakos74/lachesis/benchmarks/network"
+	"github.com/drakos74/lachesis/store/app/storage"
+)
+
+// Workload describes the operations of the clients, for recording a history
+// the clients pick among a few keys, so that their operations overlap in time and in keys.
+type Workload struct {
+	Clients int
+	// Operations is the number of operations of every client
+	Operations int
+	// Keys is the number of distinct keys, the smaller the more contention between the clients
+	Keys int
+	// Reads is the probability of an operation to be a read
+	Reads float64
+	// Interval is the maximum think time of a client between its operations, in units of the virtual clock
+	// it only applies to simulations.
+	Interval int64
+}
+
+// key returns the key of the given index
+func key(i int) storage.Key {
+	return storage.Key(fmt.Sprintf("key-%d", i))
+}
+
+// value returns a unique value for the operation of the client
+// so that every read can be traced back to the write it observed.
+func value(client, op int) storage.Value {
+	return storage.Value(fmt.Sprintf("c%d-%d", client, op))
+}
+
+// apply executes the next operation of the client on the store
+func (w Workload) apply(s Store, r *rand.Rand, client, op int) {
+	k := key(r.Intn(w.Keys))
+	if r.Float64() < w.Reads {
+		_, _ = s.Get(k)
+		return
+	}
+	_ = s.Put(storage.NewElement(k, value(client, op)))
+}
+
+// Concurrent runs the workload with a goroutine for every client, and records the history of their operations
+// the choices of the clients are drawn from the seed, but the interleaving of their operations is up to the scheduler.
+func Concurrent(s Store, workload Workload, seed int64) *History {
+	history := NewHistory()
+	var wg sync.WaitGroup
+	wg.Add(workload.Clients)
+	for i := 0; i < workload.Clients; i++ {
+		go func(client int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed + int64(client)))
+			c := history.Client(client, s)
+			for op := 0; op < workload.Operations; op++ {
+				workload.apply(c, r, client, op)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return history
+}
+
+// Simulate runs the workload with a process of the simulation for every client, and records the history of their operations
+// the history is fully determined by the seed of the simulation.
+func Simulate(sim *network.Simulation, workload Workload) *History {
+	history := NewHistory()
+	for i := 0; i < workload.Clients; i++ {
+		client := i
+		sim.Go(fmt.Sprintf("client %d", client), func() {
+			c := history.Client(client, sim)
+			for op := 0; op < workload.Operations; op++ {
+				if workload.Interval > 0 {
+					sim.NewWaiter().Wait(1 + sim.Rand().Int63n(workload.Interval))
+				}
+				workload.apply(c, sim.Rand(), client, op)
+			}
+		})
+	}
+	sim.Simulator.Run(0)
+	return history
+}
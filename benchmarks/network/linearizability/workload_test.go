@@ -0,0 +1,125 @@
+package linearizability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/benchmarks/network"
+	"github.com/drakos74/lachesis/benchmarks/network/lb"
+	"github.com/drakos74/lachesis/benchmarks/network/paxos"
+	"github.com/drakos74/lachesis/benchmarks/network/raft"
+	"github.com/drakos74/lachesis/store/io/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+var workload = Workload{Clients: 10, Operations: 30, Keys: 3, Reads: 0.5, Interval: 10}
+
+func shardedNetwork() *network.FactoryBuilder {
+	return network.Factory().
+		Router(lb.ShardedPartition).
+		Storage(mem.CacheFactory).
+		Nodes(5)
+}
+
+func replicaNetwork() *network.FactoryBuilder {
+	return network.Factory().
+		Router(lb.ReplicaPartition).
+		Storage(mem.CacheFactory).
+		Nodes(5).
+		Node(network.Node)
+}
+
+func paxosNetwork() *network.FactoryBuilder {
+	return network.Factory().
+		Router(lb.RandomPartition).
+		Storage(mem.CacheFactory).
+		Nodes(5).
+		Protocol(paxos.Protocol()).
+		Node(network.Node)
+}
+
+func raftNetwork() *network.FactoryBuilder {
+	return network.Factory().
+		Router(lb.LeaderFollowerPartition).
+		Storage(mem.SyncCacheFactory).
+		Nodes(5).
+		Protocol(raft.Protocol()).
+		Node(network.Node)
+}
+
+func TestConcurrent_ShardedNetwork(t *testing.T) {
+	net := shardedNetwork().Create()()
+	defer net.Close()
+
+	history := Concurrent(net, Workload{Clients: 10, Operations: 100, Keys: 3, Reads: 0.5}, network.Seed())
+
+	result := Check(history.Operations())
+	assert.True(t, result.Ok, result.String())
+}
+
+func TestSimulate_Replay(t *testing.T) {
+	seed := network.Seed()
+
+	history := Simulate(paxosNetwork().Simulate(seed), workload)
+	assert.Equal(t, history.Operations(), Simulate(paxosNetwork().Simulate(seed), workload).Operations(),
+		"replay with %s=%d", network.SeedVariable, seed)
+}
+
+// the random switch without any protocol keeps a single copy of the key on a random node
+// so that the reads miss the writes that went to other nodes
+func TestSimulate_RandomNetwork(t *testing.T) {
+	seed := network.Seed()
+
+	net := network.Factory().
+		Router(lb.RandomPartition).
+		Storage(mem.CacheFactory).
+		Nodes(5).
+		Simulate(seed)
+
+	result := Check(Simulate(net, workload).Operations())
+	assert.False(t, result.Ok, "replay with %s=%d", network.SeedVariable, seed)
+	assert.True(t, len(result.Counterexample) > 0)
+	t.Log(result)
+}
+
+// the configurations that claim to keep a consistent view of every key, under faults
+func TestSimulate_Linearizable(t *testing.T) {
+	seed := network.Seed()
+
+	networks := map[string]func() *network.FactoryBuilder{
+		"sharded": func() *network.FactoryBuilder {
+			return shardedNetwork().Faults(network.At(20, network.Delay(0, 20*time.Millisecond)))
+		},
+		// the reads fall back to the next replica, while a replica is down or has lost its state
+		"replica": func() *network.FactoryBuilder {
+			return replicaNetwork().Faults(network.At(20, network.Crash(1)).For(50))
+		},
+		// the leader serves all operations, and rejects the writes it cannot replicate to a majority
+		"raft": func() *network.FactoryBuilder {
+			return raftNetwork().Faults(
+				network.At(20, network.Delay(0, 20*time.Millisecond)).For(100),
+				network.At(50, network.Partition([]int{0, 1, 2})).For(50),
+			)
+		},
+	}
+
+	for name, net := range networks {
+		t.Run(name, func(t *testing.T) {
+			result := Check(Simulate(net().Simulate(seed), workload).Operations())
+			assert.True(t, result.Ok, "%v\nreplay with %s=%d", result, network.SeedVariable, seed)
+		})
+	}
+}
+
+// paxos reaches consensus on the writes, but serves the reads from a random node,
+// which might not have learned about the latest write, while it is partitioned away from the majority
+func TestSimulate_PaxosPartition(t *testing.T) {
+	seed := network.Seed()
+
+	net := paxosNetwork().
+		Faults(network.At(20, network.Partition([]int{0, 1}, []int{2, 3, 4})).For(200)).
+		Simulate(seed)
+
+	result := Check(Simulate(net, Workload{Clients: 10, Operations: 50, Keys: 3, Reads: 0.5, Interval: 10}).Operations())
+	t.Logf("%v\nreplay with %s=%d", result, network.SeedVariable, seed)
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/rand"
+	"sync"
+	"time"
 
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/rs/zerolog/log"
 )
@@ -36,9 +40,12 @@ type Metadata []Meta
 // the network has a Storage functionality as a whole and can be viewed as a distributed Storage
 type Network struct {
 	Switch
+	// switchMutex guards the switch, which the events replace, while the clients are being routed
+	switchMutex sync.RWMutex
 	WorldClock
-	nodes []Storage
-	cnl   func()
+	nodes  []Storage
+	faults *faults
+	cnl    func()
 }
 
 // FactoryBuilder is the builder factory for a network
@@ -49,6 +56,7 @@ type FactoryBuilder struct {
 	protocol    ProtocolFactory
 	parallelism int
 	events      []Event
+	faults      []Timed
 }
 
 // Factory creates a new NodeFactory
@@ -91,6 +99,12 @@ func (f *FactoryBuilder) Node(nodeFactory NodeFactory) *FactoryBuilder {
 	return f
 }
 
+// Faults specifies the schedule of faults to inject into the network
+func (f *FactoryBuilder) Faults(schedule ...Timed) *FactoryBuilder {
+	f.faults = schedule
+	return f
+}
+
 func (f *FactoryBuilder) validate() {
 	if f.parallelism == 0 {
 		panic("cannot create network without amount of parallelism")
@@ -125,8 +139,28 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 
 		nodes := make([]Storage, 0)
 
+		// actions on the nodes are executed by their client routine, in between the client operations
+		controls := make([]chan func(), f.parallelism)
+		mailboxes := make([]*mailbox, f.parallelism)
+		faults := newFaults(f.faults, rand.New(rand.NewSource(time.Now().UnixNano())), nodeControl{
+			storage: f.storage,
+			run: func(index int, action func(node *StorageNode)) {
+				if node, ok := nodes[index].(*StorageNode); ok {
+					controls[index] <- func() {
+						action(node)
+					}
+				}
+			},
+			sleep: time.Sleep,
+		})
+
 		for i := 0; i < f.parallelism; i++ {
 			node := f.nodeFactory(f.storage, f.protocol)
+			index := i
+			control := make(chan func())
+			controls[i] = control
+			mailboxes[i] = newMailbox()
+			go mailboxes[i].run(ctx, node.Cluster().Internal.in)
 
 			// listen to internal cluster events
 			go func() {
@@ -146,20 +180,11 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 				for {
 					select {
 					case cmd := <-node.Cluster().Operation.in:
-						element := storage.Nil
-						var err error
-						switch cmd.Type() {
-						case Put:
-							err = node.Put(cmd.Element())
-						case Get:
-							element, err = node.Get(cmd.Element().Key)
-						}
-						node.Cluster().Operation.out <- Response{
-							Element: element,
-							Err:     err,
-						}
+						node.Cluster().Operation.out <- serve(node, cmd)
 					case <-node.Cluster().Meta.in:
 						node.Cluster().Meta.out <- node.Metadata()
+					case action := <-control:
+						action()
 					case <-ctx.Done():
 						log.Debug().Msg("Closing Storage channel")
 						return
@@ -167,6 +192,24 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 				}
 			}()
 
+			// keep time for the nodes that need it
+			if period := node.Cluster().Internal.period; period > 0 {
+				go func() {
+					ticker := time.NewTicker(period)
+					defer ticker.Stop()
+					for {
+						select {
+						case <-ticker.C:
+							if !faults.down(index) {
+								mailboxes[index].push(Message{Type: Tick})
+							}
+						case <-ctx.Done():
+							return
+						}
+					}
+				}()
+			}
+
 			// register node to the network interface
 			route.Register(len(nodes))
 			nodes = append(nodes, node)
@@ -176,9 +219,11 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 				for msg := range node.Cluster().Internal.out {
 					// ignore empty messages
 					if msg != Void {
-						for _, n := range nodes {
+						for j, n := range nodes {
 							if msg.Source != n.Cluster().Internal.ID && (msg.RoutingID == 0 || n.Cluster().Internal.ID == msg.RoutingID) {
-								n.Cluster().Internal.in <- msg
+								for _, delay := range faults.deliver(index, j, msg) {
+									deliver(ctx, faults, j, mailboxes[j], msg, delay)
+								}
 							}
 						}
 					}
@@ -195,9 +240,11 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 					warmUp: eventInterval,
 					events: f.events,
 				},
+				faults: faults,
 			},
-			nodes: nodes,
-			cnl:   cnl,
+			nodes:  nodes,
+			faults: faults,
+			cnl:    cnl,
 		}
 
 		// listen to the world clock for external events
@@ -216,8 +263,89 @@ func (f *FactoryBuilder) Create() storage.StorageFactory {
 
 }
 
+// deliver passes the message to the mailbox of the node after the given delay
+// delayed messages can be overtaken by the ones that follow
+func deliver(ctx context.Context, faults *faults, index int, box *mailbox, msg Message, delay time.Duration) {
+	send := func() {
+		// the node might have crashed in the meantime
+		if !faults.down(index) {
+			box.push(msg)
+		}
+	}
+	if delay == 0 {
+		send()
+		return
+	}
+	go func() {
+		select {
+		case <-time.After(delay):
+			send()
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// mailbox queues the incoming messages of a node
+// so that the sender never blocks on a node that is busy sending messages of its own, which could end up in a deadlock
+type mailbox struct {
+	mutex   sync.Mutex
+	pending []Message
+	ready   chan struct{}
+}
+
+func newMailbox() *mailbox {
+	return &mailbox{
+		pending: make([]Message, 0),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push adds a message to the mailbox
+func (m *mailbox) push(msg Message) {
+	m.mutex.Lock()
+	m.pending = append(m.pending, msg)
+	m.mutex.Unlock()
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run passes the messages to the node in the order they arrived
+func (m *mailbox) run(ctx context.Context, in chan Message) {
+	for {
+		m.mutex.Lock()
+		if len(m.pending) == 0 {
+			m.mutex.Unlock()
+			select {
+			case <-m.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		msg := m.pending[0]
+		m.pending = m.pending[1:]
+		m.mutex.Unlock()
+		select {
+		case in <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// router returns the current switch of the network
+func (n *Network) router() Switch {
+	n.switchMutex.RLock()
+	defer n.switchMutex.RUnlock()
+	return n.Switch
+}
+
 // trigger initiates an event for the network
 func (n *Network) trigger(event Event) {
+	n.switchMutex.Lock()
+	defer n.switchMutex.Unlock()
 	if ev, ok := n.Switch.(Event); ok {
 		// get back the initial router implementation
 		n.Switch = ev.Reset()
@@ -233,28 +361,32 @@ func (n *Network) Put(element storage.Element) error {
 	cmd := PutCommand{element: element}
 	// emulate a network retry mechanism
 	// i.e. to capture cases where node is down
-	ids, err := retry(10, n.Route, cmd.Element().Key)
+	ids, err := retry(10, n.faults.route(skip(n.router(), n.faults.down)), cmd.Element().Key)
 	if err != nil {
 		return fmt.Errorf("error during put action: %w", err)
 	}
 
-	var response Response
+	failures := 0
 	for _, id := range ids {
 		n.nodes[id].Cluster().Operation.in <- cmd
 		nodeResponse := <-n.nodes[id].Cluster().Operation.out
-		if nodeResponse.Err == nil {
-			// pick the non-failing response to send to the client
-			// TODO : investigate also the fail-fast approach by DeRegistering parallelism
-			response = nodeResponse
-		} else {
+		n.follow(nodeResponse)
+		if nodeResponse.Err != nil {
 			// TODO : track these events differently
 			log.Info().Str("Type", "ERROR").Msg(fmt.Sprintf("node %d returned an error = %v", id, nodeResponse.Err))
+			failures++
+			err = nodeResponse.Err
 		}
 	}
 
 	n.WorldClock.tick <- struct{}{}
 
-	return response.Err
+	// pick the non-failing response to send to the client, if any
+	// TODO : investigate also the fail-fast approach by DeRegistering parallelism
+	if failures < len(ids) {
+		return nil
+	}
+	return err
 
 }
 
@@ -262,7 +394,7 @@ func (n *Network) Put(element storage.Element) error {
 func (n *Network) Get(key storage.Key) (storage.Element, error) {
 	cmd := GetCommand{key: key}
 	// emulate a network retry mechanism
-	ids, err := retry(10, n.Route, cmd.Element().Key)
+	ids, err := retry(10, n.faults.route(skip(n.router(), n.faults.down)), cmd.Element().Key)
 	if err != nil {
 		return storage.Nil, fmt.Errorf("error during get action: %w", err)
 	}
@@ -272,15 +404,38 @@ func (n *Network) Get(key storage.Key) (storage.Element, error) {
 		// we emulate for now blocking communication
 		n.nodes[id].Cluster().Operation.in <- cmd
 		response = <-n.nodes[id].Cluster().Operation.out
+		n.follow(response)
 		// stop at the first successful response
 		if response.Err == nil {
 			break
 		}
+		// a missing key on one node should not hide a failure on another
+		if err == nil || store.IsNotFound(err) {
+			err = response.Err
+		}
 	}
 
 	n.WorldClock.tick <- struct{}{}
 
-	return response.Element, response.Err
+	if response.Err == nil {
+		return response.Element, nil
+	}
+	return response.Element, err
+}
+
+// follow lets the switch know of the leader of the cluster, as reported in the response of a node
+func (n *Network) follow(response Response) {
+	if response.Leader == 0 {
+		return
+	}
+	if l, ok := leader(n.router()); ok {
+		for i, node := range n.nodes {
+			if node.Cluster().ID == response.Leader {
+				l.Lead(i)
+				return
+			}
+		}
+	}
 }
 
 // retry emulates a retry mechanism, in case a node is down
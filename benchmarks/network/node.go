@@ -5,6 +5,7 @@ import (
 
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 // Void is an empty message
@@ -65,6 +66,10 @@ const (
 	Commit
 	// Confirm is the final triggered after the second phase for 1st tier nodes
 	Confirm
+	// Tick is sent by the network to the nodes that keep time, at the period they asked for
+	Tick
+	// RPC is a protocol specific message, which is interpreted based on its content
+	RPC
 )
 
 // String prints a humanly readable string representation of the given message type
@@ -78,6 +83,10 @@ func (t MsgType) String() string {
 		return "Confirm"
 	case Confirm:
 		return "confirm"
+	case Tick:
+		return "tick"
+	case RPC:
+		return "rpc"
 	}
 	return ""
 }
@@ -116,24 +125,37 @@ type MsgProcessor func(state *State, storage storage.Storage, msg interface{}) (
 // State represents the wal of the storage node
 type State struct {
 	Index int64
-	// TODO : make this also a storage interface to be able to inject different implementations for the WAL
-	// only caveat is that the raw implementation is not enough, as we want to store an 'interface' and not raw bytes
+	// Log holds the protocol specific state
 	Log map[string]interface{}
+	// WAL is the sequenced log of the node, for the protocols that rely on an ordered history of commands
+	WAL WAL
 }
 
 // NewStateLog creates a new state log for a node
+// with an in-memory WAL, which does not survive a restart of the node. See Processor.WAL for a durable one.
 func NewStateLog() State {
+	return NewState(NewWAL())
+}
+
+// NewState creates a new state log for a node with the given WAL
+func NewState(wal WAL) State {
 	return State{
 		Log: make(map[string]interface{}),
+		WAL: wal,
 	}
 }
 
+// ClientProcessor bears the logic of serving a client command
+type ClientProcessor func(state *State, node *StorageNode, cmd Command) Response
+
 // Processor encapsulates all logic related to the internal cluster communication protocol
 type Processor struct {
 	Store    storage.Storage
 	State    State
 	initiate func(state *State, node *StorageNode, element storage.Element) (rpc interface{}, wait bool)
 	handle   map[MsgType]MsgProcessor
+	client   ClientProcessor
+	newWAL   WALFactory
 }
 
 // ProcessorFactory creates a new processor
@@ -168,6 +190,34 @@ func (p *Processor) Confirm(handler MsgProcessor) *Processor {
 	return p
 }
 
+// Client adds a handler for the client commands to the processor
+// it replaces the two-phase put of the node, for the protocols that serve the client commands on their own.
+func (p *Processor) Client(handler ClientProcessor) *Processor {
+	p.client = handler
+	return p
+}
+
+// WAL sets the factory for the WAL of the nodes, e.g. a FileWALFactory for a log that survives a restart
+// without one, the nodes keep their log in memory.
+func (p *Processor) WAL(newWAL WALFactory) *Processor {
+	p.newWAL = newWAL
+	return p
+}
+
+// newState creates the state log for the node with the given id
+// if the WAL cannot be opened, the node keeps running, but all the operations on its log fail.
+func (p *Processor) newState(id uint32) State {
+	if p.newWAL == nil {
+		return NewStateLog()
+	}
+	wal, err := p.newWAL(id)
+	if err != nil {
+		log.Error().Err(err).Uint32("node", id).Msg("could not open WAL")
+		return NewState(failedWAL{err: err})
+	}
+	return NewState(wal)
+}
+
 // Storage adds a storage implementation to the processor
 func (p *Processor) Storage(storage storage.Storage) *Processor {
 	p.Store = storage
@@ -186,6 +236,16 @@ type Peer struct {
 	processor Processor
 }
 
+// State returns the protocol state of the node
+func (p *Peer) State() *State {
+	return &p.processor.State
+}
+
+// Store returns the storage of the node
+func (p *Peer) Store() storage.Storage {
+	return p.processor.Store
+}
+
 func (p *Peer) initPut(node *StorageNode, element storage.Element) (rpc interface{}, wait bool) {
 	return p.processor.initiate(&p.processor.State, node, element)
 }
@@ -223,7 +283,7 @@ func Node(newStorage storage.StorageFactory, newCluster ProtocolFactory) Storage
 	protocol, peer := newCluster(id)
 	store := newStorage()
 	peer.processor.Storage(store)
-	peer.processor.State = NewStateLog()
+	peer.processor.State = peer.processor.newState(id)
 	return &StorageNode{
 		Member: Member{
 			Operation: Operation{
@@ -263,11 +323,23 @@ func Execute(store storage.Storage, cmd Command) Response {
 	}
 }
 
+// serve executes the client command on the node
+func serve(node Storage, cmd Command) Response {
+	if n, ok := node.(*StorageNode); ok && n.processor.client != nil {
+		return n.processor.client(&n.processor.State, n, cmd)
+	}
+	return Execute(node, cmd)
+}
+
 // Storage interface
 
 // Put writes an element to the Storage
 func (n *StorageNode) Put(element storage.Element) error {
 
+	if n.processor.client != nil {
+		return n.processor.client(&n.processor.State, n, NewPut(element)).Err
+	}
+
 	cmd, wait := n.Peer.initPut(n, element)
 
 	if wait {
@@ -303,6 +375,10 @@ func (n *StorageNode) Put(element storage.Element) error {
 
 // Get retrieves an element from the Storage
 func (n *StorageNode) Get(key storage.Key) (storage.Element, error) {
+	if n.processor.client != nil {
+		response := n.processor.client(&n.processor.State, n, NewGet(key))
+		return response.Element, response.Err
+	}
 	return n.processor.Store.Get(key)
 }
 
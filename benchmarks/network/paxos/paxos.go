@@ -1,6 +1,7 @@
 package paxos
 
 import (
+	"encoding/binary"
 	"fmt"
 	"reflect"
 	"time"
@@ -11,7 +12,18 @@ import (
 
 // Protocol implements the internal cluster communication requirements,
 // e.g. the proposers and acceptors interaction logic
+// the nodes keep the accepted proposals in memory.
 func Protocol() network.ProtocolFactory {
+	return protocol(nil)
+}
+
+// DurableProtocol is the paxos protocol with the accepted proposals of every node in a file of the given directory
+// so that a node restores them, when it restarts.
+func DurableProtocol(dir string) network.ProtocolFactory {
+	return protocol(network.FileWALFactory(dir, codec{}))
+}
+
+func protocol(newWAL network.WALFactory) network.ProtocolFactory {
 
 	processor := network.ProcessorFactory(func(state *network.State, node *network.StorageNode, element storage.Element) (rpc interface{}, wait bool) {
 		index := time.Now().UnixNano()
@@ -25,14 +37,9 @@ func Protocol() network.ProtocolFactory {
 	processor.Propose(func(state *network.State, storage storage.Storage, msg interface{}) (interface{}, error) {
 		// we expect a proposal message
 		if proposal, ok := msg.(Proposal); ok {
-			if currentState, ok := state.Log[string(proposal.command.Element().Key)]; ok {
-				entry := currentState.(Proposal)
-				if entry.index > proposal.index {
-					return nil, fmt.Errorf("a higher index '%v' already exists for key '%v'",
-						entry.index, proposal.command.Element().Key)
-				}
+			if err := accept(state, proposal); err != nil {
+				return nil, err
 			}
-			state.Log[string(proposal.command.Element().Key)] = proposal
 			response := Promise{}
 			return response, nil
 		}
@@ -44,14 +51,9 @@ func Protocol() network.ProtocolFactory {
 		// we are doing the same work as the follower in the previous step
 		// e.g. appending to our log the same as the follower did, so that we are fully aligned!
 		if proposal, ok := msg.(Proposal); ok {
-			if currentState, ok := state.Log[string(proposal.command.Element().Key)]; ok {
-				entry := currentState.(Proposal)
-				if entry.index > proposal.index {
-					return nil, fmt.Errorf("a higher index '%v' already exists for key '%v'",
-						entry.index, proposal.command.Element().Key)
-				}
+			if err := accept(state, proposal); err != nil {
+				return nil, err
 			}
-			state.Log[string(proposal.command.Element().Key)] = proposal
 			response := Commit{key: proposal.command.Element().Key}
 			return response, nil
 		}
@@ -61,8 +63,13 @@ func Protocol() network.ProtocolFactory {
 	// follower phase 2 processing logic
 	processor.Commit(func(state *network.State, storage storage.Storage, msg interface{}) (interface{}, error) {
 		if commit, ok := msg.(Commit); ok {
-			currentState := state.Log[string(commit.key)]
-			entry := currentState.(Proposal)
+			entry, ok, err := accepted(state, commit.key)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("no proposal found to commit for key '%v'", commit.key)
+			}
 			network.Execute(storage, entry.command)
 			return nil, nil
 		}
@@ -71,13 +78,108 @@ func Protocol() network.ProtocolFactory {
 
 	processor.Confirm(func(state *network.State, storage storage.Storage, msg interface{}) (interface{}, error) {
 		if commit, ok := msg.(Commit); ok {
-			currentState := state.Log[string(commit.key)]
-			entry := currentState.(Proposal)
+			entry, ok, err := accepted(state, commit.key)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("no proposal found to commit for key '%v'", commit.key)
+			}
 			network.Execute(storage, entry.command)
 			return nil, nil
 		}
 		return nil, fmt.Errorf("unexpected message received for commit confirmation '%v'", reflect.TypeOf(msg))
 	})
 
+	processor.WAL(newWAL)
+
 	return network.ConsensusProtocol(*processor)
 }
+
+// restored marks the state of a node, that has restored its accepted proposals from its log
+// the empty key is never the key of a proposal.
+const restored = ""
+
+// restore rebuilds the accepted proposals of the node from its log, once after the node (re)starts
+// the proposals are replayed in the order they were accepted, so the latest one for every key prevails.
+func restore(state *network.State) error {
+	if _, ok := state.Log[restored]; ok {
+		return nil
+	}
+	err := state.WAL.Replay(0, func(index uint64, entry interface{}) error {
+		proposal, ok := entry.(Proposal)
+		if !ok {
+			return fmt.Errorf("unexpected entry in log at '%d': %v", index, reflect.TypeOf(entry))
+		}
+		state.Log[string(proposal.command.Element().Key)] = proposal
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not restore accepted proposals: %w", err)
+	}
+	state.Log[restored] = true
+	return nil
+}
+
+// accept adds the proposal to the log of the node, unless a proposal with a higher index has been accepted for the key
+func accept(state *network.State, proposal Proposal) error {
+	if err := restore(state); err != nil {
+		return err
+	}
+	key := proposal.command.Element().Key
+	if currentState, ok := state.Log[string(key)]; ok {
+		entry := currentState.(Proposal)
+		if entry.index > proposal.index {
+			return fmt.Errorf("a higher index '%v' already exists for key '%v'", entry.index, key)
+		}
+	}
+	if _, err := state.WAL.Append(proposal); err != nil {
+		return fmt.Errorf("could not accept proposal for key '%v': %w", key, err)
+	}
+	state.Log[string(key)] = proposal
+	return nil
+}
+
+// accepted returns the proposal the node has accepted for the key
+func accepted(state *network.State, key storage.Key) (Proposal, bool, error) {
+	if err := restore(state); err != nil {
+		return Proposal{}, false, err
+	}
+	proposal, ok := state.Log[string(key)].(Proposal)
+	return proposal, ok, nil
+}
+
+// proposalHeaderSize is the size of the header of an encoded proposal
+// [index:8]
+const proposalHeaderSize = 8
+
+// codec encodes the accepted proposals, for a log that is stored in a file
+type codec struct{}
+
+// Encode serializes the proposal along with its command
+func (codec) Encode(entry interface{}) ([]byte, error) {
+	proposal, ok := entry.(Proposal)
+	if !ok {
+		return nil, fmt.Errorf("unexpected entry for paxos log: %v", reflect.TypeOf(entry))
+	}
+	cmd := network.EncodeCommand(proposal.command)
+	b := make([]byte, proposalHeaderSize+len(cmd))
+	binary.BigEndian.PutUint64(b[:proposalHeaderSize], uint64(proposal.index))
+	copy(b[proposalHeaderSize:], cmd)
+	return b, nil
+}
+
+// Decode de-serializes a proposal, that was serialized with Encode
+func (codec) Decode(data []byte) (interface{}, error) {
+	if len(data) < proposalHeaderSize {
+		return nil, fmt.Errorf("cannot read paxos proposal from %d bytes", len(data))
+	}
+	cmd, err := network.DecodeCommand(data[proposalHeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+	return Proposal{
+		index:   int64(binary.BigEndian.Uint64(data[:proposalHeaderSize])),
+		command: cmd,
+	}, nil
+}
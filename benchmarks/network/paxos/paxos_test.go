@@ -2,6 +2,7 @@ package paxos
 
 import (
 	"testing"
+	"time"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
 	"github.com/drakos74/lachesis/benchmarks/network/lb"
@@ -53,3 +54,114 @@ func testNetworkSimpleNodeDownEvent(t *testing.T) {
 func testNetworkLeaderNodeDownEvent(t *testing.T) {
 	new(test.FailureRate).Run(t, newPaxosNetwork(network.NewNodeDownEvent(0, 30)), test.Limit{})
 }
+
+func paxosNetwork(event ...network.Event) *network.FactoryBuilder {
+	return network.Factory(event...).
+		Router(lb.RandomPartition).
+		Storage(mem.CacheFactory).
+		Nodes(10).
+		Protocol(Protocol()).
+		Node(network.Node)
+}
+
+// the simulation runs the concurrent clients deterministically,
+// so that the outcome of the protocol can be replayed from the seed
+func TestNetwork_SimulatedNodeDownEvent(t *testing.T) {
+	seed := network.Seed()
+
+	workload := network.Workload{Clients: 500, KeySize: 10, ValueSize: 100, Interval: 1000}
+
+	report := paxosNetwork(network.NewNodeDownEvent(3, 30)).Simulate(seed).Run(workload)
+	t.Log(report)
+
+	assert.Equal(t, report, paxosNetwork(network.NewNodeDownEvent(3, 30)).Simulate(seed).Run(workload),
+		"replay with %s=%d", network.SeedVariable, seed)
+}
+
+// duplicated and reordered messages should not affect the outcome of the protocol
+func TestNetwork_DuplicateAndDelayFaults(t *testing.T) {
+	new(test.Consistency).Run(t, network.Factory().
+		Router(lb.RandomPartition).
+		Storage(mem.CacheFactory).
+		Nodes(10).
+		Protocol(Protocol()).
+		Faults(
+			network.At(10, network.Duplicate(0.2)),
+			network.At(20, network.Delay(0, time.Millisecond)).For(100),
+		).
+		Create())
+}
+
+func TestNetwork_SimulatedFaults(t *testing.T) {
+	seed := network.Seed()
+
+	workload := network.Workload{Clients: 500, KeySize: 10, ValueSize: 100, Interval: 1000}
+
+	for name, scenario := range map[string]struct {
+		faults []network.Timed
+		fail   bool
+	}{
+		"partition": {faults: []network.Timed{network.At(100, network.Partition([]int{0, 1, 2})).For(200)}, fail: true},
+		"one-way":   {faults: []network.Timed{network.At(100, network.OneWayPartition([]int{0, 1, 2}, []int{3, 4, 5})).For(200)}, fail: true},
+		"drop":      {faults: []network.Timed{network.At(100, network.Drop(0.1)).For(200)}, fail: true},
+		"crash":     {faults: []network.Timed{network.At(100, network.Crash(3)).For(200)}, fail: true},
+		"restart":   {faults: []network.Timed{network.At(100, network.Restart(3)).For(200)}, fail: true},
+		"delay":     {faults: []network.Timed{network.At(100, network.Delay(0, 100*time.Millisecond)).For(200)}},
+		"duplicate": {faults: []network.Timed{network.At(100, network.Duplicate(0.5)).For(200)}},
+		"slow-disk": {faults: []network.Timed{network.At(100, network.SlowDisk(3, 50*time.Millisecond)).For(200)}},
+		"composed": {faults: []network.Timed{
+			network.At(100, network.Delay(0, 20*time.Millisecond)).For(300),
+			network.At(150, network.Partition([]int{0, 1}, []int{2, 3, 4})).For(50),
+			network.At(300, network.Crash(5)).For(100),
+			network.At(500, network.Duplicate(0.1)),
+		}, fail: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			report := paxosNetwork().Faults(scenario.faults...).Simulate(seed).Run(workload)
+			t.Log(report)
+
+			assert.Equal(t, scenario.fail, report.WriteErrors > 0, "replay with %s=%d", network.SeedVariable, seed)
+			assert.Equal(t, report, paxosNetwork().Faults(scenario.faults...).Simulate(seed).Run(workload),
+				"replay with %s=%d", network.SeedVariable, seed)
+		})
+	}
+}
+
+// a node with a durable log restores the proposals it accepted, when it restarts
+func TestAccept_Restart(t *testing.T) {
+	newWAL := network.FileWALFactory(t.TempDir(), codec{})
+
+	wal, err := newWAL(1)
+	assert.NoError(t, err)
+	state := network.NewState(wal)
+
+	put := func(index int64, key, value string) Proposal {
+		return Proposal{index: index, command: network.NewPut(storage.NewElement([]byte(key), []byte(value)))}
+	}
+	assert.NoError(t, accept(&state, put(1, "key-1", "value-1")))
+	assert.NoError(t, accept(&state, put(2, "key-2", "value-2")))
+	assert.NoError(t, accept(&state, put(3, "key-1", "value-3")))
+	// a proposal behind the accepted one is rejected
+	assert.Error(t, accept(&state, put(2, "key-1", "value-4")))
+
+	err = wal.(*network.FileWAL).Close()
+	assert.NoError(t, err)
+	wal, err = newWAL(1)
+	assert.NoError(t, err)
+	state = network.NewState(wal)
+
+	proposal, ok, err := accepted(&state, []byte("key-1"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, put(3, "key-1", "value-3"), proposal)
+	proposal, ok, err = accepted(&state, []byte("key-2"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, put(2, "key-2", "value-2"), proposal)
+	_, ok, err = accepted(&state, []byte("key-3"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// the restored proposals still guard the key
+	assert.Error(t, accept(&state, put(2, "key-1", "value-4")))
+}
@@ -2,6 +2,8 @@ package network
 
 import (
 	"fmt"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/drakos74/lachesis/store/app/storage"
@@ -16,25 +18,161 @@ type Internal struct {
 	out     chan Message
 	signal  chan Signal
 	Process MsgRouter
+	// transport replaces the channels, when the network runs in a simulation
+	transport *transport
+	// period is the interval of the Tick messages for the node, if it keeps time
+	period time.Duration
+	rand   *rand.Rand
+}
+
+// Tick asks the network to send a Tick message to the node at the given period
+// the ticks follow the real clock for the emulated network, and the virtual one for a simulation.
+func (i *Internal) Tick(period time.Duration) *Internal {
+	i.period = period
+	return i
+}
+
+// Rand returns the source of randomness for the protocol
+// it is the source of the simulator within a simulation, so that the choices of the protocol can be replayed.
+// It must only be used from within the processing of the messages.
+func (i *Internal) Rand() *rand.Rand {
+	if i.transport != nil {
+		return i.transport.sim.Rand()
+	}
+	if i.rand == nil {
+		i.rand = rand.New(rand.NewSource(time.Now().UnixNano() + int64(i.ID)))
+	}
+	return i.rand
 }
 
 // Send propagates a message to the appropriate communication channel for inter-node communication
 func (i *Internal) Send(msg Message) {
+	if i.transport != nil {
+		i.transport.send(msg)
+		return
+	}
 	i.out <- msg
 }
 
+// notify signals the completion of a protocol phase to the node waiting for it
+func (i *Internal) notify(s Signal) {
+	if i.transport != nil {
+		i.transport.notify(s)
+		return
+	}
+	i.signal <- s
+}
+
 func (i *Internal) processSignal(signal Signal, process func() error) error {
+	if i.transport != nil {
+		return i.transport.processSignal(signal, process)
+	}
 	select {
 	case s := <-i.signal:
 		if s == signal {
 			return process()
 		}
 		return fmt.Errorf("unexpected signal received: '%v' instead of '%v'", s, signal)
-	case <-time.Tick(5 * time.Second):
+	case <-time.Tick(consensusTimeout):
 		return fmt.Errorf("could not get consensus from cluster")
 	}
 }
 
+// consensusTimeout is the time a node waits for the cluster to reach consensus
+const consensusTimeout = 5 * time.Second
+
+// transport carries the messages and signals of a node through the simulator
+type transport struct {
+	sim     *Simulator
+	deliver func(msg Message)
+	// signals are buffered, as they are received within the same routine as the messages
+	signals []Signal
+	waiter  *Waiter
+}
+
+func (t *transport) send(msg Message) {
+	t.deliver(msg)
+}
+
+func (t *transport) notify(s Signal) {
+	t.signals = append(t.signals, s)
+	if t.waiter != nil {
+		t.waiter.Wake()
+	}
+}
+
+func (t *transport) processSignal(signal Signal, process func() error) error {
+	if len(t.signals) == 0 {
+		t.waiter = t.sim.NewWaiter()
+		ok := t.waiter.Wait(units(consensusTimeout))
+		t.waiter = nil
+		if !ok {
+			return fmt.Errorf("could not get consensus from cluster")
+		}
+	}
+	s := t.signals[0]
+	t.signals = t.signals[1:]
+	if s == signal {
+		return process()
+	}
+	return fmt.Errorf("unexpected signal received: '%v' instead of '%v'", s, signal)
+}
+
+// Future is the result of an operation that completes asynchronously
+// e.g. a client command that waits for the cluster to reach consensus, while the messages are processed by the node.
+type Future struct {
+	transport *transport
+	once      sync.Once
+	done      chan Response
+	// the result is kept along with the waiter of the process, within a simulation
+	completed bool
+	response  Response
+	waiter    *Waiter
+}
+
+// Future creates a new future for the operations of the node
+func (i *Internal) Future() *Future {
+	return &Future{
+		transport: i.transport,
+		done:      make(chan Response, 1),
+	}
+}
+
+// Complete sets the result of the future
+// it never blocks, and only the first result is kept.
+func (f *Future) Complete(response Response) {
+	f.once.Do(func() {
+		if f.transport != nil {
+			f.completed = true
+			f.response = response
+			if f.waiter != nil {
+				f.waiter.Wake()
+			}
+			return
+		}
+		f.done <- response
+	})
+}
+
+// Wait blocks until the future is completed, or the timeout expires
+// it returns false, if the timeout expired.
+func (f *Future) Wait(timeout time.Duration) (Response, bool) {
+	if f.transport != nil {
+		if !f.completed {
+			f.waiter = f.transport.sim.NewWaiter()
+			// a zero timeout would wait indefinitely
+			f.waiter.Wait(units(timeout) + 1)
+		}
+		return f.response, f.completed
+	}
+	select {
+	case response := <-f.done:
+		return response, true
+	case <-time.After(timeout):
+		return Response{}, false
+	}
+}
+
 // buffer defines the buffering capabilities of the network for inter-node communication
 const buffer = 0
 
@@ -69,6 +207,8 @@ type confirmation struct {
 	msgType map[uint32]MsgType
 	count   map[uint32]int
 	trigger map[uint32]bool
+	// voters keeps track of the nodes that have responded, so that duplicate responses are counted only once
+	voters map[uint32]map[uint32]bool
 }
 
 func (c *confirmation) reached(id uint32) bool {
@@ -88,11 +228,13 @@ func ConsensusProtocol(processor Processor) ProtocolFactory {
 			msgType: make(map[uint32]MsgType),
 			count:   make(map[uint32]int),
 			trigger: make(map[uint32]bool),
+			voters:  make(map[uint32]map[uint32]bool),
 		}
 
 		signal := make(chan Signal)
 
-		return Protocol(id, signal, func(members int, node Storage, msg Message) Message {
+		var internal *Internal
+		internal, peer := Protocol(id, signal, func(members int, node Storage, msg Message) Message {
 
 			member, _ := node.(*StorageNode)
 
@@ -132,7 +274,18 @@ func ConsensusProtocol(processor Processor) ProtocolFactory {
 					consensus.count[msg.ID] = int(float64(members-2) * consensusThreshold)
 					consensus.trigger[msg.ID] = false
 					consensus.msgType[msg.ID] = msg.Type
+					consensus.voters[msg.ID] = make(map[uint32]bool)
+				}
+				if consensus.voters[msg.ID][msg.Source] {
+					log.Debug().
+						Str("type", "leader").
+						Str("rpc", msg.Type.String()).
+						Uint32("id", msg.ID).
+						Uint32("from", msg.Source).
+						Msg("ignore duplicate rpc response")
+					return Void
 				}
+				consensus.voters[msg.ID][msg.Source] = true
 				if msg.Err == nil {
 					consensus.count[msg.ID]--
 					if consensus.reached(msg.ID) {
@@ -142,7 +295,7 @@ func ConsensusProtocol(processor Processor) ProtocolFactory {
 							Uint32("id", msg.ID).
 							Uint32("node", member.Cluster().ID).
 							Msg("received signal")
-						signal <- msg.Type.Phase()
+						internal.notify(msg.Type.Phase())
 						consensus.trigger[msg.ID] = true
 					}
 				} else {
@@ -154,5 +307,6 @@ func ConsensusProtocol(processor Processor) ProtocolFactory {
 			// dont trigger any other events
 			return Void
 		}, processor)
+		return internal, peer
 	}
 }
@@ -22,13 +22,52 @@ type HeartBeat struct {
 }
 
 // AppendRPC is the append RPC command for the raft protocol
+// the leader sends it without any entries as its heartbeat.
 type AppendRPC struct {
 	HeartBeat
-	command network.Command
+	entries     []*State
+	commitIndex int64
 }
 
 // ResponseRPC is the response object for the raft protocol
+// on success, the log index is the last index of the follower log that matches the leader,
+// otherwise it is the index, after which the leader should retry.
 type ResponseRPC struct {
 	HeartBeat
+	from    uint32
+	success bool
+}
+
+// SnapshotRPC is the install snapshot RPC command for the raft protocol
+// the leader sends it instead of the states, that it no longer keeps in its log.
+type SnapshotRPC struct {
+	Epoch
+	snapshot Snapshot
+}
+
+// VoteRPC is the request of a candidate for the votes of the other nodes
+type VoteRPC struct {
+	term         int
+	candidate    uint32
+	lastLogIndex int64
+	lastLogTerm  int
+}
+
+// BallotRPC is the response to a vote request
+type BallotRPC struct {
+	term    int
+	from    uint32
+	granted bool
+}
+
+// ForwardRPC passes a client command from a follower to the leader
+type ForwardRPC struct {
+	id      uint32
+	command network.Command
+}
+
+// ResultRPC passes the result of a forwarded command back to the follower
+type ResultRPC struct {
+	id       uint32
 	response network.Response
 }
@@ -1,180 +1,719 @@
 package raft
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
-	"github.com/drakos74/lachesis/store/app/storage"
+	"github.com/rs/zerolog/log"
 )
 
-// Protocol implements the internal cluster communication requirements,
-// e.g. the leader and followers interaction logic
-func Protocol() network.ProtocolFactory {
+const (
+	// tick is the period of the clock of the nodes
+	tick = 10 * time.Millisecond
+	// electionTicks is the least number of ticks without hearing from a leader, before a follower starts an election
+	// the timeout of every node is drawn at random between electionTicks and twice as much, so that candidates rarely collide
+	electionTicks = 10
+	// requestTimeout is the time a client command waits for the cluster
+	requestTimeout = time.Second
+	// snapshotThreshold is the number of applied states, after which the node takes a snapshot of its storage and compacts its log
+	snapshotThreshold = 100
+)
 
-	processor := network.ProcessorFactory(func(state *network.State, node *network.StorageNode, element storage.Element) (rpc interface{}, wait bool) {
-		stMachine, err := retrieveStatMachine(state)
-		if err != nil {
-			return nil, false
-		}
-		return AppendRPC{
-			HeartBeat: HeartBeat{
-				Epoch: Epoch{
-					leaderID: node.Cluster().ID,
-				},
-				Log: Log{
-					prevLogIndex: stMachine.commitIndex - 1,
-					logIndex:     stMachine.commitIndex,
-				},
-			},
-			command: network.NewPut(element),
-		}, true
-	})
+var (
+	errNoLeader  = errors.New("no leader elected")
+	errNotLeader = errors.New("node is not the leader")
+	errTimeout   = errors.New("could not get consensus from cluster")
+)
+
+// role of a node in the cluster
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+// String returns a humanly readable representation of the role
+func (r role) String() string {
+	switch r {
+	case follower:
+		return "follower"
+	case candidate:
+		return "candidate"
+	case leader:
+		return "leader"
+	}
+	return ""
+}
+
+// request is a client command waiting for its state to be applied
+// it is either a command of the leader itself, or one forwarded by a follower.
+type request struct {
+	term   int
+	future *network.Future
+	from   uint32
+	id     uint32
+}
+
+// node is the raft state of a cluster member
+type node struct {
+	mutex  sync.Mutex
+	member *network.StorageNode
+	role   role
+	term   int
+	// votedFor is the candidate that received the vote of the node for the current term
+	votedFor uint32
+	leader   uint32
+	log      *stateMachine
+	// lastApplied is the index of the last state applied to the storage
+	lastApplied int64
+	// written are the keys of the storage, for taking a snapshot of it
+	written keys
+	// size is the number of members of the cluster
+	size int
+	// elapsed counts the ticks since the node last heard from a leader, or granted its vote
+	elapsed int
+	timeout int
+	// votes are the votes of the candidate
+	votes map[uint32]bool
+	// next and match are the indexes of the leader for every follower, as per the paper
+	next  map[uint32]int64
+	match map[uint32]int64
+	// behind are the followers that the leader already sent the missing states to, within the current tick
+	behind map[uint32]bool
+	// pending are the requests of the leader for every index of the log
+	pending map[int64]*request
+	// forwarded are the requests of the follower, that wait for the result of the leader
+	forwarded map[uint32]*network.Future
+	requests  uint32
+	// elected are the requests that wait for a leader to be elected
+	elected []*network.Future
+}
+
+// initialization guards the creation of the raft state,
+// as the client and the cluster messages of a node are served by different routines
+var initialization sync.Mutex
+
+// retrieveNode returns the raft state of the node, creating it if needed
+func retrieveNode(state *network.State, member *network.StorageNode) (*node, error) {
+	initialization.Lock()
+	defer initialization.Unlock()
+	if _, ok := state.Log[""]; !ok {
+		n := &node{
+			member:    member,
+			log:       newStateMachine(state.WAL),
+			written:   make(keys),
+			pending:   make(map[int64]*request),
+			forwarded: make(map[uint32]*network.Future),
+		}
+		n.restore()
+		state.Log[""] = n
+	}
+	n, ok := state.Log[""].(*node)
+	if !ok {
+		return nil, fmt.Errorf("could not retrieve raft state: %v", reflect.TypeOf(state.Log[""]))
+	}
+	return n, nil
+}
 
-	// follower phase 1 processing logic
-	processor.Propose(func(state *network.State, storage storage.Storage, msg interface{}) (interface{}, error) {
-		stMachine, err := retrieveStatMachine(state)
+// restore picks up the state of a node, that restarted with its storage and its log
+// the compacted states have been applied to the storage before, so it only needs a snapshot of it for the followers.
+func (n *node) restore() {
+	if n.log.snapshot.index > 0 {
+		n.lastApplied = n.log.snapshot.index
+		data, err := takeSnapshot(n.member.Store(), n.written)
 		if err != nil {
-			return nil, fmt.Errorf("could not retrieve state machine '%w'", err)
+			log.Err(err).Uint32("node", n.id()).Msg("could not restore snapshot")
 		}
-		// we expect a proposal message
-		if cmd, ok := msg.(AppendRPC); ok {
+		n.log.snapshot.data = data
+	}
+	// the node has been part of the terms of its log
+	if _, term := n.log.last(); term > n.term {
+		n.term = term
+	}
+}
 
-			err := appendRPC(stMachine, cmd)
+func (n *node) id() uint32 {
+	return n.member.Cluster().ID
+}
 
-			if err != nil {
-				return nil, err
-			}
+// message creates a message from the node, for the given recipient or for all nodes, if zero
+func (n *node) message(to uint32, content interface{}) network.Message {
+	return network.Message{
+		Source:    n.id(),
+		RoutingID: to,
+		Type:      network.RPC,
+		Content:   content,
+	}
+}
 
-			updateStateMachine(state, stMachine)
+// send passes the messages to the cluster
+func (n *node) send(messages []network.Message) {
+	for _, msg := range messages {
+		n.member.Cluster().Internal.Send(msg)
+	}
+}
 
-			return ResponseRPC{
-				HeartBeat: cmd.HeartBeat,
-				response:  network.Response{},
-			}, nil
-		}
-		return nil, fmt.Errorf("unexpected message received for proposal confirmation '%v'", reflect.TypeOf(msg))
+// majority checks if the given number of nodes, including the node itself, is a majority of the cluster
+func (n *node) majority(count int) bool {
+	return 2*count > n.size
+}
+
+// resetTimeout draws a new election timeout
+func (n *node) resetTimeout() {
+	n.elapsed = 0
+	n.timeout = electionTicks + n.member.Cluster().Internal.Rand().Intn(electionTicks)
+}
+
+// observe moves the node to a newer term, as a follower
+func (n *node) observe(term int) []network.Message {
+	if term <= n.term {
+		return nil
+	}
+	n.term = term
+	n.votedFor = 0
+	n.leader = 0
+	return n.stepDown()
+}
+
+// stepDown turns the node into a follower
+// the requests that the node was serving as a leader are failed, although their states might still be committed by the next leader.
+func (n *node) stepDown() []network.Message {
+	wasLeader := n.role == leader
+	n.role = follower
+	if !wasLeader {
+		return nil
+	}
+	log.Debug().Uint32("node", n.id()).Int("term", n.term).Msg("step down")
+	indexes := make([]int64, 0, len(n.pending))
+	for index := range n.pending {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
 	})
+	out := make([]network.Message, 0)
+	for _, index := range indexes {
+		out = append(out, n.reply(n.pending[index], network.Response{Err: fmt.Errorf("could not commit state '%d': %w", index, errNotLeader)})...)
+	}
+	n.pending = make(map[int64]*request)
+	return out
+}
 
-	// leader phase1 processing logic
-	processor.Promise(func(state *network.State, storage storage.Storage, msg interface{}) (interface{}, error) {
-		// we are doing the same work as the follower in the previous step
-		// e.g. appending to our log the same as the follower did, so that we are fully aligned!
-		// create our stateMachine if not already created
-		if _, ok := state.Log[""]; !ok {
-			state.Log[""] = newStateMachine()
-		}
+// follow sets the leader of the current term, and releases the requests that were waiting for one
+func (n *node) follow(leaderID uint32) {
+	n.leader = leaderID
+	for _, future := range n.elected {
+		future.Complete(network.Response{Leader: leaderID})
+	}
+	n.elected = nil
+}
 
-		// we expect a proposal message
-		if cmd, ok := msg.(AppendRPC); ok {
-			wal := state.Log[""]
-			if stateMachine, ok := wal.(*stateMachine); ok {
+// tick moves the clock of the node
+// the leader sends its heartbeat on every tick, while the followers start an election, if they have not heard from it for long.
+func (n *node) tick() []network.Message {
+	if n.timeout == 0 {
+		n.resetTimeout()
+	}
+	if n.role == leader {
+		n.behind = make(map[uint32]bool)
+		return []network.Message{n.heartbeat()}
+	}
+	n.elapsed++
+	if n.elapsed < n.timeout {
+		return nil
+	}
+	return n.campaign()
+}
 
-				err := appendRPC(stateMachine, cmd)
+// campaign starts an election for the next term
+func (n *node) campaign() []network.Message {
+	n.term++
+	n.role = candidate
+	n.votedFor = n.id()
+	n.leader = 0
+	n.votes = map[uint32]bool{n.id(): true}
+	n.resetTimeout()
+	log.Debug().Uint32("node", n.id()).Int("term", n.term).Msg("start election")
+	if n.majority(len(n.votes)) {
+		return n.lead()
+	}
+	index, term := n.log.last()
+	return []network.Message{n.message(0, VoteRPC{
+		term:         n.term,
+		candidate:    n.id(),
+		lastLogIndex: index,
+		lastLogTerm:  term,
+	})}
+}
 
-				if err != nil {
-					return nil, err
-				}
+// lead turns the candidate into the leader of its term
+// the leader appends an empty state for its term, so that the states of the previous terms get committed along with it.
+func (n *node) lead() []network.Message {
+	log.Debug().Uint32("node", n.id()).Int("term", n.term).Msg("elected leader")
+	n.role = leader
+	n.follow(n.id())
+	n.next = make(map[uint32]int64)
+	n.match = make(map[uint32]int64)
+	n.behind = make(map[uint32]bool)
+	out, err := n.propose(nil, nil)
+	if err != nil {
+		log.Err(err).Uint32("node", n.id()).Msg("could not append state for the new term")
+	}
+	return out
+}
 
-				state.Log[""] = stateMachine
+// vote decides on the vote request of a candidate
+// the vote goes to the first candidate of the term, with a log at least as up-to-date as the one of the node.
+func (n *node) vote(rpc VoteRPC) []network.Message {
+	out := n.observe(rpc.term)
+	index, term := n.log.last()
+	upToDate := rpc.lastLogTerm > term || (rpc.lastLogTerm == term && rpc.lastLogIndex >= index)
+	granted := rpc.term == n.term && (n.votedFor == 0 || n.votedFor == rpc.candidate) && upToDate
+	if granted {
+		n.votedFor = rpc.candidate
+		n.resetTimeout()
+	}
+	return append(out, n.message(rpc.candidate, BallotRPC{
+		term:    n.term,
+		from:    n.id(),
+		granted: granted,
+	}))
+}
 
-				return ResponseRPC{
-					HeartBeat: cmd.HeartBeat,
-					response:  network.Response{},
-				}, nil
-			}
-			return nil, fmt.Errorf("could not retrieve state machine '%v'", reflect.TypeOf(wal))
-		}
-		return nil, fmt.Errorf("unexpected message received for proposal confirmation '%v'", reflect.TypeOf(msg))
+// count adds the vote to the ones of the candidate
+func (n *node) count(rpc BallotRPC) []network.Message {
+	if rpc.term > n.term {
+		return n.observe(rpc.term)
+	}
+	if n.role != candidate || rpc.term != n.term || !rpc.granted {
+		return nil
+	}
+	n.votes[rpc.from] = true
+	if n.majority(len(n.votes)) {
+		return n.lead()
+	}
+	return nil
+}
+
+// heartbeat creates the append RPC without any entries, for all the followers
+func (n *node) heartbeat() network.Message {
+	index, term := n.log.last()
+	return n.message(0, AppendRPC{
+		HeartBeat: HeartBeat{
+			Epoch: Epoch{term: n.term, leaderID: n.id()},
+			Log: Log{
+				prevLogIndex: index,
+				prevLogTerm:  int64(term),
+				logIndex:     index,
+			},
+		},
+		commitIndex: n.log.commitIndex,
 	})
+}
 
-	// follower phase 2 processing logic
-	processor.Commit(func(state *network.State, store storage.Storage, msg interface{}) (interface{}, error) {
-		// for ease of use, we skip another verify at this stage
-		// we assume the leader is 'sane' in the sense that it will adhere to the protocol
-		if heartbeat, ok := msg.(ResponseRPC); ok {
-			wal := state.Log[""]
-
-			if stateMachine, ok := wal.(*stateMachine); ok {
-				// get all the pending entries from the state machine and commit them to the store
-				for i := state.Index; i <= heartbeat.logIndex; i++ {
-					resp := network.Execute(store, stateMachine.states[i].cmd)
-					if resp.Err == nil {
-						stateMachine.states[i].committed = true
-					}
-				}
-
-				stateMachine.commitIndex = heartbeat.logIndex + 1
-
-				state.Log[""] = stateMachine
-
-				return ResponseRPC{
-					response: network.Response{
-						Element: storage.Nil,
-					},
-				}, nil
-			}
-			return nil, fmt.Errorf("could not retrieve state machine '%v'", reflect.TypeOf(wal))
+// replicate creates the append RPC for the states of the log from the given index
+// the follower gets the snapshot instead, if the states have been compacted.
+func (n *node) replicate(to uint32, from int64) (network.Message, error) {
+	if from <= n.log.snapshot.index {
+		return n.message(to, SnapshotRPC{
+			Epoch:    Epoch{term: n.term, leaderID: n.id()},
+			snapshot: n.log.snapshot,
+		}), nil
+	}
+	entries, err := n.log.entries(from)
+	if err != nil {
+		return network.Void, err
+	}
+	return n.message(to, AppendRPC{
+		HeartBeat: HeartBeat{
+			Epoch: Epoch{term: n.term, leaderID: n.id()},
+			Log: Log{
+				prevLogIndex: from - 1,
+				prevLogTerm:  int64(n.log.term(from - 1)),
+				logIndex:     from - 1 + int64(len(entries)),
+			},
+		},
+		entries:     entries,
+		commitIndex: n.log.commitIndex,
+	}), nil
+}
+
+// propose appends the command to the log of the leader, and sends it to the followers
+func (n *node) propose(cmd network.Command, req *request) ([]network.Message, error) {
+	index, err := n.log.append(n.term, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if req != nil {
+		req.term = n.term
+		n.pending[index] = req
+	}
+	msg, err := n.replicate(0, index)
+	if err != nil {
+		return nil, err
+	}
+	// a single node cluster commits right away
+	return append([]network.Message{msg}, n.advance()...), nil
+}
+
+// heed follows the leader of the RPC, unless it comes from a previous term
+func (n *node) heed(epoch Epoch) ([]network.Message, bool) {
+	out := n.observe(epoch.term)
+	if epoch.term < n.term {
+		return out, false
+	}
+	if n.role != follower {
+		out = append(out, n.stepDown()...)
+	}
+	if n.leader != epoch.leaderID {
+		n.follow(epoch.leaderID)
+	}
+	n.resetTimeout()
+	return out, true
+}
+
+// append processes the append RPC of the leader
+func (n *node) append(rpc AppendRPC) []network.Message {
+	out, ok := n.heed(rpc.Epoch)
+	response := ResponseRPC{
+		HeartBeat: HeartBeat{Epoch: Epoch{term: n.term, leaderID: n.leader}},
+		from:      n.id(),
+	}
+	if !ok {
+		// let the stale leader know of the new term
+		return append(out, n.message(rpc.leaderID, response))
+	}
+
+	if err := n.log.verify(rpc.HeartBeat); err != nil {
+		log.Debug().Err(err).Uint32("node", n.id()).Msg("reject append")
+		// let the leader retry from the end of our log, or from before the conflicting state
+		response.logIndex = rpc.prevLogIndex - 1
+		if size := n.log.size(); size < response.logIndex {
+			response.logIndex = size
 		}
-		return nil, fmt.Errorf("unexpected message received for commit action '%v'", reflect.TypeOf(msg))
-	})
+		return append(out, n.message(rpc.leaderID, response))
+	}
 
-	processor.Confirm(func(state *network.State, store storage.Storage, msg interface{}) (interface{}, error) {
-		if heartbeat, ok := msg.(ResponseRPC); ok {
-			wal := state.Log[""]
+	if err := n.log.merge(rpc); err != nil {
+		log.Err(err).Uint32("node", n.id()).Msg("could not append states")
+		response.logIndex = rpc.prevLogIndex
+		return append(out, n.message(rpc.leaderID, response))
+	}
 
-			if stateMachine, ok := wal.(*stateMachine); ok {
-				// get all the pending entries from the state machine and commit them to the store
-				for i := state.Index; i <= heartbeat.logIndex; i++ {
-					resp := network.Execute(store, stateMachine.states[i].cmd)
-					if resp.Err == nil {
-						stateMachine.states[i].committed = true
-					}
-				}
+	match := rpc.prevLogIndex + int64(len(rpc.entries))
+	if rpc.commitIndex > n.log.commitIndex {
+		commit := rpc.commitIndex
+		if match < commit {
+			commit = match
+		}
+		if commit > n.log.commitIndex {
+			n.log.commitIndex = commit
+			out = append(out, n.apply()...)
+		}
+	}
+
+	response.success = true
+	response.logIndex = match
+	return append(out, n.message(rpc.leaderID, response))
+}
 
-				stateMachine.commitIndex = heartbeat.logIndex + 1
+// acknowledge processes the response of a follower to the append RPC of the leader
+func (n *node) acknowledge(rpc ResponseRPC) ([]network.Message, error) {
+	if rpc.term > n.term {
+		return n.observe(rpc.term), nil
+	}
+	if n.role != leader || rpc.term != n.term {
+		return nil, nil
+	}
+	out := make([]network.Message, 0)
+	if rpc.success {
+		if rpc.logIndex > n.match[rpc.from] {
+			n.match[rpc.from] = rpc.logIndex
+		}
+		n.next[rpc.from] = n.match[rpc.from] + 1
+		out = append(out, n.advance()...)
+	} else {
+		n.next[rpc.from] = rpc.logIndex + 1
+		if n.next[rpc.from] < 1 {
+			n.next[rpc.from] = 1
+		}
+	}
+	// bring the follower up to date, but only once per tick,
+	// as the responses to the states that are still on their way would trigger the same append over and over again
+	if next := n.next[rpc.from]; next <= n.log.size() && !n.behind[rpc.from] {
+		n.behind[rpc.from] = true
+		msg, err := n.replicate(rpc.from, next)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
 
-				state.Log[""] = stateMachine
+// advance moves the commit index of the leader to the last state that is stored on a majority of the cluster
+// only the states of the current term are counted, as the ones of the previous terms might still be replaced by another leader,
+// even if they are stored on a majority (see section 5.4.2 of the paper). They get committed along with the first state of the current term.
+func (n *node) advance() []network.Message {
+	for index := n.log.size(); index > n.log.commitIndex; index-- {
+		if n.log.term(index) != n.term {
+			break
+		}
+		count := 1
+		for _, match := range n.match {
+			if match >= index {
+				count++
+			}
+		}
+		if n.majority(count) {
+			n.log.commitIndex = index
+			return n.apply()
+		}
+	}
+	return nil
+}
 
-				return ResponseRPC{
-					response: network.Response{
-						Element: storage.Nil,
-					},
-				}, nil
+// apply executes the committed states on the storage of the node, and replies to the requests that wait for them
+func (n *node) apply() []network.Message {
+	out := make([]network.Message, 0)
+	for n.lastApplied < n.log.commitIndex {
+		index := n.lastApplied + 1
+		state, err := n.log.state(index)
+		if err != nil {
+			log.Err(err).Uint32("node", n.id()).Msg("could not apply state")
+			return out
+		}
+		response := network.Response{}
+		if state.cmd != nil {
+			response = network.Execute(n.member.Store(), state.cmd)
+			n.written.add(state.cmd)
+		}
+		state.committed = true
+		n.lastApplied = index
+		if req, ok := n.pending[index]; ok {
+			delete(n.pending, index)
+			if req.term != state.term {
+				response = network.Response{Err: fmt.Errorf("state '%d' was replaced: %w", index, errNotLeader)}
 			}
-			return nil, fmt.Errorf("could not retrieve state machine '%v'", reflect.TypeOf(wal))
+			out = append(out, n.reply(req, response)...)
+		}
+	}
+	if n.lastApplied-n.log.snapshot.index >= snapshotThreshold {
+		if err := n.compact(); err != nil {
+			log.Err(err).Uint32("node", n.id()).Msg("could not compact log")
 		}
-		return nil, fmt.Errorf("unexpected message received for commit confirmation '%v'", reflect.TypeOf(msg))
+	}
+	return out
+}
+
+// compact takes a snapshot of the storage, and removes the applied states from the log
+func (n *node) compact() error {
+	data, err := takeSnapshot(n.member.Store(), n.written)
+	if err != nil {
+		return err
+	}
+	return n.log.compact(Snapshot{
+		index: n.lastApplied,
+		term:  n.log.term(n.lastApplied),
+		data:  data,
 	})
+}
 
-	return network.ConsensusProtocol(*processor)
+// install replaces the state of the follower with the snapshot of the leader
+func (n *node) install(rpc SnapshotRPC) []network.Message {
+	out, ok := n.heed(rpc.Epoch)
+	response := ResponseRPC{
+		HeartBeat: HeartBeat{Epoch: Epoch{term: n.term, leaderID: n.leader}},
+		from:      n.id(),
+	}
+	if !ok {
+		return append(out, n.message(rpc.leaderID, response))
+	}
+	// the follower might have caught up in the meantime
+	if rpc.snapshot.index > n.log.commitIndex {
+		log.Debug().Uint32("node", n.id()).Int64("index", rpc.snapshot.index).Msg("install snapshot")
+		err := restoreSnapshot(n.member.Store(), n.written, rpc.snapshot.data)
+		if err == nil {
+			err = n.log.install(rpc.snapshot)
+		}
+		if err != nil {
+			log.Err(err).Uint32("node", n.id()).Msg("could not install snapshot")
+			response.logIndex = n.log.commitIndex
+			return append(out, n.message(rpc.leaderID, response))
+		}
+		n.lastApplied = rpc.snapshot.index
+	}
+	response.success = true
+	response.logIndex = rpc.snapshot.index
+	return append(out, n.message(rpc.leaderID, response))
 }
 
-func appendRPC(stateMachine *stateMachine, cmd AppendRPC) error {
-	err := stateMachine.verify(cmd.HeartBeat)
+// reply passes the response to the request, along with the leader of the cluster
+func (n *node) reply(req *request, response network.Response) []network.Message {
+	response.Leader = n.leader
+	if req.future != nil {
+		req.future.Complete(response)
+		return nil
+	}
+	return []network.Message{n.message(req.from, ResultRPC{id: req.id, response: response})}
+}
 
-	if err != nil {
-		return fmt.Errorf("inconsistent node state: %w", err)
+// forward processes a command forwarded by a follower
+func (n *node) forward(from uint32, rpc ForwardRPC) ([]network.Message, error) {
+	req := &request{from: from, id: rpc.id}
+	if n.role != leader {
+		return n.reply(req, network.Response{Err: errNotLeader}), nil
 	}
+	return n.propose(rpc.command, req)
+}
 
-	// add the new state
-	stateMachine.append(cmd)
+// result completes the forwarded request of the follower
+func (n *node) result(rpc ResultRPC) {
+	if future, ok := n.forwarded[rpc.id]; ok {
+		delete(n.forwarded, rpc.id)
+		future.Complete(rpc.response)
+	}
+}
 
-	return nil
+// serve executes the client command
+// the leader appends the command to the log, while the followers forward it to the leader,
+// and both wait until the command is committed and applied. Reads go through the log too, so that they are linearizable.
+func (n *node) serve(cmd network.Command) network.Response {
+	// wait at most once for an election
+	for attempt := 0; attempt < 2; attempt++ {
+		future := n.member.Cluster().Internal.Future()
+
+		n.mutex.Lock()
+		switch {
+		case n.role == leader:
+			out, err := n.propose(cmd, &request{future: future})
+			n.mutex.Unlock()
+			if err != nil {
+				return network.Response{Err: err, Leader: n.id()}
+			}
+			n.send(out)
+			return n.await(future, 0)
+		case n.leader != 0:
+			n.requests++
+			id := n.requests
+			n.forwarded[id] = future
+			msg := n.message(n.leader, ForwardRPC{id: id, command: cmd})
+			n.mutex.Unlock()
+			n.send([]network.Message{msg})
+			return n.await(future, id)
+		default:
+			n.elected = append(n.elected, future)
+			n.mutex.Unlock()
+			if _, ok := future.Wait(2 * electionTicks * tick); !ok {
+				return network.Response{Err: errNoLeader}
+			}
+		}
+	}
+	return network.Response{Err: errNoLeader}
 }
 
-func retrieveStatMachine(state *network.State) (*stateMachine, error) {
-	if _, ok := state.Log[""]; !ok {
-		state.Log[""] = newStateMachine()
+// await waits for the result of the command
+func (n *node) await(future *network.Future, forwarded uint32) network.Response {
+	response, ok := future.Wait(requestTimeout)
+	if ok {
+		return response
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if forwarded > 0 {
+		delete(n.forwarded, forwarded)
 	}
+	return network.Response{Err: errTimeout, Leader: n.leader}
+}
+
+// process handles the messages of the cluster for the node
+func (n *node) process(members int, msg network.Message) ([]network.Message, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
 
-	wal := state.Log[""]
-	if stMachine, ok := wal.(*stateMachine); ok {
-		return stMachine, nil
+	// the cluster size is fixed, even if the switch takes nodes out of the network
+	if members > n.size {
+		n.size = members
+	}
+
+	switch msg.Type {
+	case network.Tick:
+		return n.tick(), nil
+	case network.RPC:
+		switch rpc := msg.Content.(type) {
+		case AppendRPC:
+			return n.append(rpc), nil
+		case SnapshotRPC:
+			return n.install(rpc), nil
+		case ResponseRPC:
+			return n.acknowledge(rpc)
+		case VoteRPC:
+			return n.vote(rpc), nil
+		case BallotRPC:
+			return n.count(rpc), nil
+		case ForwardRPC:
+			return n.forward(msg.Source, rpc)
+		case ResultRPC:
+			n.result(rpc)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected message received '%v'", reflect.TypeOf(msg.Content))
 	}
-	return nil, fmt.Errorf("could not verify state machine: %v", reflect.TypeOf(wal))
+	return nil, nil
+}
+
+// Protocol implements the internal cluster communication requirements,
+// e.g. the leader election and the log replication from the leader to the followers
+// the nodes keep their log in memory.
+func Protocol() network.ProtocolFactory {
+	return protocol(nil)
+}
+
+// DurableProtocol is the raft protocol with the log of every node in a file of the given directory
+// so that a node restores its log, when it restarts.
+func DurableProtocol(dir string) network.ProtocolFactory {
+	return protocol(network.FileWALFactory(dir, codec{}))
 }
 
-func updateStateMachine(state *network.State, stMachine *stateMachine) {
-	state.Log[""] = stMachine
+func protocol(newWAL network.WALFactory) network.ProtocolFactory {
+
+	processor := network.ProcessorFactory(nil).
+		WAL(newWAL).
+		Client(func(state *network.State, member *network.StorageNode, cmd network.Command) network.Response {
+			n, err := retrieveNode(state, member)
+			if err != nil {
+				return network.Response{Err: err}
+			}
+			return n.serve(cmd)
+		})
+
+	return func(id uint32) (*network.Internal, *network.Peer) {
+		internal, peer := network.Protocol(id, nil, func(members int, storage network.Storage, msg network.Message) network.Message {
+			member, ok := storage.(*network.StorageNode)
+			if !ok {
+				return network.Void
+			}
+			n, err := retrieveNode(member.State(), member)
+			if err != nil {
+				log.Err(err).Msg("cannot process message")
+				return network.Void
+			}
+			out, err := n.process(members, msg)
+			if err != nil {
+				log.Err(err).Uint32("node", member.Cluster().ID).Msg("cannot process message")
+			}
+			n.send(out)
+			// all messages are sent above
+			return network.Void
+		}, *processor)
+		internal.Tick(tick)
+		return internal, peer
+	}
 }
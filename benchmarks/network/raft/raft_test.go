@@ -1,7 +1,9 @@
 package raft
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
 	"github.com/drakos74/lachesis/benchmarks/network/lb"
@@ -53,3 +55,194 @@ func TestNetwork_SimpleNodeDownEvent(t *testing.T) {
 func TestNetwork_LeaderNodeDownEvent(t *testing.T) {
 	new(test.FailureRate).Run(t, newRaftNetwork(network.NewNodeDownEvent(0, 30)), test.Limit{})
 }
+
+// the leader cannot reach consensus, while half of the followers are partitioned away
+func TestNetwork_SimulatedFaults(t *testing.T) {
+	seed := network.Seed()
+
+	simulate := func() network.Report {
+		return network.Factory().
+			Router(lb.LeaderFollowerPartition).
+			Storage(mem.SyncCacheFactory).
+			Nodes(10).
+			Protocol(Protocol()).
+			Faults(
+				network.At(100, network.Delay(0, 20*time.Millisecond)).For(100),
+				network.At(200, network.Partition([]int{0, 1, 2, 3, 4})).For(50),
+			).
+			Simulate(seed).
+			Run(network.Workload{Clients: 500, KeySize: 10, ValueSize: 100, Interval: 1000})
+	}
+
+	report := simulate()
+	t.Log(report)
+
+	assert.True(t, report.WriteErrors > 0, "replay with %s=%d", network.SeedVariable, seed)
+	assert.Equal(t, report, simulate(), "replay with %s=%d", network.SeedVariable, seed)
+}
+
+// the cluster elects a new leader, while its nodes crash one after the other
+// only the requests that were waiting on the crashed leader should fail
+func TestNetwork_SimulatedLeaderElection(t *testing.T) {
+	seed := network.Seed()
+
+	simulate := func() network.Report {
+		return network.Factory().
+			Router(lb.LeaderFollowerPartition).
+			Storage(mem.SyncCacheFactory).
+			Nodes(5).
+			Protocol(Protocol()).
+			Faults(
+				network.At(100, network.Crash(0)).For(100),
+				network.At(250, network.Crash(1)).For(100),
+				network.At(400, network.Crash(2)).For(100),
+				network.At(550, network.Crash(3)).For(100),
+				network.At(700, network.Crash(4)).For(100),
+			).
+			Simulate(seed).
+			Run(network.Workload{Clients: 1000, KeySize: 10, ValueSize: 100, Interval: 10000})
+	}
+
+	report := simulate()
+	t.Log(report)
+
+	assert.True(t, report.WriteErrorRate() < 5, "replay with %s=%d", network.SeedVariable, seed)
+	assert.Equal(t, report, simulate(), "replay with %s=%d", network.SeedVariable, seed)
+}
+
+// the nodes restart one after the other with their durable log, and rejoin the cluster
+func TestNetwork_SimulatedRestart(t *testing.T) {
+	seed := network.Seed()
+
+	report := network.Factory().
+		Router(lb.LeaderFollowerPartition).
+		Storage(mem.SyncCacheFactory).
+		Nodes(5).
+		Protocol(DurableProtocol(t.TempDir())).
+		Faults(
+			network.At(100, network.Restart(0)).For(100),
+			network.At(250, network.Restart(1)).For(100),
+			network.At(400, network.Restart(2)).For(100),
+		).
+		Simulate(seed).
+		Run(network.Workload{Clients: 500, KeySize: 10, ValueSize: 100, Interval: 10000})
+	t.Log(report)
+
+	assert.True(t, report.WriteErrorRate() < 5, "replay with %s=%d", network.SeedVariable, seed)
+}
+
+func newNode(t *testing.T, size int) *node {
+	member, ok := network.Node(mem.CacheFactory, Protocol()).(*network.StorageNode)
+	assert.True(t, ok)
+	n, err := retrieveNode(member.State(), member)
+	assert.NoError(t, err)
+	n.size = size
+	return n
+}
+
+// a node with a durable log restores its states, when it restarts
+func TestNode_Restart(t *testing.T) {
+	dir := t.TempDir()
+	member, ok := network.Node(mem.CacheFactory, DurableProtocol(dir)).(*network.StorageNode)
+	assert.True(t, ok)
+	n, err := retrieveNode(member.State(), member)
+	assert.NoError(t, err)
+
+	elements := make([]storage.Element, 0)
+	for i := 0; i < 10; i++ {
+		element := storage.NewElement([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+		_, err := n.log.append(i/3+1, network.NewPut(element))
+		assert.NoError(t, err)
+		elements = append(elements, element)
+	}
+	// the first states are applied and compacted
+	for _, element := range elements[:4] {
+		network.Execute(member.Store(), network.NewPut(element))
+	}
+	n.log.commitIndex = 4
+	n.lastApplied = 4
+	err = n.compact()
+	assert.NoError(t, err)
+
+	// restart the node with its storage, as the Restart fault does
+	wal, ok := member.State().WAL.(*network.FileWAL)
+	assert.True(t, ok)
+	err = wal.Close()
+	assert.NoError(t, err)
+	restored, err := network.FileWALFactory(dir, codec{})(member.Cluster().ID)
+	assert.NoError(t, err)
+	*member.State() = network.NewState(restored)
+
+	n, err = retrieveNode(member.State(), member)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), n.log.size())
+	assert.Equal(t, int64(4), n.log.snapshot.index)
+	assert.Equal(t, int64(4), n.log.commitIndex)
+	assert.Equal(t, int64(4), n.lastApplied)
+	assert.Equal(t, 4, n.term)
+	states, err := n.log.entries(5)
+	assert.NoError(t, err)
+	for i, state := range states {
+		assert.Equal(t, (i+4)/3+1, state.term)
+		assert.Equal(t, int64(i+5), state.index)
+		assert.Equal(t, elements[i+4], state.cmd.Element())
+	}
+
+	// the log continues after the restored states
+	index, err := n.log.append(4, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), index)
+}
+
+func TestNode_Vote(t *testing.T) {
+	n := newNode(t, 3)
+	n.term = 2
+	_, err := n.log.append(2, nil)
+	assert.NoError(t, err)
+
+	ballot := func(out []network.Message) BallotRPC {
+		assert.Equal(t, 1, len(out))
+		b, ok := out[0].Content.(BallotRPC)
+		assert.True(t, ok)
+		return b
+	}
+
+	// the candidate is missing the state of the previous term
+	b := ballot(n.vote(VoteRPC{term: 3, candidate: 1}))
+	assert.False(t, b.granted)
+	assert.Equal(t, 3, b.term)
+
+	b = ballot(n.vote(VoteRPC{term: 3, candidate: 2, lastLogIndex: 1, lastLogTerm: 2}))
+	assert.True(t, b.granted)
+
+	// only one vote per term
+	b = ballot(n.vote(VoteRPC{term: 3, candidate: 3, lastLogIndex: 1, lastLogTerm: 2}))
+	assert.False(t, b.granted)
+
+	b = ballot(n.vote(VoteRPC{term: 4, candidate: 3, lastLogIndex: 1, lastLogTerm: 2}))
+	assert.True(t, b.granted)
+}
+
+// the leader does not commit the states of previous terms by counting their replicas
+// see figure 8 of the raft paper
+func TestNode_CommitRule(t *testing.T) {
+	n := newNode(t, 5)
+	for i := 0; i < 2; i++ {
+		_, err := n.log.append(2, nil)
+		assert.NoError(t, err)
+	}
+
+	n.term = 3
+	n.role = leader
+	n.match = map[uint32]int64{1: 2, 2: 2}
+	n.advance()
+	assert.Equal(t, int64(0), n.log.commitIndex)
+
+	// once a state of the current term is on a majority, all previous ones are committed along with it
+	_, err := n.log.append(3, nil)
+	assert.NoError(t, err)
+	n.match = map[uint32]int64{1: 3, 2: 3}
+	n.advance()
+	assert.Equal(t, int64(3), n.log.commitIndex)
+	assert.Equal(t, int64(3), n.lastApplied)
+}
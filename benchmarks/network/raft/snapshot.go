@@ -0,0 +1,91 @@
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/drakos74/lachesis/benchmarks/network"
+	"github.com/drakos74/lachesis/benchmarks/store"
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
+)
+
+// Snapshot is the state of the storage of a node, after applying all the states of the log up to its index
+// it replaces these states in the log, as well as the states of the followers, that have fallen too far behind.
+type Snapshot struct {
+	index int64
+	term  int
+	// data is the content of the storage in the snapshot stream format of the store package
+	data []byte
+}
+
+// keys tracks the keys written to the storage of the node
+// so that a snapshot can be taken from the storages that cannot list their elements.
+type keys map[string]struct{}
+
+// add tracks the key of a command, if it writes to the storage
+func (k keys) add(cmd network.Command) {
+	if cmd != nil && cmd.Type() == network.Put {
+		k[string(cmd.Element().Key)] = struct{}{}
+	}
+}
+
+// sorted returns the keys in order, so that the snapshot is the same for the same elements
+func (k keys) sorted() []string {
+	sorted := make([]string, 0, len(k))
+	for key := range k {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// takeSnapshot writes the elements of the storage in the snapshot stream format
+// the storages that implement lstore.Snapshotter write their own snapshot, for the rest the elements are read one by one.
+func takeSnapshot(s storage.Storage, written keys) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if snapshotter, ok := s.(lstore.Snapshotter); ok {
+		if err := snapshotter.Snapshot(buffer); err != nil {
+			return nil, fmt.Errorf("could not take snapshot: %w", err)
+		}
+		return buffer.Bytes(), nil
+	}
+	elements := make([]lstore.Element, 0, len(written))
+	for _, key := range written.sorted() {
+		element, err := s.Get(storage.Key(key))
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not take snapshot: %w", err)
+		}
+		elements = append(elements, lstore.NewElement(element.Key, element.Value))
+	}
+	err := lstore.WriteSnapshot(buffer, lstore.NewCursor(elements))
+	if err != nil {
+		return nil, fmt.Errorf("could not take snapshot: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// restoreSnapshot adds the elements of the snapshot to the storage
+// as the commands only ever write elements, adding them on top of the older state of a follower results in the state of the snapshot.
+func restoreSnapshot(s storage.Storage, written keys, data []byte) error {
+	elements, err := lstore.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not read snapshot: %w", err)
+	}
+	for _, element := range elements {
+		written[string(element.Key)] = struct{}{}
+	}
+	if snapshotter, ok := s.(lstore.Snapshotter); ok {
+		return snapshotter.Restore(bytes.NewReader(data))
+	}
+	for _, element := range elements {
+		if err := s.Put(storage.NewElement(element.Key, element.Value)); err != nil {
+			return fmt.Errorf("could not restore snapshot: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package raft
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/drakos74/lachesis/benchmarks/network"
+	"github.com/drakos74/lachesis/benchmarks/network/lb"
+	"github.com/drakos74/lachesis/store/app/storage"
+	"github.com/drakos74/lachesis/store/io/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot_Storage(t *testing.T) {
+
+	source := mem.CacheFactory()
+	written := make(keys)
+	for i := 0; i < 10; i++ {
+		cmd := network.NewPut(storage.NewElement([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))))
+		network.Execute(source, cmd)
+		written.add(cmd)
+	}
+
+	data, err := takeSnapshot(source, written)
+	assert.NoError(t, err)
+
+	target := mem.CacheFactory()
+	restored := make(keys)
+	err = restoreSnapshot(target, restored, data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, written, restored)
+	for key := range written {
+		expected, err := source.Get(storage.Key(key))
+		assert.NoError(t, err)
+		element, err := target.Get(storage.Key(key))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, element)
+	}
+
+	err = restoreSnapshot(target, restored, data[:len(data)-1])
+	assert.Error(t, err)
+
+}
+
+// a follower that restarts without its state, catches up from the snapshot of the leader,
+// as the leader has compacted its log in the meantime
+func TestNetwork_SimulatedSnapshotInstall(t *testing.T) {
+	seed := network.Seed()
+
+	nodes := make([]*network.StorageNode, 0)
+	sim := network.Factory().
+		Router(lb.LeaderFollowerPartition).
+		Storage(mem.SyncCacheFactory).
+		Nodes(5).
+		Protocol(Protocol()).
+		Node(func(newStorage storage.StorageFactory, newCluster network.ProtocolFactory) network.Storage {
+			node := network.Node(newStorage, newCluster)
+			if n, ok := node.(*network.StorageNode); ok {
+				nodes = append(nodes, n)
+			}
+			return node
+		}).
+		Faults(network.At(20, network.Crash(1)).For(3 * snapshotThreshold)).
+		Simulate(seed)
+
+	elements := make([]storage.Element, 0)
+	sim.Go("client", func() {
+		for i := 0; i < 5*snapshotThreshold; i++ {
+			element := storage.NewElement([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+			if err := sim.Put(element); err == nil {
+				elements = append(elements, element)
+			}
+		}
+	})
+	sim.Simulator.Run(0)
+
+	n, err := retrieveNode(nodes[1].State(), nodes[1])
+	assert.NoError(t, err)
+	assert.True(t, n.log.snapshot.index > 0, "replay with %s=%d", network.SeedVariable, seed)
+
+	// all the elements written before the node came back are part of its state
+	for _, element := range elements[:3*snapshotThreshold] {
+		stored, err := nodes[1].Store().Get(element.Key)
+		assert.NoError(t, err, "replay with %s=%d", network.SeedVariable, seed)
+		assert.Equal(t, element, stored)
+	}
+
+	// the log of every node is compacted
+	for _, node := range nodes {
+		n, err := retrieveNode(node.State(), node)
+		assert.NoError(t, err)
+		assert.True(t, n.log.size()-n.log.snapshot.index <= 2*snapshotThreshold, "replay with %s=%d", network.SeedVariable, seed)
+	}
+}
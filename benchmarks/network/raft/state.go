@@ -1,6 +1,7 @@
 package raft
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"github.com/drakos74/lachesis/benchmarks/network"
@@ -14,51 +15,214 @@ type State struct {
 	committed bool
 }
 
+// stateMachine keeps the states of the node in its write-ahead log
+// the index of a state in the raft log is the same as its index in the write-ahead log, starting from 1.
+// The states up to the index of the snapshot are compacted, and only the snapshot is kept in their place.
 type stateMachine struct {
 	commitIndex int64
-	states      []*State
+	wal         network.WAL
+	snapshot    Snapshot
 }
 
-func newStateMachine() *stateMachine {
-	return &stateMachine{states: make([]*State, 0)}
+// newStateMachine creates the state machine on top of the given log
+// a log that is restored after a restart continues after its compacted states, which were all committed.
+// Their snapshot is not part of the log, so its term is unknown, until the node takes or installs a new one.
+func newStateMachine(wal network.WAL) *stateMachine {
+	sm := &stateMachine{wal: wal}
+	compacted := int64(wal.First()) - 1
+	if wal.First() == 0 {
+		compacted = int64(wal.Last())
+	}
+	if compacted > 0 {
+		sm.snapshot = Snapshot{index: compacted, term: -1}
+		sm.commitIndex = compacted
+	}
+	return sm
 }
 
-func (sm *stateMachine) verify(heartBeat HeartBeat) error {
+// stateHeaderSize is the size of the header of an encoded state
+// [term:8][index:8]
+const stateHeaderSize = 16
 
-	if len(sm.states) == 0 {
-		// accept everything
-		return nil
+// codec encodes the states of the log, for a WAL that is stored in a file
+type codec struct{}
+
+// Encode serializes the state along with its command
+func (codec) Encode(entry interface{}) ([]byte, error) {
+	state, ok := entry.(*State)
+	if !ok {
+		return nil, fmt.Errorf("unexpected entry for raft log: %T", entry)
 	}
-	state := sm.states[len(sm.states)-1]
+	cmd := network.EncodeCommand(state.cmd)
+	b := make([]byte, stateHeaderSize+len(cmd))
+	binary.BigEndian.PutUint64(b[0:8], uint64(state.term))
+	binary.BigEndian.PutUint64(b[8:stateHeaderSize], uint64(state.index))
+	copy(b[stateHeaderSize:], cmd)
+	return b, nil
+}
 
-	if state.term > heartBeat.term {
-		return fmt.Errorf("stale term received '%v' compared to current '%v'", heartBeat.term, state.term)
+// Decode de-serializes a state, that was serialized with Encode
+func (codec) Decode(data []byte) (interface{}, error) {
+	if len(data) < stateHeaderSize {
+		return nil, fmt.Errorf("cannot read raft state from %d bytes", len(data))
 	}
+	cmd, err := network.DecodeCommand(data[stateHeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		term:  int(binary.BigEndian.Uint64(data[0:8])),
+		index: int64(binary.BigEndian.Uint64(data[8:stateHeaderSize])),
+		cmd:   cmd,
+	}, nil
+}
 
-	var index int
-	for i := len(sm.states) - 1; i >= 0; i-- {
-		st := sm.states[i]
-		// find previous log entry in our own state machine
-		if st.index == heartBeat.prevLogIndex &&
-			st.term == heartBeat.term {
-			index = i
-			break
-		}
+// size returns the number of states
+func (sm *stateMachine) size() int64 {
+	return int64(sm.wal.Last())
+}
+
+// state returns the state at the given index
+func (sm *stateMachine) state(i int64) (*State, error) {
+	entry, err := sm.wal.Get(uint64(i))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve state '%d': %w", i, err)
+	}
+	state, ok := entry.(*State)
+	if !ok {
+		return nil, fmt.Errorf("unexpected entry in log at '%d': %T", i, entry)
 	}
+	return state, nil
+}
+
+// term returns the term of the state at the given index
+// the index 0 stands for the empty log, before the first state.
+func (sm *stateMachine) term(i int64) int {
+	if i <= 0 {
+		return 0
+	}
+	if i == sm.snapshot.index {
+		return sm.snapshot.term
+	}
+	state, err := sm.state(i)
+	if err != nil {
+		return -1
+	}
+	return state.term
+}
 
-	// delete any preceding entries
-	sm.states = sm.states[0 : index+1]
+// last returns the index and the term of the last state
+func (sm *stateMachine) last() (int64, int) {
+	size := sm.size()
+	return size, sm.term(size)
+}
 
+// verify checks that the log contains the state at the previous index of the heartbeat, with the same term
+// i.e. that the log matches the one of the leader up to that point.
+func (sm *stateMachine) verify(heartBeat HeartBeat) error {
+	// the states of the snapshot are committed, so they match the ones of any leader
+	if heartBeat.prevLogIndex < sm.snapshot.index {
+		return nil
+	}
+	if heartBeat.prevLogIndex > sm.size() {
+		return fmt.Errorf("missing state at '%d' in log of size '%d'", heartBeat.prevLogIndex, sm.size())
+	}
+	if term := sm.term(heartBeat.prevLogIndex); int64(term) != heartBeat.prevLogTerm {
+		return fmt.Errorf("inconsistent term at '%d': '%d' compared to '%d'", heartBeat.prevLogIndex, heartBeat.prevLogTerm, term)
+	}
 	return nil
 }
 
-func (sm *stateMachine) append(cmd AppendRPC) {
+// merge adds the states of the append RPC after its previous index
+// any conflicting state, along with all that follow it, is removed before. States that are already in the log are skipped,
+// so that a stale or duplicate RPC does not remove the ones that follow.
+func (sm *stateMachine) merge(cmd AppendRPC) error {
+	for i, state := range cmd.entries {
+		index := cmd.prevLogIndex + int64(i) + 1
+		if index <= sm.snapshot.index {
+			continue
+		}
+		if index <= sm.size() {
+			if sm.term(index) == state.term {
+				continue
+			}
+			if index <= sm.commitIndex {
+				return fmt.Errorf("cannot remove committed state at '%d'", index)
+			}
+			err := sm.wal.Truncate(uint64(index))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := sm.wal.Append(&State{
+			term:  state.term,
+			index: index,
+			cmd:   state.cmd,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	sm.states = append(sm.states, &State{
-		term:      cmd.term,
-		index:     cmd.logIndex,
-		cmd:       cmd.command,
-		committed: false,
+// append adds a new state for the command at the end of the log, and returns its index
+func (sm *stateMachine) append(term int, cmd network.Command) (int64, error) {
+	index := sm.size() + 1
+	_, err := sm.wal.Append(&State{
+		term:  term,
+		index: index,
+		cmd:   cmd,
 	})
+	return index, err
+}
+
+// entries returns the states from the given index to the end of the log
+func (sm *stateMachine) entries(from int64) ([]*State, error) {
+	if from <= sm.snapshot.index {
+		return nil, fmt.Errorf("states from '%d' are compacted up to '%d'", from, sm.snapshot.index)
+	}
+	states := make([]*State, 0)
+	for i := from; i <= sm.size(); i++ {
+		state, err := sm.state(i)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
 
+// compact replaces the states up to the index of the snapshot with the snapshot
+func (sm *stateMachine) compact(snapshot Snapshot) error {
+	if snapshot.index <= sm.snapshot.index {
+		return nil
+	}
+	if snapshot.index > sm.commitIndex {
+		return fmt.Errorf("cannot compact uncommitted state at '%d'", snapshot.index)
+	}
+	if err := sm.wal.Compact(uint64(snapshot.index)); err != nil {
+		return fmt.Errorf("could not compact log up to '%d': %w", snapshot.index, err)
+	}
+	sm.snapshot = snapshot
+	return nil
+}
+
+// install replaces the log with the snapshot of the leader
+// the states that follow the snapshot are kept, if the log contains the last state of the snapshot.
+func (sm *stateMachine) install(snapshot Snapshot) error {
+	if snapshot.index <= sm.commitIndex {
+		return fmt.Errorf("snapshot at '%d' is behind the committed state at '%d'", snapshot.index, sm.commitIndex)
+	}
+	if sm.term(snapshot.index) != snapshot.term {
+		if err := sm.wal.Truncate(uint64(sm.snapshot.index + 1)); err != nil {
+			return fmt.Errorf("could not discard log for snapshot at '%d': %w", snapshot.index, err)
+		}
+	}
+	if err := sm.wal.Compact(uint64(snapshot.index)); err != nil {
+		return fmt.Errorf("could not compact log up to '%d': %w", snapshot.index, err)
+	}
+	sm.snapshot = snapshot
+	sm.commitIndex = snapshot.index
+	return nil
 }
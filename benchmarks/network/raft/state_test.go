@@ -3,15 +3,16 @@ package raft
 import (
 	"testing"
 
+	"github.com/drakos74/lachesis/benchmarks/network"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestStateVerifyAppend(t *testing.T) {
 
-	machine := newStateMachine()
+	machine := newStateMachine(network.NewWAL())
 
 	term := 10
-	for i := 0; i < 10; i++ {
+	for i := int64(0); i < 10; i++ {
 
 		cmd := AppendRPC{
 			HeartBeat: HeartBeat{
@@ -19,96 +20,196 @@ func TestStateVerifyAppend(t *testing.T) {
 					term: term,
 				},
 				Log: Log{
-					prevLogIndex: int64(i) - 1,
-					prevLogTerm:  int64(9),
-					logIndex:     int64(i),
+					prevLogIndex: i,
+					prevLogTerm:  int64(machine.term(i)),
+					logIndex:     i + 1,
 				},
 			},
+			entries: []*State{{term: term}},
 		}
 
 		err := machine.verify(cmd.HeartBeat)
 		assert.NoError(t, err)
 
-		machine.append(cmd)
+		err = machine.merge(cmd)
+		assert.NoError(t, err)
 	}
 
-	assert.Equal(t, 10, len(machine.states))
+	assert.Equal(t, 10, int(machine.size()))
 
-	// now try to roll back some states
-	err := machine.verify(HeartBeat{
-		Epoch: Epoch{
-			term: term,
-		},
-		Log: Log{
-			prevLogIndex: 5,
-			prevLogTerm:  9,
-			logIndex:     5,
+	// a new leader replaces the states after index 5
+	cmd := AppendRPC{
+		HeartBeat: HeartBeat{
+			Epoch: Epoch{
+				term: term + 1,
+			},
+			Log: Log{
+				prevLogIndex: 5,
+				prevLogTerm:  int64(term),
+				logIndex:     6,
+			},
 		},
-	})
+		entries: []*State{{term: term + 1}},
+	}
 
+	err := machine.verify(cmd.HeartBeat)
+	assert.NoError(t, err)
+	err = machine.merge(cmd)
 	assert.NoError(t, err)
-	assert.Equal(t, 6, len(machine.states))
+	assert.Equal(t, 6, int(machine.size()))
 
-	assert.Equal(t, machine.states[len(machine.states)-1], &State{
-		term:  10,
-		index: 5,
+	state, err := machine.state(machine.size())
+	assert.NoError(t, err)
+	assert.Equal(t, state, &State{
+		term:  11,
+		index: 6,
 	})
 
 }
 
 func TestStateMachine_VerifyOverflow(t *testing.T) {
 
-	machine := newStateMachine()
+	machine := newStateMachine(network.NewWAL())
+
+	preFillStates(t, machine, 10, 10, 10, 10)
 
-	preFillStates(machine, 2, 3, 4, 5, 6, 7)
+	// the log does not contain the previous state yet
+	err := machine.verify(prevState(5, 10))
+	assert.Error(t, err)
 
-	// Note : newIndex is irrelevant for now
-	err := machine.verify(prevState(5))
+	err = machine.verify(prevState(4, 10))
 	assert.NoError(t, err)
 
-	assert.Equal(t, 4, len(machine.states))
+	// the previous state is there, but comes from another term
+	err = machine.verify(prevState(4, 9))
+	assert.Error(t, err)
+
+	assert.Equal(t, 4, int(machine.size()))
 
 }
 
-func prevState(prevIndex int64) HeartBeat {
-	return HeartBeat{
-		Epoch: Epoch{
-			term: 10,
-		},
-		Log: Log{
-			prevLogIndex: prevIndex,
-			prevLogTerm:  10,
-		},
-	}
+func TestStateMachine_MergeDuplicate(t *testing.T) {
+
+	machine := newStateMachine(network.NewWAL())
+
+	preFillStates(t, machine, 10, 10, 10, 10)
+
+	// a stale append for states that are already in the log, does not remove the ones that follow
+	err := machine.merge(AppendRPC{
+		HeartBeat: prevState(1, 10),
+		entries:   []*State{{term: 10}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, int(machine.size()))
+
 }
 
-func newState(prevIndex, newIndex int64) HeartBeat {
+func TestStateMachine_MergeCommitted(t *testing.T) {
+
+	machine := newStateMachine(network.NewWAL())
+
+	preFillStates(t, machine, 10, 10, 10, 10)
+	machine.commitIndex = 3
+
+	err := machine.merge(AppendRPC{
+		HeartBeat: prevState(2, 10),
+		entries:   []*State{{term: 11}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 4, int(machine.size()))
+
+}
+
+func prevState(prevIndex int64, prevTerm int64) HeartBeat {
 	return HeartBeat{
 		Epoch: Epoch{
-			term: 10,
+			term: 11,
 		},
 		Log: Log{
 			prevLogIndex: prevIndex,
-			prevLogTerm:  10,
-			logIndex:     newIndex,
+			prevLogTerm:  prevTerm,
 		},
 	}
 }
 
-func preFillStates(machine *stateMachine, indexes ...int64) {
+func preFillStates(t *testing.T, machine *stateMachine, terms ...int) {
 
-	for _, index := range indexes {
-		cmd := AppendRPC{
-			HeartBeat: HeartBeat{
-				Epoch: Epoch{
-					term: 10,
-				},
-				Log: Log{
-					logIndex: index,
-				},
-			},
-		}
-		machine.append(cmd)
+	for _, term := range terms {
+		_, err := machine.append(term, nil)
+		assert.NoError(t, err)
 	}
 
 }
+
+func TestStateMachine_Compact(t *testing.T) {
+
+	machine := newStateMachine(network.NewWAL())
+
+	preFillStates(t, machine, 10, 10, 10, 11, 11, 11)
+
+	// only committed states can be compacted
+	err := machine.compact(Snapshot{index: 4, term: 11})
+	assert.Error(t, err)
+
+	machine.commitIndex = 5
+	err = machine.compact(Snapshot{index: 4, term: 11})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 6, int(machine.size()))
+	assert.Equal(t, 11, machine.term(4))
+	_, err = machine.state(3)
+	assert.Error(t, err)
+	_, err = machine.entries(4)
+	assert.Error(t, err)
+	entries, err := machine.entries(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	// the states of the snapshot match the ones of any leader
+	err = machine.verify(prevState(2, 10))
+	assert.NoError(t, err)
+	err = machine.merge(AppendRPC{
+		HeartBeat: prevState(2, 10),
+		entries:   []*State{{term: 10}, {term: 11}, {term: 11}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, int(machine.size()))
+
+	// the log continues after the snapshot
+	index, err := machine.append(12, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, int(index))
+
+}
+
+func TestStateMachine_Install(t *testing.T) {
+
+	machine := newStateMachine(network.NewWAL())
+
+	preFillStates(t, machine, 10, 10, 11, 11)
+	machine.commitIndex = 2
+
+	// the log contains the last state of the snapshot, so the states that follow are kept
+	err := machine.install(Snapshot{index: 3, term: 11})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, int(machine.size()))
+	assert.Equal(t, 3, int(machine.commitIndex))
+	assert.Equal(t, 11, machine.term(4))
+
+	// a snapshot behind the committed states is rejected
+	err = machine.install(Snapshot{index: 2, term: 10})
+	assert.Error(t, err)
+
+	// a snapshot beyond the log replaces it
+	err = machine.install(Snapshot{index: 10, term: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, int(machine.size()))
+	assert.Equal(t, 12, machine.term(10))
+	_, err = machine.state(4)
+	assert.Error(t, err)
+
+	index, err := machine.append(12, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, int(index))
+
+}
@@ -1,6 +1,10 @@
 package network
 
-import "github.com/rs/zerolog/log"
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
 
 // Key represents a generic byte array that is used for being able to partition traffic
 type Key []byte
@@ -15,6 +19,46 @@ type Switch interface {
 	Members() []int
 }
 
+// Leader is implemented by the switches that route the requests to the leader of the cluster
+// the network lets them know of the leader, as reported by the nodes along with their responses.
+type Leader interface {
+	Lead(index int)
+	// Skip lets the switch know that the node is not reachable, so that it routes to another one
+	// which will in turn point to the new leader.
+	Skip(index int)
+}
+
+// leader returns the switch that follows the leader of the cluster, if any, looking through the events that wrap it
+func leader(sw Switch) (Leader, bool) {
+	for sw != nil {
+		if l, ok := sw.(Leader); ok {
+			return l, true
+		}
+		ev, ok := sw.(Event)
+		if !ok {
+			break
+		}
+		sw = ev.Reset()
+	}
+	return nil, false
+}
+
+// skip wraps the routing of the switch, so that a switch following the leader of the cluster
+// moves on to another member, when the routed node is down
+func skip(sw Switch, down func(index int) bool) func(key Key) ([]int, error) {
+	return func(key Key) ([]int, error) {
+		ids, err := sw.Route(key)
+		if l, ok := leader(sw); ok && err == nil {
+			for _, id := range ids {
+				if down(id) {
+					l.Skip(id)
+				}
+			}
+		}
+		return ids, err
+	}
+}
+
 // PartitionStrategy is the factory type for creating a network switch abstraction
 type PartitionStrategy func() Switch
 
@@ -29,19 +73,21 @@ type UnarySwitch struct {
 }
 
 // Route returns the appropriate member for handling the given request based on the given key
-func (u UnarySwitch) Route(key Key) ([]int, error) {
+func (u *UnarySwitch) Route(key Key) ([]int, error) {
 	return []int{0}, nil
 }
 
 // Members returns all the indexes of the current cluster members
-func (u UnarySwitch) Members() []int {
+func (u *UnarySwitch) Members() []int {
 	return []int{0}
 }
 
 // Cluster is the base implementation for the functionality of Register Deregister
 // it keeps a slice of the indexes of the network members
 // and appropriately removes or adds
+// The members are guarded, as the events remove them, while the clients are being routed.
 type Cluster struct {
+	mutex   sync.RWMutex
 	members []int
 }
 
@@ -53,18 +99,26 @@ func NewCluster() Cluster {
 // Register registers a node to the cluster
 func (c *Cluster) Register(id int) {
 	log.Info().Int("Index", id).Msg("Register To Network")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.members = append(c.members, id)
 }
 
 // DeRegister removes a node from the cluster
 func (c *Cluster) DeRegister(id int) {
 	log.Info().Int("Index", id).Msg("De-Register From Network")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	copy(c.members[id:], c.members[id+1:]) // Shift a[i+1:] left one Index.
 	c.members[len(c.members)-1] = 0        // Erase last element (write zero value).
 	c.members = c.members[:len(c.members)-1]
 }
 
-// Members returns the cluster member indexes
+// Members returns a copy of the cluster member indexes
 func (c *Cluster) Members() []int {
-	return c.members
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	members := make([]int, len(c.members))
+	copy(members, c.members)
+	return members
 }
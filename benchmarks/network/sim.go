@@ -0,0 +1,268 @@
+package network
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SeedVariable is the environment variable that fixes the seed of the simulations
+// so that a failing run can be replayed
+const SeedVariable = "LACHESIS_SEED"
+
+// Seed returns the seed for a simulation
+// it is read from the SeedVariable environment variable if present, otherwise a new random seed is generated.
+func Seed() int64 {
+	if s, ok := os.LookupEnv(SeedVariable); ok {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid seed '%s' in %s: %v", s, SeedVariable, err))
+		}
+		return seed
+	}
+	return time.Now().UnixNano()
+}
+
+// task is a unit of work scheduled on the virtual clock of the simulator
+type task struct {
+	at   int64
+	seq  uint64
+	name string
+	run  func()
+	// daemon tasks do not keep the simulation running
+	daemon bool
+}
+
+// tasks is a priority queue of tasks, ordered by their time and by the order they were scheduled in
+type tasks []*task
+
+func (t tasks) Len() int { return len(t) }
+
+func (t tasks) Less(i, j int) bool {
+	if t[i].at == t[j].at {
+		return t[i].seq < t[j].seq
+	}
+	return t[i].at < t[j].at
+}
+
+func (t tasks) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+
+func (t *tasks) Push(x interface{}) { *t = append(*t, x.(*task)) }
+
+func (t *tasks) Pop() interface{} {
+	old := *t
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*t = old[:n-1]
+	return item
+}
+
+// process is a routine that runs under the control of the simulator
+type process struct {
+	resume chan struct{}
+	daemon bool
+}
+
+// Simulator is a single-threaded scheduler on a virtual clock
+// all the activity of a simulation e.g. message deliveries, client operations and events, is scheduled as tasks
+// that run one at a time, in the order of their time and of their scheduling.
+// All random choices are drawn from a single source, so that a run is fully determined by its seed.
+//
+// Periodic activity, like the clock of the nodes, runs as daemon tasks, along with all the tasks and processes they start,
+// so that a simulation ends once only daemon tasks are left.
+type Simulator struct {
+	seed    int64
+	rand    *rand.Rand
+	now     int64
+	seq     uint64
+	tasks   tasks
+	trace   []string
+	running *process
+	// daemon is true while a daemon task or process is running
+	daemon bool
+	// live is the number of scheduled tasks that are not daemons
+	live int
+	// yield is signalled by the running process, when it parks or exits
+	yield chan struct{}
+}
+
+// NewSimulator creates a new simulator for the given seed
+func NewSimulator(seed int64) *Simulator {
+	return &Simulator{
+		seed:  seed,
+		rand:  rand.New(rand.NewSource(seed)),
+		tasks: make(tasks, 0),
+		trace: make([]string, 0),
+		yield: make(chan struct{}),
+	}
+}
+
+// Seed returns the seed of the simulator
+func (s *Simulator) Seed() int64 {
+	return s.seed
+}
+
+// Rand returns the source of randomness of the simulator
+// it must only be used from within the tasks and processes of the simulator
+func (s *Simulator) Rand() *rand.Rand {
+	return s.rand
+}
+
+// Now returns the current virtual time
+func (s *Simulator) Now() int64 {
+	return s.now
+}
+
+// Trace returns the names of the tasks that have run so far, along with the time they ran at
+// two runs with the same seed produce the same trace
+func (s *Simulator) Trace() []string {
+	return s.trace
+}
+
+// Schedule adds a task to be run after the given delay on the virtual clock
+func (s *Simulator) Schedule(delay int64, name string, f func()) {
+	s.push(delay, name, f, s.daemon)
+}
+
+// Every schedules a daemon task to run periodically on the virtual clock, starting after one period
+func (s *Simulator) Every(period int64, name string, f func()) {
+	if period <= 0 {
+		panic(fmt.Sprintf("invalid period %d for '%s'", period, name))
+	}
+	var tick func()
+	tick = func() {
+		f()
+		s.push(period, name, tick, true)
+	}
+	s.push(period, name, tick, true)
+}
+
+func (s *Simulator) push(delay int64, name string, f func(), daemon bool) {
+	if delay < 0 {
+		delay = 0
+	}
+	if !daemon {
+		s.live++
+	}
+	s.seq++
+	heap.Push(&s.tasks, &task{
+		at:     s.now + delay,
+		seq:    s.seq,
+		name:   name,
+		run:    f,
+		daemon: daemon,
+	})
+}
+
+// Step runs the next task
+// it returns false if there are no tasks left
+func (s *Simulator) Step() bool {
+	if len(s.tasks) == 0 {
+		return false
+	}
+	t := heap.Pop(&s.tasks).(*task)
+	if !t.daemon {
+		s.live--
+	}
+	s.now = t.at
+	s.trace = append(s.trace, fmt.Sprintf("%d %s", t.at, t.name))
+	s.daemon = t.daemon
+	t.run()
+	s.daemon = false
+	return true
+}
+
+// Run runs the tasks until the virtual clock goes past the given time
+// a non-positive time runs the tasks until only daemon tasks are left
+func (s *Simulator) Run(until int64) {
+	for len(s.tasks) > 0 {
+		if until > 0 && s.tasks[0].at > until {
+			return
+		}
+		if until <= 0 && s.live == 0 {
+			return
+		}
+		s.Step()
+	}
+}
+
+// Go schedules the given function to run as a process of the simulator
+// a process runs exclusively, as any other task, until it returns or waits on a Waiter.
+// This allows blocking code e.g. a client operation, to run within the simulation.
+func (s *Simulator) Go(name string, f func()) {
+	s.Schedule(0, name, func() {
+		p := &process{resume: make(chan struct{}), daemon: s.daemon}
+		go func() {
+			<-p.resume
+			f()
+			s.yield <- struct{}{}
+		}()
+		s.switchTo(p)
+	})
+}
+
+// switchTo hands over the execution to the given process, until it parks or exits
+func (s *Simulator) switchTo(p *process) {
+	daemon := s.daemon
+	s.running = p
+	s.daemon = p.daemon
+	p.resume <- struct{}{}
+	<-s.yield
+	s.running = nil
+	s.daemon = daemon
+}
+
+// park suspends the running process, until a task switches back to it
+func (s *Simulator) park() {
+	p := s.running
+	if p == nil {
+		panic("cannot park outside of a simulator process")
+	}
+	s.yield <- struct{}{}
+	<-p.resume
+}
+
+// Waiter suspends a process of the simulator until it is woken up
+type Waiter struct {
+	sim     *Simulator
+	process *process
+	done    bool
+	expired bool
+}
+
+// NewWaiter creates a waiter for the running process of the simulator
+func (s *Simulator) NewWaiter() *Waiter {
+	return &Waiter{sim: s, process: s.running}
+}
+
+// Wait suspends the process until the waiter is woken up, or the timeout expires
+// a non-positive timeout waits indefinitely. It returns false, if the timeout expired.
+func (w *Waiter) Wait(timeout int64) bool {
+	if timeout > 0 {
+		w.sim.Schedule(timeout, "timeout", func() {
+			w.resume(true)
+		})
+	}
+	w.sim.park()
+	return !w.expired
+}
+
+// Wake resumes the waiting process, unless the waiter has been resumed already
+func (w *Waiter) Wake() {
+	w.sim.Schedule(0, "wake", func() {
+		w.resume(false)
+	})
+}
+
+func (w *Waiter) resume(expired bool) {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.expired = expired
+	w.sim.switchTo(w.process)
+}
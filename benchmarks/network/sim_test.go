@@ -0,0 +1,101 @@
+package network
+
+import (
+	"testing"
+
+	mem2 "github.com/drakos74/lachesis/store/io/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator_Order(t *testing.T) {
+	sim := NewSimulator(1)
+
+	order := make([]string, 0)
+	record := func(name string) func() {
+		return func() {
+			order = append(order, name)
+		}
+	}
+
+	sim.Schedule(10, "c", record("c"))
+	sim.Schedule(5, "a", record("a"))
+	// tasks for the same time run in the order they were scheduled
+	sim.Schedule(5, "b", record("b"))
+	sim.Schedule(0, "nested", func() {
+		sim.Schedule(7, "d", record("d"))
+	})
+
+	sim.Run(0)
+
+	assert.Equal(t, []string{"a", "b", "d", "c"}, order)
+	assert.Equal(t, int64(10), sim.Now())
+	assert.Equal(t, []string{"0 nested", "5 a", "5 b", "7 d", "10 c"}, sim.Trace())
+}
+
+func TestSimulator_RunUntil(t *testing.T) {
+	sim := NewSimulator(1)
+
+	count := 0
+	for i := int64(1); i <= 10; i++ {
+		sim.Schedule(i, "count", func() {
+			count++
+		})
+	}
+
+	sim.Run(5)
+	assert.Equal(t, 5, count)
+
+	sim.Run(0)
+	assert.Equal(t, 10, count)
+}
+
+func TestSimulator_Process(t *testing.T) {
+	sim := NewSimulator(1)
+
+	order := make([]string, 0)
+
+	var waiter *Waiter
+	sim.Go("waiting", func() {
+		order = append(order, "wait")
+		waiter = sim.NewWaiter()
+		ok := waiter.Wait(100)
+		assert.True(t, ok)
+		order = append(order, "woken")
+	})
+	sim.Schedule(50, "wake", func() {
+		order = append(order, "wake")
+		waiter.Wake()
+	})
+	sim.Go("timing-out", func() {
+		ok := sim.NewWaiter().Wait(20)
+		assert.False(t, ok)
+		order = append(order, "timeout")
+	})
+
+	sim.Run(0)
+
+	assert.Equal(t, []string{"wait", "timeout", "wake", "woken"}, order)
+}
+
+func TestSimulation_Replay(t *testing.T) {
+	seed := Seed()
+
+	simulate := func() Report {
+		net := Factory(NewNodeDownEvent(0, 30)).
+			Router(SinglePartition).
+			Storage(mem2.CacheFactory).
+			Nodes(1).
+			Simulate(seed)
+		return net.Run(Workload{Clients: 200, KeySize: 10, ValueSize: 20, Interval: 1000})
+	}
+
+	report := simulate()
+	t.Log(report)
+	assert.Equal(t, 200, report.Writes)
+	assert.Equal(t, 200, report.Reads)
+	// the client operations fail while the single node is down
+	assert.True(t, report.WriteErrors+report.ReadErrors > 0)
+
+	// the same seed reproduces the same run
+	assert.Equal(t, report, simulate(), "replay with %s=%d", SeedVariable, seed)
+}
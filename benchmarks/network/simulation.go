@@ -0,0 +1,421 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/drakos74/lachesis/benchmarks/store"
+	"github.com/drakos74/lachesis/store/app/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Randomized is implemented by the components of the network that make random choices
+// so that they draw them from the source of the simulation instead of the global one
+type Randomized interface {
+	Randomize(rand *rand.Rand)
+}
+
+// Latency is the range of the virtual time it takes for a message to be delivered between two nodes
+type Latency struct {
+	Min int64
+	Max int64
+}
+
+// next draws the latency for a message
+func (l Latency) next(r *rand.Rand) int64 {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + r.Int63n(l.Max-l.Min+1)
+}
+
+// DefaultLatency is the latency of the messages, if not specified for the simulation
+var DefaultLatency = Latency{Min: 1, Max: 10}
+
+// Workload describes the client operations of a simulation
+// every client writes a random element and reads it back, as in the failure rate test suite
+type Workload struct {
+	Clients   int
+	KeySize   int
+	ValueSize int
+	// Interval is the range of the virtual time within which the clients arrive
+	Interval int64
+}
+
+// Report summarises the outcome of a simulation
+type Report struct {
+	Seed        int64
+	Writes      int
+	Reads       int
+	WriteErrors int
+	ReadErrors  int
+	// Trace is the sequence of tasks that were run, which is the same for all runs with the same seed
+	Trace []string
+}
+
+// WriteErrorRate returns the percentage of the failed writes
+func (r Report) WriteErrorRate() float64 {
+	if r.Writes == 0 {
+		return 0
+	}
+	return 100 * float64(r.WriteErrors) / float64(r.Writes)
+}
+
+// ReadErrorRate returns the percentage of the failed or inconsistent reads
+func (r Report) ReadErrorRate() float64 {
+	if r.Reads == 0 {
+		return 0
+	}
+	return 100 * float64(r.ReadErrors) / float64(r.Reads)
+}
+
+// String returns a humanly readable representation of the report
+func (r Report) String() string {
+	return fmt.Sprintf("seed = %d, write-error = %.2f%%, read-error = %.2f%%, tasks = %d",
+		r.Seed, r.WriteErrorRate(), r.ReadErrorRate(), len(r.Trace))
+}
+
+// unit is the duration of a unit of the virtual clock
+const unit = time.Millisecond
+
+// units converts a duration to units of the virtual clock
+func units(d time.Duration) int64 {
+	return int64(d / unit)
+}
+
+// operation is a named action of a node
+type operation struct {
+	name string
+	run  func()
+}
+
+// queue runs the operations of a node one at a time, each one as a process of the simulator
+type queue struct {
+	busy    bool
+	pending []operation
+}
+
+// simNode is a network member within a simulation
+// its client operations and incoming messages are queued separately,
+// so that each kind is executed one at a time, as in the emulated network
+type simNode struct {
+	Storage
+	index int
+	ops   queue
+	inbox queue
+}
+
+// Simulation is a network running deterministically on a Simulator
+// message deliveries, client operations and events are all scheduled on the simulator,
+// so that a run can be replayed from its seed.
+type Simulation struct {
+	*Simulator
+	Switch
+	nodes   []*simNode
+	events  *Events
+	faults  *faults
+	cycles  int
+	latency Latency
+}
+
+// Simulate creates a network that runs deterministically on a simulator with the given seed
+func (f *FactoryBuilder) Simulate(seed int64) *Simulation {
+	f.validate()
+
+	sim := NewSimulator(seed)
+
+	route := f.router()
+	if r, ok := route.(Randomized); ok {
+		r.Randomize(sim.Rand())
+	}
+
+	s := &Simulation{
+		Simulator: sim,
+		Switch:    route,
+		nodes:     make([]*simNode, 0),
+		events: &Events{
+			warmUp: eventInterval,
+			events: f.events,
+		},
+		latency: DefaultLatency,
+	}
+
+	s.faults = newFaults(f.faults, sim.Rand(), nodeControl{
+		storage: f.storage,
+		run: func(index int, action func(node *StorageNode)) {
+			if node, ok := s.nodes[index].Storage.(*StorageNode); ok {
+				action(node)
+			}
+		},
+		sleep: func(d time.Duration) {
+			if units(d) > 0 {
+				s.NewWaiter().Wait(units(d))
+			}
+		},
+	})
+
+	for i := 0; i < f.parallelism; i++ {
+		node := f.nodeFactory(f.storage, f.protocol)
+		index := i
+		node.Cluster().Internal.transport = &transport{
+			sim: sim,
+			deliver: func(msg Message) {
+				s.send(index, msg)
+			},
+		}
+		route.Register(len(s.nodes))
+		target := &simNode{Storage: node, index: i}
+		s.nodes = append(s.nodes, target)
+
+		// keep time for the nodes that need it
+		if period := node.Cluster().Internal.period; period > 0 {
+			name := fmt.Sprintf("tick %d", i)
+			s.Every(units(period), name, func() {
+				if s.faults.down(target.index) {
+					return
+				}
+				s.enqueue(&target.inbox, name, func() {
+					response := target.Cluster().Internal.Process(len(s.Members()), target.Storage, Message{Type: Tick})
+					s.send(target.index, response)
+				})
+			})
+		}
+	}
+
+	return s
+}
+
+// Latency sets the range of the delivery time for the internal messages
+func (s *Simulation) Latency(latency Latency) *Simulation {
+	s.latency = latency
+	return s
+}
+
+// send schedules the delivery of the message to all its recipients
+func (s *Simulation) send(from int, msg Message) {
+	// ignore empty messages
+	if msg == Void {
+		return
+	}
+	for _, n := range s.nodes {
+		if msg.Source != n.Cluster().ID && (msg.RoutingID == 0 || n.Cluster().ID == msg.RoutingID) {
+			target := n
+			name := fmt.Sprintf("deliver %v %d from %d to %d", msg.Type, msg.ID, from, target.index)
+			for _, delay := range s.faults.deliver(from, target.index, msg) {
+				s.Schedule(s.latency.next(s.Rand())+units(delay), name, func() {
+					// the node might have crashed in the meantime
+					if s.faults.down(target.index) {
+						return
+					}
+					s.enqueue(&target.inbox, name, func() {
+						response := target.Cluster().Internal.Process(len(s.Members()), target.Storage, msg)
+						s.send(target.index, response)
+					})
+				})
+			}
+		}
+	}
+}
+
+// execute queues the command for the node, and passes the response to the given callback
+func (s *Simulation) execute(n *simNode, cmd Command, done func(response Response)) {
+	s.enqueue(&n.ops, fmt.Sprintf("execute %v on %d", cmd.Type(), n.index), func() {
+		done(serve(n.Storage, cmd))
+	})
+}
+
+// enqueue adds the operation to the queue, and starts it if the queue is idle
+func (s *Simulation) enqueue(q *queue, name string, run func()) {
+	q.pending = append(q.pending, operation{name: name, run: run})
+	if !q.busy {
+		s.next(q)
+	}
+}
+
+// next starts the next operation of the queue, if any
+func (s *Simulation) next(q *queue) {
+	if len(q.pending) == 0 {
+		q.busy = false
+		return
+	}
+	q.busy = true
+	op := q.pending[0]
+	q.pending = q.pending[1:]
+	s.Go(op.name, func() {
+		op.run()
+		s.next(q)
+	})
+}
+
+// call executes the command on the node and waits for the response
+// it must be called from within a process of the simulator
+func (s *Simulation) call(n *simNode, cmd Command) Response {
+	var response Response
+	w := s.NewWaiter()
+	s.execute(n, cmd, func(r Response) {
+		response = r
+		w.Wake()
+	})
+	w.Wait(0)
+	return response
+}
+
+// tick counts a client operation, and fires the next event, if it is due
+func (s *Simulation) tick() {
+	s.faults.tick()
+	s.cycles++
+	// leave some time to warm up, and use the same amount to move to the next events
+	if s.cycles > s.events.warmUp {
+		idx := s.events.index
+		if idx < len(s.events.events) {
+			event := s.events.events[idx]
+			s.Schedule(0, fmt.Sprintf("event %d", idx), func() {
+				log.Info().
+					Str("Type", "EVENT").
+					Msg(fmt.Sprintf("apply new event at %d - %d = %v", s.Now(), idx, event))
+				s.trigger(event)
+			})
+			s.events.index++
+		}
+		s.cycles = 0
+	}
+}
+
+// trigger initiates an event for the network
+func (s *Simulation) trigger(event Event) {
+	if ev, ok := s.Switch.(Event); ok {
+		// get back the initial router implementation
+		s.Switch = ev.Reset()
+	}
+	// wrap with the new one
+	s.Switch = event.Wrap(s.Switch)
+	s.DeRegister(event.Index())
+}
+
+// Put writes an element to the network
+// it must be called from within a process of the simulator
+func (s *Simulation) Put(element storage.Element) error {
+	cmd := PutCommand{element: element}
+	// emulate a network retry mechanism
+	ids, err := retry(10, s.faults.route(skip(s.Switch, s.faults.down)), cmd.Element().Key)
+	if err != nil {
+		return fmt.Errorf("error during put action: %w", err)
+	}
+
+	failures := 0
+	for _, id := range ids {
+		nodeResponse := s.call(s.nodes[id], cmd)
+		s.follow(nodeResponse)
+		if nodeResponse.Err != nil {
+			log.Info().Str("Type", "ERROR").Msg(fmt.Sprintf("node %d returned an error = %v", id, nodeResponse.Err))
+			failures++
+			err = nodeResponse.Err
+		}
+	}
+
+	s.tick()
+
+	// the put succeeds, if any of the nodes succeeded
+	if failures < len(ids) {
+		return nil
+	}
+	return err
+}
+
+// Get reads an element from the network
+// it must be called from within a process of the simulator
+func (s *Simulation) Get(key storage.Key) (storage.Element, error) {
+	cmd := GetCommand{key: key}
+	// emulate a network retry mechanism
+	ids, err := retry(10, s.faults.route(skip(s.Switch, s.faults.down)), cmd.Element().Key)
+	if err != nil {
+		return storage.Nil, fmt.Errorf("error during get action: %w", err)
+	}
+
+	var response Response
+	for _, id := range ids {
+		response = s.call(s.nodes[id], cmd)
+		s.follow(response)
+		// stop at the first successful response
+		if response.Err == nil {
+			break
+		}
+		// a missing key on one node should not hide a failure on another
+		if err == nil || store.IsNotFound(err) {
+			err = response.Err
+		}
+	}
+
+	s.tick()
+
+	if response.Err == nil {
+		return response.Element, nil
+	}
+	return response.Element, err
+}
+
+// follow lets the switch know of the leader of the cluster, as reported in the response of a node
+func (s *Simulation) follow(response Response) {
+	if response.Leader == 0 {
+		return
+	}
+	if l, ok := leader(s.Switch); ok {
+		for _, n := range s.nodes {
+			if n.Cluster().ID == response.Leader {
+				l.Lead(n.index)
+				return
+			}
+		}
+	}
+}
+
+// Run executes the workload on the network, until all the clients are done
+func (s *Simulation) Run(workload Workload) Report {
+	report := Report{Seed: s.Seed()}
+
+	for i := 0; i < workload.Clients; i++ {
+		client := i
+		element := storage.NewElement(s.bytes(workload.KeySize), s.bytes(workload.ValueSize))
+		arrival := int64(0)
+		if workload.Interval > 0 {
+			arrival = s.Rand().Int63n(workload.Interval)
+		}
+		s.Schedule(arrival, fmt.Sprintf("arrive client %d", client), func() {
+			s.Go(fmt.Sprintf("client %d", client), func() {
+				report.Writes++
+				if err := s.Put(element); err != nil {
+					report.WriteErrors++
+				}
+				report.Reads++
+				result, err := s.Get(element.Key)
+				if err != nil || string(result.Value) != string(element.Value) {
+					report.ReadErrors++
+				}
+			})
+		})
+	}
+
+	s.Simulator.Run(0)
+
+	report.Trace = s.Trace()
+	return report
+}
+
+// bytes generates a random byte array of the given size
+func (s *Simulation) bytes(size int) []byte {
+	b := make([]byte, size)
+	s.Rand().Read(b)
+	return b
+}
+
+// Close shuts down the storage of all the nodes
+func (s *Simulation) Close() error {
+	var err error
+	for _, n := range s.nodes {
+		if e := n.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,291 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/drakos74/lachesis/benchmarks/store"
+	lstore "github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/wal"
+)
+
+// WAL is a sequenced write-ahead log for the state of a node.
+// It follows the log of the store module (store/io/wal), with the difference that the entries are kept as objects
+// rather than raw bytes, so that a file backed log can be plugged in along with an encoding for the entries.
+type WAL interface {
+	// Append adds the entry to the end of the log, and returns its index
+	Append(entry interface{}) (uint64, error)
+	// Get returns the entry for the given index
+	Get(index uint64) (interface{}, error)
+	// Truncate removes all the entries from the given index onwards
+	Truncate(index uint64) error
+	// Compact removes all the entries up to and including the given index, e.g. once they are part of a snapshot
+	// the log continues after the given index, even if it did not reach it before.
+	Compact(index uint64) error
+	// Replay calls the given function for all the entries starting from the given index, in order
+	Replay(from uint64, f func(index uint64, entry interface{}) error) error
+	// First returns the index of the first entry, or zero if the log is empty
+	First() uint64
+	// Last returns the index of the last entry, or of the last compacted one if the log is empty,
+	// or zero if the log never had any entries
+	Last() uint64
+}
+
+// MemWAL is an in-memory WAL
+// the entries are lost when the node stops.
+type MemWAL struct {
+	mutex   sync.RWMutex
+	first   uint64
+	entries []interface{}
+}
+
+// NewWAL creates a new in-memory WAL
+func NewWAL() *MemWAL {
+	return &MemWAL{
+		first:   1,
+		entries: make([]interface{}, 0),
+	}
+}
+
+// Append adds the entry to the end of the log, and returns its index
+func (w *MemWAL) Append(entry interface{}) (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.entries = append(w.entries, entry)
+	return w.first + uint64(len(w.entries)) - 1, nil
+}
+
+// Get returns the entry for the given index
+func (w *MemWAL) Get(index uint64) (interface{}, error) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if index < w.first || index >= w.first+uint64(len(w.entries)) {
+		return nil, fmt.Errorf("%w: no entry at index %d", store.ErrNotFound, index)
+	}
+	return w.entries[index-w.first], nil
+}
+
+// Truncate removes all the entries from the given index onwards
+func (w *MemWAL) Truncate(index uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if index < w.first {
+		return fmt.Errorf("%w: cannot truncate log at %d before its first entry %d", store.ErrNotFound, index, w.first)
+	}
+	if index < w.first+uint64(len(w.entries)) {
+		w.entries = w.entries[:index-w.first]
+	}
+	return nil
+}
+
+// Compact removes all the entries up to and including the given index
+// the log continues after the given index, even if it did not reach it before.
+func (w *MemWAL) Compact(index uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if index < w.first {
+		return nil
+	}
+	remaining := make([]interface{}, 0)
+	if index < w.first+uint64(len(w.entries)) {
+		// copy the remaining entries, so that the compacted ones can be released
+		remaining = append(remaining, w.entries[index-w.first+1:]...)
+	}
+	w.entries = remaining
+	w.first = index + 1
+	return nil
+}
+
+// Replay calls the given function for all the entries starting from the given index, in order
+func (w *MemWAL) Replay(from uint64, f func(index uint64, entry interface{}) error) error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if from < w.first {
+		from = w.first
+	}
+	for index := from; index < w.first+uint64(len(w.entries)); index++ {
+		err := f(index, w.entries[index-w.first])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// First returns the index of the first entry, or zero if the log is empty
+func (w *MemWAL) First() uint64 {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if len(w.entries) == 0 {
+		return 0
+	}
+	return w.first
+}
+
+// Last returns the index of the last entry, or of the last compacted one if the log is empty,
+// or zero if the log never had any entries
+func (w *MemWAL) Last() uint64 {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.first + uint64(len(w.entries)) - 1
+}
+
+// Codec encodes the entries of a WAL into bytes, so that they can be stored in a file
+type Codec interface {
+	// Encode serializes the entry
+	Encode(entry interface{}) ([]byte, error)
+	// Decode de-serializes an entry, that was serialized with Encode
+	Decode(data []byte) (interface{}, error)
+}
+
+// WALFactory creates the WAL for the node with the given id
+type WALFactory func(id uint32) (WAL, error)
+
+// FileWAL is a WAL backed by the file log of the store module
+// every entry is synced to disk before Append returns, so that the log survives a restart of the node.
+type FileWAL struct {
+	name  string
+	log   *wal.Log
+	codec Codec
+}
+
+// OpenWAL opens the file WAL in the given file, with the given encoding for the entries
+// the entries already in the file are restored.
+func OpenWAL(name string, codec Codec) (*FileWAL, error) {
+	l, err := wal.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWAL{name: name, log: l, codec: codec}, nil
+}
+
+// FileWALFactory creates file WALs in the given directory, one file per node id
+func FileWALFactory(dir string, codec Codec) WALFactory {
+	return func(id uint32) (WAL, error) {
+		return OpenWAL(filepath.Join(dir, fmt.Sprintf("%d.wal", id)), codec)
+	}
+}
+
+// Append adds the entry to the end of the log, and returns its index
+func (w *FileWAL) Append(entry interface{}) (uint64, error) {
+	data, err := w.codec.Encode(entry)
+	if err != nil {
+		return 0, fmt.Errorf("could not encode entry: %w", err)
+	}
+	index, err := w.log.Append(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.log.Sync(); err != nil {
+		// the entry is reported as failed, so it must not come back on a restart
+		if truncErr := w.log.Truncate(index); truncErr != nil {
+			return 0, fmt.Errorf("could not sync entry '%d': %v [%w]", index, truncErr, err)
+		}
+		return 0, fmt.Errorf("could not sync entry '%d': %w", index, err)
+	}
+	return index, nil
+}
+
+// Get returns the entry for the given index
+func (w *FileWAL) Get(index uint64) (interface{}, error) {
+	entry, err := w.log.Get(index)
+	if errors.Is(err, lstore.ErrNotFound) {
+		return nil, fmt.Errorf("%w: no entry at index %d", store.ErrNotFound, index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w.codec.Decode(entry.Data)
+}
+
+// Truncate removes all the entries from the given index onwards
+func (w *FileWAL) Truncate(index uint64) error {
+	err := w.log.Truncate(index)
+	if errors.Is(err, lstore.ErrNotFound) {
+		return fmt.Errorf("%w: cannot truncate log at %d before its first entry", store.ErrNotFound, index)
+	}
+	if err != nil {
+		return err
+	}
+	return w.log.Sync()
+}
+
+// Compact removes all the entries up to and including the given index
+// the log continues after the given index, even if it did not reach it before.
+func (w *FileWAL) Compact(index uint64) error {
+	return w.log.Compact(index)
+}
+
+// Replay calls the given function for all the entries starting from the given index, in order
+// the function must not modify the log.
+func (w *FileWAL) Replay(from uint64, f func(index uint64, entry interface{}) error) error {
+	return w.log.Replay(from, func(entry wal.Entry) error {
+		e, err := w.codec.Decode(entry.Data)
+		if err != nil {
+			return fmt.Errorf("could not decode entry '%d': %w", entry.Index, err)
+		}
+		return f(entry.Index, e)
+	})
+}
+
+// First returns the index of the first entry, or zero if the log is empty
+func (w *FileWAL) First() uint64 {
+	return w.log.First()
+}
+
+// Last returns the index of the last entry, or of the last compacted one if the log is empty,
+// or zero if the log never had any entries
+func (w *FileWAL) Last() uint64 {
+	return w.log.Last()
+}
+
+// Close closes the file of the log
+func (w *FileWAL) Close() error {
+	return w.log.Close()
+}
+
+// Remove closes the log and deletes its file, as after a loss of the disk
+func (w *FileWAL) Remove() error {
+	err := w.log.Close()
+	if err != nil && !errors.Is(err, lstore.ErrClosed) {
+		return err
+	}
+	return os.Remove(w.name)
+}
+
+// failedWAL is the WAL of a node, whose log could not be opened
+// all the operations report the error, so that the node does not carry on without its log.
+type failedWAL struct {
+	err error
+}
+
+func (w failedWAL) Append(entry interface{}) (uint64, error) {
+	return 0, w.err
+}
+
+func (w failedWAL) Get(index uint64) (interface{}, error) {
+	return nil, w.err
+}
+
+func (w failedWAL) Truncate(index uint64) error {
+	return w.err
+}
+
+func (w failedWAL) Compact(index uint64) error {
+	return w.err
+}
+
+func (w failedWAL) Replay(from uint64, f func(index uint64, entry interface{}) error) error {
+	return w.err
+}
+
+func (w failedWAL) First() uint64 {
+	return 0
+}
+
+func (w failedWAL) Last() uint64 {
+	return 0
+}
@@ -1,13 +1,17 @@
 package badger
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v2"
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
 	"github.com/rs/zerolog/log"
 )
 
@@ -24,14 +28,109 @@ func (s *Store) Put(element storage.Element) error {
 	})
 }
 
+// NewBatch creates a batch of writes, that is committed within a single badger transaction
+func (s *Store) NewBatch() lstore.Batch {
+	return lstore.NewWriteBatch(func(writes []lstore.Write) error {
+		err := s.db.Update(func(txn *badger.Txn) error {
+			for _, w := range writes {
+				var err error
+				if w.Delete {
+					err = txn.Delete(w.Key)
+				} else {
+					err = txn.Set(w.Key, w.Value)
+				}
+				if err != nil {
+					return fmt.Errorf(storage.InternalError, "batch", w.Key, err)
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, badger.ErrDBClosed) {
+			return store.ErrClosed
+		}
+		return err
+	})
+}
+
+// Snapshot writes all the elements of the badger store to the writer
+// the elements are read within a single read transaction, so that the snapshot is consistent
+func (s *Store) Snapshot(w io.Writer) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		itr := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer itr.Close()
+		elements := &cursor{itr: itr}
+		err := lstore.WriteSnapshot(w, elements)
+		if err != nil {
+			return err
+		}
+		return elements.err
+	})
+	if errors.Is(err, badger.ErrDBClosed) {
+		return store.ErrClosed
+	}
+	return err
+}
+
+// Restore adds the elements of the snapshot in the reader to the badger store
+// the elements are written as a single batch
+func (s *Store) Restore(r io.Reader) error {
+	elements, err := lstore.ReadSnapshot(r)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot %w", err)
+	}
+	batch := s.NewBatch()
+	for _, element := range elements {
+		batch.Put(element)
+	}
+	return batch.Commit()
+}
+
+// cursor iterates over the elements of a badger iterator
+// it stops at the first value that cannot be read, and keeps the error.
+type cursor struct {
+	itr     *badger.Iterator
+	started bool
+	element lstore.Element
+	err     error
+}
+
+// Next moves the iterator to the next element
+func (c *cursor) Next() bool {
+	if c.started {
+		c.itr.Next()
+	} else {
+		c.itr.Rewind()
+		c.started = true
+	}
+	if c.err != nil || !c.itr.Valid() {
+		return false
+	}
+	item := c.itr.Item()
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		c.err = fmt.Errorf(storage.InternalError, "snapshot", item.Key(), err)
+		return false
+	}
+	c.element = lstore.NewElement(item.KeyCopy(nil), value)
+	return true
+}
+
+// Element returns the element at the current iterator position
+func (c *cursor) Element() lstore.Element {
+	return c.element
+}
+
 // Get retrieves a value for the given key from the badger storage implementation
 func (s *Store) Get(key storage.Key) (storage.Element, error) {
 	var value []byte
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return store.NotFound(key)
+		}
 		if err != nil {
-			return fmt.Errorf(storage.NoValue, key)
+			return fmt.Errorf(storage.InternalError, "get", key, err)
 		}
 		key = item.KeyCopy(nil)
 		value, err = item.ValueCopy(nil)
@@ -41,6 +140,9 @@ func (s *Store) Get(key storage.Key) (storage.Element, error) {
 
 		return nil
 	})
+	if errors.Is(err, badger.ErrDBClosed) {
+		return storage.Element{}, store.ErrClosed
+	}
 	if err != nil {
 		return storage.Element{}, err
 	}
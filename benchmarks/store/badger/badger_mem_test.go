@@ -1,9 +1,15 @@
 package badger
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
 
+	"github.com/drakos74/lachesis/benchmarks/store"
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
 	"github.com/drakos74/lachesis/store/test"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestBadgerInMem_KeyValueImplementation(t *testing.T) {
@@ -13,3 +19,93 @@ func TestBadgerInMem_KeyValueImplementation(t *testing.T) {
 func TestBadgerInMem_SyncImplementation(t *testing.T) {
 	new(test.Concurrency).Run(t, MemoryFactory)
 }
+
+func TestBadgerInMem_Errors(t *testing.T) {
+
+	s, err := NewMemoryStore()
+	assert.NoError(t, err)
+
+	_, err = s.Get(storage.Key("key"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = s.Close()
+	assert.NoError(t, err)
+
+	_, err = s.Get(storage.Key("key"))
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
+
+func TestBadgerInMem_Batch(t *testing.T) {
+
+	s, err := NewMemoryStore()
+	assert.NoError(t, err)
+
+	err = s.Put(storage.NewElement(storage.Key("key-1"), storage.Value("value-1")))
+	assert.NoError(t, err)
+
+	batch := s.NewBatch()
+	batch.Put(lstore.NewElement([]byte("key-2"), []byte("value-2")))
+	batch.Put(lstore.NewElement([]byte("key-3"), []byte("value-3")))
+	batch.Delete(lstore.Key("key-1"))
+
+	// nothing is visible before the commit
+	_, err = s.Get(storage.Key("key-2"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = batch.Commit()
+	assert.NoError(t, err)
+
+	_, err = s.Get(storage.Key("key-1"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	element, err := s.Get(storage.Key("key-3"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Value("value-3"), element.Value)
+
+	err = s.Close()
+	assert.NoError(t, err)
+
+	batch.Put(lstore.NewElement([]byte("key-4"), []byte("value-4")))
+	err = batch.Commit()
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
+
+func TestBadgerInMem_Snapshot(t *testing.T) {
+
+	s, err := NewMemoryStore()
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		err := s.Put(storage.NewElement(storage.Key(fmt.Sprintf("key-%d", i)), storage.Value(fmt.Sprintf("value-%d", i))))
+		assert.NoError(t, err)
+	}
+
+	snapshot := new(bytes.Buffer)
+	err = s.Snapshot(snapshot)
+	assert.NoError(t, err)
+
+	restored, err := NewMemoryStore()
+	assert.NoError(t, err)
+
+	// an invalid snapshot leaves the store untouched
+	err = restored.Restore(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()-1]))
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+	assert.Equal(t, uint64(0), restored.Metadata().Size)
+
+	err = restored.Restore(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, s.Metadata(), restored.Metadata())
+	element, err := restored.Get(storage.Key("key-42"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Value("value-42"), element.Value)
+
+	err = s.Close()
+	assert.NoError(t, err)
+	err = restored.Close()
+	assert.NoError(t, err)
+
+	err = s.Snapshot(new(bytes.Buffer))
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
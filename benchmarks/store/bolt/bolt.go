@@ -1,13 +1,17 @@
 package bolt
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
 	"github.com/rs/zerolog/log"
 )
 
@@ -20,11 +24,95 @@ type Store struct {
 
 // Put writes an element to the bolt file storage
 func (s Store) Put(element storage.Element) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		err := b.Put(element.Key, element.Value)
 		return err
 	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return store.ErrClosed
+	}
+	return err
+}
+
+// NewBatch creates a batch of writes, that is committed within a single bolt transaction
+func (s Store) NewBatch() lstore.Batch {
+	return lstore.NewWriteBatch(func(writes []lstore.Write) error {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			for _, w := range writes {
+				var err error
+				if w.Delete {
+					err = b.Delete(w.Key)
+				} else {
+					err = b.Put(w.Key, w.Value)
+				}
+				if err != nil {
+					return fmt.Errorf(storage.InternalError, "batch", w.Key, err)
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+			return store.ErrClosed
+		}
+		return err
+	})
+}
+
+// Snapshot writes all the elements of the bolt file storage to the writer
+// the elements are read within a single read transaction, so that the snapshot is consistent
+func (s Store) Snapshot(w io.Writer) error {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return lstore.WriteSnapshot(w, lstore.NewCursor(nil))
+		}
+		// the slices returned by bolt are only valid within the transaction, but they are written out right away
+		return lstore.WriteSnapshot(w, &cursor{c: b.Cursor()})
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return store.ErrClosed
+	}
+	return err
+}
+
+// Restore adds the elements of the snapshot in the reader to the bolt file storage
+// the elements are written as a single batch
+func (s Store) Restore(r io.Reader) error {
+	elements, err := lstore.ReadSnapshot(r)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot %w", err)
+	}
+	batch := s.NewBatch()
+	for _, element := range elements {
+		batch.Put(element)
+	}
+	return batch.Commit()
+}
+
+// cursor iterates over the elements of a bolt bucket cursor
+type cursor struct {
+	c       *bolt.Cursor
+	started bool
+	key     []byte
+	value   []byte
+}
+
+// Next moves the bucket cursor to the next element
+func (c *cursor) Next() bool {
+	if c.started {
+		c.key, c.value = c.c.Next()
+	} else {
+		c.key, c.value = c.c.First()
+		c.started = true
+	}
+	return c.key != nil
+}
+
+// Element returns the element at the current bucket cursor position
+func (c *cursor) Element() lstore.Element {
+	return lstore.NewElement(c.key, c.value)
 }
 
 // Get retrieves a value from the bolt file storage based on the given key
@@ -34,14 +122,17 @@ func (s Store) Get(key storage.Key) (storage.Element, error) {
 		b := tx.Bucket([]byte(bucket))
 		if b == nil {
 			// no bucket, no value
-			return fmt.Errorf(storage.NoValue, key)
+			return store.NotFound(key)
 		}
 		value = b.Get(key)
 		if value == nil {
-			return fmt.Errorf(storage.NoValue, key)
+			return store.NotFound(key)
 		}
 		return nil
 	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return storage.Element{}, store.ErrClosed
+	}
 	if err != nil {
 		return storage.Element{}, err
 	}
@@ -1,9 +1,16 @@
 package bolt
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
 
+	"github.com/drakos74/lachesis/benchmarks/store"
+	"github.com/drakos74/lachesis/benchmarks/store/badger"
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
 	"github.com/drakos74/lachesis/store/test"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestBoltFile_KeyValueImplementation(t *testing.T) {
@@ -13,3 +20,76 @@ func TestBoltFile_KeyValueImplementation(t *testing.T) {
 func TestBoltFile_SyncImplementation(t *testing.T) {
 	new(test.Concurrency).Run(t, FileFactory("data"))
 }
+
+func TestBoltFile_Batch(t *testing.T) {
+
+	s, err := NewFileStore(fmt.Sprintf("%s/batch", t.TempDir()))
+	assert.NoError(t, err)
+
+	err = s.Put(storage.NewElement(storage.Key("key-1"), storage.Value("value-1")))
+	assert.NoError(t, err)
+
+	batch := s.NewBatch()
+	batch.Put(lstore.NewElement([]byte("key-2"), []byte("value-2")))
+	batch.Put(lstore.NewElement([]byte("key-3"), []byte("value-3")))
+	batch.Delete(lstore.Key("key-1"))
+
+	// nothing is visible before the commit
+	_, err = s.Get(storage.Key("key-2"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = batch.Commit()
+	assert.NoError(t, err)
+
+	_, err = s.Get(storage.Key("key-1"))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	element, err := s.Get(storage.Key("key-3"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Value("value-3"), element.Value)
+
+	err = s.Close()
+	assert.NoError(t, err)
+
+	batch.Put(lstore.NewElement([]byte("key-4"), []byte("value-4")))
+	err = batch.Commit()
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
+
+func TestBoltFile_Snapshot(t *testing.T) {
+
+	// a snapshot of badger restores into bolt, and back
+	source, err := badger.NewMemoryStore()
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		err := source.Put(storage.NewElement(storage.Key(fmt.Sprintf("key-%d", i)), storage.Value(fmt.Sprintf("value-%d", i))))
+		assert.NoError(t, err)
+	}
+	snapshot := new(bytes.Buffer)
+	err = source.Snapshot(snapshot)
+	assert.NoError(t, err)
+
+	s, err := NewFileStore(fmt.Sprintf("%s/snapshot", t.TempDir()))
+	assert.NoError(t, err)
+	err = s.Restore(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, source.Metadata(), s.Metadata())
+
+	snapshot.Reset()
+	err = s.Snapshot(snapshot)
+	assert.NoError(t, err)
+	target, err := badger.NewMemoryStore()
+	assert.NoError(t, err)
+	err = target.Restore(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, source.Metadata(), target.Metadata())
+	element, err := target.Get(storage.Key("key-42"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Value("value-42"), element.Value)
+
+	for _, closer := range []storage.Storage{source, s, target} {
+		err = closer.Close()
+		assert.NoError(t, err)
+	}
+
+}
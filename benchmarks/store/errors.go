@@ -0,0 +1,29 @@
+// Package store holds the errors reported by the benchmark storage adapters,
+// and adapts the storages of the vendored store version to the layers of the store module.
+package store
+
+import (
+	"errors"
+
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
+)
+
+var (
+	// ErrNotFound is returned when there is no value for a given key
+	ErrNotFound = lstore.ErrNotFound
+	// ErrClosed is returned for operations on a storage that has already been closed
+	ErrClosed = lstore.ErrClosed
+	// ErrCorrupted is returned when the stored data cannot be read back the way it was written
+	ErrCorrupted = lstore.ErrCorrupted
+)
+
+// NotFound creates the error for a key that has no value in the storage
+func NotFound(key storage.Key) error {
+	return lstore.NotFound(lstore.Key(key))
+}
+
+// IsNotFound checks if the error reports a missing key
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
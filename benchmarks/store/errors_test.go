@@ -0,0 +1,26 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNotFound(t *testing.T) {
+
+	key := storage.Key("key")
+
+	assert.True(t, IsNotFound(NotFound(key)))
+	assert.True(t, IsNotFound(fmt.Errorf("wrapped: %w", NotFound(key))))
+	// the errors of the store module are the same
+	assert.True(t, IsNotFound(lstore.NotFound(lstore.Key(key))))
+
+	assert.False(t, IsNotFound(nil))
+	assert.False(t, IsNotFound(ErrClosed))
+	assert.False(t, IsNotFound(errors.New("disk failure")))
+
+}
@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/rs/zerolog/log"
 )
@@ -51,7 +52,7 @@ func (f Storage) Get(key storage.Key) (storage.Element, error) {
 			return result, nil
 		}
 	}
-	return storage.Nil, fmt.Errorf(storage.NoValue, key)
+	return storage.Nil, store.NotFound(key)
 }
 
 // Metadata returns the internal stats of the file storage implementation
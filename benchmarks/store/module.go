@@ -0,0 +1,117 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/drakos74/lachesis/store/app/storage"
+	lstore "github.com/drakos74/lachesis/store/store"
+)
+
+// The benchmark adapters and the network emulator are written against the storage interface of the vendored store version,
+// while the layers on top of the storages, like the cached storage, batches and snapshots, come from the store module.
+// Module and Vendored convert between the two interfaces, whose elements only differ in their types.
+
+// Deleter is implemented by the vendored storages that can remove elements
+// the vendored storage interface has no Delete method.
+type Deleter interface {
+	Delete(key storage.Key) error
+}
+
+// Module adapts the storages of the vendored interface to the storage interface of the store module
+func Module(newStorage storage.StorageFactory) lstore.StorageFactory {
+	return func() lstore.Storage {
+		return module{newStorage()}
+	}
+}
+
+// module is a vendored storage behind the storage interface of the store module
+type module struct {
+	storage storage.Storage
+}
+
+// Put adds the element to the vendored storage
+func (m module) Put(element lstore.Element) error {
+	return m.storage.Put(storage.NewElement(element.Key, element.Value))
+}
+
+// Get retrieves the element for the given key from the vendored storage
+func (m module) Get(key lstore.Key) (lstore.Element, error) {
+	element, err := m.storage.Get(storage.Key(key))
+	if err != nil {
+		return lstore.Element{}, err
+	}
+	return lstore.NewElement(element.Key, element.Value), nil
+}
+
+// Delete removes the element for the given key, if the vendored storage is a Deleter
+func (m module) Delete(key lstore.Key) error {
+	deleter, ok := m.storage.(Deleter)
+	if !ok {
+		return fmt.Errorf("could not delete from storage %T: %w", m.storage, lstore.ErrNotSupported)
+	}
+	return deleter.Delete(storage.Key(key))
+}
+
+// Metadata returns the metadata of the vendored storage
+func (m module) Metadata() lstore.Metadata {
+	metadata := m.storage.Metadata()
+	return lstore.Metadata{
+		Size:        metadata.Size,
+		KeysBytes:   metadata.KeysBytes,
+		ValuesBytes: metadata.ValuesBytes,
+		Errors:      append(lstore.NewMetadata().Errors, metadata.Errors...),
+	}
+}
+
+// Close closes the vendored storage
+func (m module) Close() error {
+	return m.storage.Close()
+}
+
+// Vendored adapts the storages of the store module to the vendored storage interface
+func Vendored(newStorage lstore.StorageFactory) storage.StorageFactory {
+	return func() storage.Storage {
+		return &Adapter{Storage: newStorage()}
+	}
+}
+
+// Adapter is a storage of the store module behind the vendored storage interface
+// the storage of the store module is exposed, for the capabilities and metadata that the vendored interface has no place for.
+type Adapter struct {
+	Storage lstore.Storage
+}
+
+// Put adds the element to the storage
+func (a *Adapter) Put(element storage.Element) error {
+	return a.Storage.Put(lstore.NewElement(element.Key, element.Value))
+}
+
+// Get retrieves the element for the given key from the storage
+func (a *Adapter) Get(key storage.Key) (storage.Element, error) {
+	element, err := a.Storage.Get(lstore.Key(key))
+	if err != nil {
+		return storage.Nil, err
+	}
+	return storage.NewElement(element.Key, element.Value), nil
+}
+
+// Delete removes the element for the given key from the storage
+func (a *Adapter) Delete(key storage.Key) error {
+	return a.Storage.Delete(lstore.Key(key))
+}
+
+// Metadata returns the sizes and errors of the storage
+func (a *Adapter) Metadata() storage.Metadata {
+	metadata := a.Storage.Metadata()
+	return storage.Metadata{
+		Size:        metadata.Size,
+		KeysBytes:   metadata.KeysBytes,
+		ValuesBytes: metadata.ValuesBytes,
+		Errors:      append(storage.NewMetadata().Errors, metadata.Errors...),
+	}
+}
+
+// Close closes the storage
+func (a *Adapter) Close() error {
+	return a.Storage.Close()
+}
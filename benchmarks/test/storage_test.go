@@ -6,13 +6,18 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/drakos74/lachesis/benchmarks/store"
 	"github.com/drakos74/lachesis/benchmarks/store/badger"
 	"github.com/drakos74/lachesis/benchmarks/store/bolt"
 	"github.com/drakos74/lachesis/store/app/storage"
 	"github.com/drakos74/lachesis/store/io/file"
 	"github.com/drakos74/lachesis/store/io/mem"
+	lstore "github.com/drakos74/lachesis/store/store"
+	lfile "github.com/drakos74/lachesis/store/store/io/file"
 	"github.com/drakos74/lachesis/store/test"
 	"github.com/rs/zerolog"
 )
@@ -101,7 +106,94 @@ func BenchmarkFileBolt(b *testing.B) {
 	executeBenchmarks(b, bolt.FileFactory("testdata/bolt"))
 }
 
+// cached
+
+// cachePolicy reads through the in-memory front storage, and writes through to the back storage
+var cachePolicy = lstore.CachePolicy{Write: lstore.WriteThrough, ReadThrough: true}
+
+// writeBackPolicy reads through the in-memory front storage, and flushes the writes to the back storage asynchronously
+var writeBackPolicy = lstore.CachePolicy{Write: lstore.WriteBack, ReadThrough: true}
+
+// cached puts the in-memory front storage in front of the back storage, with the cached storage of the store module
+func cached(back storage.StorageFactory, policy lstore.CachePolicy) storage.StorageFactory {
+	return store.Vendored(lstore.CachedStorageFactory(store.Module(mem.SyncCacheFactory), store.Module(back), policy))
+}
+
+// BenchmarkCachedSyncTriePad executes the benchmarks for the thread-safe file storage
+// behind an in-memory cache
+func BenchmarkCachedSyncTriePad(b *testing.B) {
+	executeBenchmarks(b, cached(file.SyncScratchPadFactory(b.TempDir()), cachePolicy))
+}
+
+// BenchmarkWriteBackSyncTriePad executes the benchmarks for the thread-safe file storage
+// behind an in-memory write-back cache
+func BenchmarkWriteBackSyncTriePad(b *testing.B) {
+	executeBenchmarks(b, cached(file.SyncScratchPadFactory(b.TempDir()), writeBackPolicy))
+}
+
+// BenchmarkCachedFileBadger executes the benchmarks for badger file store
+// behind an in-memory cache
+func BenchmarkCachedFileBadger(b *testing.B) {
+	executeBenchmarks(b, cached(badger.FileFactory(b.TempDir()), cachePolicy))
+}
+
+// BenchmarkCachedFileBolt executes the benchmarks for bolt file store
+// behind an in-memory cache
+func BenchmarkCachedFileBolt(b *testing.B) {
+	executeBenchmarks(b, cached(bolt.FileFactory(b.TempDir()), cachePolicy))
+}
+
+// BenchmarkWriteBackFileBolt executes the benchmarks for bolt file store
+// behind an in-memory write-back cache
+func BenchmarkWriteBackFileBolt(b *testing.B) {
+	executeBenchmarks(b, cached(bolt.FileFactory(b.TempDir()), writeBackPolicy))
+}
+
+// durable
+
+// durabilityInterval is the period between the background syncs of the SyncInterval mode
+const durabilityInterval = 10 * time.Millisecond
+
+// durable generates the thread-safe file storage of the store module, that syncs its writes with the given mode
+func durable(b *testing.B, mode lfile.SyncMode) storage.StorageFactory {
+	return store.Vendored(lfile.SyncDurablePadFactory(b.TempDir(), lfile.Durability{Mode: mode, Interval: durabilityInterval}))
+}
+
+// BenchmarkDurableSyncNone executes the durability benchmarks for the thread-safe file storage
+// that leaves the syncing to the operating system
+func BenchmarkDurableSyncNone(b *testing.B) {
+	executeDurabilityBenchmarks(b, durable(b, lfile.SyncNone))
+}
+
+// BenchmarkDurableSyncEveryWrite executes the durability benchmarks for the thread-safe file storage
+// that syncs after every write
+func BenchmarkDurableSyncEveryWrite(b *testing.B) {
+	executeDurabilityBenchmarks(b, durable(b, lfile.SyncEveryWrite))
+}
+
+// BenchmarkDurableSyncInterval executes the durability benchmarks for the thread-safe file storage
+// that syncs periodically in the background
+func BenchmarkDurableSyncInterval(b *testing.B) {
+	executeDurabilityBenchmarks(b, durable(b, lfile.SyncInterval))
+}
+
+// BenchmarkDurableSyncGroupCommit executes the durability benchmarks for the thread-safe file storage
+// that shares a single sync among the concurrent writers
+func BenchmarkDurableSyncGroupCommit(b *testing.B) {
+	executeDurabilityBenchmarks(b, durable(b, lfile.SyncGroupCommit))
+}
+
 func executeBenchmarks(b *testing.B, storageFactory func() storage.Storage) {
+	executeScenarios(b, storageFactory, put, batch, get)
+}
+
+// executeDurabilityBenchmarks adds the concurrent writes to the benchmarks,
+// as the sync modes differ the most when many writers wait for their writes to be synced
+func executeDurabilityBenchmarks(b *testing.B, storageFactory func() storage.Storage) {
+	executeScenarios(b, storageFactory, put, concurrentPut, batch, get)
+}
+
+func executeScenarios(b *testing.B, storageFactory func() storage.Storage, execution ...benchmarkExecution) {
 
 	// reduce logging
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
@@ -129,7 +221,7 @@ func executeBenchmarks(b *testing.B, storageFactory func() storage.Storage) {
 
 	for _, scenario := range scenarios {
 		storage := storageFactory()
-		executeBenchmark(b, storage, scenario, put, get)
+		executeBenchmark(b, storage, scenario, execution...)
 	}
 
 }
@@ -140,10 +232,15 @@ func executeBenchmark(b *testing.B, storage storage.Storage, scenario Scenario,
 		currentScenario := scenario.get()
 		elements := test.Elements(currentScenario.Num, test.Random(currentScenario.KeySize, currentScenario.ValueSize))
 		for _, exec := range execution {
-			b.Run(fmt.Sprintf("%s|%s|%s|num-objects:%d|size-key:%d|size-value:%d|", reflect.TypeOf(storage).String(), getFuncName(exec), scenario.name, scenario.Num, scenario.KeySize, scenario.ValueSize), func(b *testing.B) {
+			b.Run(fmt.Sprintf("%s|%s|%s|num-objects:%d|size-key:%d|size-value:%d|", getStorageName(storage), getFuncName(exec), scenario.name, scenario.Num, scenario.KeySize, scenario.ValueSize), func(b *testing.B) {
 				for i := 0; i < b.N; i++ {
 					exec(storage, elements)
 				}
+				if adapter, ok := storage.(*store.Adapter); ok {
+					if cached, ok := adapter.Storage.(*lstore.CachedStorage); ok {
+						b.ReportMetric(cached.Metadata().HitRatio(), "hit-ratio")
+					}
+				}
 			})
 		}
 	}
@@ -169,6 +266,54 @@ func put(storage storage.Storage, elements []storage.Element) {
 	}
 }
 
+// writers is the number of goroutines of the concurrent put execution
+const writers = 8
+
+// concurrentPut writes the elements from a number of goroutines, each one taking every writers-th element
+func concurrentPut(storage storage.Storage, elements []storage.Element) {
+	var wg sync.WaitGroup
+	wg.Add(writers)
+	for w := 0; w < writers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(elements); i += writers {
+				err := storage.Put(elements[i])
+				if err != nil {
+					log.Fatalf("error : %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// batchSize is the number of elements committed together by the batch execution
+// it keeps the transactions of the native implementations within their size limits
+const batchSize = 1000
+
+// batch writes the elements in batches, for the storage implementations that support them
+// the rest fall back to single puts
+func batch(storage storage.Storage, elements []storage.Element) {
+	batcher, ok := storage.(lstore.Batcher)
+	if adapter, isAdapter := storage.(*store.Adapter); isAdapter {
+		batcher, ok = adapter.Storage.(lstore.Batcher)
+	}
+	if !ok {
+		put(storage, elements)
+		return
+	}
+	batch := batcher.NewBatch()
+	for i, element := range elements {
+		batch.Put(lstore.NewElement(element.Key, element.Value))
+		if (i+1)%batchSize == 0 || i == len(elements)-1 {
+			err := batch.Commit()
+			if err != nil {
+				log.Fatalf("error : %v", err)
+			}
+		}
+	}
+}
+
 func get(storage storage.Storage, elements []storage.Element) {
 	for _, element := range elements {
 		result, err := storage.Get(element.Key)
@@ -183,6 +328,14 @@ func get(storage storage.Storage, elements []storage.Element) {
 
 // TODO : add sequential get scenario
 
+// getStorageName returns the type of the storage, or of the storage of the store module behind an adapter
+func getStorageName(s storage.Storage) string {
+	if adapter, ok := s.(*store.Adapter); ok {
+		return reflect.TypeOf(adapter.Storage).String()
+	}
+	return reflect.TypeOf(s).String()
+}
+
 func getFuncName(exec benchmarkExecution) string {
 	execName := runtime.FuncForPC(reflect.ValueOf(exec).Pointer()).Name()
 	idx := strings.LastIndex(execName, ".")
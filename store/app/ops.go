@@ -13,10 +13,20 @@ type Join func(element store.Element) ([]byte, error)
 // Deserializer transform the byte array into an element object by splitting from the byte array keys and values
 type Split func(key store.Key, data []byte) (store.Element, error)
 
+// Tombstone creates the byte representation that marks the removal of the element for the given key
+type Tombstone func(key store.Key) ([]byte, error)
+
 // ConcatOperator combines the functionalities of the Join and Split methods into one single struct
 type ConcatOperator struct {
 	Join
 	Split
+	Tombstone
+}
+
+// noTombstone rejects the removals for the formats that cannot represent them
+// their records are not read back from the file, so a removal could never be restored.
+func noTombstone(key store.Key) ([]byte, error) {
+	return nil, fmt.Errorf("%w: cannot serialize tombstone for '%v'", store.ErrNotSupported, key)
 }
 
 // IndexedConcat handles the concatenation logic
@@ -34,6 +44,7 @@ func IndexedConcat() ConcatOperator {
 			n := len(data) - len(nl)
 			return store.NewElement(key, data[0:n]), nil
 		},
+		Tombstone: noTombstone,
 	}
 }
 
@@ -52,5 +63,37 @@ func RawConcat() ConcatOperator {
 			n := len(data) - len(nl)
 			return store.NewElement(key, data[0:n+1]), nil
 		},
+		Tombstone: noTombstone,
+	}
+}
+
+// RecordConcat handles the serialization logic for records that carry also the key and a checksum
+// this allows the storage to be restored from the file
+func RecordConcat() ConcatOperator {
+	return ConcatOperator{
+		Join: func(element store.Element) ([]byte, error) {
+			b, err := bytes.EncodeRecord(bytes.Record{Key: element.Key, Value: element.Value})
+			if err != nil {
+				return nil, fmt.Errorf("could not serialize record %w", err)
+			}
+			return b, nil
+		},
+		Split: func(key store.Key, data []byte) (store.Element, error) {
+			record, err := bytes.DecodeRecord(data)
+			if err != nil {
+				return store.Nil, fmt.Errorf("could not deserialize record %w", err)
+			}
+			if !store.BytesEqual(key, record.Key) {
+				return store.Nil, fmt.Errorf("record key '%v' does not match '%v'", record.Key, key)
+			}
+			return store.NewElement(key, record.Value), nil
+		},
+		Tombstone: func(key store.Key) ([]byte, error) {
+			b, err := bytes.EncodeRecord(bytes.Record{Key: key, Tombstone: true})
+			if err != nil {
+				return nil, fmt.Errorf("could not serialize tombstone %w", err)
+			}
+			return b, nil
+		},
 	}
 }
@@ -0,0 +1,119 @@
+package store
+
+import "errors"
+
+// Batcher is implemented by the storage implementations that can apply a group of writes atomically
+type Batcher interface {
+	// NewBatch creates an empty batch for the storage
+	NewBatch() Batch
+}
+
+// Batch collects writes, that are applied to the storage all together on Commit
+// none of the writes is visible before the commit, and either all or none of them are applied.
+// Deleting a key that is not in the storage is not an error within a batch.
+type Batch interface {
+	// Put adds the element to the batch
+	Put(element Element)
+	// Delete adds the removal of the element for the given key to the batch
+	Delete(key Key)
+	// Commit applies all the writes of the batch in the order they were added
+	Commit() error
+}
+
+// Write is a single operation of a batch
+type Write struct {
+	Element
+	// Delete marks the removal of the element for the key
+	Delete bool
+}
+
+// WriteBatch is a batch that collects the writes in order
+// and hands them over to the storage specific commit function
+type WriteBatch struct {
+	writes []Write
+	commit func(writes []Write) error
+}
+
+// NewWriteBatch creates a new batch, that is applied with the given commit function
+func NewWriteBatch(commit func(writes []Write) error) *WriteBatch {
+	return &WriteBatch{
+		writes: make([]Write, 0),
+		commit: commit,
+	}
+}
+
+// Put adds the element to the batch
+func (b *WriteBatch) Put(element Element) {
+	b.writes = append(b.writes, Write{Element: element})
+}
+
+// Delete adds the removal of the element for the given key to the batch
+func (b *WriteBatch) Delete(key Key) {
+	b.writes = append(b.writes, Write{Element: NewElement(key, nil), Delete: true})
+}
+
+// Commit applies the writes of the batch
+// the batch is emptied afterwards, so that it can be re-used
+func (b *WriteBatch) Commit() error {
+	writes := b.writes
+	b.writes = make([]Write, 0)
+	return b.commit(writes)
+}
+
+// Len returns the number of writes in the batch
+func (b *WriteBatch) Len() int {
+	return len(b.writes)
+}
+
+// Apply executes the writes one after the other on the given storage
+// if one of them fails, the ones already applied are rolled back to the previous values of their keys,
+// so that the batch is applied either as a whole or not at all.
+// The caller is responsible for making them atomic towards other operations e.g. by holding the storage lock
+func Apply(storage Storage, writes []Write) error {
+	undo := make([]Write, 0, len(writes))
+	for _, w := range writes {
+		previous, err := previous(storage, w.Key)
+		if err == nil {
+			err = apply(storage, w)
+		}
+		if err != nil {
+			rollback(storage, undo)
+			return err
+		}
+		undo = append(undo, previous)
+	}
+	return nil
+}
+
+// previous returns the write that restores the current state of the key
+func previous(storage Storage, key Key) (Write, error) {
+	element, err := storage.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return Write{Element: NewElement(key, nil), Delete: true}, nil
+	}
+	if err != nil {
+		return Write{}, err
+	}
+	return Write{Element: element}, nil
+}
+
+// apply executes a single write on the storage
+// a missing key is not an error for a delete within a batch
+func apply(storage Storage, w Write) error {
+	if w.Delete {
+		err := storage.Delete(w.Key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	return storage.Put(w.Element)
+}
+
+// rollback reverts the applied writes in reverse order
+// it is a best effort, as the storage already failed once
+func rollback(storage Storage, undo []Write) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		_ = apply(storage, undo[i])
+	}
+}
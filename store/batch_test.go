@@ -0,0 +1,55 @@
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// rejecting is a storage that fails the writes for one key
+type rejecting struct {
+	store.Storage
+	key store.Key
+}
+
+var errRejecting = errors.New("rejected write")
+
+func (r rejecting) Put(element store.Element) error {
+	if bytes.Equal(element.Key, r.key) {
+		return errRejecting
+	}
+	return r.Storage.Put(element)
+}
+
+func TestApply_Rollback(t *testing.T) {
+
+	elements := test.Elements(10, test.Random(10, 20))
+	storage := mem.NewCache()
+	for _, element := range elements[:5] {
+		err := storage.Put(element)
+		assert.NoError(t, err)
+	}
+
+	writes := []store.Write{
+		{Element: store.NewElement(elements[0].Key, []byte("updated"))},
+		{Element: store.NewElement(elements[1].Key, nil), Delete: true},
+		{Element: elements[5]},
+		{Element: elements[6]},
+	}
+	err := store.Apply(rejecting{Storage: storage, key: elements[6].Key}, writes)
+	assert.ErrorIs(t, err, errRejecting)
+
+	// the storage is left as it was before the batch
+	for _, element := range elements[:5] {
+		test.IntermediateReadOperation(t, storage, element.Key, element.Value)
+	}
+	_, err = storage.Get(elements[5].Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.Equal(t, uint64(5), storage.Metadata().Size)
+
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// WritePolicy defines how the writes to a cached storage reach the back storage
+type WritePolicy int
+
+const (
+	// WriteThrough writes to the back storage synchronously, before updating the front storage
+	WriteThrough WritePolicy = iota
+	// WriteBack writes to the front storage, and flushes the writes to the back storage asynchronously
+	WriteBack
+)
+
+// defaultQueueSize is the size of the flush queue, if none is given in the policy
+const defaultQueueSize = 1024
+
+// CachePolicy configures a cached storage
+type CachePolicy struct {
+	// Write is the policy for the writes
+	Write WritePolicy
+	// ReadThrough fills the front storage with the elements read from the back storage on a miss
+	ReadThrough bool
+	// QueueSize is the number of writes waiting to be flushed for the WriteBack policy, beyond which the writes block
+	QueueSize int
+}
+
+// write is a change to the back storage, that has not been flushed yet
+type write struct {
+	value   Value
+	deleted bool
+}
+
+// CachedStorage is a storage layer, that serves the reads from a fast front storage
+// and keeps the elements in a slower back storage.
+// The front storage is read concurrently, so it needs to be thread-safe,
+// while the back storage is accessed under the lock of the layer.
+type CachedStorage struct {
+	front  Storage
+	back   Storage
+	policy CachePolicy
+	// mutex guards the access to the back storage and the pending writes
+	// the reads that hit the front storage only take the read lock
+	mutex sync.RWMutex
+	// pending holds the latest write for every key, that is not yet flushed
+	pending map[string]write
+	// flushed is signalled every time the pending writes are emptied
+	flushed *sync.Cond
+	// queue carries the keys of the pending writes to the flushing routine
+	queue   chan string
+	senders sync.WaitGroup
+	done    chan struct{}
+	errors  []error
+	closed  bool
+	hits    uint64
+	misses  uint64
+}
+
+// NewCachedStorage creates a cached storage with the given front and back storage
+// for the WriteBack policy, it starts the routine that flushes the writes, which is stopped by Close.
+func NewCachedStorage(front, back StorageFactory, policy CachePolicy) *CachedStorage {
+	c := &CachedStorage{
+		front:   front(),
+		back:    back(),
+		policy:  policy,
+		pending: make(map[string]write),
+		errors:  make([]error, 0),
+	}
+	c.flushed = sync.NewCond(&c.mutex)
+	if policy.Write == WriteBack {
+		size := policy.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		c.queue = make(chan string, size)
+		c.done = make(chan struct{})
+		go c.flush()
+	}
+	return c
+}
+
+// CachedStorageFactory generates a cached storage implementation
+func CachedStorageFactory(front, back StorageFactory, policy CachePolicy) StorageFactory {
+	return func() Storage {
+		return NewCachedStorage(front, back, policy)
+	}
+}
+
+// Put adds an element to the storage
+func (c *CachedStorage) Put(element Element) error {
+	if c.policy.Write == WriteBack {
+		return c.enqueue(element.Key, write{value: element.Value})
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.back.Put(element)
+	if err != nil {
+		return err
+	}
+	c.fill(element)
+	return nil
+}
+
+// Get retrieves the element for the given key
+// it reads from the front storage, and falls back to the back storage on a miss.
+func (c *CachedStorage) Get(key Key) (Element, error) {
+	c.mutex.RLock()
+	element, ok, err := c.cached(key)
+	c.mutex.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return element, err
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return Element{}, ErrClosed
+	}
+	// a write might have come in, while the lock was released
+	if element, ok, err := c.cached(key); ok {
+		return element, err
+	}
+	element, err = c.back.Get(key)
+	if err != nil {
+		return element, err
+	}
+	if c.policy.ReadThrough {
+		c.fill(element)
+	}
+	return element, nil
+}
+
+// cached looks up the element in the pending writes and the front storage
+// it returns false, if the back storage needs to be consulted.
+func (c *CachedStorage) cached(key Key) (Element, bool, error) {
+	if c.closed {
+		return Element{}, true, ErrClosed
+	}
+	if w, ok := c.pending[string(key)]; ok {
+		if w.deleted {
+			return Element{}, true, NotFound(key)
+		}
+		return NewElement(key, w.value), true, nil
+	}
+	element, err := c.front.Get(key)
+	if err == nil {
+		return element, true, nil
+	}
+	return Element{}, false, nil
+}
+
+// Delete removes the element for the given key
+func (c *CachedStorage) Delete(key Key) error {
+	if c.policy.Write == WriteBack {
+		return c.enqueue(key, write{deleted: true})
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.back.Delete(key)
+	if err != nil {
+		return err
+	}
+	_ = c.front.Delete(key)
+	return nil
+}
+
+// fill puts the element into the front storage
+// the front storage is only a cache, so if it cannot keep the element, any stale copy is dropped instead.
+func (c *CachedStorage) fill(element Element) {
+	if err := c.front.Put(element); err != nil {
+		_ = c.front.Delete(element.Key)
+	}
+}
+
+// enqueue records the write as pending, and hands it over to the flushing routine
+func (c *CachedStorage) enqueue(key Key, w write) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	if w.deleted {
+		if err := c.exists(key); err != nil {
+			c.mutex.Unlock()
+			return err
+		}
+		_ = c.front.Delete(key)
+	} else {
+		c.fill(NewElement(key, w.value))
+	}
+	c.pending[string(key)] = w
+	c.senders.Add(1)
+	c.mutex.Unlock()
+
+	// the queue only carries the key, the flush picks up the latest write for it,
+	// so that the order the keys are queued in does not matter
+	defer c.senders.Done()
+	c.queue <- string(key)
+	return nil
+}
+
+// exists checks if there is an element for the key, in any of the storages
+func (c *CachedStorage) exists(key Key) error {
+	if _, ok, err := c.cached(key); ok {
+		return err
+	}
+	_, err := c.back.Get(key)
+	return err
+}
+
+// flush applies the pending writes to the back storage, until the queue is closed
+func (c *CachedStorage) flush() {
+	defer close(c.done)
+	for key := range c.queue {
+		c.mutex.Lock()
+		if w, ok := c.pending[key]; ok {
+			// the write might have been flushed already, if the key was queued more than once
+			var err error
+			if w.deleted {
+				err = c.back.Delete(Key(key))
+				if errors.Is(err, ErrNotFound) {
+					// the element was never flushed in the first place
+					err = nil
+				}
+			} else {
+				err = c.back.Put(NewElement(Key(key), w.value))
+			}
+			if err != nil {
+				c.errors = append(c.errors, err)
+			}
+			delete(c.pending, key)
+			if len(c.pending) == 0 {
+				c.flushed.Broadcast()
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// Flush waits until all the pending writes have been applied to the back storage
+func (c *CachedStorage) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.pending) > 0 {
+		c.flushed.Wait()
+	}
+}
+
+// Metadata returns the metadata of the back storage, along with the hits and misses of the front storage
+// it waits for the pending writes to be flushed first, and reports the errors of the flushes, if any.
+func (c *CachedStorage) Metadata() Metadata {
+	c.Flush()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metadata := c.back.Metadata()
+	metadata.Hits = atomic.LoadUint64(&c.hits)
+	metadata.Misses = atomic.LoadUint64(&c.misses)
+	metadata.Evictions = c.front.Metadata().Evictions
+	for _, err := range c.errors {
+		metadata.Error(err)
+	}
+	return metadata
+}
+
+// Close flushes the pending writes, and closes both the front and the back storage
+// it returns the first error of the flushes, if any.
+func (c *CachedStorage) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	if c.queue != nil {
+		// the writes that were accepted before closing still need to get through
+		c.senders.Wait()
+		close(c.queue)
+		<-c.done
+	}
+
+	var err error
+	if len(c.errors) > 0 {
+		err = c.errors[0]
+	}
+	if frontErr := c.front.Close(); err == nil {
+		err = frontErr
+	}
+	if backErr := c.back.Close(); err == nil {
+		err = backErr
+	}
+	return err
+}
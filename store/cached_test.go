@@ -0,0 +1,140 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/file"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var cachePolicies = map[string]store.CachePolicy{
+	"write-through":              {Write: store.WriteThrough},
+	"write-through-read-through": {Write: store.WriteThrough, ReadThrough: true},
+	"write-back":                 {Write: store.WriteBack},
+	"write-back-read-through":    {Write: store.WriteBack, ReadThrough: true, QueueSize: 10},
+}
+
+func TestCachedStorage_KeyValueImplementation(t *testing.T) {
+	for name, policy := range cachePolicies {
+		t.Run(name, func(t *testing.T) {
+			// a front storage that is too small to hold all the elements
+			new(test.ConsistencyWithMeta).Run(t, store.CachedStorageFactory(mem.SyncBoundedCacheFactory(mem.Entries(100), mem.LRU), mem.SyncBTreeFactory, policy))
+		})
+	}
+}
+
+func TestCachedStorage_SyncImplementation(t *testing.T) {
+	for name, policy := range cachePolicies {
+		t.Run(name, func(t *testing.T) {
+			new(test.Concurrency).Run(t, store.CachedStorageFactory(mem.SyncBoundedCacheFactory(mem.Entries(100), mem.LRU), mem.SyncBTreeFactory, policy))
+		})
+	}
+}
+
+func TestCachedStorage_ReadThrough(t *testing.T) {
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for _, readThrough := range []bool{false, true} {
+
+		back := mem.SyncBTreeFactory()
+		for _, element := range elements {
+			err := back.Put(element)
+			assert.NoError(t, err)
+		}
+
+		cached := store.NewCachedStorage(mem.SyncCacheFactory, func() store.Storage {
+			return back
+		}, store.CachePolicy{ReadThrough: readThrough})
+		for i := 0; i < 2; i++ {
+			for _, element := range elements {
+				test.IntermediateReadOperation(t, cached, element.Key, element.Value)
+			}
+		}
+
+		metadata := cached.Metadata()
+		if readThrough {
+			// the second round of reads is served by the front storage
+			assert.Equal(t, uint64(10), metadata.Hits)
+			assert.Equal(t, uint64(10), metadata.Misses)
+			assert.Equal(t, 0.5, metadata.HitRatio())
+		} else {
+			assert.Equal(t, uint64(0), metadata.Hits)
+			assert.Equal(t, uint64(20), metadata.Misses)
+			assert.Equal(t, 0.0, metadata.HitRatio())
+		}
+
+		err := cached.Close()
+		assert.NoError(t, err)
+	}
+
+}
+
+func TestCachedStorage_WriteBackClose(t *testing.T) {
+
+	path := t.TempDir()
+	cached := store.NewCachedStorage(mem.SyncCacheFactory, file.SyncScratchPadFactory(path), store.CachePolicy{Write: store.WriteBack, QueueSize: 1})
+
+	elements := test.Elements(100, test.Random(10, 20))
+	for _, element := range elements {
+		err := cached.Put(element)
+		assert.NoError(t, err)
+	}
+	for _, element := range elements[:10] {
+		err := cached.Delete(element.Key)
+		assert.NoError(t, err)
+	}
+	err := cached.Delete(elements[0].Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// the pending writes are flushed on close
+	err = cached.Close()
+	assert.NoError(t, err)
+	err = cached.Put(elements[0])
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+	pad, err := file.OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	for _, element := range elements[10:] {
+		test.IntermediateReadOperation(t, pad, element.Key, element.Value)
+	}
+	for _, element := range elements[:10] {
+		_, err := pad.Get(element.Key)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	}
+	assert.Equal(t, uint64(90), pad.Metadata().Size)
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+// failing is a storage that rejects all the writes
+type failing struct {
+	store.Storage
+}
+
+var errFailing = errors.New("failing write")
+
+func (failing) Put(element store.Element) error {
+	return errFailing
+}
+
+func TestCachedStorage_WriteBackErrors(t *testing.T) {
+
+	cached := store.NewCachedStorage(mem.SyncCacheFactory, func() store.Storage {
+		return failing{mem.NewSyncCache()}
+	}, store.CachePolicy{Write: store.WriteBack})
+
+	err := cached.Put(test.Random(10, 20).ElementFactory())
+	assert.NoError(t, err)
+
+	// the flush error is reported asynchronously
+	metadata := cached.Metadata()
+	assert.Equal(t, 1, len(metadata.Errors))
+	err = cached.Close()
+	assert.ErrorIs(t, err, errFailing)
+
+}
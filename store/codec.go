@@ -0,0 +1,106 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec transforms objects of a given type to the byte slices of the storage and back
+type Codec[T any] interface {
+	// Encode serializes the object
+	Encode(v T) ([]byte, error)
+	// Decode re-creates the object from its serialized form
+	Decode(b []byte) (T, error)
+}
+
+// JSONCodec serializes the objects with encoding/json
+// the encoded keys do not keep the order of the objects, e.g. 10 sorts before 2,
+// so the keys that need to be scanned in order should use the tuple codecs instead.
+type JSONCodec[T any] struct{}
+
+// Encode serializes the object to json
+func (JSONCodec[T]) Encode(v T) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal %v to json: %w", v, err)
+	}
+	return b, nil
+}
+
+// Decode re-creates the object from json
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, fmt.Errorf("could not unmarshal json: %w", err)
+	}
+	return v, nil
+}
+
+// GobCodec serializes the objects with encoding/gob
+// every object is encoded with its own type information, so that it can be decoded on its own.
+type GobCodec[T any] struct{}
+
+// Encode serializes the object to gob
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := gob.NewEncoder(buffer).Encode(v); err != nil {
+		return nil, fmt.Errorf("could not encode %v to gob: %w", v, err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decode re-creates the object from gob
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v); err != nil {
+		return v, fmt.Errorf("could not decode gob: %w", err)
+	}
+	return v, nil
+}
+
+// ProtoCodec serializes protocol buffer messages
+type ProtoCodec[T proto.Message] struct {
+	constructor func() T
+}
+
+// NewProtoCodec creates a codec for protocol buffer messages
+// the constructor creates the empty message, that the serialized form is decoded into.
+func NewProtoCodec[T proto.Message](constructor func() T) ProtoCodec[T] {
+	return ProtoCodec[T]{constructor: constructor}
+}
+
+// Encode serializes the message to the protocol buffer wire format
+func (c ProtoCodec[T]) Encode(v T) ([]byte, error) {
+	b, err := proto.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal %v to protobuf: %w", v, err)
+	}
+	return b, nil
+}
+
+// Decode re-creates the message from the protocol buffer wire format
+func (c ProtoCodec[T]) Decode(b []byte) (T, error) {
+	v := c.constructor()
+	if err := proto.Unmarshal(b, v); err != nil {
+		return v, fmt.Errorf("could not unmarshal protobuf: %w", err)
+	}
+	return v, nil
+}
+
+// RawCodec passes byte slices and strings through as they are
+// it preserves the order of the keys, so that a storage scan returns them sorted.
+type RawCodec[T ~[]byte | ~string] struct{}
+
+// Encode returns the bytes of the object
+func (RawCodec[T]) Encode(v T) ([]byte, error) {
+	return []byte(v), nil
+}
+
+// Decode returns the object for the bytes
+func (RawCodec[T]) Decode(b []byte) (T, error) {
+	return T(b), nil
+}
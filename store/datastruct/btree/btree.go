@@ -2,7 +2,6 @@ package btree
 
 import (
 	"sort"
-	"sync/atomic"
 
 	"github.com/drakos74/lachesis/store/store"
 )
@@ -67,37 +66,101 @@ func (t *BTree) Get(key store.Element) store.Element {
 	return t.root.get(key)
 }
 
-// Stats returns the stats of the Btree
-func (t *BTree) Stats() (count, keySize, valueSize uint64) {
-	var nodeCount uint64
-	var depth uint64
-	stats(t.root, &count, &nodeCount, &depth, &keySize, &valueSize)
-	return
+// Delete removes an item equal to the passed in item from the tree, returning
+// it.  If no such item exists, returns Nil.
+func (t *BTree) Delete(item store.Element) store.Element {
+	if t.root == nil || len(t.root.elements) == 0 {
+		return store.Nil
+	}
+	out := t.root.remove(item, t.minElements(), removeItem)
+	if len(t.root.elements) == 0 && len(t.root.children) > 0 {
+		// the root has been merged into its only child
+		t.root = t.root.children[0]
+	}
+	if !store.IsNil(out) {
+		t.length--
+	}
+	return out
 }
 
-func stats(n *node, count, nodes, depth, keySize, valueSize *uint64) {
+// ItemIterator allows callers of AscendRange to iterate in-order over portions of the tree.
+// When this function returns false, iteration will stop.
+type ItemIterator func(item store.Element) bool
 
-	if n == nil {
+// AscendRange calls the iterator for every value in the tree within the range
+// [greaterOrEqual, lessThan), until iterator returns false.
+// A Nil element leaves the corresponding side of the range unbounded.
+func (t *BTree) AscendRange(greaterOrEqual, lessThan store.Element, iterator ItemIterator) {
+	if t.root == nil {
 		return
 	}
+	t.root.ascend(greaterOrEqual, lessThan, iterator)
+}
 
-	atomic.AddUint64(count, uint64(len(n.elements)))
+// Ascend calls the iterator for every value in the tree in ascending order, until iterator returns false.
+func (t *BTree) Ascend(iterator ItemIterator) {
+	t.AscendRange(store.Nil, store.Nil, iterator)
+}
 
-	for _, e := range n.elements {
-		atomic.AddUint64(keySize, uint64(len(e.Key)))
-		atomic.AddUint64(valueSize, uint64(len(e.Value)))
+// Descend calls the iterator for every value in the tree in descending order, until iterator returns false.
+func (t *BTree) Descend(iterator ItemIterator) {
+	if t.root == nil {
+		return
 	}
+	t.root.descend(iterator)
+}
 
-	atomic.AddUint64(nodes, uint64(len(n.children)))
-
-	if len(n.children) > 0 {
-		atomic.AddUint64(depth, 1)
+// Min returns the smallest element in the tree, or Nil if the tree is empty.
+func (t *BTree) Min() store.Element {
+	n := t.root
+	if n == nil || len(n.elements) == 0 {
+		return store.Nil
 	}
+	for len(n.children) > 0 {
+		n = n.children[0]
+	}
+	return n.elements[0]
+}
 
-	for _, c := range n.children {
-		stats(c, count, nodes, depth, keySize, valueSize)
+// Max returns the largest element in the tree, or Nil if the tree is empty.
+func (t *BTree) Max() store.Element {
+	n := t.root
+	if n == nil || len(n.elements) == 0 {
+		return store.Nil
+	}
+	for len(n.children) > 0 {
+		n = n.children[len(n.children)-1]
 	}
+	return n.elements[len(n.elements)-1]
+}
 
+// Len returns the number of elements in the tree
+func (t *BTree) Len() int {
+	return t.length
+}
+
+// Stats are the internal statistics of the btree
+type Stats struct {
+	Count       uint64
+	KeysBytes   uint64
+	ValuesBytes uint64
+	// Nodes is the number of nodes, including the root
+	Nodes uint64
+	// Height is the number of levels of the tree, with all the leaves on the last one
+	Height uint64
+	// Fill is the ratio of the elements to the number of elements all the nodes can hold
+	Fill float64
+}
+
+// Stats returns the stats of the Btree
+func (t *BTree) Stats() Stats {
+	var s Stats
+	if t.root == nil || len(t.root.elements) == 0 {
+		return s
+	}
+	t.root.stats(1, &s)
+	s.Fill = float64(s.Count) / float64(s.Nodes*uint64(t.maxElements()))
+	return s
 }
 
 type node struct {
@@ -149,6 +212,159 @@ func (n *node) get(key store.Element) store.Element {
 	return store.Nil
 }
 
+// toRemove details what item to remove in a node.remove call.
+type toRemove int
+
+const (
+	removeItem toRemove = iota // removes the given item
+	removeMin                  // removes smallest item in the subtree
+	removeMax                  // removes largest item in the subtree
+)
+
+// remove removes an item from the subtree rooted at this node.
+func (n *node) remove(item store.Element, minElements int, typ toRemove) store.Element {
+	var i int
+	var found bool
+	switch typ {
+	case removeMax:
+		if len(n.children) == 0 {
+			return n.elements.pop()
+		}
+		i = len(n.elements)
+	case removeMin:
+		if len(n.children) == 0 {
+			return n.elements.removeAt(0)
+		}
+		i = 0
+	case removeItem:
+		i, found = n.elements.find(item)
+		if len(n.children) == 0 {
+			if found {
+				return n.elements.removeAt(i)
+			}
+			return store.Nil
+		}
+	default:
+		panic("invalid remove type")
+	}
+	// if we get here, we have children
+	if len(n.children[i].elements) <= minElements {
+		return n.growChildAndRemove(i, item, minElements, typ)
+	}
+	child := n.children[i]
+	if found {
+		// the item exists at index 'i', and the child can give us a predecessor,
+		// as it has more than minElements elements in it
+		out := n.elements[i]
+		n.elements[i] = child.remove(store.Nil, minElements, removeMax)
+		return out
+	}
+	// the item is not in this node and the child is big enough to remove from
+	return child.remove(item, minElements, typ)
+}
+
+// growChildAndRemove grows child 'i' to make sure it's possible to remove an
+// item from it while keeping it at minElements, then calls remove to actually
+// remove it.
+// The child is grown by stealing from the left or right sibling, or merging with the right one,
+// so that the second remove call is guaranteed to find enough elements.
+func (n *node) growChildAndRemove(i int, item store.Element, minElements int, typ toRemove) store.Element {
+	if i > 0 && len(n.children[i-1].elements) > minElements {
+		// steal from left child
+		child := n.children[i]
+		stealFrom := n.children[i-1]
+		stolenItem := stealFrom.elements.pop()
+		child.elements.insertAt(0, n.elements[i-1])
+		n.elements[i-1] = stolenItem
+		if len(stealFrom.children) > 0 {
+			child.children.insertAt(0, stealFrom.children.pop())
+		}
+	} else if i < len(n.elements) && len(n.children[i+1].elements) > minElements {
+		// steal from right child
+		child := n.children[i]
+		stealFrom := n.children[i+1]
+		stolenItem := stealFrom.elements.removeAt(0)
+		child.elements = append(child.elements, n.elements[i])
+		n.elements[i] = stolenItem
+		if len(stealFrom.children) > 0 {
+			child.children = append(child.children, stealFrom.children.removeAt(0))
+		}
+	} else {
+		if i >= len(n.elements) {
+			i--
+		}
+		// merge with right child
+		child := n.children[i]
+		mergeItem := n.elements.removeAt(i)
+		mergeChild := n.children.removeAt(i + 1)
+		child.elements = append(child.elements, mergeItem)
+		child.elements = append(child.elements, mergeChild.elements...)
+		child.children = append(child.children, mergeChild.children...)
+	}
+	return n.remove(item, minElements, typ)
+}
+
+// ascend iterates in order over the elements of the subtree within the range [start, stop)
+// it returns false if the iteration was stopped by the iterator or the end of the range
+func (n *node) ascend(start, stop store.Element, iterator ItemIterator) bool {
+	var i int
+	if !store.IsNil(start) {
+		i, _ = n.elements.find(start)
+	}
+	for ; i < len(n.elements); i++ {
+		if len(n.children) > 0 {
+			if !n.children[i].ascend(start, stop, iterator) {
+				return false
+			}
+		}
+		if !store.IsNil(stop) && !store.IsLess(n.elements[i], stop) {
+			return false
+		}
+		if !iterator(n.elements[i]) {
+			return false
+		}
+	}
+	if len(n.children) > 0 {
+		return n.children[len(n.children)-1].ascend(start, stop, iterator)
+	}
+	return true
+}
+
+// descend iterates in reverse order over the elements of the subtree
+// it returns false if the iteration was stopped by the iterator
+func (n *node) descend(iterator ItemIterator) bool {
+	for i := len(n.elements) - 1; i >= 0; i-- {
+		if len(n.children) > 0 {
+			if !n.children[i+1].descend(iterator) {
+				return false
+			}
+		}
+		if !iterator(n.elements[i]) {
+			return false
+		}
+	}
+	if len(n.children) > 0 {
+		return n.children[0].descend(iterator)
+	}
+	return true
+}
+
+// stats adds the stats of the subtree, where depth is the level of the node starting from 1 for the root
+func (n *node) stats(depth uint64, s *Stats) {
+	s.Nodes++
+	if depth > s.Height {
+		s.Height = depth
+	}
+	s.Count += uint64(len(n.elements))
+	for _, e := range n.elements {
+		s.KeysBytes += uint64(len(e.Key))
+		s.ValuesBytes += uint64(len(e.Value))
+	}
+	for _, c := range n.children {
+		c.stats(depth+1, s)
+	}
+}
+
 // maybeSplitChild checks if a child should be split, and if so splits it.
 // Returns whether or not a split occurred.
 func (n *node) maybeSplitChild(i, maxElements int) bool {
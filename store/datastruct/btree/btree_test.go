@@ -1,9 +1,13 @@
 package btree
 
 import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
 	"github.com/drakos74/lachesis/store/store/test"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestNode_New(t *testing.T) {
@@ -63,8 +67,8 @@ func TestBTree_PutGet(t *testing.T) {
 		tree.ReplaceOrInsert(element)
 	}
 
-	assert.Equal(t, 1, len(tree.root.elements))
-	assert.Equal(t, 2, len(tree.root.children))
+	// the shape of the tree depends on the order of the elements, but not its invariants
+	assertBTree(t, tree)
 
 	for _, element := range elements {
 		el := tree.Get(element)
@@ -83,26 +87,258 @@ func TestBTree_Count(t *testing.T) {
 		tree.ReplaceOrInsert(element)
 	}
 
-	assert.Equal(t, 2, len(tree.root.elements))
-	assert.Equal(t, 3, len(tree.root.children))
+	assertBTree(t, tree)
+
+	stats := tree.Stats()
+	assert.Equal(t, 100, int(stats.Count))
+	assert.Equal(t, 100, tree.Len())
+	assert.Equal(t, 100*5, int(stats.KeysBytes))
+	assert.Equal(t, 100*10, int(stats.ValuesBytes))
+
+	// with at most 7 and at least 3 elements per node, 100 elements fit into 3 levels
+	assert.Equal(t, 3, int(stats.Height))
+	assert.GreaterOrEqual(t, stats.Nodes, uint64(100/7))
+	assert.LessOrEqual(t, stats.Nodes, uint64(1+99/3))
+	assert.Equal(t, float64(stats.Count)/float64(stats.Nodes*7), stats.Fill)
+
+}
+
+func TestBTree_StatsEmpty(t *testing.T) {
+
+	tree := New(2)
+	assert.Equal(t, Stats{}, tree.Stats())
+
+	element := test.Random(5, 10).ElementFactory()
+	tree.ReplaceOrInsert(element)
+	assert.Equal(t, Stats{Count: 1, KeysBytes: 5, ValuesBytes: 10, Nodes: 1, Height: 1, Fill: 1.0 / 3}, tree.Stats())
+
+	tree.Delete(element)
+	assert.Equal(t, Stats{}, tree.Stats())
+
+}
+
+func TestBTree_Delete(t *testing.T) {
+
+	tree := New(2)
+
+	elements := test.Elements(100, test.Random(5, 10))
+
+	for _, element := range elements {
+		tree.ReplaceOrInsert(element)
+	}
+
+	for i, element := range elements {
+		if i%2 == 0 {
+			el := tree.Delete(element)
+			assert.Equal(t, element, el)
+		}
+	}
+
+	for i, element := range elements {
+		el := tree.Get(element)
+		if i%2 == 0 {
+			assert.Equal(t, store.Nil, el)
+		} else {
+			assert.Equal(t, element, el)
+		}
+	}
+
+	assertBTree(t, tree)
+	assert.Equal(t, 50, int(tree.Stats().Count))
+	assert.Equal(t, 50, tree.Len())
+
+	// delete the rest
+	for _, element := range elements {
+		tree.Delete(element)
+	}
+
+	assert.Equal(t, 0, int(tree.Stats().Count))
+	assert.Equal(t, 0, tree.Len())
+
+}
+
+func TestBTree_DeleteNotFound(t *testing.T) {
+
+	tree := New(2)
+
+	assert.Equal(t, store.Nil, tree.Delete(test.Random(5, 10).ElementFactory()))
+
+	elements := test.Elements(10, test.Random(5, 10))
+
+	for _, element := range elements {
+		tree.ReplaceOrInsert(element)
+	}
+
+	assert.Equal(t, store.Nil, tree.Delete(test.Random(5, 10).ElementFactory()))
+	assert.Equal(t, 10, tree.length)
+
+}
+
+func TestBTree_AscendRange(t *testing.T) {
+
+	tree := New(2)
+
+	elements := test.Elements(100, test.Random(5, 10))
+
+	for _, element := range elements {
+		tree.ReplaceOrInsert(element)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return store.IsLess(elements[i], elements[j])
+	})
+
+	// full range
+	all := make([]store.Element, 0)
+	tree.AscendRange(store.Nil, store.Nil, func(item store.Element) bool {
+		all = append(all, item)
+		return true
+	})
+	assert.Equal(t, elements, all)
+
+	// partial range
+	partial := make([]store.Element, 0)
+	tree.AscendRange(elements[10], elements[90], func(item store.Element) bool {
+		partial = append(partial, item)
+		return true
+	})
+	assert.Equal(t, elements[10:90], partial)
+
+	// stop the iteration early
+	count := 0
+	tree.AscendRange(store.Nil, store.Nil, func(item store.Element) bool {
+		count++
+		return count < 5
+	})
+	assert.Equal(t, 5, count)
+
+}
+
+func TestBTree_Descend(t *testing.T) {
+
+	tree := New(2)
+
+	elements := test.Elements(100, test.Random(5, 10))
+
+	for _, element := range elements {
+		tree.ReplaceOrInsert(element)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return store.IsLess(elements[j], elements[i])
+	})
+
+	all := make([]store.Element, 0)
+	tree.Descend(func(item store.Element) bool {
+		all = append(all, item)
+		return true
+	})
+	assert.Equal(t, elements, all)
+
+	// stop the iteration early
+	count := 0
+	tree.Descend(func(item store.Element) bool {
+		count++
+		return count < 5
+	})
+	assert.Equal(t, 5, count)
+
+}
+
+func TestBTree_MinMax(t *testing.T) {
+
+	tree := New(2)
+	assert.Equal(t, store.Nil, tree.Min())
+	assert.Equal(t, store.Nil, tree.Max())
+
+	elements := test.Elements(100, test.Random(5, 10))
+
+	for _, element := range elements {
+		tree.ReplaceOrInsert(element)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return store.IsLess(elements[i], elements[j])
+	})
 
-	// elements
-	var e uint64
-	// node count
-	var n uint64
-	// depth count e.g. nodes with children
-	var d uint64
-	// key size
-	var ks uint64
-	var vs uint64
+	assert.Equal(t, elements[0], tree.Min())
+	assert.Equal(t, elements[99], tree.Max())
 
-	stats(tree.root, &e, &n, &d, &ks, &vs)
+	tree.Delete(elements[0])
+	tree.Delete(elements[99])
+	assert.Equal(t, elements[1], tree.Min())
+	assert.Equal(t, elements[98], tree.Max())
 
-	assert.Equal(t, 100, int(e))
-	assert.Equal(t, 20, int(n))
-	assert.Equal(t, 4, int(d))
+}
 
-	assert.Equal(t, 100*5, int(ks))
-	assert.Equal(t, 100*10, int(vs))
+func TestBTree_Random(t *testing.T) {
+
+	for _, degree := range []int{2, 3, 10} {
+
+		tree := New(degree)
+		elements := make(map[string]store.Element)
+		generator := test.Random(2, 10)
+
+		for i := 0; i < 5000; i++ {
+			element := generator.ElementFactory()
+			// the short keys make both overwrites and deletes of existing keys quite common
+			if rand.Intn(3) == 0 {
+				_, exists := elements[string(element.Key)]
+				assert.Equal(t, exists, !store.IsNil(tree.Delete(element)))
+				delete(elements, string(element.Key))
+				continue
+			}
+			tree.ReplaceOrInsert(element)
+			elements[string(element.Key)] = element
+		}
+
+		assertBTree(t, tree)
+		assert.Equal(t, len(elements), tree.Len())
+		for _, element := range elements {
+			assert.Equal(t, element, tree.Get(element))
+		}
+	}
 
 }
+
+// assertBTree checks the invariants of the tree
+// the elements are in order, all the leaves are on the same level,
+// and every node other than the root holds between minElements and maxElements elements.
+func assertBTree(t *testing.T, tree *BTree) {
+	var previous store.Element
+	count := 0
+	tree.Ascend(func(item store.Element) bool {
+		if count > 0 {
+			assert.True(t, store.IsLess(previous, item))
+		}
+		previous = item
+		count++
+		return true
+	})
+	assert.Equal(t, tree.Len(), count)
+
+	if tree.root == nil {
+		return
+	}
+	leaves := make(map[int]int)
+	var check func(n *node, depth int)
+	check = func(n *node, depth int) {
+		assert.LessOrEqual(t, len(n.elements), tree.maxElements())
+		if n != tree.root {
+			assert.GreaterOrEqual(t, len(n.elements), tree.minElements())
+		}
+		if len(n.children) == 0 {
+			leaves[depth]++
+			return
+		}
+		assert.Equal(t, len(n.elements)+1, len(n.children))
+		for _, c := range n.children {
+			check(c, depth+1)
+		}
+	}
+	check(tree.root, 1)
+	assert.Equal(t, 1, len(leaves))
+	for depth := range leaves {
+		assert.Equal(t, uint64(depth), tree.Stats().Height)
+	}
+}
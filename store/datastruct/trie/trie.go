@@ -1,96 +1,266 @@
 package trie
 
 import (
-	"fmt"
+	"bytes"
+	"sort"
+
 	"github.com/drakos74/lachesis/store/store"
 )
 
-// Trie is a trie structure with keys and values made of byte arrays
-// TODO : review, check implementation and flavours of Trie(s) based on the theory
+// Trie is a path-compressed radix trie (Patricia trie) with keys and values made of byte arrays
+// every edge is labelled with a sequence of bytes instead of a single one,
+// so that chains of nodes with a single child collapse into one node.
+// It is not thread-safe.
 type Trie struct {
-	key   byte
-	value []byte
-	tries map[byte]Trie
+	root *node
+	// size, keys and values keep track of the number of pairs and their total size in bytes
+	size   int
+	keys   int
+	values int
+}
+
+// node is a node of the trie
+// the key of a node is the concatenation of the prefixes on the path from the root.
+type node struct {
+	prefix []byte
+	value  []byte
+	// leaf marks the nodes that hold a value, which might as well be empty
+	leaf bool
+	// children are sorted by the first byte of their prefix, which is unique among them
+	children []*node
 }
 
 // NewTrie creates a new Trie
-func NewTrie(b byte) *Trie {
-	return &Trie{
-		key:   b,
-		value: make([]byte, 0),
-		tries: make(map[byte]Trie),
-	}
+func NewTrie() *Trie {
+	return &Trie{root: &node{}}
 }
 
 // Commit adds the corresponding key-value pair to the Trie
+// it overwrites the value of the key, if it already exists, without affecting any other key.
 func (t *Trie) Commit(key []byte, value []byte) error {
-
-	if len(key) == 1 {
-		return t.add(key[:1], value)
+	n := t.root
+	rest := key
+	for len(rest) > 0 {
+		i, ok := n.child(rest[0])
+		if !ok {
+			n.insert(i, &node{prefix: clone(rest), value: value, leaf: true})
+			t.add(key, value)
+			return nil
+		}
+		c := n.children[i]
+		l := common(c.prefix, rest)
+		if l < len(c.prefix) {
+			// split the edge at the point where the key diverges
+			split := &node{prefix: c.prefix[:l], children: []*node{c}}
+			c.prefix = c.prefix[l:]
+			n.children[i] = split
+			c = split
+		}
+		n = c
+		rest = rest[l:]
 	}
-
-	b := key[0]
-	trie, ok := t.tries[b]
-
-	if ok {
-		// we already have this node ...
-		return trie.Commit(key[1:], value)
+	if n.leaf {
+		t.values -= len(n.value)
+		t.values += len(value)
+		n.value = value
+		return nil
 	}
-	// we dont have the rest of these nodes in the trie
-	return t.add(key, value)
+	n.value = value
+	n.leaf = true
+	t.add(key, value)
+	return nil
 }
 
 // Read reads the value for the corresponding key
+// an empty value is returned as found, as opposed to a missing key.
 func (t *Trie) Read(key []byte) ([]byte, bool) {
-
-	b := key[0]
-	trie, ok := t.tries[b]
-	if ok {
-		if len(key) > 1 {
-			return trie.Read(key[1:])
-		} else if len(trie.value) > 0 {
-			return trie.value, true
+	n := t.root
+	for len(key) > 0 {
+		i, ok := n.child(key[0])
+		if !ok {
+			return nil, false
+		}
+		n = n.children[i]
+		if !bytes.HasPrefix(key, n.prefix) {
+			return nil, false
 		}
+		key = key[len(n.prefix):]
+	}
+	if n.leaf {
+		return n.value, true
 	}
 	return nil, false
 }
 
-// with will directly override the value of the trie node.
-func (t *Trie) with(value []byte) Trie {
-	t.value = value
-	return *t
+// Remove removes the value for the corresponding key
+// it returns false if there was no value stored for the key
+func (t *Trie) Remove(key []byte) bool {
+	var parent *node
+	var index int
+	n := t.root
+	rest := key
+	for len(rest) > 0 {
+		i, ok := n.child(rest[0])
+		if !ok {
+			return false
+		}
+		c := n.children[i]
+		if !bytes.HasPrefix(rest, c.prefix) {
+			return false
+		}
+		parent, index, n = n, i, c
+		rest = rest[len(c.prefix):]
+	}
+	if !n.leaf {
+		return false
+	}
+	t.size--
+	t.keys -= len(key)
+	t.values -= len(n.value)
+	n.value = nil
+	n.leaf = false
+
+	if parent == nil {
+		// the empty key lives in the root, which is never pruned
+		return true
+	}
+	switch len(n.children) {
+	case 0:
+		// prune the node, as it does not lead to any other value
+		parent.children = append(parent.children[:index], parent.children[index+1:]...)
+		if parent != t.root && !parent.leaf && len(parent.children) == 1 {
+			parent.merge()
+		}
+	case 1:
+		n.merge()
+	}
+	return true
 }
 
-// add will add the value to the first and only child of the trie
-func (t *Trie) add(key []byte, value []byte) error {
+// Walk iterates in key order over the key-value pairs of the Trie within the range [from, to)
+// an empty from or to key leaves the corresponding side of the range unbounded.
+// The iteration stops if the given function returns false.
+func (t *Trie) Walk(from, to []byte, f func(key []byte, value []byte) bool) {
+	t.root.walk(make([]byte, 0), from, to, f)
+}
 
-	b := key[0]
-	trie := NewTrie(b)
-	if len(key) > 1 {
-		t.tries[b] = *trie
-		return trie.add(key[1:], value)
+// Prefix iterates in key order over the key-value pairs of the Trie with keys starting with the given prefix
+// The iteration stops if the given function returns false.
+func (t *Trie) Prefix(p []byte, f func(key []byte, value []byte) bool) {
+	n := t.root
+	path := make([]byte, 0)
+	for len(p) > 0 {
+		i, ok := n.child(p[0])
+		if !ok {
+			return
+		}
+		n = n.children[i]
+		path = concat(path, n.prefix)
+		if len(p) <= len(n.prefix) {
+			// the prefix ends within the edge, so all the keys of the node match
+			if !bytes.HasPrefix(n.prefix, p) {
+				return
+			}
+			break
+		}
+		if !bytes.HasPrefix(p, n.prefix) {
+			return
+		}
+		p = p[len(n.prefix):]
 	}
-	t.tries[b] = trie.with(value)
+	n.walk(path, nil, nil, f)
+}
 
-	return nil
+// Len returns the number of key-value pairs in the Trie
+func (t *Trie) Len() int {
+	return t.size
+}
+
+// add updates the stats for a new key
+func (t *Trie) add(key, value []byte) {
+	t.size++
+	t.keys += len(key)
+	t.values += len(value)
+}
+
+// child looks up the child starting with the given byte
+// if there is none, it returns the position where such a child would be inserted.
+func (n *node) child(b byte) (int, bool) {
+	i := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= b
+	})
+	return i, i < len(n.children) && n.children[i].prefix[0] == b
+}
+
+// insert adds the child at the given position
+func (n *node) insert(i int, child *node) {
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
+}
+
+// merge absorbs the only child of a node without a value
+// the first byte of the prefix stays the same, so the node keeps its position among its siblings.
+func (n *node) merge() {
+	child := n.children[0]
+	n.prefix = concat(n.prefix, child.prefix)
+	n.value = child.value
+	n.leaf = child.leaf
+	n.children = child.children
+}
+
+// walk visits the node and its children in order,
+// where path is the key of the node
+func (n *node) walk(path, from, to []byte, f func(key []byte, value []byte) bool) bool {
+	if n.leaf && (len(from) == 0 || bytes.Compare(path, from) >= 0) {
+		if !f(path, n.value) {
+			return false
+		}
+	}
+	for _, c := range n.children {
+		key := concat(path, c.prefix)
+		// every key from now on will be out of range
+		if len(to) > 0 && bytes.Compare(key, to) >= 0 {
+			return false
+		}
+		// skip the whole sub-trie, if all it's keys are before the start of the range
+		if len(from) > 0 && bytes.Compare(key, from) < 0 && !bytes.HasPrefix(from, key) {
+			continue
+		}
+		if !c.walk(key, from, to, f) {
+			return false
+		}
+	}
+	return true
 }
 
 // Metadata returns the internal stats for the Trie storage implementation
 func Metadata(trie *Trie) store.Metadata {
 	metadata := store.NewMetadata()
-	for _, t := range trie.tries {
-		metadata.Merge(Metadata(&t))
-		metadata.KeysBytes++
-	}
-	if trie.value != nil && len(trie.value) > 0 {
-		metadata.Size++
-		metadata.ValuesBytes += uint64(len(trie.value))
-	}
-	metadata.KeysBytes++
+	metadata.Size = uint64(trie.size)
+	metadata.KeysBytes = uint64(trie.keys)
+	metadata.ValuesBytes = uint64(trie.values)
 	return metadata
 }
 
-// String prints the contents of the whole Tries
-func (t *Trie) String() string {
-	return fmt.Sprintf("key:%v,value:%v,tries:\n\t-> %v", t.key, t.value, t.tries)
+// common returns the length of the common prefix of the given byte arrays
+func common(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// concat returns a new byte array with the contents of a followed by the ones of b
+func concat(a, b []byte) []byte {
+	c := make([]byte, len(a)+len(b))
+	copy(c, a)
+	copy(c[len(a):], b)
+	return c
+}
+
+// clone returns a copy of the byte array, so that the trie does not depend on the caller's memory
+func clone(b []byte) []byte {
+	return concat(nil, b)
 }
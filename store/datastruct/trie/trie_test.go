@@ -1,52 +1,17 @@
 package trie
 
 import (
+	"bytes"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func newTestTrie() *Trie {
-	k := byte('A')
-	trie := NewTrie(k)
-	return trie
-}
-
-func TestTrie_add(t *testing.T) {
-
-	trie := newTestTrie()
-
-	b := byte('s')
-
-	err := trie.add([]byte{b}, []byte{1})
-
-	assert.NoError(t, err)
-
-	assertRead(t, trie, []byte{b}, []byte{1})
-}
-
-func TestTrie_addOverwrite(t *testing.T) {
-
-	trie := newTestTrie()
-
-	b := byte('s')
-
-	err := trie.add([]byte{b}, []byte{1})
-
-	assert.NoError(t, err)
-
-	assertRead(t, trie, []byte{b}, []byte{1})
-
-	err = trie.add([]byte{b}, []byte{2})
-	assert.NoError(t, err)
-
-	assertRead(t, trie, []byte{b}, []byte{2})
-
-}
-
 func TestTrie_Commit(t *testing.T) {
 
-	trie := newTestTrie()
+	trie := NewTrie()
 
 	b := []byte("demo")
 
@@ -58,7 +23,7 @@ func TestTrie_Commit(t *testing.T) {
 
 func TestTrie_MultiCommit(t *testing.T) {
 
-	trie := newTestTrie()
+	trie := NewTrie()
 
 	b1 := []byte("demo1")
 	b2 := []byte("demo2")
@@ -77,11 +42,16 @@ func TestTrie_MultiCommit(t *testing.T) {
 	assertRead(t, trie, b2, []byte{2})
 	assertRead(t, trie, b3, []byte{3})
 
+	// the common prefix is kept in a single node
+	assert.Equal(t, 1, len(trie.root.children))
+	assert.Equal(t, []byte("demo"), trie.root.children[0].prefix)
+	assert.Equal(t, 3, len(trie.root.children[0].children))
+
 }
 
 func TestTrie_CommitOvewrite(t *testing.T) {
 
-	trie := newTestTrie()
+	trie := NewTrie()
 
 	b := []byte("demo")
 
@@ -92,11 +62,50 @@ func TestTrie_CommitOvewrite(t *testing.T) {
 	assert.NoError(t, err)
 
 	assertRead(t, trie, b, []byte{2})
+	assert.Equal(t, 1, trie.Len())
+
+}
+
+func TestTrie_CommitPrefix(t *testing.T) {
+
+	trie := NewTrie()
+
+	// a shorter key must not override the keys it is a prefix of, whatever the order
+	keys := []string{"demo1", "demo", "d", "demo12", "dem"}
+	for i, k := range keys {
+		err := trie.Commit([]byte(k), []byte{byte(i + 1)})
+		assert.NoError(t, err)
+	}
+	for i, k := range keys {
+		assertRead(t, trie, []byte(k), []byte{byte(i + 1)})
+	}
+	assert.Equal(t, len(keys), trie.Len())
+
+}
+
+func TestTrie_EmptyValue(t *testing.T) {
+
+	trie := NewTrie()
+
+	err := trie.Commit([]byte("demo"), []byte{})
+	assert.NoError(t, err)
+	err = trie.Commit([]byte(""), []byte{})
+	assert.NoError(t, err)
+
+	assertRead(t, trie, []byte("demo"), []byte{})
+	assertRead(t, trie, []byte(""), []byte{})
+	assert.Equal(t, 2, trie.Len())
+
+	assert.True(t, trie.Remove([]byte("demo")))
+	assert.True(t, trie.Remove([]byte("")))
+	_, ok := trie.Read([]byte(""))
+	assert.False(t, ok)
+	assert.Equal(t, 0, trie.Len())
 
 }
 
 func TestTrie_ReadNotFoundExtended(t *testing.T) {
-	trie := newTestTrie()
+	trie := NewTrie()
 
 	b := []byte("demo")
 
@@ -112,7 +121,7 @@ func TestTrie_ReadNotFoundExtended(t *testing.T) {
 }
 
 func TestTrie_ReadNotFoundWithin(t *testing.T) {
-	trie := newTestTrie()
+	trie := NewTrie()
 
 	b := []byte("demo")
 
@@ -125,6 +134,75 @@ func TestTrie_ReadNotFoundWithin(t *testing.T) {
 
 	assert.False(t, ok)
 	assert.Nil(t, v)
+
+	v, ok = trie.Read([]byte("deno"))
+
+	assert.False(t, ok)
+	assert.Nil(t, v)
+}
+
+func TestTrie_Remove(t *testing.T) {
+	trie := NewTrie()
+
+	b1 := []byte("demo")
+	b2 := []byte("demo1")
+
+	err := trie.Commit(b1, []byte{1})
+	assert.NoError(t, err)
+	err = trie.Commit(b2, []byte{2})
+	assert.NoError(t, err)
+
+	ok := trie.Remove(b1)
+	assert.True(t, ok)
+
+	v, ok := trie.Read(b1)
+	assert.False(t, ok)
+	assert.Nil(t, v)
+
+	// the longer key should still be reachable
+	assertRead(t, trie, b2, []byte{2})
+	// through a single node
+	assert.Equal(t, b2, trie.root.children[0].prefix)
+
+	ok = trie.Remove(b2)
+	assert.True(t, ok)
+
+	// nothing should be left in the trie
+	assert.Equal(t, 0, len(trie.root.children))
+	assert.Equal(t, 0, trie.Len())
+}
+
+func TestTrie_RemoveMerge(t *testing.T) {
+	trie := NewTrie()
+
+	for i, k := range []string{"demo1", "demo2", "dem"} {
+		err := trie.Commit([]byte(k), []byte{byte(i + 1)})
+		assert.NoError(t, err)
+	}
+
+	assert.True(t, trie.Remove([]byte("demo1")))
+
+	// the node without a value merges with its only child
+	assert.Equal(t, []byte("dem"), trie.root.children[0].prefix)
+	assert.Equal(t, []byte("o2"), trie.root.children[0].children[0].prefix)
+	assertRead(t, trie, []byte("demo2"), []byte{2})
+	assertRead(t, trie, []byte("dem"), []byte{3})
+}
+
+func TestTrie_RemoveNotFound(t *testing.T) {
+	trie := NewTrie()
+
+	b := []byte("demo")
+
+	err := trie.Commit(b, []byte{1})
+	assert.Nil(t, err)
+
+	assert.False(t, trie.Remove([]byte("dem")))
+	assert.False(t, trie.Remove([]byte("demo1")))
+	assert.False(t, trie.Remove([]byte("other")))
+	assert.False(t, trie.Remove([]byte("")))
+
+	assertRead(t, trie, b, []byte{1})
 }
 
 func assertRead(t *testing.T, trie *Trie, key []byte, value []byte) {
@@ -132,3 +210,102 @@ func assertRead(t *testing.T, trie *Trie, key []byte, value []byte) {
 	assert.True(t, ok)
 	assert.Equal(t, value, v)
 }
+
+func TestTrie_Walk(t *testing.T) {
+	trie := NewTrie()
+
+	keys := []string{"demo3", "b", "demo", "de", "abc", "demo1", "demo2"}
+
+	for i, k := range keys {
+		err := trie.Commit([]byte(k), []byte{byte(i + 1)})
+		assert.NoError(t, err)
+	}
+
+	assertWalk(t, trie, "", "", "abc", "b", "de", "demo", "demo1", "demo2", "demo3")
+	assertWalk(t, trie, "b", "demo2", "b", "de", "demo", "demo1")
+	assertWalk(t, trie, "dem", "", "demo", "demo1", "demo2", "demo3")
+	assertWalk(t, trie, "", "de", "abc", "b")
+	assertWalk(t, trie, "e", "")
+}
+
+func assertWalk(t *testing.T, trie *Trie, from, to string, expected ...string) {
+	keys := make([]string, 0)
+	trie.Walk([]byte(from), []byte(to), func(key []byte, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, append(make([]string, 0), expected...), keys)
+}
+
+func TestTrie_Prefix(t *testing.T) {
+	trie := NewTrie()
+
+	keys := []string{"demo3", "b", "demo", "de", "abc", "demo1", "demo2", "dx"}
+
+	for i, k := range keys {
+		err := trie.Commit([]byte(k), []byte{byte(i + 1)})
+		assert.NoError(t, err)
+	}
+
+	assertPrefix(t, trie, "", "abc", "b", "de", "demo", "demo1", "demo2", "demo3", "dx")
+	assertPrefix(t, trie, "d", "de", "demo", "demo1", "demo2", "demo3", "dx")
+	assertPrefix(t, trie, "dem", "demo", "demo1", "demo2", "demo3")
+	assertPrefix(t, trie, "demo", "demo", "demo1", "demo2", "demo3")
+	assertPrefix(t, trie, "demo2", "demo2")
+	assertPrefix(t, trie, "demo4")
+	assertPrefix(t, trie, "dez")
+	assertPrefix(t, trie, "e")
+}
+
+func assertPrefix(t *testing.T, trie *Trie, p string, expected ...string) {
+	keys := make([]string, 0)
+	trie.Prefix([]byte(p), func(key []byte, value []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, append(make([]string, 0), expected...), keys)
+}
+
+func TestTrie_Random(t *testing.T) {
+	trie := NewTrie()
+	elements := make(map[string][]byte)
+
+	// a small alphabet creates a lot of shared prefixes
+	key := func() []byte {
+		k := make([]byte, rand.Intn(6))
+		for i := range k {
+			k[i] = byte('a' + rand.Intn(3))
+		}
+		return k
+	}
+
+	for i := 0; i < 10000; i++ {
+		k := key()
+		if rand.Intn(3) == 0 {
+			_, exists := elements[string(k)]
+			assert.Equal(t, exists, trie.Remove(k))
+			delete(elements, string(k))
+			continue
+		}
+		v := []byte{byte(i)}
+		err := trie.Commit(k, v)
+		assert.NoError(t, err)
+		elements[string(k)] = v
+	}
+
+	assert.Equal(t, len(elements), trie.Len())
+	expected := make([]string, 0, len(elements))
+	for k, v := range elements {
+		assertRead(t, trie, []byte(k), v)
+		expected = append(expected, k)
+	}
+	sort.Strings(expected)
+
+	keys := make([]string, 0, len(elements))
+	trie.Walk(nil, nil, func(key []byte, value []byte) bool {
+		assert.True(t, bytes.Equal(elements[string(key)], value))
+		keys = append(keys, string(key))
+		return true
+	})
+	assert.Equal(t, expected, keys)
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when there is no value for a given key
+	ErrNotFound = errors.New("could not find element")
+	// ErrKeyTooLarge is returned when a key exceeds the size supported by the storage implementation
+	ErrKeyTooLarge = errors.New("key too large")
+	// ErrValueTooLarge is returned when a value exceeds the size supported by the storage implementation
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrCorrupted is returned when the stored data cannot be read back the way it was written
+	ErrCorrupted = errors.New("corrupted data")
+	// ErrClosed is returned for operations on a storage that has already been closed
+	ErrClosed = errors.New("storage is closed")
+	// ErrNotSupported is returned for operations that the underlying storage implementation does not provide
+	ErrNotSupported = errors.New("operation not supported")
+)
+
+// KeyError is the error of a storage operation for a specific key
+type KeyError struct {
+	Key Key
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%v for key %v", e.Err, e.Key)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// NotFound creates the error for a key that has no value in the storage
+func NotFound(key Key) error {
+	return &KeyError{Key: key, Err: ErrNotFound}
+}
@@ -0,0 +1,18 @@
+package store
+
+import "time"
+
+// Expirer is implemented by the storage implementations that can expire their elements
+// an expired element behaves as if it was not there, and is removed lazily, when it is read,
+// or by a sweep of the storage.
+type Expirer interface {
+	// PutWithTTL adds an element to the storage, that expires after the given duration
+	// a plain Put of the same key afterwards removes the expiry.
+	PutWithTTL(element Element, ttl time.Duration) error
+}
+
+// Expired checks if the given expiry time has passed
+// a zero expiry means that the element never expires.
+func Expired(expiry, now time.Time) bool {
+	return !expiry.IsZero() && !now.Before(expiry)
+}
@@ -1,9 +1,16 @@
 module github.com/drakos74/lachesis/store/store
 
-go 1.15
+go 1.18
 
 require (
+	github.com/golang/protobuf v1.3.1
 	github.com/google/btree v1.0.0
 	github.com/rs/zerolog v1.20.0
 	github.com/stretchr/testify v1.7.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// indexer maintains a secondary index on the writes of a repository
+type indexer[V any] interface {
+	// update moves the primary key from the index entries of the previous value to the ones of the current value
+	// a nil previous value stands for a new key, and a nil current value for a deleted one.
+	update(key []byte, previous, current *V) error
+	close() error
+}
+
+// Index is a secondary index of a repository, that finds the key value pairs by the index keys of their values
+// The index keeps an entry for every pair of an index key and the primary key of a value that maps to it,
+// in an auxiliary storage, and is updated on every Put and Delete of the repository.
+// The entries are looked up by the prefix of their index key, so the storage of the index needs to be Iterable.
+// Only the writes after the creation of the index are indexed.
+// The lookups hold the read lock of the repository, so that they do not see a value in between its index updates.
+type Index[K, V, I any] struct {
+	repo    *Repository[K, V]
+	storage Storage
+	keys    Codec[I]
+	extract func(value V) []I
+}
+
+// NewIndex creates a secondary index for the repository, kept in the given storage
+// the extract function returns the index keys for a value, which are encoded with the given codec.
+func NewIndex[K, V, I any](repo *Repository[K, V], storage Storage, keys Codec[I], extract func(value V) []I) *Index[K, V, I] {
+	index := &Index[K, V, I]{
+		repo:    repo,
+		storage: storage,
+		keys:    keys,
+		extract: extract,
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.indexes = append(repo.indexes, index)
+	return index
+}
+
+// Find returns the key value pairs with values that map to the given index key
+// It fails with ErrNotSupported, if the storage of the index is not Iterable.
+func (idx *Index[K, V, I]) Find(i I) (*KVCursor[K, V], error) {
+	iterable, ok := idx.storage.(Iterable)
+	if !ok {
+		return nil, fmt.Errorf("could not search index storage %T: %w", idx.storage, ErrNotSupported)
+	}
+	key, err := idx.keys.Encode(i)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode index key %v: %w", i, err)
+	}
+	idx.repo.mutex.RLock()
+	defer idx.repo.mutex.RUnlock()
+	cursor, err := iterable.Prefix(entryPrefix(key))
+	if err != nil {
+		return nil, err
+	}
+	return idx.postings(cursor)
+}
+
+// Scan returns the key value pairs with values that map to index keys in the range [from, to)
+// a nil from or to key leaves the corresponding side of the range unbounded.
+// The pairs are returned in the order of their encoded index keys.
+// It fails with ErrNotSupported, if the storage of the index is not Iterable.
+func (idx *Index[K, V, I]) Scan(from, to *I) (*KVCursor[K, V], error) {
+	iterable, ok := idx.storage.(Iterable)
+	if !ok {
+		return nil, fmt.Errorf("could not scan index storage %T: %w", idx.storage, ErrNotSupported)
+	}
+	fromKey, err := idx.bound(from)
+	if err != nil {
+		return nil, err
+	}
+	toKey, err := idx.bound(to)
+	if err != nil {
+		return nil, err
+	}
+	idx.repo.mutex.RLock()
+	defer idx.repo.mutex.RUnlock()
+	cursor, err := iterable.Scan(fromKey, toKey)
+	if err != nil {
+		return nil, err
+	}
+	return idx.postings(cursor)
+}
+
+// postings retrieves the elements for the primary keys of the index entries of the cursor
+// a value that maps to more than one of the index keys is returned only once.
+func (idx *Index[K, V, I]) postings(cursor Cursor) (*KVCursor[K, V], error) {
+	keys := make([][]byte, 0)
+	seen := make(map[string]struct{})
+	for cursor.Next() {
+		_, key, err := decodeEntry(cursor.Element().Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode index entry %v: %w", cursor.Element().Key, err)
+		}
+		if _, ok := seen[string(key)]; ok {
+			continue
+		}
+		seen[string(key)] = struct{}{}
+		keys = append(keys, key)
+	}
+	return idx.lookup(keys)
+}
+
+// lookup retrieves the elements for the given primary keys from the repository
+// a primary key that is gone from the storage e.g. because its value expired, is skipped.
+func (idx *Index[K, V, I]) lookup(keys [][]byte) (*KVCursor[K, V], error) {
+	elements := make([]Element, 0, len(keys))
+	for _, key := range keys {
+		element, err := idx.repo.storage.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve indexed element for key %v: %w", key, err)
+		}
+		elements = append(elements, element)
+	}
+	return &KVCursor[K, V]{repo: idx.repo, cursor: NewCursor(elements)}, nil
+}
+
+// bound encodes the index key for one side of a range
+// the index entries sort by their index key first, so the prefix of the index key bounds all its entries.
+func (idx *Index[K, V, I]) bound(i *I) (Key, error) {
+	if i == nil {
+		return nil, nil
+	}
+	key, err := idx.keys.Encode(*i)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode index key %v: %w", *i, err)
+	}
+	return entryPrefix(key), nil
+}
+
+func (idx *Index[K, V, I]) update(key []byte, previous, current *V) error {
+	removed, err := idx.encode(previous)
+	if err != nil {
+		return err
+	}
+	added, err := idx.encode(current)
+	if err != nil {
+		return err
+	}
+	for k := range removed {
+		if _, ok := added[k]; ok {
+			// the value still maps to the same index key
+			delete(added, k)
+			continue
+		}
+		if err := idx.remove([]byte(k), key); err != nil {
+			return err
+		}
+	}
+	for k := range added {
+		if err := idx.add([]byte(k), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the set of the encoded index keys for the value
+func (idx *Index[K, V, I]) encode(value *V) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	if value == nil {
+		return keys, nil
+	}
+	for _, i := range idx.extract(*value) {
+		key, err := idx.keys.Encode(i)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode index key %v: %w", i, err)
+		}
+		keys[string(key)] = struct{}{}
+	}
+	return keys, nil
+}
+
+// add adds the entry for the primary key under the index key
+func (idx *Index[K, V, I]) add(indexKey, key []byte) error {
+	return idx.storage.Put(NewElement(encodeEntry(indexKey, key), []byte{}))
+}
+
+// remove removes the entry for the primary key under the index key
+func (idx *Index[K, V, I]) remove(indexKey, key []byte) error {
+	err := idx.storage.Delete(encodeEntry(indexKey, key))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("could not remove index entry %v for %v: %w", indexKey, key, err)
+	}
+	return nil
+}
+
+func (idx *Index[K, V, I]) close() error {
+	return idx.storage.Close()
+}
+
+// the index entries are keyed by the tuple of the index key and the primary key,
+// encoded as byte strings the same way as the tuple package does.
+// Each byte string is terminated by a nil byte, with the nil bytes within it escaped,
+// so that the encoding of the index key is a prefix of its entries only, and sorts in the same order as the index key.
+const (
+	entryCode   = 0x01
+	entryEnd    = 0x00
+	entryEscape = 0xFF
+)
+
+// encodeEntry creates the key of the index entry for the primary key under the index key
+func encodeEntry(indexKey, key []byte) Key {
+	buffer := new(bytes.Buffer)
+	writeEntry(buffer, indexKey)
+	writeEntry(buffer, key)
+	return buffer.Bytes()
+}
+
+// entryPrefix creates the prefix of the keys of all the entries under the index key
+func entryPrefix(indexKey []byte) Key {
+	buffer := new(bytes.Buffer)
+	writeEntry(buffer, indexKey)
+	return buffer.Bytes()
+}
+
+// writeEntry writes one byte string of the tuple
+func writeEntry(buffer *bytes.Buffer, b []byte) {
+	buffer.WriteByte(entryCode)
+	for _, c := range b {
+		buffer.WriteByte(c)
+		if c == entryEnd {
+			buffer.WriteByte(entryEscape)
+		}
+	}
+	buffer.WriteByte(entryEnd)
+}
+
+// decodeEntry reads the index key and the primary key from the key of an index entry
+func decodeEntry(b []byte) ([]byte, []byte, error) {
+	indexKey, n, err := readEntry(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, m, err := readEntry(b[n:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if n+m != len(b) {
+		return nil, nil, fmt.Errorf("%w: trailing bytes in index entry", ErrCorrupted)
+	}
+	return indexKey, key, nil
+}
+
+// readEntry reads one byte string of the tuple
+// it returns also the number of bytes read.
+func readEntry(b []byte) ([]byte, int, error) {
+	if len(b) == 0 || b[0] != entryCode {
+		return nil, 0, fmt.Errorf("%w: invalid index entry", ErrCorrupted)
+	}
+	v := make([]byte, 0)
+	for i := 1; i < len(b); i++ {
+		if b[i] != entryEnd {
+			v = append(v, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == entryEscape {
+			v = append(v, entryEnd)
+			i++
+			continue
+		}
+		return v, i + 1, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unterminated index entry", ErrCorrupted)
+}
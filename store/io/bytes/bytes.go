@@ -3,6 +3,8 @@ package bytes
 import (
 	"encoding/binary"
 	"fmt"
+
+	"github.com/drakos74/lachesis/store/store"
 )
 
 // Concat merges 2 arrays of bytes into one
@@ -27,52 +29,51 @@ func Concat(size int, arrays ...[]byte) ([]byte, error) {
 const (
 	maxKeySize   = 65535
 	maxValueSize = 2147483647
+	// indexSize is the size of the fileIndex [segment:4][offset:4][size:4]
+	indexSize = 12
 )
 
 type fileIndex struct {
-	bytes  []byte
-	offset uint64
-	size   uint16
+	bytes   []byte
+	segment uint32
+	offset  uint64
+	size    uint32
 }
 
 // TODO : consider using unsafe ... at least to test performance gain
-func FileIndex(offset int, size int) (fileIndex, error) {
+func FileIndex(segment uint32, offset int, size int) (fileIndex, error) {
 
-	if size > maxKeySize {
-		return fileIndex{}, fmt.Errorf("cannot store key of size bigger than %d. size was %d", maxKeySize, size)
+	if size > maxValueSize {
+		return fileIndex{}, fmt.Errorf("%w: cannot index record of size bigger than %d. size was %d", store.ErrValueTooLarge, maxValueSize, size)
 	}
-	ss := uint16(size)
+	ss := uint32(size)
 
 	if offset > maxValueSize {
-		return fileIndex{}, fmt.Errorf("cannot store value of size bigger than %d. size was %d", maxValueSize, offset)
+		return fileIndex{}, fmt.Errorf("cannot index offset bigger than %d. offset was %d", maxValueSize, offset)
 	}
 	oo := uint32(offset)
 
-	s := make([]byte, 2)
-	binary.LittleEndian.PutUint16(s, ss)
-	o := make([]byte, 4)
-	binary.LittleEndian.PutUint32(o, oo)
-	b, err := Concat(6, o, s)
-	if err != nil {
-		return fileIndex{}, fmt.Errorf("could not create fileIndex for [%d,%d] %w", offset, size, err)
-	}
+	b := make([]byte, indexSize)
+	binary.LittleEndian.PutUint32(b[:4], segment)
+	binary.LittleEndian.PutUint32(b[4:8], oo)
+	binary.LittleEndian.PutUint32(b[8:], ss)
 	return fileIndex{
-		bytes:  b,
-		offset: uint64(oo),
-		size:   ss,
+		bytes:   b,
+		segment: segment,
+		offset:  uint64(oo),
+		size:    ss,
 	}, nil
 }
 
 func ReadIndex(b []byte) (fileIndex, error) {
-	if len(b) != 6 {
+	if len(b) != indexSize {
 		return fileIndex{}, fmt.Errorf("cannot read size from fileIndex %v", b)
 	}
-	o := binary.LittleEndian.Uint32(b[:4])
-	s := binary.LittleEndian.Uint16(b[4:])
 	return fileIndex{
-		bytes:  b,
-		offset: uint64(o),
-		size:   s,
+		bytes:   b,
+		segment: binary.LittleEndian.Uint32(b[:4]),
+		offset:  uint64(binary.LittleEndian.Uint32(b[4:8])),
+		size:    binary.LittleEndian.Uint32(b[8:]),
 	}, nil
 }
 
@@ -80,6 +81,10 @@ func (i fileIndex) Bytes() []byte {
 	return i.bytes
 }
 
+func (i fileIndex) Segment() uint32 {
+	return i.segment
+}
+
 func (i fileIndex) Offset() int64 {
 	return int64(i.offset)
 }
@@ -0,0 +1,30 @@
+package bytes
+
+import (
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileIndex(t *testing.T) {
+
+	index, err := FileIndex(3, 1024, 70000)
+	assert.NoError(t, err)
+
+	read, err := ReadIndex(index.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), read.Segment())
+	assert.Equal(t, int64(1024), read.Offset())
+	assert.Equal(t, 70000, read.Size())
+
+	_, err = FileIndex(0, 0, maxValueSize+1)
+	assert.ErrorIs(t, err, store.ErrValueTooLarge)
+
+	_, err = FileIndex(0, maxValueSize+1, 10)
+	assert.Error(t, err)
+
+	_, err = ReadIndex(index.Bytes()[1:])
+	assert.Error(t, err)
+
+}
@@ -0,0 +1,182 @@
+package bytes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// Handle the ScratchPad records
+
+const (
+	// RecordHeaderSize is the size of the header preceding every record in the file
+	// [checksum:4][flags:1][key size:2][value size:4]
+	RecordHeaderSize = 11
+	// expirySize is the size of the expiry time, that follows the header of the records flagged as expiring
+	// [expiry unix nanos:8]
+	expirySize    = 8
+	tombstoneFlag = byte(1)
+	continuedFlag = byte(2)
+	expiringFlag  = byte(4)
+)
+
+// ErrChecksum is returned when the content of a record does not match its checksum
+var ErrChecksum = fmt.Errorf("%w: checksum mismatch", store.ErrCorrupted)
+
+// ErrRecordSize is returned when the header of a record declares a key or value bigger than a record can hold
+var ErrRecordSize = fmt.Errorf("%w: invalid record size", store.ErrCorrupted)
+
+// Record represents a key-value entry the way it is stored in a file
+type Record struct {
+	Key       []byte
+	Value     []byte
+	Tombstone bool
+	// Continued marks a record of a batch, that is followed by more records of the same batch
+	Continued bool
+	// Expires is the time after which the record is not valid anymore
+	// the zero time means that the record never expires.
+	Expires time.Time
+}
+
+// EncodeRecord serializes the record, prefixing it with a header that carries
+// the key size, value size and a checksum of the content.
+// The expiry, if any, is written between the header and the key.
+func EncodeRecord(record Record) ([]byte, error) {
+	if len(record.Key) > maxKeySize {
+		return nil, fmt.Errorf("%w: cannot store key of size bigger than %d. size was %d", store.ErrKeyTooLarge, maxKeySize, len(record.Key))
+	}
+	if len(record.Value) > maxValueSize {
+		return nil, fmt.Errorf("%w: cannot store value of size bigger than %d. size was %d", store.ErrValueTooLarge, maxValueSize, len(record.Value))
+	}
+	offset := RecordHeaderSize
+	if !record.Expires.IsZero() {
+		offset += expirySize
+	}
+	b := make([]byte, offset+len(record.Key)+len(record.Value))
+	if record.Tombstone {
+		b[4] |= tombstoneFlag
+	}
+	if record.Continued {
+		b[4] |= continuedFlag
+	}
+	if !record.Expires.IsZero() {
+		b[4] |= expiringFlag
+		binary.LittleEndian.PutUint64(b[RecordHeaderSize:offset], uint64(record.Expires.UnixNano()))
+	}
+	binary.LittleEndian.PutUint16(b[5:7], uint16(len(record.Key)))
+	binary.LittleEndian.PutUint32(b[7:11], uint32(len(record.Value)))
+	copy(b[offset:], record.Key)
+	copy(b[offset+len(record.Key):], record.Value)
+	binary.LittleEndian.PutUint32(b[0:4], crc32.ChecksumIEEE(b[4:]))
+	return b, nil
+}
+
+// DecodeRecord de-serializes a single record from the given bytes and verifies its checksum
+func DecodeRecord(b []byte) (Record, error) {
+	if len(b) < RecordHeaderSize {
+		return Record{}, fmt.Errorf("cannot read record header from %d bytes", len(b))
+	}
+	if size := RecordSize(b); len(b) != size {
+		return Record{}, fmt.Errorf("record size does not match header %d vs %d", len(b), size)
+	}
+	if checksum := binary.LittleEndian.Uint32(b[0:4]); checksum != crc32.ChecksumIEEE(b[4:]) {
+		return Record{}, fmt.Errorf("%w for record %d vs %d", ErrChecksum, checksum, crc32.ChecksumIEEE(b[4:]))
+	}
+	keySize, _ := sizes(b)
+	offset := RecordHeaderSize
+	if isExpiring(b) {
+		offset += expirySize
+	}
+	return Record{
+		Key:       b[offset : offset+keySize],
+		Value:     b[offset+keySize:],
+		Tombstone: b[4]&tombstoneFlag == tombstoneFlag,
+		Continued: IsContinued(b),
+		Expires:   Expiry(b),
+	}, nil
+}
+
+// ReadRecord reads the next record from the reader and verifies its checksum
+// it returns also the number of bytes of the record.
+// io.EOF is returned only if there are no more records to read.
+func ReadRecord(r io.Reader) (Record, int, error) {
+	return ReadRecordWithin(r, math.MaxInt64)
+}
+
+// ReadRecordWithin reads the next record from a reader, that holds the given number of bytes at most, e.g. the rest of a file
+// the sizes in the header are checked before allocating the record, so that a corrupted header cannot exhaust the memory.
+// A record that does not fit in the remaining bytes is reported as torn, with io.ErrUnexpectedEOF.
+func ReadRecordWithin(r io.Reader, remaining int64) (Record, int, error) {
+	header := make([]byte, RecordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return Record{}, n, err
+	}
+	if err := CheckHeader(header); err != nil {
+		return Record{}, n, err
+	}
+	if size := int64(RecordSize(header)); size > remaining {
+		return Record{}, int(remaining), io.ErrUnexpectedEOF
+	}
+	b := make([]byte, RecordSize(header))
+	copy(b, header)
+	m, err := io.ReadFull(r, b[RecordHeaderSize:])
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, n + m, err
+	}
+	record, err := DecodeRecord(b)
+	return record, len(b), err
+}
+
+// CheckHeader verifies that the sizes declared in the given record header are within the limits of the records
+func CheckHeader(header []byte) error {
+	keySize, valueSize := sizes(header)
+	if keySize > maxKeySize || valueSize > maxValueSize {
+		return fmt.Errorf("%w: key size %d and value size %d exceed %d and %d", ErrRecordSize, keySize, valueSize, maxKeySize, maxValueSize)
+	}
+	return nil
+}
+
+// RecordSize returns the size of the whole record, as declared in the given header
+func RecordSize(header []byte) int {
+	keySize, valueSize := sizes(header)
+	size := RecordHeaderSize + keySize + valueSize
+	if isExpiring(header) {
+		size += expirySize
+	}
+	return size
+}
+
+// IsContinued checks the given record header for the flag marking that the record is followed by more records of the same batch
+func IsContinued(header []byte) bool {
+	return header[4]&continuedFlag == continuedFlag
+}
+
+// Expiry reads the expiry time from the given record
+// it returns the zero time for a record that never expires.
+func Expiry(record []byte) time.Time {
+	if !isExpiring(record) {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.LittleEndian.Uint64(record[RecordHeaderSize:RecordHeaderSize+expirySize])))
+}
+
+// isExpiring checks the given record header for the flag marking that the record carries an expiry
+func isExpiring(header []byte) bool {
+	return header[4]&expiringFlag == expiringFlag
+}
+
+// sizes reads the key and value size from the record header
+func sizes(header []byte) (keySize, valueSize int) {
+	keySize = int(binary.LittleEndian.Uint16(header[5:7]))
+	valueSize = int(binary.LittleEndian.Uint32(header[7:11]))
+	return
+}
@@ -0,0 +1,137 @@
+package bytes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord_EncodeDecode(t *testing.T) {
+
+	record := Record{Key: []byte("key"), Value: []byte("value")}
+
+	b, err := EncodeRecord(record)
+	assert.NoError(t, err)
+	assert.Equal(t, RecordHeaderSize+len(record.Key)+len(record.Value), len(b))
+
+	decoded, err := DecodeRecord(b)
+	assert.NoError(t, err)
+	assert.Equal(t, record, decoded)
+
+	_, err = EncodeRecord(Record{Key: make([]byte, maxKeySize+1)})
+	assert.ErrorIs(t, err, store.ErrKeyTooLarge)
+
+	_, err = DecodeRecord(b[:len(b)-1])
+	assert.Error(t, err)
+
+	b[RecordHeaderSize]++
+	_, err = DecodeRecord(b)
+	assert.ErrorIs(t, err, ErrChecksum)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+
+}
+
+func TestRecord_Expiring(t *testing.T) {
+
+	record := Record{Key: []byte("key"), Value: []byte("value"), Expires: time.Unix(1600000000, 123)}
+
+	b, err := EncodeRecord(record)
+	assert.NoError(t, err)
+	assert.Equal(t, RecordHeaderSize+expirySize+len(record.Key)+len(record.Value), len(b))
+	assert.Equal(t, len(b), RecordSize(b[:RecordHeaderSize]))
+
+	decoded, err := DecodeRecord(b)
+	assert.NoError(t, err)
+	assert.Equal(t, record, decoded)
+	assert.Equal(t, record.Expires, Expiry(b))
+
+	// the expiry is covered by the checksum
+	b[RecordHeaderSize]++
+	_, err = DecodeRecord(b)
+	assert.ErrorIs(t, err, ErrChecksum)
+
+}
+
+func TestRecord_Read(t *testing.T) {
+
+	records := []Record{
+		{Key: []byte("key1"), Value: []byte("value1")},
+		{Key: []byte("key2"), Value: []byte{}},
+		{Key: []byte("key1"), Value: []byte{}, Tombstone: true},
+		{Key: []byte("key3"), Value: []byte("value3"), Continued: true},
+		{Key: []byte("key2"), Value: []byte{}, Tombstone: true, Continued: true},
+		{Key: []byte("key4"), Value: []byte("value4"), Expires: time.Unix(1600000000, 0)},
+	}
+
+	buffer := new(bytes.Buffer)
+	for _, record := range records {
+		b, err := EncodeRecord(record)
+		assert.NoError(t, err)
+		buffer.Write(b)
+	}
+
+	for _, record := range records {
+		r, n, err := ReadRecord(buffer)
+		assert.NoError(t, err)
+		size := RecordHeaderSize + len(record.Key) + len(record.Value)
+		if !record.Expires.IsZero() {
+			size += expirySize
+		}
+		assert.Equal(t, size, n)
+		assert.Equal(t, record, r)
+	}
+
+	_, _, err := ReadRecord(buffer)
+	assert.Equal(t, io.EOF, err)
+
+}
+
+func TestRecord_ReadCorrupted(t *testing.T) {
+
+	b, err := EncodeRecord(Record{Key: []byte("key"), Value: []byte("value")})
+	assert.NoError(t, err)
+
+	// torn record
+	_, _, err = ReadRecord(bytes.NewReader(b[:len(b)-2]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// checksum mismatch
+	b[len(b)-1]++
+	_, n, err := ReadRecord(bytes.NewReader(b))
+	assert.ErrorIs(t, err, ErrChecksum)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+	assert.Equal(t, len(b), n)
+
+}
+
+func TestRecord_ReadCorruptedSize(t *testing.T) {
+
+	b, err := EncodeRecord(Record{Key: []byte("key"), Value: []byte("value")})
+	assert.NoError(t, err)
+
+	// a value size that no record can have is rejected before reading the record
+	header := make([]byte, RecordHeaderSize)
+	copy(header, b)
+	binary.LittleEndian.PutUint32(header[7:11], maxValueSize+1)
+	_, n, err := ReadRecord(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrRecordSize)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+	assert.Equal(t, RecordHeaderSize, n)
+
+	// a record that does not fit in the remaining bytes is torn
+	_, n, err = ReadRecordWithin(bytes.NewReader(b), int64(len(b)-1))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, len(b)-1, n)
+
+	r, n, err := ReadRecordWithin(bytes.NewReader(b), int64(len(b)))
+	assert.NoError(t, err)
+	assert.Equal(t, len(b), n)
+	assert.Equal(t, []byte("value"), r.Value)
+
+}
@@ -0,0 +1,107 @@
+package file
+
+import (
+	"fmt"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/rs/zerolog/log"
+)
+
+// NewBatch creates a batch of writes for the pad.
+// The records of the batch are written with a single append followed by a sync,
+// and all but the last one are flagged as continued, so that an interrupted batch is dropped on a reopen.
+// A batch that fails to sync is truncated from the file right away.
+// With a write-ahead log, the batch is one entry of the log, which is synced before the batch is written to the file.
+func (s *ScratchPad) NewBatch() store.Batch {
+	return store.NewWriteBatch(s.commit)
+}
+
+// commit writes the records for the given writes as one contiguous block and indexes them
+func (s *ScratchPad) commit(writes []store.Write) error {
+	if s.closed {
+		return store.ErrClosed
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	// serialize everything first, so that an invalid element leaves the pad untouched
+	records := make([][]byte, len(writes))
+	size := 0
+	for i, w := range writes {
+		bb, err := bytes.EncodeRecord(bytes.Record{
+			Key:       w.Key,
+			Value:     w.Value,
+			Tombstone: w.Delete,
+			Continued: i < len(writes)-1,
+		})
+		if err != nil {
+			return fmt.Errorf("could not serialize batch element '%v' %w", w.Key, err)
+		}
+		records[i] = bb
+		size += len(bb)
+	}
+	if size > maxSegmentSize {
+		return fmt.Errorf("%w: cannot write batch of size bigger than %d. size was %d", store.ErrValueTooLarge, maxSegmentSize, size)
+	}
+	data := make([]byte, 0, size)
+	for _, bb := range records {
+		data = append(data, bb...)
+	}
+
+	index, err := s.logWrite(data)
+	if err == nil {
+		err = s.syncLog()
+	}
+	if err != nil {
+		s.unlogWrite(index)
+		return fmt.Errorf("could not write batch of '%d' elements %w", len(writes), err)
+	}
+	p, err := s.segments.append(data)
+	if err != nil {
+		s.unlogWrite(index)
+		return fmt.Errorf("could not write batch of '%d' elements %w", len(writes), err)
+	}
+	err = s.segments.sync()
+	if err != nil {
+		s.unlogWrite(index)
+		// the batch is reported as failed, so it must not come back on a reopen
+		if truncErr := s.segments.truncate(p.offset); truncErr != nil {
+			log.Error().Err(truncErr).Str("filename", s.segments.active().name).Msg("could not drop unsynced batch")
+		}
+		return fmt.Errorf("could not sync batch of '%d' elements %w", len(writes), err)
+	}
+
+	log.Trace().
+		Uint32("segment", p.segment).
+		Int("offset", p.offset).
+		Int("Size", size).
+		Int("count", len(writes)).
+		Msg("Write_Batch")
+
+	for i, w := range writes {
+		n := len(records[i])
+		// the writes of a batch do not expire
+		delete(s.expiries, string(w.Key))
+		if w.Delete {
+			s.garbage += untrack(s.index, w.Key) + n
+		} else {
+			garbage, err := track(s.index, w.Key, p, n)
+			if err != nil {
+				return fmt.Errorf("could not index batch element '%v' %w", w.Key, err)
+			}
+			s.garbage += garbage
+		}
+		p.offset += n
+	}
+	return nil
+}
+
+// NewBatch creates a batch of writes for the store, that is committed while using a write lock
+func (ss *SyncScratchPad) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		ss.mutex.Lock()
+		defer ss.mutex.Unlock()
+		return ss.store.commit(writes)
+	})
+}
@@ -0,0 +1,159 @@
+package file
+
+import (
+	"os"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchPad_BatchReopen(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	batch := pad.NewBatch()
+	for _, element := range elements {
+		batch.Put(element)
+	}
+	batch.Delete(elements[0].Key)
+	err = batch.Commit()
+	assert.NoError(t, err)
+	assertPad(t, pad, elements[1:], elements[:1])
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	assertPad(t, pad, elements[1:], elements[:1])
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_BatchInvalid(t *testing.T) {
+
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	batch := pad.NewBatch()
+	for _, element := range elements {
+		batch.Put(element)
+	}
+	batch.Put(store.NewElement(make([]byte, 70000), []byte("value")))
+	err = batch.Commit()
+	assert.ErrorIs(t, err, store.ErrKeyTooLarge)
+
+	// nothing of the batch was written
+	assert.Equal(t, 0, pad.segments.size())
+	assertPad(t, pad, nil, elements)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	err = batch.Commit()
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
+
+func TestScratchPad_ReopenIncompleteBatch(t *testing.T) {
+
+	for name, cut := range map[string]func(b []byte, last int) []byte{
+		// the last record of the batch is missing
+		"incomplete": func(b []byte, last int) []byte {
+			return b[:last]
+		},
+		// the last record of the batch is torn
+		"torn": func(b []byte, last int) []byte {
+			return b[:len(b)-3]
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			path := t.TempDir()
+
+			pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+			assert.NoError(t, err)
+
+			elements := test.Elements(10, test.Random(10, 20))
+			for _, element := range elements {
+				err := pad.Put(element)
+				assert.NoError(t, err)
+			}
+			size := pad.segments.size()
+			name := pad.segments.active().name
+			err = pad.Close()
+			assert.NoError(t, err)
+
+			// simulate an interrupted batch
+			batch := test.Elements(3, test.Random(10, 20))
+			data := make([]byte, 0)
+			last := 0
+			for i, element := range batch {
+				record, err := bytes.EncodeRecord(bytes.Record{Key: element.Key, Value: element.Value, Continued: i < len(batch)-1})
+				assert.NoError(t, err)
+				last = len(data)
+				data = append(data, record...)
+			}
+			file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+			assert.NoError(t, err)
+			_, err = file.Write(cut(data, last))
+			assert.NoError(t, err)
+			err = file.Close()
+			assert.NoError(t, err)
+
+			pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+			assert.NoError(t, err)
+			assert.Equal(t, size, pad.segments.size())
+			assertPad(t, pad, elements, batch)
+			info, err := os.Stat(name)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(size), info.Size())
+
+			err = pad.Close()
+			assert.NoError(t, err)
+		})
+	}
+
+}
+
+func TestScratchPad_CompactBatch(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	batch := pad.NewBatch()
+	for _, element := range elements {
+		batch.Put(element)
+	}
+	err = batch.Commit()
+	assert.NoError(t, err)
+
+	// the last record of the batch becomes garbage, so the others are left without the end of their batch
+	last := elements[len(elements)-1]
+	err = pad.Delete(last.Key)
+	assert.NoError(t, err)
+
+	err = pad.Compact()
+	assert.NoError(t, err)
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	assertPad(t, pad, elements[:len(elements)-1], []store.Element{last})
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
@@ -0,0 +1,115 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/drakos74/lachesis/store/store/io/wal"
+	"github.com/rs/zerolog/log"
+)
+
+// WithLog records the writes of the pad in the given write-ahead log, before they are applied to the files
+// every write, or batch of writes, is an entry of the log, holding the same records the pad writes,
+// so that the writes can be replayed on another storage with ReplayLog, e.g. for a replica.
+// The entry is synced along with the pad, according to its durability policy, and removed if the write fails.
+// The log is owned by the caller, and is only synced when the pad is closed.
+func (s *ScratchPad) WithLog(changes *wal.Log) *ScratchPad {
+	s.changes = changes
+	return s
+}
+
+// WithLog records the writes of the store in the given write-ahead log, before they are applied to the files
+func (ss *SyncScratchPad) WithLog(changes *wal.Log) *SyncScratchPad {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.store.WithLog(changes)
+	return ss
+}
+
+// logWrite appends the records of a write to the log of the pad, if any
+// it returns the index of the entry, or zero if there is no log.
+func (s *ScratchPad) logWrite(records []byte) (uint64, error) {
+	if s.changes == nil {
+		return 0, nil
+	}
+	index, err := s.changes.Append(records)
+	if err != nil {
+		return 0, fmt.Errorf("could not log write %w", err)
+	}
+	return index, nil
+}
+
+// unlogWrite removes the entry of a write that failed from the log of the pad
+func (s *ScratchPad) unlogWrite(index uint64) {
+	if index == 0 {
+		return
+	}
+	if err := s.changes.Truncate(index); err != nil {
+		log.Error().Err(err).Uint64("index", index).Msg("could not drop failed write from log")
+	}
+}
+
+// syncLog syncs the log of the pad, if any
+func (s *ScratchPad) syncLog() error {
+	if s.changes == nil {
+		return nil
+	}
+	return s.changes.Sync()
+}
+
+// ReplayLog applies the writes of the log, starting from the given index, to the given storage
+// the elements that have expired in the meantime are skipped, while the ones that expire later keep their expiry,
+// if the storage implements store.Expirer.
+func ReplayLog(changes *wal.Log, from uint64, target store.Storage) error {
+	now := time.Now()
+	return changes.Replay(from, func(entry wal.Entry) error {
+		for offset := 0; offset < len(entry.Data); {
+			if len(entry.Data)-offset < bytes.RecordHeaderSize {
+				return fmt.Errorf("%w: incomplete record in entry '%d'", store.ErrCorrupted, entry.Index)
+			}
+			size := bytes.RecordSize(entry.Data[offset:])
+			if offset+size > len(entry.Data) {
+				return fmt.Errorf("%w: incomplete record in entry '%d'", store.ErrCorrupted, entry.Index)
+			}
+			record, err := bytes.DecodeRecord(entry.Data[offset : offset+size])
+			if err != nil {
+				return fmt.Errorf("could not read write of entry '%d' %w", entry.Index, err)
+			}
+			err = replay(record, target, now)
+			if err != nil {
+				return fmt.Errorf("could not replay write of entry '%d' %w", entry.Index, err)
+			}
+			offset += size
+		}
+		return nil
+	})
+}
+
+// replay applies the write of a single record to the storage
+func replay(record bytes.Record, target store.Storage, now time.Time) error {
+	element := store.NewElement(record.Key, record.Value)
+	switch {
+	case record.Tombstone:
+		err := target.Delete(record.Key)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	case record.Expires.IsZero():
+		return target.Put(element)
+	case store.Expired(record.Expires, now):
+		// the element might have been written before, without an expiry
+		err := target.Delete(record.Key)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if expirer, ok := target.(store.Expirer); ok {
+		return expirer.PutWithTTL(element, record.Expires.Sub(now))
+	}
+	return target.Put(element)
+}
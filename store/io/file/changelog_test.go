@@ -0,0 +1,63 @@
+package file
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/io/wal"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchPad_ReplayLog(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "wal")
+	changes, err := wal.Open(name)
+	assert.NoError(t, err)
+
+	pad, err := NewSyncScratchPad(t.TempDir())
+	assert.NoError(t, err)
+	pad.WithDurability(Durability{Mode: SyncEveryWrite}).WithLog(changes)
+
+	elements := test.Elements(5, test.Random(10, 20))
+	assert.NoError(t, pad.Put(elements[0]))
+	assert.NoError(t, pad.Put(elements[1]))
+	assert.NoError(t, pad.Delete(elements[0].Key))
+	assert.NoError(t, pad.PutWithTTL(elements[2], time.Hour))
+	assert.NoError(t, pad.PutWithTTL(elements[4], time.Millisecond))
+	batch := pad.NewBatch()
+	batch.Put(elements[3])
+	batch.Delete(elements[1].Key)
+	assert.NoError(t, batch.Commit())
+
+	// the failed writes are not logged
+	assert.ErrorIs(t, pad.Delete(elements[0].Key), store.ErrNotFound)
+	assert.Equal(t, uint64(6), changes.Last())
+
+	assert.NoError(t, pad.Close())
+	assert.NoError(t, changes.Close())
+	time.Sleep(time.Millisecond)
+
+	changes, err = wal.Open(name)
+	assert.NoError(t, err)
+	defer changes.Close()
+
+	target := mem.CacheFactory()
+	err = ReplayLog(changes, 0, target)
+	assert.NoError(t, err)
+	assertPad(t, target, elements[2:4], []store.Element{elements[0], elements[1], elements[4]})
+
+	// a replay from a later entry applies only the writes that follow
+	target = mem.CacheFactory()
+	err = ReplayLog(changes, 4, target)
+	assert.NoError(t, err)
+	assertPad(t, target, elements[2:4], []store.Element{elements[0], elements[1], elements[4]})
+	target = mem.CacheFactory()
+	err = ReplayLog(changes, 6, target)
+	assert.NoError(t, err)
+	assertPad(t, target, elements[3:4], elements[:3])
+
+}
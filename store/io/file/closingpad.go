@@ -2,12 +2,15 @@ package file
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/drakos74/lachesis/store/store"
-	"github.com/drakos74/lachesis/store/store/io/bytes"
 	"github.com/drakos74/lachesis/store/store/io/mem"
 	"github.com/rs/zerolog/log"
 )
 
+// ClosingPad is a file storage that syncs the file after every write
+// it is the single-threaded counterpart of a SyncScratchPad with the SyncEveryWrite durability policy
 type ClosingPad struct {
 	ScratchPad
 }
@@ -36,43 +39,46 @@ func TreeClosingPadFactory(path string) store.StorageFactory {
 	}
 }
 
-// Put adds an element to the store
+// Put adds an element to the store and syncs it to the file
 func (s *ClosingPad) Put(element store.Element) error {
-	bb, err := s.concat.Join(element)
-	if err != nil {
-		return fmt.Errorf("could not serialize element '%v' %w", element, err)
-	}
-	// Note : we leave the overwrites there ... just applying a new fileIndex !!!
-	// We will silently remove them at the next 'compaction' operation
-	n, err := s.wrFile.Write(bb)
-	if err != nil {
-		return fmt.Errorf("could not write element '%v' %w", element, err)
-	}
 	// TODO : seems we dont need to call 'sync' in order to flush to the file...
 	//  need to investigate the low level implications of this
 	defer func() {
-		syncErr := s.wrFile.Sync()
+		if s.closed {
+			return
+		}
+		syncErr := s.segments.sync()
 		if syncErr != nil {
 			log.Err(syncErr)
 		}
 	}()
-	if n != len(bb) {
-		// TODO : handle the file corruption -> open new file
-		return fmt.Errorf("write failed '%d' != %d", n, len(bb))
-	}
+	return s.ScratchPad.Put(element)
+}
 
-	index, err := bytes.FileIndex(s.offset, n)
-	if err != nil {
-		return fmt.Errorf("could not create fileIndex '%v' %w", index, err)
-	}
-	s.offset += n
+// PutWithTTL adds an element that expires after the given duration to the store, and syncs it to the file
+func (s *ClosingPad) PutWithTTL(element store.Element, ttl time.Duration) error {
+	defer func() {
+		if s.closed {
+			return
+		}
+		syncErr := s.segments.sync()
+		if syncErr != nil {
+			log.Err(syncErr)
+		}
+	}()
+	return s.ScratchPad.PutWithTTL(element, ttl)
+}
 
-	log.Trace().
-		Int64("offset", index.Offset()).
-		Int("Size", index.Size()).
-		Bytes("key", element.Key).
-		Msg("Write_Index")
-	// Note : we overwrite the element only in the key struct,
-	// so the old value is not reachable from the outside world
-	return s.index.Put(store.NewElement(element.Key, index.Bytes()))
+// Delete removes an element from the store and syncs the tombstone to the file
+func (s *ClosingPad) Delete(key store.Key) error {
+	defer func() {
+		if s.closed {
+			return
+		}
+		syncErr := s.segments.sync()
+		if syncErr != nil {
+			log.Err(syncErr)
+		}
+	}()
+	return s.ScratchPad.Delete(key)
 }
@@ -1 +1,15 @@
 package file
+
+import (
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store/test"
+)
+
+func TestTrieClosingPad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, TrieClosingPadFactory(t.TempDir()))
+}
+
+func TestTreeClosingPad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, TreeClosingPadFactory(t.TempDir()))
+}
@@ -0,0 +1,304 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/rs/zerolog/log"
+)
+
+// Compaction defines when a pad should be compacted in the background
+type Compaction struct {
+	// Interval is the period for checking the state of the pad
+	Interval time.Duration
+	// MinSize is the file size in bytes, below which no compaction is triggered
+	MinSize int
+	// GarbageRatio is the ratio of unreachable bytes in the file, above which a compaction is triggered
+	GarbageRatio float64
+}
+
+// due checks if a file of the given size and garbage needs to be compacted
+func (c Compaction) due(size, garbage int) bool {
+	return garbage > 0 && size >= c.MinSize && float64(garbage) >= c.GarbageRatio*float64(size)
+}
+
+// compaction holds the state of a compaction in progress
+type compaction struct {
+	// segments are the new files, the live records are written to
+	segments *segments
+	index    store.Storage
+	garbage  int
+	// expiries are rebuilt from the copied records, as an element might expire, and be removed from the pad, while copying
+	expiries map[string]time.Time
+	// source are the segments we are compacting
+	source *segments
+	// indexes are the entries of the source index at the start of the compaction
+	indexes store.Cursor
+	// mark is the position in the source segments up to which the records are reachable through the indexes
+	mark position
+}
+
+// Compact rewrites the files of the pad, keeping only the records reachable from the index.
+// Overwritten values and deleted elements are dropped from the new files,
+// the index is swapped to the new offsets and the old files are removed.
+func (s *ScratchPad) Compact() error {
+	c, err := s.startCompaction()
+	if err != nil {
+		return err
+	}
+	err = c.copy()
+	if err != nil {
+		c.abort()
+		return err
+	}
+	return s.completeCompaction(c)
+}
+
+// startCompaction creates the new files and captures the entries of the index that need to be copied
+func (s *ScratchPad) startCompaction() (*compaction, error) {
+	if s.closed {
+		return nil, store.ErrClosed
+	}
+	iterable, ok := s.index.(store.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("index %T does not support ordered iteration", s.index)
+	}
+	indexes, err := iterable.Scan(store.Key{}, store.Key{})
+	if err != nil {
+		return nil, fmt.Errorf("could not scan index %w", err)
+	}
+	// we write to temporary files, so that an incomplete compaction is never picked up on a reopen
+	sgs, err := createSegments(s.segments.path, s.segments.limit, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not create segments for compaction %w", err)
+	}
+
+	log.Debug().
+		Str("path", s.segments.path).
+		Int("size", s.segments.size()).
+		Int("garbage", s.garbage).
+		Msg("Start ScratchPad Compaction")
+
+	return &compaction{
+		segments: sgs,
+		index:    s.newIndex(),
+		expiries: make(map[string]time.Time),
+		source:   s.segments,
+		indexes:  indexes,
+		mark:     s.segments.end(),
+	}, nil
+}
+
+// copy copies the records of the captured index entries from the source segments to the new ones
+// it does not touch the state of the pad, so it can run concurrently to the reads.
+// The records that have expired are dropped, while the rest keep their expiry in the new index.
+func (c *compaction) copy() error {
+	now := time.Now()
+	for c.indexes.Next() {
+		element := c.indexes.Element()
+		index, err := bytes.ReadIndex(element.Value)
+		if err != nil {
+			return fmt.Errorf("cannot read fileIndex '%v' %w", index, err)
+		}
+		data, err := c.source.readAt(index.Segment(), index.Offset(), index.Size())
+		if err != nil {
+			return err
+		}
+		if store.Expired(bytes.Expiry(data), now) {
+			continue
+		}
+		if bytes.IsContinued(data) {
+			// the rest of the batch might not be copied, so the record needs to stand on its own
+			data, err = detach(data)
+			if err != nil {
+				return err
+			}
+		}
+		err = c.append(element.Key, data, bytes.Expiry(data))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replay applies to the new segments the records written to the source segments after the mark
+func (c *compaction) replay() error {
+	now := time.Now()
+	return c.source.scan(c.mark, func(p position, record bytes.Record, n int) error {
+		if record.Tombstone || store.Expired(record.Expires, now) {
+			c.garbage += untrack(c.index, record.Key)
+			delete(c.expiries, string(record.Key))
+			return nil
+		}
+		// the records of a batch are complete at this point, but its tombstones are not copied
+		record.Continued = false
+		data, err := bytes.EncodeRecord(record)
+		if err != nil {
+			return fmt.Errorf("could not serialize record at '%v' %w", p, err)
+		}
+		return c.append(record.Key, data, record.Expires)
+	})
+}
+
+// detach clears the batch flag of the given record
+func detach(data []byte) ([]byte, error) {
+	record, err := bytes.DecodeRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	record.Continued = false
+	return bytes.EncodeRecord(record)
+}
+
+// append writes the record to the new segments and indexes it along with its expiry
+func (c *compaction) append(key store.Key, data []byte, expires time.Time) error {
+	p, err := c.segments.append(data)
+	if err != nil {
+		return fmt.Errorf("could not write record for '%v' %w", key, err)
+	}
+	garbage, err := track(c.index, key, p, len(data))
+	if err != nil {
+		return fmt.Errorf("could not index record for '%v' %w", key, err)
+	}
+	c.garbage += garbage
+	if expires.IsZero() {
+		delete(c.expiries, string(key))
+	} else {
+		c.expiries[string(key)] = expires
+	}
+	return nil
+}
+
+// abort discards the new files
+func (c *compaction) abort() {
+	_ = c.segments.remove()
+	_ = c.index.Close()
+}
+
+// completeCompaction catches up with the writes that happened while copying,
+// and swaps the files and the index of the pad
+// The switch goes through a manifest of the source files, written before the new files are published,
+// so that a reopen after a crash in between completes it, instead of bringing back the records of the source files.
+func (s *ScratchPad) completeCompaction(c *compaction) error {
+	err := c.replay()
+	if err == nil {
+		err = c.segments.sync()
+	}
+	if err == nil {
+		err = writeManifest(s.segments.path, c.source)
+	}
+	if err == nil {
+		err = c.segments.publish()
+		if err != nil {
+			// the source files are still the ones in use
+			_ = os.Remove(filepath.Join(s.segments.path, manifest))
+		}
+	}
+	if err != nil {
+		c.abort()
+		return fmt.Errorf("could not complete compaction %w", err)
+	}
+
+	index := s.index
+	// the elements that expired while copying are back in the index, but expire again along with their records
+	s.segments, s.index, s.garbage, s.expiries = c.segments, c.index, c.garbage, c.expiries
+
+	log.Debug().
+		Str("filename", s.segments.active().name).
+		Int("size", s.segments.size()).
+		Int("garbage", s.garbage).
+		Msg("Complete ScratchPad Compaction")
+
+	_ = index.Close()
+	err = c.source.remove()
+	if err != nil {
+		// the manifest stays, so that the next reopen removes the files
+		return fmt.Errorf("could not clean up compacted files %w", err)
+	}
+	err = os.Remove(filepath.Join(s.segments.path, manifest))
+	if err != nil {
+		return fmt.Errorf("could not clean up compaction manifest %w", err)
+	}
+	return nil
+}
+
+// manifest is the name of the file listing the source files of a compaction, that is being switched to its new files
+const manifest = "compaction.manifest"
+
+// writeManifest stores the names of the source files of the compaction in the manifest of the path
+// the manifest is written to a temporary file first, so that it is either complete or missing.
+func writeManifest(path string, source *segments) error {
+	names := make([]string, len(source.list))
+	for i, sg := range source.list {
+		names[i] = filepath.Base(sg.name)
+	}
+	name := filepath.Join(path, manifest)
+	file, err := os.Create(name + ".tmp")
+	if err != nil {
+		return fmt.Errorf("could not create compaction manifest %w", err)
+	}
+	_, err = file.WriteString(strings.Join(names, "\n"))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("could not write compaction manifest %w", err)
+	}
+	return nil
+}
+
+// recoverCompaction cleans up after a compaction, that was interrupted by a crash
+// without a manifest, the compaction did not reach the switch, and its temporary files are discarded.
+// With a manifest, the new files are complete, so the ones still temporary are published and the source files removed.
+func recoverCompaction(path string) error {
+	name := filepath.Join(path, manifest)
+	if err := os.Remove(name + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove incomplete compaction manifest %w", err)
+	}
+	temps, err := filepath.Glob(fmt.Sprintf("%s/*.%s.tmp", path, extension))
+	if err != nil {
+		return fmt.Errorf("could not list compaction files %w", err)
+	}
+	sort.Strings(temps)
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		for _, temp := range temps {
+			log.Warn().Str("filename", temp).Msg("Remove incomplete compaction file")
+			if err := os.Remove(temp); err != nil {
+				return fmt.Errorf("could not remove incomplete compaction file '%s' %w", temp, err)
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read compaction manifest %w", err)
+	}
+	// the temporary files are renamed in the order they were written, after the ones already published
+	for _, temp := range temps {
+		log.Warn().Str("filename", temp).Msg("Publish compaction file")
+		if err := os.Rename(temp, fileName(path)); err != nil {
+			return fmt.Errorf("could not publish compaction file '%s' %w", temp, err)
+		}
+	}
+	for _, source := range strings.Split(string(data), "\n") {
+		err := os.Remove(filepath.Join(path, source))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove compacted file '%s' %w", source, err)
+		}
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,338 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchPad_Compact(t *testing.T) {
+
+	for name, index := range map[string]store.StorageFactory{
+		"trie":  mem.SyncTrieFactory,
+		"btree": mem.SyncBTreeFactory,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := t.TempDir()
+
+			pad, err := NewScratchPad(path, index)
+			assert.NoError(t, err)
+
+			elements := test.Elements(100, test.Random(10, 20))
+			for _, element := range elements {
+				err := pad.Put(element)
+				assert.NoError(t, err)
+			}
+			live := pad.Metadata().ValuesBytes
+
+			// overwrite and delete, so that the file grows, but the live records stay the same size
+			for i := 0; i < 10; i++ {
+				for j := 0; j < 10; j++ {
+					err := pad.Put(elements[j])
+					assert.NoError(t, err)
+				}
+				err = pad.Delete(elements[len(elements)-1-i].Key)
+				assert.NoError(t, err)
+			}
+			deleted := elements[len(elements)-10:]
+			elements = elements[:len(elements)-10]
+			assert.True(t, pad.Metadata().ValuesBytes > live)
+			assert.True(t, pad.garbage > 0)
+
+			err = pad.Compact()
+			assert.NoError(t, err)
+
+			assert.True(t, pad.Metadata().ValuesBytes < live)
+			assert.Equal(t, 0, pad.garbage)
+			assert.Equal(t, uint64(len(elements)), pad.Metadata().Size)
+			assertPad(t, pad, elements, deleted)
+
+			// only the compacted file should be left
+			files, err := filepath.Glob(fmt.Sprintf("%s/*", path))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{pad.segments.active().name}, files)
+
+			// the compacted file is picked up on a reopen
+			err = pad.Close()
+			assert.NoError(t, err)
+			pad, err = OpenScratchPad(path, index)
+			assert.NoError(t, err)
+			assertPad(t, pad, elements, deleted)
+			err = pad.Close()
+			assert.NoError(t, err)
+		})
+	}
+
+}
+
+func TestScratchPad_CompactNotIterable(t *testing.T) {
+
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncCacheFactory)
+	assert.NoError(t, err)
+
+	err = pad.Compact()
+	assert.Error(t, err)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestSyncScratchPad_CompactWithConcurrentOperations(t *testing.T) {
+
+	pad, err := NewSyncTreePad(t.TempDir())
+	assert.NoError(t, err)
+
+	elements := test.Elements(500, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+	for _, element := range elements[:250] {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+
+	// keep reading, writing and deleting while the compaction runs
+	written := test.Elements(100, test.Random(10, 20))
+	deleted := elements[len(elements)-100:]
+	elements = elements[:len(elements)-100]
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for _, element := range elements {
+			e, err := pad.Get(element.Key)
+			assert.NoError(t, err)
+			assert.Equal(t, element.Value, e.Value)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for _, element := range written {
+			err := pad.Put(element)
+			assert.NoError(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for _, element := range deleted {
+			err := pad.Delete(element.Key)
+			assert.NoError(t, err)
+		}
+	}()
+
+	err = pad.Compact()
+	assert.NoError(t, err)
+	wg.Wait()
+
+	assertPad(t, pad, elements, deleted)
+	assertPad(t, pad, written, nil)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_CompactExpired(t *testing.T) {
+
+	path := t.TempDir()
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(20, test.Random(10, 20))
+	// size is the size of the records that do not expire
+	size := 0
+	for i, element := range elements {
+		if i%2 == 0 {
+			err = pad.PutWithTTL(element, 10*time.Millisecond)
+		} else {
+			offset := pad.segments.size()
+			err = pad.Put(element)
+			size += pad.segments.size() - offset
+		}
+		assert.NoError(t, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the expired records are dropped, even if they were not removed from the index yet
+	err = pad.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, size, pad.segments.size())
+
+	live := make([]store.Element, 0)
+	expired := make([]store.Element, 0)
+	for i, element := range elements {
+		if i%2 == 0 {
+			expired = append(expired, element)
+		} else {
+			live = append(live, element)
+		}
+	}
+	assertPad(t, pad, live, expired)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	assertPad(t, pad, live, expired)
+	assert.Equal(t, uint64(len(live)), pad.Metadata().Size)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+// an element that expires while the compaction copies it, does not come back without its expiry
+func TestScratchPad_CompactExpiresWhileCopying(t *testing.T) {
+
+	ttl := 20 * time.Millisecond
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(3, test.Random(10, 20))
+	err = pad.PutWithTTL(elements[0], ttl)
+	assert.NoError(t, err)
+	err = pad.PutWithTTL(elements[1], ttl)
+	assert.NoError(t, err)
+	err = pad.Put(elements[2])
+	assert.NoError(t, err)
+
+	// the copy runs without the lock of the pad, as in SyncScratchPad.Compact
+	c, err := pad.startCompaction()
+	assert.NoError(t, err)
+	err = c.copy()
+	assert.NoError(t, err)
+
+	// the elements expire, and are removed from the pad, before the compaction completes
+	time.Sleep(ttl)
+	_, err = pad.Get(elements[0].Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.Equal(t, 1, pad.Sweep())
+
+	err = pad.completeCompaction(c)
+	assert.NoError(t, err)
+
+	// the copied records are back in the index, along with their expiry
+	assert.Equal(t, 2, pad.Sweep())
+	assertPad(t, pad, elements[2:], elements[:2])
+	assert.Equal(t, uint64(1), pad.Metadata().Size)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+// a crash during a compaction leaves either the source or the new files in place
+func TestScratchPad_CompactInterrupted(t *testing.T) {
+
+	for name, switched := range map[string]bool{
+		"before-switch": false,
+		"after-switch":  true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := t.TempDir()
+			pad, err := NewSegmentedPad(path, mem.SyncTrieFactory, 256)
+			assert.NoError(t, err)
+
+			elements := test.Elements(100, test.Random(10, 20))
+			for _, element := range elements {
+				err := pad.Put(element)
+				assert.NoError(t, err)
+			}
+			for _, element := range elements[90:] {
+				err := pad.Delete(element.Key)
+				assert.NoError(t, err)
+			}
+			deleted := elements[90:]
+			elements = elements[:90]
+
+			c, err := pad.startCompaction()
+			assert.NoError(t, err)
+			assert.NoError(t, c.copy())
+			assert.NoError(t, c.replay())
+			assert.NoError(t, c.segments.sync())
+			assert.True(t, len(c.segments.list) > 1)
+			compacted := len(c.segments.list)
+			if switched {
+				assert.NoError(t, writeManifest(path, c.source))
+				// only the first file is published before the crash
+				sg := c.segments.list[0]
+				assert.NoError(t, os.Rename(sg.name, fileName(path)))
+			}
+			// crash
+			_ = c.segments.close()
+			_ = pad.segments.close()
+
+			pad, err = OpenSegmentedPad(path, mem.SyncTrieFactory, 256)
+			assert.NoError(t, err)
+			assertPad(t, pad, elements, deleted)
+			assert.Equal(t, uint64(len(elements)), pad.Metadata().Size)
+
+			temps, err := filepath.Glob(fmt.Sprintf("%s/*.tmp", path))
+			assert.NoError(t, err)
+			assert.Empty(t, temps)
+			assert.NoFileExists(t, filepath.Join(path, manifest))
+			if switched {
+				// only the compacted files are left
+				assert.Equal(t, compacted, len(pad.segments.list))
+				assert.Equal(t, 0, pad.garbage)
+			} else {
+				assert.True(t, pad.garbage > 0)
+			}
+
+			err = pad.Close()
+			assert.NoError(t, err)
+		})
+	}
+
+}
+
+func TestSyncScratchPad_BackgroundCompaction(t *testing.T) {
+
+	pad := SyncCompactingPadFactory(t.TempDir(), Compaction{
+		Interval:     10 * time.Millisecond,
+		GarbageRatio: 0.5,
+	})().(*SyncScratchPad)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for i := 0; i < 10; i++ {
+		for _, element := range elements {
+			err := pad.Put(element)
+			assert.NoError(t, err)
+		}
+	}
+	size := pad.Metadata().ValuesBytes
+
+	assert.Eventually(t, func() bool {
+		return pad.Metadata().ValuesBytes < size
+	}, time.Second, 10*time.Millisecond)
+
+	assertPad(t, pad, elements, nil)
+
+	err := pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func assertPad(t *testing.T, pad store.Storage, elements, deleted []store.Element) {
+	for _, element := range elements {
+		e, err := pad.Get(element.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, element.Value, e.Value)
+	}
+	for _, element := range deleted {
+		_, err := pad.Get(element.Key)
+		assert.Error(t, err)
+	}
+}
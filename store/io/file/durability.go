@@ -0,0 +1,116 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// SyncMode defines when the writes of a pad are synced to disk
+type SyncMode int
+
+const (
+	// SyncNone leaves the syncing of the files to the operating system
+	SyncNone SyncMode = iota
+	// SyncEveryWrite syncs the file after every write, before returning to the caller
+	SyncEveryWrite
+	// SyncInterval syncs the file periodically in the background
+	// a write might be lost if the process crashes within the interval
+	SyncInterval
+	// SyncGroupCommit syncs the file before returning to the caller,
+	// but concurrent writers share a single sync
+	SyncGroupCommit
+)
+
+// Durability defines the sync policy of a pad
+type Durability struct {
+	Mode SyncMode
+	// Interval is the period between two syncs for the SyncInterval mode
+	Interval time.Duration
+}
+
+// group collects the concurrent writes, so that they are made durable with a single sync.
+// Every write gets a sequence number, and waits until the writes up to its own are synced.
+// The first writer to wait becomes the leader and syncs on behalf of everyone that has written so far,
+// while the writes arriving during the sync are picked up by the next leader.
+type group struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	// written is the sequence number of the last write
+	written uint64
+	// synced is the sequence number up to which the writes are durable
+	synced  uint64
+	syncing bool
+	// err is the error of a failed sync
+	// once a sync fails we cannot know which writes made it to the disk, so all following writes fail as well
+	err error
+}
+
+// newGroup creates a new group commit
+func newGroup() *group {
+	g := &group{}
+	g.cond = sync.NewCond(&g.mutex)
+	return g
+}
+
+// add registers a new write, returning its sequence number
+// it needs to be called in the same order the writes are applied to the file
+func (g *group) add() uint64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.written++
+	return g.written
+}
+
+// wait blocks until the write with the given sequence number is synced with the given sync function
+func (g *group) wait(seq uint64, sync func() error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for g.synced < seq && g.err == nil {
+		if g.syncing {
+			g.cond.Wait()
+			continue
+		}
+		g.syncing = true
+		target := g.written
+		g.mutex.Unlock()
+		err := sync()
+		g.mutex.Lock()
+		g.syncing = false
+		if err != nil {
+			g.err = fmt.Errorf("could not sync writes up to '%d' %w", target, err)
+		} else {
+			g.synced = target
+		}
+		g.cond.Broadcast()
+	}
+	if g.synced >= seq {
+		return nil
+	}
+	return g.err
+}
+
+// syncFile syncs the file the store is currently writing to
+// the lock is held only for getting the file, so that the writers can go on while the sync is in progress.
+// A file that has been closed in the meantime, was synced before closing, by the roll over or the close of the store.
+func (ss *SyncScratchPad) syncFile() error {
+	ss.mutex.RLock()
+	file := ss.store.segments.wrFile
+	changes := ss.store.changes
+	ss.mutex.RUnlock()
+	// the log of the writes, if any, goes first, as it is written ahead of the file
+	if changes != nil {
+		if err := changes.Sync(); err != nil && !errors.Is(err, store.ErrClosed) {
+			return err
+		}
+	}
+	err := file.Sync()
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
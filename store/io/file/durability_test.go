@@ -0,0 +1,147 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var policies = map[string]Durability{
+	"none":         {Mode: SyncNone},
+	"every-write":  {Mode: SyncEveryWrite},
+	"interval":     {Mode: SyncInterval, Interval: 10 * time.Millisecond},
+	"group-commit": {Mode: SyncGroupCommit},
+}
+
+func TestDurablePad_KeyValueImplementation(t *testing.T) {
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			new(test.ConsistencyWithMeta).Run(t, SyncDurablePadFactory(t.TempDir(), policy))
+		})
+	}
+}
+
+func TestDurablePad_SyncImplementation(t *testing.T) {
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			new(test.Concurrency).Run(t, SyncDurablePadFactory(t.TempDir(), policy))
+		})
+	}
+}
+
+func TestGroup_Wait(t *testing.T) {
+
+	g := newGroup()
+
+	var syncs int32
+	flush := func() error {
+		atomic.AddInt32(&syncs, 1)
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+
+	writers := 100
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the sequence numbers are taken in the order of the writes, as the pad does under its lock
+			mutex.Lock()
+			seq := g.add()
+			mutex.Unlock()
+			err := g.wait(seq, flush)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(writers), g.synced)
+	assert.True(t, syncs >= 1)
+	assert.True(t, int(syncs) < writers, "expected the writers to share syncs, but got %d syncs for %d writers", syncs, writers)
+
+}
+
+func TestGroup_WaitError(t *testing.T) {
+
+	g := newGroup()
+
+	failure := errors.New("disk failure")
+	err := g.wait(g.add(), func() error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	// all following writes fail, since the state of the file is unknown
+	err = g.wait(g.add(), func() error {
+		return nil
+	})
+	assert.ErrorIs(t, err, failure)
+
+}
+
+func TestSyncScratchPad_GroupCommitReopen(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewSyncScratchPad(path)
+	assert.NoError(t, err)
+	pad = pad.WithDurability(Durability{Mode: SyncGroupCommit})
+
+	elements := test.Elements(100, test.Random(10, 20))
+	var wg sync.WaitGroup
+	for _, element := range elements {
+		wg.Add(1)
+		go func(element store.Element) {
+			defer wg.Done()
+			err := pad.Put(element)
+			assert.NoError(t, err)
+		}(element)
+	}
+	wg.Wait()
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	reopened, err := OpenScratchPad(path, pad.store.newIndex)
+	assert.NoError(t, err)
+	assertPad(t, reopened, elements, nil)
+	err = reopened.Close()
+	assert.NoError(t, err)
+
+}
+
+func BenchmarkDurablePad_Put(b *testing.B) {
+	for _, name := range []string{"none", "interval", "group-commit", "every-write"} {
+		for _, parallelism := range []int{1, 16} {
+			b.Run(fmt.Sprintf("%s|parallelism:%d", name, parallelism), func(b *testing.B) {
+				pad := SyncDurablePadFactory(b.TempDir(), policies[name])()
+				elements := test.Elements(b.N, test.Random(10, 100))
+				var next int64 = -1
+				b.SetParallelism(parallelism)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						err := pad.Put(elements[atomic.AddInt64(&next, 1)])
+						if err != nil {
+							b.Fatalf("error : %v", err)
+						}
+					}
+				})
+				b.StopTimer()
+				err := pad.Close()
+				if err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// maxReadHandles is the number of segment files a pad keeps open for reading
+const maxReadHandles = 16
+
+// handle is an open read file for a segment
+type handle struct {
+	file *os.File
+	// refs is the number of reads currently using the file
+	refs int
+	// used is the tick of the last access, in order to find the least recently used handle
+	used uint64
+}
+
+// handles is a pool of open read handles for the segment files.
+// It keeps at most max files open, by closing the least recently used ones that are not in use.
+// It is safe for concurrent use.
+type handles struct {
+	mutex sync.Mutex
+	max   int
+	names map[uint32]string
+	open  map[uint32]*handle
+	tick  uint64
+}
+
+// newHandles creates a new pool of read handles
+func newHandles(max int) *handles {
+	return &handles{
+		max:   max,
+		names: make(map[uint32]string),
+		open:  make(map[uint32]*handle),
+	}
+}
+
+// register adds the file for the given segment to the pool
+// if the segment was already registered, its open handle is dropped
+func (h *handles) register(id uint32, name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if hd, ok := h.open[id]; ok && hd.refs == 0 {
+		_ = hd.file.Close()
+		delete(h.open, id)
+	}
+	h.names[id] = name
+}
+
+// name returns the file name for the given segment
+func (h *handles) name(id uint32) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.names[id]
+}
+
+// acquire returns an open read file for the given segment
+// every call needs to be followed by a release, once the file is not used anymore
+func (h *handles) acquire(id uint32) (*os.File, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.tick++
+	hd, ok := h.open[id]
+	if !ok {
+		name, ok := h.names[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown segment '%d'", id)
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not create read file for segment '%d' %w", id, err)
+		}
+		hd = &handle{file: file}
+		h.open[id] = hd
+	}
+	hd.refs++
+	hd.used = h.tick
+	h.evict()
+	return hd.file, nil
+}
+
+// release marks the file for the given segment as not used by the caller anymore
+func (h *handles) release(id uint32) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if hd, ok := h.open[id]; ok {
+		hd.refs--
+	}
+	h.evict()
+}
+
+// evict closes the least recently used idle handles, while there are more than max open
+func (h *handles) evict() {
+	for len(h.open) > h.max {
+		var lru uint32
+		var oldest *handle
+		for id, hd := range h.open {
+			if hd.refs == 0 && (oldest == nil || hd.used < oldest.used) {
+				lru, oldest = id, hd
+			}
+		}
+		if oldest == nil {
+			// all handles are in use, we will try again on the next release
+			return
+		}
+		_ = oldest.file.Close()
+		delete(h.open, lru)
+	}
+}
+
+// close closes all the open handles
+func (h *handles) close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var err error
+	for id, hd := range h.open {
+		if closeErr := hd.file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("could not close read file for segment '%d' %w", id, closeErr)
+		}
+		delete(h.open, id)
+	}
+	return err
+}
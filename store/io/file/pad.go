@@ -1,51 +1,240 @@
 package file
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"github.com/drakos74/lachesis/store/store"
-	"github.com/drakos74/lachesis/store/store/app"
-	"os"
-	"strconv"
+	"io"
+	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/app"
 	"github.com/drakos74/lachesis/store/store/io/bytes"
 	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/io/wal"
 	"github.com/rs/zerolog/log"
 )
 
-// ScratchPad is a single file wrapper for storing key value pairs
-// it uses a Trie for storing the keys as a fileIndex for the file
+const extension = "lac"
+
+// ScratchPad is a file wrapper for storing key value pairs
+// it uses a Trie for storing the keys as a fileIndex for the file.
+// The records are appended to a list of segment files, rolling over to a new one at a configurable size.
+// The elements put with a ttl expire lazily, when they are read, or when Sweep is called.
+// There is no background sweeper, as the pad is not thread-safe; SyncScratchPad.WithSweeper provides one.
 type ScratchPad struct {
-	wrFile *os.File
-	rdFile *os.File
-	// we store in the fileIndex a slice of bytes representing the stored object [Size,Size]
+	segments *segments
+	// we store in the fileIndex a slice of bytes representing the stored object [Segment,Offset,Size]
 	index store.Storage
 	// we use this to encapsulate our concatenation logic
-	concat   app.ConcatOperator
-	offset   int
-	filename string
+	concat app.ConcatOperator
+	// newIndex creates a fresh index, when the file is rewritten during a compaction
+	newIndex store.StorageFactory
+	// garbage is the amount of bytes in the file that are not reachable from the index anymore
+	garbage int
+	// expiries holds the expiry time of the elements that were put with a ttl
+	expiries map[string]time.Time
+	// changes is the write-ahead log the writes are recorded in, if any
+	changes *wal.Log
+	closed  bool
 }
 
 // NewScratchPad creates a new ScratchPad instance
 func NewScratchPad(path string, index store.StorageFactory) (*ScratchPad, error) {
-	// generate a file name
-	fileName := fmt.Sprintf("%s/%s.%s", path, strconv.FormatInt(time.Now().UnixNano(), 10), "lac")
-	wrFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	return NewSegmentedPad(path, index, DefaultSegmentSize)
+}
+
+// NewSegmentedPad creates a new ScratchPad instance,
+// that rolls over to a new segment file when the given size is reached
+func NewSegmentedPad(path string, index store.StorageFactory, segmentSize int) (*ScratchPad, error) {
+	sgs, err := createSegments(path, segmentSize, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not create segments for ScratchPad %w", err)
+	}
+	return openScratchPad(sgs, index)
+}
+
+// OpenScratchPad opens the ScratchPad with the files in the given path
+// and restores its index from the records in the files.
+// If there is no file, it creates a new ScratchPad instance
+func OpenScratchPad(path string, index store.StorageFactory) (*ScratchPad, error) {
+	return OpenSegmentedPad(path, index, DefaultSegmentSize)
+}
+
+// OpenSegmentedPad opens the ScratchPad with the segment files in the given path
+// and restores its index from the records in the files.
+// A compaction that was interrupted is either completed or discarded first, depending on whether it reached the switch to its new files.
+// If there is no file, it creates a new ScratchPad instance
+func OpenSegmentedPad(path string, index store.StorageFactory, segmentSize int) (*ScratchPad, error) {
+	err := recoverCompaction(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not create write file for ScratchPad %w", err)
+		return nil, fmt.Errorf("could not recover compaction for ScratchPad %w", err)
 	}
-	rdFile, err := os.Open(fileName)
+	files, err := filepath.Glob(fmt.Sprintf("%s/*.%s", path, extension))
 	if err != nil {
-		return nil, fmt.Errorf("could not create read file for ScratchPad %w", err)
+		return nil, fmt.Errorf("could not list files for ScratchPad %w", err)
+	}
+	if len(files) == 0 {
+		return NewSegmentedPad(path, index, segmentSize)
+	}
+	// file names are unix timestamps, so they are sorted in the order they were created
+	sort.Strings(files)
+	sgs, err := openSegments(path, segmentSize, files)
+	if err != nil {
+		return nil, fmt.Errorf("could not open segments for ScratchPad %w", err)
+	}
+	return openScratchPad(sgs, index)
+}
+
+// openScratchPad creates the pad for the given segments and restores the index from the records already present in them
+func openScratchPad(sgs *segments, index store.StorageFactory) (*ScratchPad, error) {
+	pad := &ScratchPad{segments: sgs, concat: app.RecordConcat(), index: index(), newIndex: index, expiries: make(map[string]time.Time)}
+	err := pad.restore()
+	if err != nil {
+		_ = pad.Close()
+		return nil, fmt.Errorf("could not restore index for ScratchPad %w", err)
 	}
-	// TODO : we should build the fileIndex from the file ...
-	//  to make the storage consistent
-	//  but for that we need to store also the key
 	log.Debug().
-		Str("filename", wrFile.Name()).
+		Str("filename", sgs.active().name).
+		Int("segments", len(sgs.list)).
+		Int("size", sgs.size()).
 		Msg("Open ScratchPad Storage")
-	return &ScratchPad{wrFile: wrFile, rdFile: rdFile, concat: app.IndexedConcat(), index: index(), filename: fileName}, nil
+	return pad, nil
+}
+
+// restore rebuilds the index by scanning all the records in the files
+// the last write for each key wins, while tombstones and expired records remove the key from the index.
+// A torn record or an incomplete batch at the end of the last file is the result of an interrupted write, and is truncated.
+// The same goes for the last record of the last file failing its checksum, as its bytes might have not all reached the disk.
+func (s *ScratchPad) restore() error {
+	batch, err := s.scan()
+	active := s.segments.active()
+	var corruption *CorruptionError
+	if errors.As(err, &corruption) && torn(corruption, active) {
+		offset := int(corruption.Offset)
+		if batch != nil && batch.segment == active.id {
+			// the torn record belongs to a batch, that we need to drop as a whole
+			offset = batch.offset
+		}
+		log.Warn().
+			Str("filename", corruption.File).
+			Int("offset", offset).
+			Int("size", active.size-offset).
+			Msg("Truncate torn record")
+		return s.segments.truncate(offset)
+	}
+	if err != nil {
+		return err
+	}
+	if batch != nil {
+		if batch.segment != active.id {
+			return fmt.Errorf("incomplete batch at '%v' is not at the end of the files", *batch)
+		}
+		log.Warn().
+			Str("filename", active.name).
+			Int("offset", batch.offset).
+			Int("size", active.size-batch.offset).
+			Msg("Truncate incomplete batch")
+		return s.segments.truncate(batch.offset)
+	}
+	return nil
+}
+
+// torn checks if the corruption is the result of an interrupted write to the active segment
+// that is either a record cut short, or the last record of the segment with a mismatching checksum
+func torn(corruption *CorruptionError, active *segment) bool {
+	if corruption.File != active.name {
+		return false
+	}
+	if corruption.Err == io.ErrUnexpectedEOF {
+		return true
+	}
+	return errors.Is(corruption.Err, bytes.ErrChecksum) && int(corruption.Offset)+corruption.Size == active.size
+}
+
+// entry is a record read from the files, along with its position and size
+type entry struct {
+	position
+	record bytes.Record
+	size   int
+}
+
+// scan indexes all the records in the files
+// the records of a batch are indexed only once the last one of the batch is read.
+// It returns the position of the batch that was not completed, if any
+func (s *ScratchPad) scan() (*position, error) {
+	batch := make([]entry, 0)
+	err := s.segments.scan(position{}, func(p position, record bytes.Record, n int) error {
+		batch = append(batch, entry{position: p, record: record, size: n})
+		if record.Continued {
+			return nil
+		}
+		for _, e := range batch {
+			err := s.apply(e)
+			if err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	})
+	if len(batch) > 0 {
+		return &batch[0].position, err
+	}
+	return nil, err
+}
+
+// apply indexes a single record read from the files
+func (s *ScratchPad) apply(e entry) error {
+	if e.record.Tombstone || store.Expired(e.record.Expires, time.Now()) {
+		// the key might have not been there in the first place
+		s.garbage += untrack(s.index, e.record.Key) + e.size
+		delete(s.expiries, string(e.record.Key))
+		return nil
+	}
+	garbage, err := track(s.index, e.record.Key, e.position, e.size)
+	if err != nil {
+		return fmt.Errorf("could not index record at '%v' %w", e.position, err)
+	}
+	s.garbage += garbage
+	s.expire(e.record.Key, e.record.Expires)
+	return nil
+}
+
+// track points the index entry for the key to the record at the given position
+// it returns the size of the record that was previously indexed for the key, if any
+func track(index store.Storage, key store.Key, p position, size int) (int, error) {
+	fileIndex, err := bytes.FileIndex(p.segment, p.offset, size)
+	if err != nil {
+		return 0, fmt.Errorf("could not create fileIndex '%v' %w", fileIndex, err)
+	}
+	garbage := untracked(index, key)
+	return garbage, index.Put(store.NewElement(key, fileIndex.Bytes()))
+}
+
+// untrack removes the index entry for the key
+// it returns the size of the record that was indexed for the key, if any
+func untrack(index store.Storage, key store.Key) int {
+	garbage := untracked(index, key)
+	if garbage > 0 {
+		_ = index.Delete(key)
+	}
+	return garbage
+}
+
+// untracked returns the size of the record currently indexed for the key
+// or zero if there is none
+func untracked(index store.Storage, key store.Key) int {
+	element, err := index.Get(key)
+	if err != nil {
+		return 0
+	}
+	fileIndex, err := bytes.ReadIndex(element.Value)
+	if err != nil {
+		return 0
+	}
+	return fileIndex.Size()
 }
 
 // TriePadFactory generates a file storage implementation
@@ -72,116 +261,281 @@ func TreePadFactory(path string) store.StorageFactory {
 	}
 }
 
+// SegmentedPadFactory generates a file storage implementation
+// with a trie as an index, that rolls over to a new file at the given segment size
+func SegmentedPadFactory(path string, segmentSize int) store.StorageFactory {
+	return func() store.Storage {
+		pad, err := NewSegmentedPad(path, mem.SyncTrieFactory, segmentSize)
+		if err != nil {
+			panic(fmt.Sprintf("error during store creation: %v", err))
+		}
+		return pad
+	}
+}
+
 // Put adds an element to the store
 func (s *ScratchPad) Put(element store.Element) error {
+	if s.closed {
+		return store.ErrClosed
+	}
 	bb, err := s.concat.Join(element)
 	if err != nil {
 		return fmt.Errorf("could not serialize element '%v' %w", element, err)
 	}
+	return s.put(element, bb, time.Time{})
+}
+
+// PutWithTTL adds an element to the store, that expires after the given duration
+// the expiry is written in the record, so that it is still in place after a reopen.
+func (s *ScratchPad) PutWithTTL(element store.Element, ttl time.Duration) error {
+	if s.closed {
+		return store.ErrClosed
+	}
+	expires := time.Now().Add(ttl)
+	bb, err := bytes.EncodeRecord(bytes.Record{Key: element.Key, Value: element.Value, Expires: expires})
+	if err != nil {
+		return fmt.Errorf("could not serialize element '%v' %w", element, err)
+	}
+	return s.put(element, bb, expires)
+}
+
+// put appends the serialized element to the file and indexes it
+func (s *ScratchPad) put(element store.Element, bb []byte, expires time.Time) error {
 	// Note : we leave the overwrites there ... just applying a new fileIndex !!!
 	// We will silently remove them at the next 'compaction' operation
-	n, err := s.wrFile.Write(bb)
+	index, err := s.logWrite(bb)
+	if err != nil {
+		return fmt.Errorf("could not write element '%v' %w", element, err)
+	}
+	p, err := s.segments.append(bb)
 	if err != nil {
+		s.unlogWrite(index)
 		return fmt.Errorf("could not write element '%v' %w", element, err)
 	}
 	// TODO : seems we dont need to call 'sync' in order to flush to the file...
 	//  while we write and read from the same process
 	//  need to investigate the low level implications of this
 	//  (could be because go uses an mmap under the curtains for file operations)
-	//defer func(err errors) {
-	//	syncErr := storage.wrFile.Sync()
-	//	if syncErr != nil {
-	//		err.append(syncErr)
-	//	}
-	//}(storage.err)
-	if n != len(bb) {
-		// TODO : handle the file corruption -> open new file
-		return fmt.Errorf("write failed '%d' != %d", n, len(bb))
-	}
-
-	index, err := bytes.FileIndex(s.offset, n)
-	if err != nil {
-		return fmt.Errorf("could not create fileIndex '%v' %w", index, err)
-	}
-	s.offset += n
 
 	log.Trace().
-		Int64("offset", index.Offset()).
-		Int("Size", index.Size()).
+		Uint32("segment", p.segment).
+		Int("offset", p.offset).
+		Int("Size", len(bb)).
 		Bytes("key", element.Key).
 		Msg("Write_Index")
 	// Note : we overwrite the element only in the key struct,
 	// so the old value is not reachable from the outside world
-	return s.index.Put(store.NewElement(element.Key, index.Bytes()))
+	garbage, err := track(s.index, element.Key, p, len(bb))
+	s.garbage += garbage
+	if err != nil {
+		return err
+	}
+	s.expire(element.Key, expires)
+	return nil
 }
 
 // Get retrieves the element corresponding to the provided key
-// if a value is not found, it will return an error
+// if a value is not found, it will return an error.
+// An expired element is removed from the index, and reported as not found
 func (s *ScratchPad) Get(key store.Key) (store.Element, error) {
+	if s.closed {
+		return store.Element{}, store.ErrClosed
+	}
+	if s.expired(key, time.Now()) {
+		s.remove(key)
+		return store.Element{}, store.NotFound(key)
+	}
+	return s.lookup(key)
+}
+
+// lookup retrieves the element for the key from the file, without checking its expiry
+func (s *ScratchPad) lookup(key store.Key) (store.Element, error) {
+	if s.closed {
+		return store.Element{}, store.ErrClosed
+	}
 	bb, err := s.index.Get(key)
 	if err != nil {
-		return store.Element{}, fmt.Errorf(store.NoValue, key)
+		return store.Element{}, store.NotFound(key)
 	}
+	return s.readAt(bb)
+}
 
+// readAt reads the element from the file, based on the fileIndex stored for it in the index
+func (s *ScratchPad) readAt(bb store.Element) (store.Element, error) {
+	key := bb.Key
 	index, err := bytes.ReadIndex(bb.Value)
 	if err != nil {
 		return store.Element{}, fmt.Errorf("cannot read fileIndex '%v' %w", index, err)
 	}
 
 	log.Trace().
+		Uint32("segment", index.Segment()).
 		Int64("offset", index.Offset()).
 		Int("Size", index.Size()).
-		Bytes("key", bb.Key).
+		Bytes("key", key).
 		Msg("Read_Index")
 
-	data := make([]byte, index.Size())
-	n, err := s.rdFile.ReadAt(data, index.Offset())
+	data, err := s.segments.readAt(index.Segment(), index.Offset(), index.Size())
 	if err != nil {
-		return store.Element{}, fmt.Errorf("cannot read at '%d' bb '%d' found '%d' %w", index.Offset(), index.Size(), n, err)
-	}
-	if n != index.Size() {
-		return store.Element{}, fmt.Errorf("cannot read at '%d' bb '%d' found '%d'", index.Offset(), index.Size(), n)
+		return store.Element{}, err
 	}
 	result, err := s.concat.Split(key, data)
 	if err != nil {
-		return store.Element{}, fmt.Errorf("cannot deserialize '%v' %w", data, err)
+		return store.Element{}, &CorruptionError{File: s.segments.readers.name(index.Segment()), Offset: index.Offset(), Size: index.Size(), Err: err}
 	}
 	return result, nil
 }
 
+// Scan returns the elements with keys in the range [from, to) in key order
+// it relies on the index to keep the keys in order
+func (s *ScratchPad) Scan(from, to store.Key) (store.Cursor, error) {
+	if s.closed {
+		return nil, store.ErrClosed
+	}
+	index, ok := s.index.(store.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("index %T does not support ordered iteration", s.index)
+	}
+	indexes, err := index.Scan(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("could not scan index [%v,%v] %w", from, to, err)
+	}
+	return s.read(indexes)
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+// it relies on the index to keep the keys in order
+func (s *ScratchPad) Prefix(p store.Key) (store.Cursor, error) {
+	return s.Scan(p, store.PrefixEnd(p))
+}
+
+// read retrieves from the file all the elements for the given index entries
+// the elements that have expired are skipped.
+func (s *ScratchPad) read(indexes store.Cursor) (store.Cursor, error) {
+	now := time.Now()
+	elements := make([]store.Element, 0)
+	for indexes.Next() {
+		if s.expired(indexes.Element().Key, now) {
+			continue
+		}
+		element, err := s.readAt(indexes.Element())
+		if err != nil {
+			return nil, fmt.Errorf("could not read element for key '%v' %w", indexes.Element().Key, err)
+		}
+		elements = append(elements, element)
+	}
+	return store.NewCursor(elements), nil
+}
+
+// Delete removes the element corresponding to the provided key
+// the removal is appended to the file as a tombstone record, so that it is not lost on a reopen
+func (s *ScratchPad) Delete(key store.Key) error {
+	if s.closed {
+		return store.ErrClosed
+	}
+	if s.expired(key, time.Now()) {
+		s.remove(key)
+		return store.NotFound(key)
+	}
+	if untracked(s.index, key) == 0 {
+		return store.NotFound(key)
+	}
+	bb, err := s.concat.Tombstone(key)
+	if err != nil {
+		return fmt.Errorf("could not serialize tombstone for '%v' %w", key, err)
+	}
+	index, err := s.logWrite(bb)
+	if err != nil {
+		return fmt.Errorf("could not write tombstone for '%v' %w", key, err)
+	}
+	p, err := s.segments.append(bb)
+	if err != nil {
+		s.unlogWrite(index)
+		return fmt.Errorf("could not write tombstone for '%v' %w", key, err)
+	}
+
+	log.Trace().
+		Uint32("segment", p.segment).
+		Int("offset", p.offset).
+		Bytes("key", key).
+		Msg("Write_Tombstone")
+	// both the tombstone and the removed record can be dropped at the next compaction
+	s.garbage += untrack(s.index, key) + len(bb)
+	delete(s.expiries, string(key))
+	return nil
+}
+
+// Sweep removes all the expired elements from the index
+// it returns the number of the removed elements.
+// No tombstones are written, as the expired records are recognised as such on a reopen.
+func (s *ScratchPad) Sweep() int {
+	now := time.Now()
+	count := 0
+	for k, expiry := range s.expiries {
+		if store.Expired(expiry, now) {
+			s.remove(store.Key(k))
+			count++
+		}
+	}
+	return count
+}
+
+// expire sets the expiry for the element of the key
+// a zero expiry removes it, for an element that does not expire.
+func (s *ScratchPad) expire(key store.Key, expires time.Time) {
+	if expires.IsZero() {
+		delete(s.expiries, string(key))
+		return
+	}
+	s.expiries[string(key)] = expires
+}
+
+// expired checks if the element for the key has expired at the given time
+func (s *ScratchPad) expired(key store.Key, now time.Time) bool {
+	expiry, ok := s.expiries[string(key)]
+	return ok && store.Expired(expiry, now)
+}
+
+// remove drops the expired element for the key from the index
+// the record stays in the file, until the next compaction.
+func (s *ScratchPad) remove(key store.Key) {
+	s.garbage += untrack(s.index, key)
+	delete(s.expiries, string(key))
+}
+
 // Metadata returns internal statistics about the storage
 // It s not meant to serve anny functionality, but used only for testing
 func (s *ScratchPad) Metadata() store.Metadata {
-	file, _ := os.Open(s.filename)
-	fileScanner := bufio.NewScanner(file)
-	l := 0
-	var b uint64
-	for fileScanner.Scan() {
-		l++
-		b += uint64(len(fileScanner.Bytes()))
-	}
 	keyMetadata := s.index.Metadata()
 	return store.Metadata{
 		Size:        keyMetadata.Size,
 		KeysBytes:   keyMetadata.ValuesBytes + keyMetadata.KeysBytes,
-		ValuesBytes: b,
+		ValuesBytes: uint64(s.segments.size()),
 		Errors:      make([]error, 0),
 	}
 }
 
-// Close closes the file and completes all clean-up operations needed
+// Close closes the files and completes all clean-up operations needed
 func (s *ScratchPad) Close() error {
+	if s.closed {
+		return store.ErrClosed
+	}
+	s.closed = true
 
 	log.Debug().
-		Str("filename", s.wrFile.Name()).
-		Int("Offset", s.offset).
+		Str("filename", s.segments.active().name).
+		Int("segments", len(s.segments.list)).
+		Int("size", s.segments.size()).
 		Msg("Close ScratchPad Storage")
 
-	wrErr := s.wrFile.Close()
-	rdErr := s.rdFile.Close()
-
-	if wrErr != nil || rdErr != nil {
-		return fmt.Errorf("could not close ScratchPad [%v,%v]", wrErr, rdErr)
+	err := s.segments.close()
+	if err != nil {
+		return fmt.Errorf("could not close ScratchPad %w", err)
+	}
+	// the log belongs to the caller, so it is only synced
+	err = s.syncLog()
+	if err != nil {
+		return fmt.Errorf("could not sync log of ScratchPad %w", err)
 	}
 
 	return nil
@@ -1,7 +1,179 @@
 package file
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
 
-func TestScratchPad_Put(t *testing.T) {
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriePad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, TriePadFactory(t.TempDir()))
+}
+
+func TestTreePad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, TreePadFactory(t.TempDir()))
+}
+
+func TestScratchPad_Reopen(t *testing.T) {
+
+	for name, index := range map[string]store.StorageFactory{
+		"trie":  mem.SyncTrieFactory,
+		"btree": mem.SyncBTreeFactory,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := t.TempDir()
+
+			pad, err := NewScratchPad(path, index)
+			assert.NoError(t, err)
+
+			elements := test.Elements(100, test.Random(10, 20))
+			for _, element := range elements {
+				err := pad.Put(element)
+				assert.NoError(t, err)
+			}
+
+			// overwrite some keys and delete some others
+			for i := 0; i < 10; i++ {
+				elements[i].Value = test.RandomBytes(20)
+				err := pad.Put(elements[i])
+				assert.NoError(t, err)
+				err = pad.Delete(elements[len(elements)-1-i].Key)
+				assert.NoError(t, err)
+			}
+			deleted := elements[len(elements)-10:]
+			elements = elements[:len(elements)-10]
+
+			err = pad.Close()
+			assert.NoError(t, err)
+
+			pad, err = OpenScratchPad(path, index)
+			assert.NoError(t, err)
+
+			for _, element := range elements {
+				e, err := pad.Get(element.Key)
+				assert.NoError(t, err)
+				assert.Equal(t, element.Value, e.Value)
+			}
+			for _, element := range deleted {
+				_, err := pad.Get(element.Key)
+				assert.Error(t, err)
+			}
+			assert.Equal(t, uint64(len(elements)), pad.Metadata().Size)
+
+			// keep writing to the same file after the reopen
+			element := test.Random(10, 20).ElementFactory()
+			err = pad.Put(element)
+			assert.NoError(t, err)
+
+			err = pad.Close()
+			assert.NoError(t, err)
+
+			pad, err = OpenScratchPad(path, index)
+			assert.NoError(t, err)
+
+			e, err := pad.Get(element.Key)
+			assert.NoError(t, err)
+			assert.Equal(t, element.Value, e.Value)
+			assert.Equal(t, uint64(len(elements)+1), pad.Metadata().Size)
+
+			err = pad.Close()
+			assert.NoError(t, err)
+		})
+	}
+
+}
+
+func TestScratchPad_ReopenWithTTL(t *testing.T) {
+
+	path := t.TempDir()
+	ttl := 50 * time.Millisecond
+
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(4, test.Random(10, 20))
+	// expires
+	err = pad.PutWithTTL(elements[0], ttl)
+	assert.NoError(t, err)
+	// does not expire before the reopen
+	err = pad.PutWithTTL(elements[1], time.Hour)
+	assert.NoError(t, err)
+	// the plain put removes the expiry
+	err = pad.PutWithTTL(elements[2], ttl)
+	assert.NoError(t, err)
+	err = pad.Put(elements[2])
+	assert.NoError(t, err)
+	// the expired record hides the previous one
+	err = pad.Put(elements[3])
+	assert.NoError(t, err)
+	err = pad.PutWithTTL(elements[3], ttl)
+	assert.NoError(t, err)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	time.Sleep(ttl)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	assertPad(t, pad, elements[1:3], []store.Element{elements[0], elements[3]})
+	assert.Equal(t, uint64(2), pad.Metadata().Size)
+	assert.Contains(t, pad.expiries, string(elements[1].Key))
+	assert.NotContains(t, pad.expiries, string(elements[2].Key))
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_OpenEmpty(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	test.ReadWriteOperation(t, pad, test.Random(10, 20), true)
+
+}
+
+func TestScratchPad_Errors(t *testing.T) {
+
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	element := test.Random(10, 20).ElementFactory()
+
+	_, err = pad.Get(element.Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	var keyErr *store.KeyError
+	assert.True(t, errors.As(err, &keyErr))
+	assert.Equal(t, element.Key, keyErr.Key)
+
+	err = pad.Put(store.NewElement(make([]byte, 70000), element.Value))
+	assert.ErrorIs(t, err, store.ErrKeyTooLarge)
+
+	err = pad.Put(element)
+	assert.NoError(t, err)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	err = pad.Put(element)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	_, err = pad.Get(element.Key)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = pad.Delete(element.Key)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	_, err = pad.Scan(nil, nil)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = pad.Close()
+	assert.ErrorIs(t, err, store.ErrClosed)
 
 }
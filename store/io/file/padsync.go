@@ -4,14 +4,24 @@ import (
 	"fmt"
 	"github.com/drakos74/lachesis/store/store"
 	"sync"
+	"time"
 
 	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/rs/zerolog/log"
 )
 
 // SyncScratchPad is a thread-safe implementation of  file store
 type SyncScratchPad struct {
 	store *ScratchPad
 	mutex sync.RWMutex
+	// compaction makes sure only one compaction runs at a time
+	compaction sync.Mutex
+	// durability is the sync policy for the writes
+	durability Durability
+	group      *group
+	// stop signals the background routines to exit
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
 // NewSyncScratchPad creates a new file store that is thread-safe
@@ -60,27 +70,264 @@ func SyncTreePadFactory(path string) store.StorageFactory {
 	}
 }
 
+// NewSyncNativeTreePad creates a new file store that is thread-safe
+// using as an index the in-house Btree
+func NewSyncNativeTreePad(path string) (*SyncScratchPad, error) {
+	sb, err := NewScratchPad(path, mem.SyncNativeBTreeFactory)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncScratchPad{
+		store: sb,
+	}, nil
+}
+
+// SyncNativeTreePadFactory generates a synced file storage implementation
+// with the in-house btree as an index
+func SyncNativeTreePadFactory(path string) store.StorageFactory {
+	return func() store.Storage {
+		pad, err := NewSyncNativeTreePad(path)
+		if err != nil {
+			panic(fmt.Sprintf("error during store creation: %v", err))
+		}
+		return pad
+	}
+}
+
+// SyncCompactingPadFactory generates a synced file storage implementation
+// that compacts its file in the background according to the given policy
+func SyncCompactingPadFactory(path string, policy Compaction) store.StorageFactory {
+	return func() store.Storage {
+		pad, err := NewSyncScratchPad(path)
+		if err != nil {
+			panic(fmt.Sprintf("error during store creation: %v", err))
+		}
+		return pad.WithCompaction(policy)
+	}
+}
+
+// SyncDurablePadFactory generates a synced file storage implementation
+// that syncs its writes to disk according to the given policy
+func SyncDurablePadFactory(path string, policy Durability) store.StorageFactory {
+	return func() store.Storage {
+		pad, err := NewSyncScratchPad(path)
+		if err != nil {
+			panic(fmt.Sprintf("error during store creation: %v", err))
+		}
+		return pad.WithDurability(policy)
+	}
+}
+
+// WithCompaction starts a background routine that compacts the file,
+// whenever the conditions of the given policy are met.
+// The routine is stopped when the store is closed.
+func (ss *SyncScratchPad) WithCompaction(policy Compaction) *SyncScratchPad {
+	ss.background(policy.Interval, func() {
+		ss.mutex.RLock()
+		due := policy.due(ss.store.segments.size(), ss.store.garbage)
+		ss.mutex.RUnlock()
+		if due {
+			if err := ss.Compact(); err != nil {
+				log.Error().Err(err).Msg("could not compact ScratchPad")
+			}
+		}
+	})
+	return ss
+}
+
+// WithDurability sets the policy for syncing the writes to disk.
+// For the SyncInterval mode it starts a background routine, that is stopped when the store is closed.
+func (ss *SyncScratchPad) WithDurability(policy Durability) *SyncScratchPad {
+	ss.durability = policy
+	switch policy.Mode {
+	case SyncInterval:
+		ss.background(policy.Interval, func() {
+			if err := ss.syncFile(); err != nil {
+				log.Error().Err(err).Msg("could not sync ScratchPad")
+			}
+		})
+	case SyncGroupCommit:
+		ss.group = newGroup()
+	}
+	return ss
+}
+
+// WithSweeper starts a background routine that removes the expired elements at the given interval
+// the routine is stopped when the store is closed.
+func (ss *SyncScratchPad) WithSweeper(interval time.Duration) *SyncScratchPad {
+	ss.background(interval, func() {
+		ss.Sweep()
+	})
+	return ss
+}
+
+// background runs the given routine periodically, until the store is closed
+func (ss *SyncScratchPad) background(interval time.Duration, routine func()) {
+	if ss.stop == nil {
+		ss.stop = make(chan struct{})
+	}
+	stop := ss.stop
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				routine()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Compact compacts the file of the store.
+// The live records are copied without holding the lock, so that reads and writes are still served,
+// while the write lock is used only for catching up with the latest writes and swapping the files
+func (ss *SyncScratchPad) Compact() error {
+	ss.compaction.Lock()
+	defer ss.compaction.Unlock()
+
+	ss.mutex.RLock()
+	c, err := ss.store.startCompaction()
+	ss.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	err = c.copy()
+	if err != nil {
+		c.abort()
+		return err
+	}
+
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.store.completeCompaction(c)
+}
+
 // Put adds an element to the store while using a write lock
 func (ss *SyncScratchPad) Put(element store.Element) error {
+	return ss.write(func() error {
+		return ss.store.Put(element)
+	})
+}
+
+// PutWithTTL adds an element that expires after the given duration to the store while using a write lock
+func (ss *SyncScratchPad) PutWithTTL(element store.Element, ttl time.Duration) error {
+	return ss.write(func() error {
+		return ss.store.PutWithTTL(element, ttl)
+	})
+}
+
+// write applies the given write operation while using a write lock,
+// and makes it durable according to the durability policy of the store
+func (ss *SyncScratchPad) write(op func() error) error {
 	ss.mutex.Lock()
-	defer ss.mutex.Unlock()
-	return ss.store.Put(element)
+	err := op()
+	if err != nil {
+		ss.mutex.Unlock()
+		return err
+	}
+	switch ss.durability.Mode {
+	case SyncEveryWrite:
+		err = ss.store.syncLog()
+		if err == nil {
+			err = ss.store.segments.sync()
+		}
+		ss.mutex.Unlock()
+		return err
+	case SyncGroupCommit:
+		seq := ss.group.add()
+		ss.mutex.Unlock()
+		// wait for the sync outside the lock, so that more writers can join the group
+		return ss.group.wait(seq, ss.syncFile)
+	default:
+		ss.mutex.Unlock()
+		return nil
+	}
 }
 
 // Get retrieves an element from the store while using a read lock
+// the read lock is upgraded to a write lock only for removing an expired element
 func (ss *SyncScratchPad) Get(key store.Key) (store.Element, error) {
+	now := time.Now()
+	ss.mutex.RLock()
+	if !ss.store.expired(key, now) {
+		defer ss.mutex.RUnlock()
+		return ss.store.lookup(key)
+	}
+	ss.mutex.RUnlock()
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.store.closed {
+		return store.Element{}, store.ErrClosed
+	}
+	// the element might have been put again in the meantime
+	if ss.store.expired(key, now) {
+		ss.store.remove(key)
+	}
+	return store.Element{}, store.NotFound(key)
+}
+
+// Scan retrieves the elements within the given key range while using a read lock
+func (ss *SyncScratchPad) Scan(from, to store.Key) (store.Cursor, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.store.Scan(from, to)
+}
+
+// Prefix retrieves the elements with the given key prefix while using a read lock
+func (ss *SyncScratchPad) Prefix(p store.Key) (store.Cursor, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.store.Prefix(p)
+}
+
+// Verify checks the files of the store for corrupted records while using a read lock
+func (ss *SyncScratchPad) Verify() ([]CorruptionError, error) {
 	ss.mutex.RLock()
 	defer ss.mutex.RUnlock()
-	return ss.store.Get(key)
+	return ss.store.Verify()
 }
 
-// Close does any clean up
+// Sweep removes all the expired elements from the store while using a write lock
+func (ss *SyncScratchPad) Sweep() int {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.store.Sweep()
+}
+
+// Delete removes an element from the store while using a write lock
+func (ss *SyncScratchPad) Delete(key store.Key) error {
+	return ss.write(func() error {
+		return ss.store.Delete(key)
+	})
+}
+
+// Close stops the background routines, if any, and does any clean up
 func (ss *SyncScratchPad) Close() error {
+	ss.mutex.Lock()
+	stop := ss.stop
+	ss.stop = nil
+	ss.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		ss.wg.Wait()
+	}
+	ss.compaction.Lock()
+	defer ss.compaction.Unlock()
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
 	return ss.store.Close()
 }
 
 // Metadata returns internal statistics about the storage
 // It s not meant to serve anny functionality, but used only for testing
 func (ss *SyncScratchPad) Metadata() store.Metadata {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
 	return ss.store.Metadata()
 }
@@ -1 +1,59 @@
 package file
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncPad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SyncScratchPadFactory(t.TempDir()))
+}
+
+func TestSyncPad_SyncImplementation(t *testing.T) {
+	new(test.Concurrency).Run(t, SyncScratchPadFactory(t.TempDir()))
+}
+
+func TestSyncTreePad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SyncTreePadFactory(t.TempDir()))
+}
+
+func TestSyncTreePad_SyncImplementation(t *testing.T) {
+	new(test.Concurrency).Run(t, SyncTreePadFactory(t.TempDir()))
+}
+
+func TestSyncNativeTreePad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SyncNativeTreePadFactory(t.TempDir()))
+}
+
+func TestSyncNativeTreePad_SyncImplementation(t *testing.T) {
+	new(test.Concurrency).Run(t, SyncNativeTreePadFactory(t.TempDir()))
+}
+
+func TestSyncScratchPad_Sweeper(t *testing.T) {
+
+	pad, err := NewSyncScratchPad(t.TempDir())
+	assert.NoError(t, err)
+	pad = pad.WithSweeper(10 * time.Millisecond)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for i, element := range elements {
+		ttl := time.Hour
+		if i%2 == 0 {
+			ttl = 10 * time.Millisecond
+		}
+		err := pad.PutWithTTL(element, ttl)
+		assert.NoError(t, err)
+	}
+
+	// the expired elements are removed without being read
+	assert.Eventually(t, func() bool {
+		return pad.Metadata().Size == uint64(len(elements)/2)
+	}, time.Second, 10*time.Millisecond)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
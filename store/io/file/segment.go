@@ -0,0 +1,306 @@
+package file
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSegmentSize is the size in bytes, after which a pad rolls over to a new segment file
+const DefaultSegmentSize = 1 << 30
+
+// maxSegmentSize is the biggest offset a fileIndex can point to within a segment
+const maxSegmentSize = math.MaxInt32
+
+// segment is a single file of the pad
+type segment struct {
+	id   uint32
+	name string
+	size int
+}
+
+// position points to a location within the segments of a pad
+type position struct {
+	segment uint32
+	offset  int
+}
+
+// segments is the ordered list of files a pad appends its records to
+// only the last segment is open for writing, while reads go through the pool of read handles
+type segments struct {
+	path string
+	// limit is the size in bytes, after which a new segment is started
+	limit  int
+	list   []*segment
+	wrFile *os.File
+	// temp marks segments that are not yet visible to a reopen of the pad
+	temp    bool
+	readers *handles
+	next    uint32
+}
+
+// createSegments starts a new list of segments in the given path
+func createSegments(path string, limit int, temp bool) (*segments, error) {
+	if limit <= 0 || limit > maxSegmentSize {
+		return nil, fmt.Errorf("segment size must be within (0,%d] but was %d", maxSegmentSize, limit)
+	}
+	s := &segments{path: path, limit: limit, temp: temp, readers: newHandles(maxReadHandles)}
+	err := s.roll()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSegments opens the list of segments from the given files
+// the files are expected in the order they were created, the last one being open for writing
+func openSegments(path string, limit int, files []string) (*segments, error) {
+	if limit <= 0 || limit > maxSegmentSize {
+		return nil, fmt.Errorf("segment size must be within (0,%d] but was %d", maxSegmentSize, limit)
+	}
+	s := &segments{path: path, limit: limit, readers: newHandles(maxReadHandles)}
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open segment '%s' %w", name, err)
+		}
+		s.add(name, int(info.Size()))
+	}
+	wrFile, err := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not create write file for segment %w", err)
+	}
+	s.wrFile = wrFile
+	return s, nil
+}
+
+// add registers a new segment file
+func (s *segments) add(name string, size int) *segment {
+	sg := &segment{id: s.next, name: name, size: size}
+	s.next++
+	s.list = append(s.list, sg)
+	s.readers.register(sg.id, sg.name)
+	return sg
+}
+
+// active returns the segment open for writing
+func (s *segments) active() *segment {
+	return s.list[len(s.list)-1]
+}
+
+// end returns the position after the last record
+func (s *segments) end() position {
+	active := s.active()
+	return position{segment: active.id, offset: active.size}
+}
+
+// size returns the total size of all segments
+func (s *segments) size() int {
+	size := 0
+	for _, sg := range s.list {
+		size += sg.size
+	}
+	return size
+}
+
+// roll closes the active segment for writing and starts a new one
+func (s *segments) roll() error {
+	name := fileName(s.path)
+	if s.temp {
+		name = fmt.Sprintf("%s.tmp", name)
+	}
+	wrFile, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not create write file for segment %w", err)
+	}
+	if s.wrFile != nil {
+		syncErr := s.wrFile.Sync()
+		closeErr := s.wrFile.Close()
+		if syncErr != nil || closeErr != nil {
+			_ = wrFile.Close()
+			_ = os.Remove(name)
+			return fmt.Errorf("could not close segment '%s' [%v,%v]", s.active().name, syncErr, closeErr)
+		}
+	}
+	s.wrFile = wrFile
+	sg := s.add(name, 0)
+
+	log.Debug().
+		Str("filename", sg.name).
+		Uint32("segment", sg.id).
+		Msg("Roll ScratchPad Segment")
+	return nil
+}
+
+// append writes the data to the active segment, rolling to a new one if the size limit would be exceeded
+// it returns the position the data was written to
+func (s *segments) append(data []byte) (position, error) {
+	active := s.active()
+	if active.size > 0 && active.size+len(data) > s.limit {
+		err := s.roll()
+		if err != nil {
+			return position{}, err
+		}
+		active = s.active()
+	}
+	n, err := s.wrFile.Write(data)
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("write failed '%d' != %d", n, len(data))
+	}
+	if err != nil {
+		// drop the partial record and continue on a fresh segment
+		if truncErr := s.wrFile.Truncate(int64(active.size)); truncErr != nil {
+			log.Error().Err(truncErr).Str("filename", active.name).Msg("could not truncate segment")
+		}
+		if rollErr := s.roll(); rollErr != nil {
+			log.Error().Err(rollErr).Str("filename", active.name).Msg("could not roll segment")
+		}
+		return position{}, fmt.Errorf("could not write to segment '%s' %w", active.name, err)
+	}
+	p := position{segment: active.id, offset: active.size}
+	active.size += n
+	return p, nil
+}
+
+// readAt reads size bytes from the given segment and offset
+// it is safe to call concurrently with append, as it only relies on the pool of read handles
+func (s *segments) readAt(id uint32, offset int64, size int) ([]byte, error) {
+	file, err := s.readers.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.readers.release(id)
+	data := make([]byte, size)
+	n, err := file.ReadAt(data, offset)
+	if err == io.EOF {
+		// the index points past the end of the file
+		return nil, &CorruptionError{File: file.Name(), Offset: offset, Size: size, Err: io.ErrUnexpectedEOF}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read at '%d:%d' bb '%d' found '%d' %w", id, offset, size, n, err)
+	}
+	return data, nil
+}
+
+// scan reads all the records starting from the given position
+func (s *segments) scan(from position, f func(p position, record bytes.Record, n int) error) error {
+	for _, sg := range s.list {
+		if sg.id < from.segment {
+			continue
+		}
+		offset := 0
+		if sg.id == from.segment {
+			offset = from.offset
+		}
+		file, err := s.readers.acquire(sg.id)
+		if err != nil {
+			return err
+		}
+		err = scan(file, sg.id, offset, sg.size, f)
+		s.readers.release(sg.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scan reads the records of a single segment file of the given size, starting at the given offset
+func scan(file *os.File, id uint32, offset, size int, f func(p position, record bytes.Record, n int) error) error {
+	reader := bufio.NewReader(io.NewSectionReader(file, int64(offset), math.MaxInt64))
+	for {
+		record, n, err := bytes.ReadRecordWithin(reader, int64(size-offset))
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF || errors.Is(err, bytes.ErrChecksum) || errors.Is(err, bytes.ErrRecordSize) {
+			return &CorruptionError{File: file.Name(), Offset: int64(offset), Size: n, Err: err}
+		}
+		if err != nil {
+			return fmt.Errorf("could not read record at '%d:%d' %w", id, offset, err)
+		}
+		err = f(position{segment: id, offset: offset}, record, n)
+		if err != nil {
+			return err
+		}
+		offset += n
+	}
+}
+
+// truncate drops the content of the active segment after the given offset
+func (s *segments) truncate(offset int) error {
+	err := s.wrFile.Truncate(int64(offset))
+	if err != nil {
+		return fmt.Errorf("could not truncate segment '%s' at '%d' %w", s.active().name, offset, err)
+	}
+	s.active().size = offset
+	return nil
+}
+
+// sync commits the active segment to disk
+func (s *segments) sync() error {
+	return s.wrFile.Sync()
+}
+
+// publish renames the temporary segments, so that they are picked up on a reopen
+func (s *segments) publish() error {
+	for _, sg := range s.list {
+		name := fileName(s.path)
+		err := os.Rename(sg.name, name)
+		if err != nil {
+			return fmt.Errorf("could not rename segment '%s' %w", sg.name, err)
+		}
+		sg.name = name
+		s.readers.register(sg.id, sg.name)
+	}
+	s.temp = false
+	return nil
+}
+
+// close syncs and closes all files of the segments
+func (s *segments) close() error {
+	syncErr := s.wrFile.Sync()
+	wrErr := s.wrFile.Close()
+	rdErr := s.readers.close()
+	if syncErr != nil || wrErr != nil || rdErr != nil {
+		return fmt.Errorf("could not close segments [%v,%v,%v]", syncErr, wrErr, rdErr)
+	}
+	return nil
+}
+
+// remove closes and deletes all files of the segments
+func (s *segments) remove() error {
+	err := s.close()
+	for _, sg := range s.list {
+		if rmErr := os.Remove(sg.name); rmErr != nil && err == nil {
+			err = fmt.Errorf("could not remove segment '%s' %w", sg.name, rmErr)
+		}
+	}
+	return err
+}
+
+// last is the last timestamp used for a file name
+var last int64
+
+// fileName generates a new file name in the given path
+// names are unix timestamps, that are unique and increasing within the process
+func fileName(path string) string {
+	for {
+		prev := atomic.LoadInt64(&last)
+		now := time.Now().UnixNano()
+		if now <= prev {
+			now = prev + 1
+		}
+		if atomic.CompareAndSwapInt64(&last, prev, now) {
+			return fmt.Sprintf("%s/%d.%s", path, now, extension)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package file
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentedPad_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SegmentedPadFactory(t.TempDir(), 1024))
+}
+
+func TestSegmentedPad_Rolling(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewSegmentedPad(path, mem.SyncBTreeFactory, 1024)
+	assert.NoError(t, err)
+
+	elements := test.Elements(100, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		err := pad.Delete(elements[i].Key)
+		assert.NoError(t, err)
+	}
+	deleted := elements[:10]
+	elements = elements[10:]
+
+	// every segment should stay within the size limit
+	files, err := filepath.Glob(fmt.Sprintf("%s/*.%s", path, extension))
+	assert.NoError(t, err)
+	assert.True(t, len(files) > 1)
+	assert.Equal(t, len(pad.segments.list), len(files))
+	for _, sg := range pad.segments.list {
+		assert.True(t, sg.size <= 1024)
+	}
+	assertPad(t, pad, elements, deleted)
+
+	// the index is restored from all segments
+	err = pad.Close()
+	assert.NoError(t, err)
+	pad, err = OpenSegmentedPad(path, mem.SyncBTreeFactory, 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, len(files), len(pad.segments.list))
+	assertPad(t, pad, elements, deleted)
+
+	// compaction drops the segments of the removed records
+	err = pad.Compact()
+	assert.NoError(t, err)
+	compacted, err := filepath.Glob(fmt.Sprintf("%s/*.%s", path, extension))
+	assert.NoError(t, err)
+	assert.Equal(t, len(pad.segments.list), len(compacted))
+	assert.True(t, len(compacted) < len(files))
+	assertPad(t, pad, elements, deleted)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestSegmentedPad_InvalidSize(t *testing.T) {
+
+	_, err := NewSegmentedPad(t.TempDir(), mem.SyncTrieFactory, 0)
+	assert.Error(t, err)
+
+	_, err = NewSegmentedPad(t.TempDir(), mem.SyncTrieFactory, maxSegmentSize+1)
+	assert.Error(t, err)
+
+}
+
+func TestHandles_Evict(t *testing.T) {
+
+	path := t.TempDir()
+
+	sgs, err := createSegments(path, 10, false)
+	assert.NoError(t, err)
+	sgs.readers = newHandles(2)
+	for i := 0; i < 4; i++ {
+		_, err := sgs.append([]byte("0123456789"))
+		assert.NoError(t, err)
+	}
+	sgs.readers.register(0, sgs.list[0].name)
+
+	// keep the first segment in use, while reading all the others
+	_, err = sgs.readers.acquire(0)
+	assert.NoError(t, err)
+	for _, sg := range sgs.list[1:] {
+		data, err := sgs.readAt(sg.id, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("0123456789"), data)
+		assert.True(t, len(sgs.readers.open) <= 2)
+	}
+	assert.Contains(t, sgs.readers.open, uint32(0))
+
+	sgs.readers.release(0)
+	_, err = sgs.readAt(1, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(sgs.readers.open))
+
+	_, err = sgs.readAt(uint32(len(sgs.list)), 0, 10)
+	assert.Error(t, err)
+
+	err = sgs.remove()
+	assert.NoError(t, err)
+
+}
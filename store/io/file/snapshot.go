@@ -0,0 +1,39 @@
+package file
+
+import (
+	"io"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// Snapshot writes all the elements of the pad to the writer
+// it relies on the index to list the elements
+func (s *ScratchPad) Snapshot(w io.Writer) error {
+	elements, err := s.Scan(nil, nil)
+	if err != nil {
+		return err
+	}
+	return store.WriteSnapshot(w, elements)
+}
+
+// Restore adds the elements of the snapshot in the reader to the pad
+// the elements are written as a single batch
+func (s *ScratchPad) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(s, r)
+}
+
+// Snapshot writes all the elements of the store to the writer
+// the elements are read while using a read lock, so that the snapshot is consistent
+func (ss *SyncScratchPad) Snapshot(w io.Writer) error {
+	elements, err := ss.Scan(nil, nil)
+	if err != nil {
+		return err
+	}
+	return store.WriteSnapshot(w, elements)
+}
+
+// Restore adds the elements of the snapshot in the reader to the store
+// the elements are written as a single batch
+func (ss *SyncScratchPad) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(ss, r)
+}
@@ -0,0 +1,56 @@
+package file
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot_CrossBackend(t *testing.T) {
+
+	elements := test.Elements(100, test.Random(10, 20))
+
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+
+	// from the pad into the memory cache
+	snapshot := new(bytes.Buffer)
+	err = pad.Snapshot(snapshot)
+	assert.NoError(t, err)
+	cache := mem.NewCache()
+	err = cache.Restore(snapshot)
+	assert.NoError(t, err)
+	assertPad(t, cache, elements, nil)
+
+	// from the memory trie into a new pad
+	trie := mem.NewTrie()
+	err = trie.Restore(bytes.NewReader(mustSnapshot(t, cache)))
+	assert.NoError(t, err)
+	restored, err := NewScratchPad(t.TempDir(), mem.SyncBTreeFactory)
+	assert.NoError(t, err)
+	err = restored.Restore(bytes.NewReader(mustSnapshot(t, trie)))
+	assert.NoError(t, err)
+	assertPad(t, restored, elements, nil)
+	assert.Equal(t, uint64(len(elements)), restored.Metadata().Size)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+	err = restored.Close()
+	assert.NoError(t, err)
+
+}
+
+func mustSnapshot(t *testing.T, snapshotter store.Snapshotter) []byte {
+	snapshot := new(bytes.Buffer)
+	err := snapshotter.Snapshot(snapshot)
+	assert.NoError(t, err)
+	return snapshot.Bytes()
+}
@@ -0,0 +1,93 @@
+package file
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+)
+
+// CorruptionError describes a range of a file that does not hold a valid record
+type CorruptionError struct {
+	File   string
+	Offset int64
+	Size   int
+	Err    error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted record in '%s' at [%d,%d] %v", e.File, e.Offset, e.Offset+int64(e.Size), e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes every CorruptionError match store.ErrCorrupted
+func (e *CorruptionError) Is(target error) bool {
+	return target == store.ErrCorrupted
+}
+
+// Verify scans all the files of the pad and reports the ranges that do not hold a valid record
+// the returned error signals a failure to read the files, rather than corrupted content
+func (s *ScratchPad) Verify() ([]CorruptionError, error) {
+	if s.closed {
+		return nil, store.ErrClosed
+	}
+	corruptions := make([]CorruptionError, 0)
+	for _, sg := range s.segments.list {
+		cc, err := s.segments.verify(sg)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify segment '%s' %w", sg.name, err)
+		}
+		corruptions = append(corruptions, cc...)
+	}
+	return corruptions, nil
+}
+
+// verify checks every record of the segment against its checksum
+// a record with a mismatching checksum is skipped based on the size in its header,
+// while a record that does not fit in the file, or with sizes no record can have, marks the rest of it as corrupted
+func (s *segments) verify(sg *segment) ([]CorruptionError, error) {
+	file, err := s.readers.acquire(sg.id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.readers.release(sg.id)
+
+	corruptions := make([]CorruptionError, 0)
+	torn := func(offset int) []CorruptionError {
+		return append(corruptions, CorruptionError{File: sg.name, Offset: int64(offset), Size: sg.size - offset, Err: io.ErrUnexpectedEOF})
+	}
+
+	header := make([]byte, bytes.RecordHeaderSize)
+	offset := 0
+	for offset < sg.size {
+		if offset+bytes.RecordHeaderSize > sg.size {
+			return torn(offset), nil
+		}
+		_, err := file.ReadAt(header, int64(offset))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read header at '%d' %w", offset, err)
+		}
+		if err := bytes.CheckHeader(header); err != nil {
+			// there is no telling where the next record starts
+			return append(corruptions, CorruptionError{File: sg.name, Offset: int64(offset), Size: sg.size - offset, Err: err}), nil
+		}
+		size := bytes.RecordSize(header)
+		if offset+size > sg.size {
+			return torn(offset), nil
+		}
+		data := make([]byte, size)
+		_, err = file.ReadAt(data, int64(offset))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read record at '%d' %w", offset, err)
+		}
+		if _, err := bytes.DecodeRecord(data); err != nil {
+			corruptions = append(corruptions, CorruptionError{File: sg.name, Offset: int64(offset), Size: size, Err: err})
+		}
+		offset += size
+	}
+	return corruptions, nil
+}
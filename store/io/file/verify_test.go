@@ -0,0 +1,311 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchPad_GetCorrupted(t *testing.T) {
+
+	pad, err := NewScratchPad(t.TempDir(), mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+
+	offset, _ := corrupt(t, pad, elements[5].Key)
+
+	_, err = pad.Get(elements[5].Key)
+	var corruption *CorruptionError
+	assert.True(t, errors.As(err, &corruption))
+	assert.ErrorIs(t, err, bytes.ErrChecksum)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+	assert.Equal(t, offset, corruption.Offset)
+	assert.Equal(t, pad.segments.active().name, corruption.File)
+
+	// the other records are not affected
+	assertPad(t, pad, append(elements[:5:5], elements[6:]...), nil)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_Verify(t *testing.T) {
+
+	pad, err := NewSegmentedPad(t.TempDir(), mem.SyncTrieFactory, 1024)
+	assert.NoError(t, err)
+
+	elements := test.Elements(100, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+
+	corruptions, err := pad.Verify()
+	assert.NoError(t, err)
+	assert.Empty(t, corruptions)
+
+	first, firstSize := corrupt(t, pad, elements[0].Key)
+	last, lastSize := corrupt(t, pad, elements[len(elements)-1].Key)
+
+	corruptions, err = pad.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(corruptions))
+	assert.Equal(t, first, corruptions[0].Offset)
+	assert.Equal(t, firstSize, corruptions[0].Size)
+	assert.Equal(t, pad.segments.list[0].name, corruptions[0].File)
+	assert.ErrorIs(t, &corruptions[0], bytes.ErrChecksum)
+	assert.Equal(t, last, corruptions[1].Offset)
+	assert.Equal(t, lastSize, corruptions[1].Size)
+	assert.Equal(t, pad.segments.active().name, corruptions[1].File)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_ReopenTorn(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+	size := pad.segments.size()
+	name := pad.segments.active().name
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	// simulate an interrupted write
+	record, err := bytes.EncodeRecord(bytes.Record{Key: []byte("key"), Value: []byte("value")})
+	assert.NoError(t, err)
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.Write(record[:len(record)-3])
+	assert.NoError(t, err)
+	err = file.Close()
+	assert.NoError(t, err)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	assert.Equal(t, size, pad.segments.size())
+	assertPad(t, pad, elements, nil)
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), info.Size())
+
+	// new records are appended after the truncated one
+	element := test.Random(10, 20).ElementFactory()
+	err = pad.Put(element)
+	assert.NoError(t, err)
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+	assertPad(t, pad, append(elements, element), nil)
+	err = pad.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestScratchPad_ReopenCorrupted(t *testing.T) {
+
+	path := t.TempDir()
+
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+	corrupt(t, pad, elements[5].Key)
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	// a corrupted record in the middle of the file is not the result of an interrupted write
+	_, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	var corruption *CorruptionError
+	assert.True(t, errors.As(err, &corruption))
+	assert.ErrorIs(t, err, bytes.ErrChecksum)
+
+}
+
+func TestScratchPad_ReopenCorruptedLast(t *testing.T) {
+
+	for name, size := range map[string]int{
+		"record": 1,
+		"batch":  3,
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			path := t.TempDir()
+
+			pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+			assert.NoError(t, err)
+
+			elements := test.Elements(10, test.Random(10, 20))
+			for _, element := range elements {
+				err := pad.Put(element)
+				assert.NoError(t, err)
+			}
+			offset := pad.segments.size()
+			name := pad.segments.active().name
+
+			written := test.Elements(size, test.Random(10, 20))
+			batch := pad.NewBatch()
+			for _, element := range written {
+				batch.Put(element)
+			}
+			err = batch.Commit()
+			assert.NoError(t, err)
+			last, _ := corruptChecksum(t, pad, written[len(written)-1].Key)
+			err = pad.Close()
+			assert.NoError(t, err)
+
+			// the last record did not fully reach the disk, so it is dropped along with its batch
+			pad, err = OpenScratchPad(path, mem.SyncTrieFactory)
+			assert.NoError(t, err)
+			assert.Equal(t, offset, pad.segments.size())
+			if size > 1 {
+				assert.Less(t, offset, int(last))
+			}
+			assertPad(t, pad, elements, written)
+			info, err := os.Stat(name)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(offset), info.Size())
+
+			err = pad.Close()
+			assert.NoError(t, err)
+		})
+	}
+
+}
+
+// corruptChecksum flips the first byte of the checksum of the record for the given key
+// it returns the offset and size of the record
+func corruptChecksum(t *testing.T, pad *ScratchPad, key store.Key) (int64, int) {
+	element, err := pad.index.Get(key)
+	assert.NoError(t, err)
+	index, err := bytes.ReadIndex(element.Value)
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(pad.segments.readers.name(index.Segment()), os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	b := make([]byte, 1)
+	_, err = file.ReadAt(b, index.Offset())
+	assert.NoError(t, err)
+	b[0]++
+	_, err = file.WriteAt(b, index.Offset())
+	assert.NoError(t, err)
+
+	return index.Offset(), index.Size()
+}
+
+// corruptSize overwrites the value size in the header of the record for the given key
+// it returns the offset of the record
+func corruptSize(t *testing.T, pad *ScratchPad, key store.Key, size uint32) int64 {
+	element, err := pad.index.Get(key)
+	assert.NoError(t, err)
+	index, err := bytes.ReadIndex(element.Value)
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(pad.segments.readers.name(index.Segment()), os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, size)
+	_, err = file.WriteAt(b, index.Offset()+7)
+	assert.NoError(t, err)
+
+	return index.Offset()
+}
+
+// corrupt flips the last byte of the record for the given key
+// it returns the offset and size of the record
+func corrupt(t *testing.T, pad *ScratchPad, key store.Key) (int64, int) {
+	element, err := pad.index.Get(key)
+	assert.NoError(t, err)
+	index, err := bytes.ReadIndex(element.Value)
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(pad.segments.readers.name(index.Segment()), os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	b := make([]byte, 1)
+	at := index.Offset() + int64(index.Size()) - 1
+	_, err = file.ReadAt(b, at)
+	assert.NoError(t, err)
+	b[0]++
+	_, err = file.WriteAt(b, at)
+	assert.NoError(t, err)
+
+	return index.Offset(), index.Size()
+}
+
+func TestScratchPad_VerifyCorruptedSize(t *testing.T) {
+
+	path := t.TempDir()
+	pad, err := NewScratchPad(path, mem.SyncTrieFactory)
+	assert.NoError(t, err)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for _, element := range elements {
+		err := pad.Put(element)
+		assert.NoError(t, err)
+	}
+	offset := corruptSize(t, pad, elements[5].Key, math.MaxUint32)
+
+	// the rest of the file is corrupted, as there is no telling where the next record starts
+	corruptions, err := pad.Verify()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(corruptions))
+	assert.Equal(t, offset, corruptions[0].Offset)
+	assert.Equal(t, pad.segments.active().size-int(offset), corruptions[0].Size)
+	assert.ErrorIs(t, &corruptions[0], bytes.ErrRecordSize)
+
+	err = pad.Close()
+	assert.NoError(t, err)
+
+	// the header is not the result of an interrupted write, so the pad does not open
+	_, err = OpenScratchPad(path, mem.SyncTrieFactory)
+	var corruption *CorruptionError
+	assert.True(t, errors.As(err, &corruption))
+	assert.ErrorIs(t, err, bytes.ErrRecordSize)
+	assert.Equal(t, offset, corruption.Offset)
+
+}
+
+func TestCorruptionError(t *testing.T) {
+
+	err := &CorruptionError{File: "file", Offset: 10, Size: 5, Err: io.ErrUnexpectedEOF}
+	assert.Equal(t, "corrupted record in 'file' at [10,15] unexpected EOF", err.Error())
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+
+}
@@ -0,0 +1,179 @@
+package mem
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// Capacity is the limit of the contents of a bounded cache
+// it is either a number of elements or a size in bytes.
+type Capacity struct {
+	limit int
+	bytes bool
+}
+
+// Entries creates a capacity of the given number of elements
+func Entries(n int) Capacity {
+	return Capacity{limit: n}
+}
+
+// Bytes creates a capacity of the given size in bytes
+// the size of every element is the sum of the sizes of its key and value.
+func Bytes(n int) Capacity {
+	return Capacity{limit: n, bytes: true}
+}
+
+// cost returns the part of the capacity taken by the element
+func (c Capacity) cost(element store.Element) int {
+	if c.bytes {
+		return element.Size()
+	}
+	return 1
+}
+
+// bounded is an element of a bounded cache, along with its cost
+type bounded struct {
+	value store.Value
+	cost  int
+}
+
+// BoundedCache is an in memory storage with a limited capacity
+// when the capacity is exceeded, elements are evicted according to the given policy.
+// It is not thread-safe, as every read updates the state of the eviction policy.
+type BoundedCache struct {
+	storage  map[string]bounded
+	capacity Capacity
+	policy   evictor
+	// used is the part of the capacity taken by the current elements
+	used      int
+	keys      int
+	values    int
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewBoundedCache creates a new bounded cache
+func NewBoundedCache(capacity Capacity, policy Policy) *BoundedCache {
+	return &BoundedCache{
+		storage:  make(map[string]bounded),
+		capacity: capacity,
+		policy:   newEvictor(policy, capacity),
+	}
+}
+
+// BoundedCacheFactory generates a BoundedCache storage implementation
+func BoundedCacheFactory(capacity Capacity, policy Policy) store.StorageFactory {
+	return func() store.Storage {
+		return NewBoundedCache(capacity, policy)
+	}
+}
+
+// Put adds an element to the cache
+// it evicts as many elements as needed to make room for it, possibly even the previous value of the same key.
+func (c *BoundedCache) Put(element store.Element) error {
+	cost := c.capacity.cost(element)
+	if cost > c.capacity.limit {
+		return fmt.Errorf("%w: cannot store element of cost %d in cache of capacity %d", store.ErrValueTooLarge, cost, c.capacity.limit)
+	}
+	key := string(element.Key)
+	previous, ok := c.storage[key]
+	for c.used-previous.cost+cost > c.capacity.limit {
+		victim := c.policy.victim()
+		c.remove(victim)
+		c.evictions++
+		if victim == key {
+			previous, ok = bounded{}, false
+		}
+	}
+	if ok {
+		c.policy.update(key, cost)
+		c.used -= previous.cost
+		c.values -= len(previous.value)
+	} else {
+		c.policy.add(key, cost)
+		c.keys += len(key)
+	}
+	c.storage[key] = bounded{value: element.Value, cost: cost}
+	c.used += cost
+	c.values += len(element.Value)
+	return nil
+}
+
+// Get retrieves an element from the cache
+func (c *BoundedCache) Get(key store.Key) (store.Element, error) {
+	c.policy.access(string(key))
+	if result, ok := c.storage[string(key)]; ok {
+		c.hits++
+		return store.NewElement(key, result.value), nil
+	}
+	c.misses++
+	return store.Nil, store.NotFound(key)
+}
+
+// Delete removes the element for the given key from the cache
+func (c *BoundedCache) Delete(key store.Key) error {
+	if _, ok := c.storage[string(key)]; !ok {
+		return store.NotFound(key)
+	}
+	c.remove(string(key))
+	return nil
+}
+
+// remove drops the element for the key from the cache and the policy
+func (c *BoundedCache) remove(key string) {
+	element := c.storage[key]
+	c.policy.remove(key)
+	delete(c.storage, key)
+	c.used -= element.cost
+	c.keys -= len(key)
+	c.values -= len(element.value)
+}
+
+// NewBatch creates a batch of writes for the cache
+func (c *BoundedCache) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		return store.Apply(c, writes)
+	})
+}
+
+// Snapshot writes all the elements of the cache to the writer
+func (c *BoundedCache) Snapshot(w io.Writer) error {
+	return store.WriteSnapshot(w, store.NewCursor(c.elements()))
+}
+
+// Restore adds the elements of the snapshot in the reader to the cache
+// the elements are evicted as usual, if they exceed the capacity.
+func (c *BoundedCache) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(c, r)
+}
+
+// elements returns all the elements of the cache
+func (c *BoundedCache) elements() []store.Element {
+	elements := make([]store.Element, 0, len(c.storage))
+	for k, v := range c.storage {
+		elements = append(elements, store.NewElement(store.Key(k), v.value))
+	}
+	return elements
+}
+
+// Close will run any maintenance operations for the store
+func (c *BoundedCache) Close() error {
+	return nil
+}
+
+// Metadata returns internal statistics about the storage
+// along with the hits and misses of the reads, and the number of evicted elements
+func (c *BoundedCache) Metadata() store.Metadata {
+	return store.Metadata{
+		Size:        uint64(len(c.storage)),
+		KeysBytes:   uint64(c.keys),
+		ValuesBytes: uint64(c.values),
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Errors:      make([]error, 0),
+	}
+}
@@ -0,0 +1,86 @@
+package mem
+
+import (
+	"io"
+	"sync"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// SyncBoundedCache is an in memory storage with a limited capacity
+// this implementation is thread-safe.
+// It uses a single mutex, as the reads update the state of the eviction policy as well.
+type SyncBoundedCache struct {
+	cache *BoundedCache
+	sync.Mutex
+}
+
+// NewSyncBoundedCache creates a new thread-safe bounded cache
+func NewSyncBoundedCache(capacity Capacity, policy Policy) *SyncBoundedCache {
+	return &SyncBoundedCache{cache: NewBoundedCache(capacity, policy)}
+}
+
+// SyncBoundedCacheFactory generates a SyncBoundedCache storage implementation
+func SyncBoundedCacheFactory(capacity Capacity, policy Policy) store.StorageFactory {
+	return func() store.Storage {
+		return NewSyncBoundedCache(capacity, policy)
+	}
+}
+
+// Put adds an element to the cache
+func (sc *SyncBoundedCache) Put(element store.Element) error {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Put(element)
+}
+
+// Get retrieves an element from the cache
+func (sc *SyncBoundedCache) Get(key store.Key) (store.Element, error) {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Get(key)
+}
+
+// Delete removes the element for the given key from the cache
+func (sc *SyncBoundedCache) Delete(key store.Key) error {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Delete(key)
+}
+
+// NewBatch creates a batch of writes for the cache
+// the batch is applied while holding the lock, so readers see either all or none of its writes
+func (sc *SyncBoundedCache) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		sc.Lock()
+		defer sc.Unlock()
+		return store.Apply(sc.cache, writes)
+	})
+}
+
+// Snapshot writes all the elements of the cache to the writer
+// the elements are collected while holding the lock, so that the snapshot is consistent
+func (sc *SyncBoundedCache) Snapshot(w io.Writer) error {
+	sc.Lock()
+	elements := sc.cache.elements()
+	sc.Unlock()
+	return store.WriteSnapshot(w, store.NewCursor(elements))
+}
+
+// Restore adds the elements of the snapshot in the reader to the cache
+func (sc *SyncBoundedCache) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(sc, r)
+}
+
+// Close will run any maintenance operations
+func (sc *SyncBoundedCache) Close() error {
+	return nil
+}
+
+// Metadata returns internal statistics about the storage
+// along with the hits and misses of the reads, and the number of evicted elements
+func (sc *SyncBoundedCache) Metadata() store.Metadata {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Metadata()
+}
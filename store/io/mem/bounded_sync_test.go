@@ -0,0 +1,23 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store/test"
+)
+
+func TestSyncBoundedCache_KeyValueImplementation(t *testing.T) {
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			new(test.ConsistencyWithMeta).Run(t, SyncBoundedCacheFactory(Entries(10000), policy))
+		})
+	}
+}
+
+func TestSyncBoundedCache_SyncImplementation(t *testing.T) {
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			new(test.Concurrency).Run(t, SyncBoundedCacheFactory(Bytes(1<<20), policy))
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package mem
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var policies = []Policy{LRU, LFU, TinyLFU}
+
+func TestBoundedCache_KeyValueImplementation(t *testing.T) {
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			new(test.ConsistencyWithMeta).Run(t, BoundedCacheFactory(Entries(10000), policy))
+		})
+	}
+}
+
+func TestBoundedCache_Capacity(t *testing.T) {
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+
+			cache := NewBoundedCache(Entries(10), policy)
+			for _, element := range test.Elements(100, test.Random(10, 20)) {
+				err := cache.Put(element)
+				assert.NoError(t, err)
+			}
+			metadata := cache.Metadata()
+			assert.Equal(t, uint64(10), metadata.Size)
+			assert.Equal(t, uint64(90), metadata.Evictions)
+			assert.Equal(t, uint64(10*10), metadata.KeysBytes)
+			assert.Equal(t, uint64(10*20), metadata.ValuesBytes)
+
+			// the capacity in bytes covers keys and values
+			cache = NewBoundedCache(Bytes(300), policy)
+			for _, element := range test.Elements(100, test.Random(10, 20)) {
+				err := cache.Put(element)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, uint64(10), cache.Metadata().Size)
+
+			// overwrites with bigger values make room for themselves
+			element := test.Random(10, 20).ElementFactory()
+			err := cache.Put(element)
+			assert.NoError(t, err)
+			element.Value = test.RandomBytes(50)
+			err = cache.Put(element)
+			assert.NoError(t, err)
+			test.IntermediateReadOperation(t, cache, element.Key, element.Value)
+			metadata = cache.Metadata()
+			assert.Equal(t, uint64(9), metadata.Size)
+			assert.LessOrEqual(t, metadata.KeysBytes+metadata.ValuesBytes, uint64(300))
+
+			err = cache.Put(test.Random(10, 300).ElementFactory())
+			assert.ErrorIs(t, err, store.ErrValueTooLarge)
+
+		})
+	}
+
+}
+
+func TestBoundedCache_Stats(t *testing.T) {
+
+	cache := NewBoundedCache(Entries(10), LRU)
+	element := test.Random(10, 20).ElementFactory()
+	err := cache.Put(element)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = cache.Get(element.Key)
+		assert.NoError(t, err)
+	}
+	_, err = cache.Get(test.RandomBytes(10))
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	metadata := cache.Metadata()
+	assert.Equal(t, uint64(3), metadata.Hits)
+	assert.Equal(t, uint64(1), metadata.Misses)
+	assert.Equal(t, uint64(0), metadata.Evictions)
+
+}
+
+func TestBoundedCache_LRU(t *testing.T) {
+
+	cache := NewBoundedCache(Entries(3), LRU)
+	put(t, cache, "1", "2", "3")
+	get(t, cache, "1")
+	put(t, cache, "4")
+
+	assertKeys(t, cache, []string{"1", "3", "4"}, []string{"2"})
+
+}
+
+func TestBoundedCache_LFU(t *testing.T) {
+
+	cache := NewBoundedCache(Entries(3), LFU)
+	put(t, cache, "1", "2", "3")
+	get(t, cache, "1", "1", "2")
+	put(t, cache, "4")
+	// the new element is the least frequently used one now
+	put(t, cache, "5")
+
+	assertKeys(t, cache, []string{"1", "2", "5"}, []string{"3", "4"})
+
+}
+
+func TestBoundedCache_ScanResistance(t *testing.T) {
+
+	hot := make([]string, 50)
+	for i := range hot {
+		hot[i] = fmt.Sprintf("hot-%d", i)
+	}
+	cold := make([]string, 1000)
+	for i := range cold {
+		cold[i] = fmt.Sprintf("cold-%d", i)
+	}
+
+	hits := make(map[Policy]int)
+	for _, policy := range policies {
+		cache := NewBoundedCache(Entries(100), policy)
+		put(t, cache, hot...)
+		for i := 0; i < 10; i++ {
+			get(t, cache, hot...)
+		}
+		// a scan over keys that are accessed only once
+		put(t, cache, cold...)
+		for _, key := range hot {
+			if _, err := cache.Get(store.Key(key)); err == nil {
+				hits[policy]++
+			}
+		}
+	}
+
+	// the scan flushes the recently used elements, but not the frequently used ones
+	assert.Equal(t, 0, hits[LRU])
+	assert.Equal(t, len(hot), hits[LFU])
+	assert.Equal(t, len(hot), hits[TinyLFU])
+
+}
+
+func put(t *testing.T, storage store.Storage, keys ...string) {
+	for _, key := range keys {
+		err := storage.Put(store.NewElement(store.Key(key), store.Value(key)))
+		assert.NoError(t, err)
+	}
+}
+
+func get(t *testing.T, storage store.Storage, keys ...string) {
+	for _, key := range keys {
+		_, err := storage.Get(store.Key(key))
+		assert.NoError(t, err)
+	}
+}
+
+func assertKeys(t *testing.T, storage store.Storage, present, evicted []string) {
+	for _, key := range present {
+		_, err := storage.Get(store.Key(key))
+		assert.NoError(t, err, "for key %s", key)
+	}
+	for _, key := range evicted {
+		_, err := storage.Get(store.Key(key))
+		assert.ErrorIs(t, err, store.ErrNotFound, "for key %s", key)
+	}
+}
@@ -1,13 +1,15 @@
 package mem
 
 import (
-	"fmt"
+	"io"
+
 	"github.com/drakos74/lachesis/store/store"
 
 	"github.com/drakos74/lachesis/store/store/datastruct/btree"
 )
 
 // Btree is a btree storage implementation
+// it is based on the in-house btree of the datastruct package, and is not thread-safe.
 type Btree struct {
 	*btree.BTree
 }
@@ -28,18 +30,63 @@ func (b *Btree) Get(key store.Key) (store.Element, error) {
 	e := b.BTree.Get(store.NewElement(key, []byte{}))
 	var err error
 	if store.IsNil(e) {
-		err = fmt.Errorf(store.NoValue, key)
+		err = store.NotFound(key)
 	}
 	return e, err
 }
 
+// Delete removes the element for the given key
+func (b *Btree) Delete(key store.Key) error {
+	e := b.BTree.Delete(store.NewElement(key, []byte{}))
+	if store.IsNil(e) {
+		return store.NotFound(key)
+	}
+	return nil
+}
+
+// NewBatch creates a batch of writes for the btree
+func (b *Btree) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		return store.Apply(b, writes)
+	})
+}
+
+// Snapshot writes all the elements of the btree to the writer
+func (b *Btree) Snapshot(w io.Writer) error {
+	elements, err := b.Scan(nil, nil)
+	if err != nil {
+		return err
+	}
+	return store.WriteSnapshot(w, elements)
+}
+
+// Restore adds the elements of the snapshot in the reader to the btree
+func (b *Btree) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(b, r)
+}
+
+// Scan returns the elements with keys in the range [from, to) in key order
+func (b *Btree) Scan(from, to store.Key) (store.Cursor, error) {
+	elements := make([]store.Element, 0)
+	b.BTree.AscendRange(bound(from), bound(to), func(item store.Element) bool {
+		elements = append(elements, item)
+		return true
+	})
+	return store.NewCursor(elements), nil
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+func (b *Btree) Prefix(p store.Key) (store.Cursor, error) {
+	return b.Scan(p, store.PrefixEnd(p))
+}
+
 // Metadata returns the metadata for the given storage
 func (b *Btree) Metadata() store.Metadata {
-	c, ks, vs := b.Stats()
+	stats := b.Stats()
 	return store.Metadata{
-		Size:        c,
-		KeysBytes:   ks,
-		ValuesBytes: vs,
+		Size:        stats.Count,
+		KeysBytes:   stats.KeysBytes,
+		ValuesBytes: stats.ValuesBytes,
 	}
 }
 
@@ -48,3 +95,12 @@ func (b *Btree) Close() error {
 	// nothing to do here
 	return nil
 }
+
+// bound creates the element to be used as a range limit for the given key
+// an empty key corresponds to an unbounded range
+func bound(key store.Key) store.Element {
+	if len(key) == 0 {
+		return store.Nil
+	}
+	return store.NewElement(key, []byte{})
+}
@@ -0,0 +1,97 @@
+package mem
+
+import (
+	"io"
+	"sync"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/datastruct/btree"
+)
+
+// SyncNativeBTree is the thread-safe counterpart of Btree
+// it is based on the in-house btree of the datastruct package, instead of google/btree that SyncBTree uses,
+// so that the two can be compared, either as storage or as the index of a file pad.
+type SyncNativeBTree struct {
+	storage *Btree
+	sync.RWMutex
+}
+
+// NewSyncNativeBTree creates a new thread-safe btree of the given degree
+func NewSyncNativeBTree(degree int) *SyncNativeBTree {
+	return &SyncNativeBTree{storage: &Btree{btree.New(degree)}}
+}
+
+// SyncNativeBTreeFactory generates a SyncNativeBTree storage implementation
+func SyncNativeBTreeFactory() store.Storage {
+	return NewSyncNativeBTree(10)
+}
+
+// Put stores an element in the storage for the given key
+func (s *SyncNativeBTree) Put(element store.Element) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.storage.Put(element)
+}
+
+// Get returns an element based on the given key
+func (s *SyncNativeBTree) Get(key store.Key) (store.Element, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.storage.Get(key)
+}
+
+// Delete removes the element for the given key
+func (s *SyncNativeBTree) Delete(key store.Key) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.storage.Delete(key)
+}
+
+// NewBatch creates a batch of writes for the btree
+// the batch is applied while holding the write lock, so readers see either all or none of its writes
+func (s *SyncNativeBTree) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		s.Lock()
+		defer s.Unlock()
+		return store.Apply(s.storage, writes)
+	})
+}
+
+// Snapshot writes all the elements of the btree to the writer
+// the elements are collected while holding the read lock, so that the snapshot is consistent
+func (s *SyncNativeBTree) Snapshot(w io.Writer) error {
+	elements, err := s.Scan(nil, nil)
+	if err != nil {
+		return err
+	}
+	return store.WriteSnapshot(w, elements)
+}
+
+// Restore adds the elements of the snapshot in the reader to the btree
+func (s *SyncNativeBTree) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(s, r)
+}
+
+// Scan returns the elements with keys in the range [from, to) in key order
+func (s *SyncNativeBTree) Scan(from, to store.Key) (store.Cursor, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.storage.Scan(from, to)
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+func (s *SyncNativeBTree) Prefix(p store.Key) (store.Cursor, error) {
+	return s.Scan(p, store.PrefixEnd(p))
+}
+
+// Metadata returns the metadata of the given storage
+func (s *SyncNativeBTree) Metadata() store.Metadata {
+	s.RLock()
+	defer s.RUnlock()
+	return s.storage.Metadata()
+}
+
+// Close shuts down the storage and performs any needed cleanup operations
+func (s *SyncNativeBTree) Close() error {
+	return nil
+}
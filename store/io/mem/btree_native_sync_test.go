@@ -0,0 +1,67 @@
+package mem
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/test"
+)
+
+func TestSyncNativeBTree_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SyncNativeBTreeFactory)
+}
+
+func TestSyncNativeBTree_SyncImplementation(t *testing.T) {
+	new(test.Concurrency).Run(t, SyncNativeBTreeFactory)
+}
+
+// BenchmarkBTree compares the in-house btree with the one of google/btree
+func BenchmarkBTree(b *testing.B) {
+	factories := map[string]store.StorageFactory{
+		"native": SyncNativeBTreeFactory,
+		"google": SyncBTreeFactory,
+	}
+	for _, name := range []string{"native", "google"} {
+		b.Run(fmt.Sprintf("%s|put", name), func(b *testing.B) {
+			storage := factories[name]()
+			elements := test.Elements(b.N, test.Random(10, 100))
+			b.ResetTimer()
+			for _, element := range elements {
+				if err := storage.Put(element); err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%s|get", name), func(b *testing.B) {
+			storage := factories[name]()
+			elements := test.Elements(b.N, test.Random(10, 100))
+			for _, element := range elements {
+				if err := storage.Put(element); err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			}
+			b.ResetTimer()
+			for _, element := range elements {
+				if _, err := storage.Get(element.Key); err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%s|delete", name), func(b *testing.B) {
+			storage := factories[name]()
+			elements := test.Elements(b.N, test.Random(10, 100))
+			for _, element := range elements {
+				if err := storage.Put(element); err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			}
+			b.ResetTimer()
+			for _, element := range elements {
+				if err := storage.Delete(element.Key); err != nil {
+					b.Fatalf("error : %v", err)
+				}
+			}
+		})
+	}
+}
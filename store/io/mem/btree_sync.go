@@ -1,8 +1,9 @@
 package mem
 
 import (
-	"fmt"
 	"github.com/drakos74/lachesis/store/store"
+	"io"
+	"sync"
 	"sync/atomic"
 
 	"github.com/google/btree"
@@ -11,11 +12,12 @@ import (
 // SyncBTree implements a storage based on a Btree data struct
 type SyncBTree struct {
 	*btree.BTree
+	mutex sync.RWMutex
 }
 
 // SyncBTreeFactory generates a concurrently safe BTree storage implementation
 func SyncBTreeFactory() store.Storage {
-	return &SyncBTree{btree.New(10)}
+	return &SyncBTree{BTree: btree.New(10)}
 }
 
 type item struct {
@@ -29,21 +31,110 @@ func (i item) Less(than btree.Item) bool {
 
 // Put stores an element in the storage for the given key
 func (s *SyncBTree) Put(element store.Element) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.put(element)
+}
+
+// put stores an element without acquiring the lock
+func (s *SyncBTree) put(element store.Element) error {
 	s.BTree.ReplaceOrInsert(item{element})
 	return nil
 }
 
 // Get returns an element based on the given key
 func (s *SyncBTree) Get(key store.Key) (store.Element, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	e := s.BTree.Get(item{store.NewElement(key, []byte{})})
 	if e == nil {
-		return store.Nil, fmt.Errorf(store.NoValue, key)
+		return store.Nil, store.NotFound(key)
 	}
 	return e.(item).Element, nil
 }
 
+// Delete removes the element for the given key
+func (s *SyncBTree) Delete(key store.Key) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.delete(key)
+}
+
+// delete removes the element for the given key without acquiring the lock
+func (s *SyncBTree) delete(key store.Key) error {
+	e := s.BTree.Delete(item{store.NewElement(key, []byte{})})
+	if e == nil {
+		return store.NotFound(key)
+	}
+	return nil
+}
+
+// NewBatch creates a batch of writes for the btree
+// the batch is applied while holding the write lock, so readers see either all or none of its writes
+func (s *SyncBTree) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for _, w := range writes {
+			if w.Delete {
+				_ = s.delete(w.Key)
+				continue
+			}
+			err := s.put(w.Element)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot writes all the elements of the btree to the writer
+// the elements are collected while holding the read lock, so that the snapshot is consistent
+func (s *SyncBTree) Snapshot(w io.Writer) error {
+	elements, err := s.Scan(nil, nil)
+	if err != nil {
+		return err
+	}
+	return store.WriteSnapshot(w, elements)
+}
+
+// Restore adds the elements of the snapshot in the reader to the btree
+func (s *SyncBTree) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(s, r)
+}
+
+// Scan returns the elements with keys in the range [from, to) in key order
+func (s *SyncBTree) Scan(from, to store.Key) (store.Cursor, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	elements := make([]store.Element, 0)
+	iterator := func(i btree.Item) bool {
+		elements = append(elements, i.(item).Element)
+		return true
+	}
+	switch {
+	case len(from) == 0 && len(to) == 0:
+		s.BTree.Ascend(iterator)
+	case len(from) == 0:
+		s.BTree.AscendLessThan(item{store.NewElement(to, []byte{})}, iterator)
+	case len(to) == 0:
+		s.BTree.AscendGreaterOrEqual(item{store.NewElement(from, []byte{})}, iterator)
+	default:
+		s.BTree.AscendRange(item{store.NewElement(from, []byte{})}, item{store.NewElement(to, []byte{})}, iterator)
+	}
+	return store.NewCursor(elements), nil
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+func (s *SyncBTree) Prefix(p store.Key) (store.Cursor, error) {
+	return s.Scan(p, store.PrefixEnd(p))
+}
+
 // Metadata returns the metadata of the given storage
 func (s *SyncBTree) Metadata() store.Metadata {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	var count uint64
 	var keySize uint64
 	var valueSize uint64
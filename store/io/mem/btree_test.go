@@ -0,0 +1,11 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store/test"
+)
+
+func TestBTree_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, BTreeFactory)
+}
@@ -1,19 +1,28 @@
 package mem
 
 import (
-	"fmt"
+	"io"
+	"time"
+
 	"github.com/drakos74/lachesis/store/store"
 )
 
 // Cache is an in memory struct implementing the storage interface
 // it s the most efficient one in terms of performance and is used for a baseline regarding tests
+// The elements put with a ttl expire lazily, when they are read, or when Sweep is called.
+// There is no background sweeper, as the cache is not thread-safe; SyncCache.WithSweeper provides one.
 type Cache struct {
 	storage map[string]store.Value
+	// expiries holds the expiry time of the elements that were put with a ttl
+	expiries map[string]time.Time
 }
 
 // NewCache creates a new Cache instance
 func NewCache() *Cache {
-	return &Cache{storage: make(map[string]store.Value)}
+	return &Cache{
+		storage:  make(map[string]store.Value),
+		expiries: make(map[string]time.Time),
+	}
 }
 
 // CacheFactory generates a Cache storage implementation
@@ -24,16 +33,96 @@ func CacheFactory() store.Storage {
 // Put adds an element to the cache
 func (c *Cache) Put(element store.Element) error {
 	c.storage[string(element.Key)] = element.Value
+	delete(c.expiries, string(element.Key))
+	return nil
+}
+
+// PutWithTTL adds an element to the cache, that expires after the given duration
+func (c *Cache) PutWithTTL(element store.Element, ttl time.Duration) error {
+	c.storage[string(element.Key)] = element.Value
+	c.expiries[string(element.Key)] = time.Now().Add(ttl)
 	return nil
 }
 
 // Get retrieves and element from the cache
+// an expired element is removed from the cache, and reported as not found
 func (c *Cache) Get(key store.Key) (store.Element, error) {
+	if c.expired(key, time.Now()) {
+		c.remove(key)
+		return store.Nil, store.NotFound(key)
+	}
 	if result, ok := c.storage[string(key)]; ok {
 		element := store.NewElement(key, result)
 		return element, nil
 	}
-	return store.Nil, fmt.Errorf(store.NoValue, key)
+	return store.Nil, store.NotFound(key)
+}
+
+// Delete removes the element for the given key from the cache
+func (c *Cache) Delete(key store.Key) error {
+	if _, ok := c.storage[string(key)]; !ok || c.expired(key, time.Now()) {
+		c.remove(key)
+		return store.NotFound(key)
+	}
+	c.remove(key)
+	return nil
+}
+
+// Sweep removes all the expired elements from the cache
+// it returns the number of the removed elements.
+func (c *Cache) Sweep() int {
+	now := time.Now()
+	count := 0
+	for k, expiry := range c.expiries {
+		if store.Expired(expiry, now) {
+			c.remove(store.Key(k))
+			count++
+		}
+	}
+	return count
+}
+
+// expired checks if the element for the key has expired at the given time
+func (c *Cache) expired(key store.Key, now time.Time) bool {
+	expiry, ok := c.expiries[string(key)]
+	return ok && store.Expired(expiry, now)
+}
+
+// remove drops the element for the key along with its expiry
+func (c *Cache) remove(key store.Key) {
+	delete(c.storage, string(key))
+	delete(c.expiries, string(key))
+}
+
+// NewBatch creates a batch of writes for the cache
+func (c *Cache) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		return store.Apply(c, writes)
+	})
+}
+
+// Snapshot writes all the elements of the cache to the writer
+// the snapshot format does not carry the expiry, so the elements that have not expired yet are restored without one.
+func (c *Cache) Snapshot(w io.Writer) error {
+	return store.WriteSnapshot(w, store.NewCursor(c.elements()))
+}
+
+// Restore adds the elements of the snapshot in the reader to the cache
+func (c *Cache) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(c, r)
+}
+
+// elements returns all the elements of the cache, that have not expired
+func (c *Cache) elements() []store.Element {
+	now := time.Now()
+	elements := make([]store.Element, 0, len(c.storage))
+	for k, v := range c.storage {
+		if c.expired(store.Key(k), now) {
+			continue
+		}
+		elements = append(elements, store.NewElement(store.Key(k), v))
+	}
+	return elements
 }
 
 // Close will run any maintenance operations for the store
@@ -43,15 +132,22 @@ func (c *Cache) Close() error {
 
 // Metadata returns internal statistics about the storage
 // It s not meant to serve anny functionality, but used only for testing
+// The expired elements are left out, even if they have not been swept yet.
 func (c *Cache) Metadata() store.Metadata {
+	now := time.Now()
+	var size uint64
 	var keyBytes uint64
 	var valueBytes uint64
 	for k, v := range c.storage {
+		if c.expired(store.Key(k), now) {
+			continue
+		}
+		size++
 		keyBytes += uint64(len(k))
 		valueBytes += uint64(len(v))
 	}
 	return store.Metadata{
-		Size:        uint64(len(c.storage)),
+		Size:        size,
 		KeysBytes:   keyBytes,
 		ValuesBytes: valueBytes,
 		Errors:      make([]error, 0),
@@ -1,20 +1,26 @@
 package mem
 
 import (
-	"fmt"
-	"github.com/drakos74/lachesis/store/store"
+	"io"
 	"sync"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
 )
 
 // SyncCache is an in memory struct implementing the storage interface
 // this implementation is thread-safe
 type SyncCache struct {
-	storage sync.Map
+	cache *Cache
+	sync.RWMutex
+	// stop signals the sweeper to exit
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
 // NewSyncCache creates a new Cache instance
 func NewSyncCache() *SyncCache {
-	return &SyncCache{}
+	return &SyncCache{cache: NewCache()}
 }
 
 // SyncCacheFactory generates a SyncCache storage implementation
@@ -24,35 +30,122 @@ func SyncCacheFactory() store.Storage {
 
 // Put adds an element to the cache
 func (sc *SyncCache) Put(element store.Element) error {
-	sc.storage.Store(string(element.Key), element.Value)
-	return nil
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Put(element)
+}
+
+// PutWithTTL adds an element to the cache, that expires after the given duration
+func (sc *SyncCache) PutWithTTL(element store.Element, ttl time.Duration) error {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.PutWithTTL(element, ttl)
 }
 
 // Get retrieves and element from the cache
+// the read lock is upgraded to a write lock only for removing an expired element
 func (sc *SyncCache) Get(key store.Key) (store.Element, error) {
-	if result, ok := sc.storage.Load(string(key)); ok {
-		return store.NewElement(key, result.(store.Value)), nil
+	now := time.Now()
+	sc.RLock()
+	if !sc.cache.expired(key, now) {
+		defer sc.RUnlock()
+		if result, ok := sc.cache.storage[string(key)]; ok {
+			return store.NewElement(key, result), nil
+		}
+		return store.Nil, store.NotFound(key)
 	}
-	return store.Element{}, fmt.Errorf(store.NoValue, key)
+	sc.RUnlock()
+	sc.Lock()
+	defer sc.Unlock()
+	// the element might have been put again in the meantime
+	if sc.cache.expired(key, now) {
+		sc.cache.remove(key)
+	}
+	return store.Nil, store.NotFound(key)
+}
+
+// Delete removes the element for the given key from the cache
+func (sc *SyncCache) Delete(key store.Key) error {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Delete(key)
+}
+
+// NewBatch creates a batch of writes for the cache
+// the batch is applied while holding the write lock, so readers see either all or none of its writes
+func (sc *SyncCache) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		sc.Lock()
+		defer sc.Unlock()
+		return store.Apply(sc.cache, writes)
+	})
 }
 
-// Close will run any maintenance operations
+// Snapshot writes all the elements of the cache to the writer
+// the elements are collected while holding the read lock, so that the snapshot is consistent
+func (sc *SyncCache) Snapshot(w io.Writer) error {
+	sc.RLock()
+	elements := sc.cache.elements()
+	sc.RUnlock()
+	return store.WriteSnapshot(w, store.NewCursor(elements))
+}
+
+// Restore adds the elements of the snapshot in the reader to the cache
+func (sc *SyncCache) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(sc, r)
+}
+
+// Sweep removes all the expired elements from the cache while using a write lock
+func (sc *SyncCache) Sweep() int {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.cache.Sweep()
+}
+
+// WithSweeper starts a background routine that removes the expired elements at the given interval
+// the routine is stopped when the cache is closed.
+func (sc *SyncCache) WithSweeper(interval time.Duration) *SyncCache {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.stop != nil {
+		return sc
+	}
+	stop := make(chan struct{})
+	sc.stop = stop
+	sc.wg.Add(1)
+	go func() {
+		defer sc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sc.Sweep()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return sc
+}
+
+// Close stops the sweeper, if any
 func (sc *SyncCache) Close() error {
+	sc.Lock()
+	stop := sc.stop
+	sc.stop = nil
+	sc.Unlock()
+	if stop != nil {
+		close(stop)
+		sc.wg.Wait()
+	}
 	return nil
 }
 
 // Metadata returns internal statistics about the storage
 // It s not meant to serve anny functionality, but used only for testing
 func (sc *SyncCache) Metadata() store.Metadata {
-	meta := store.NewMetadata()
-	sc.storage.Range(func(key, value interface{}) bool {
-		meta.Merge(store.Metadata{
-			Size:        1,
-			KeysBytes:   uint64(len([]byte(key.(string)))),
-			ValuesBytes: uint64(len(value.(store.Value))),
-			Errors:      nil,
-		})
-		return true
-	})
-	return meta
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.cache.Metadata()
 }
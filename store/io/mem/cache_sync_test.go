@@ -0,0 +1,41 @@
+package mem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCache_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, SyncCacheFactory)
+}
+
+func TestSyncCache_SyncImplementation(t *testing.T) {
+	new(test.Concurrency).Run(t, SyncCacheFactory)
+}
+
+func TestSyncCache_Sweeper(t *testing.T) {
+
+	cache := NewSyncCache().WithSweeper(10 * time.Millisecond)
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for i, element := range elements {
+		ttl := time.Hour
+		if i%2 == 0 {
+			ttl = 10 * time.Millisecond
+		}
+		err := cache.PutWithTTL(element, ttl)
+		assert.NoError(t, err)
+	}
+
+	// the expired elements are removed without being read
+	assert.Eventually(t, func() bool {
+		return cache.Metadata().Size == uint64(len(elements)/2)
+	}, time.Second, 10*time.Millisecond)
+
+	err := cache.Close()
+	assert.NoError(t, err)
+
+}
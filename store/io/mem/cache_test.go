@@ -0,0 +1,48 @@
+package mem
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, CacheFactory)
+}
+
+func TestCache_Sweep(t *testing.T) {
+
+	cache := NewCache()
+
+	elements := test.Elements(10, test.Random(10, 20))
+	for i, element := range elements {
+		ttl := time.Hour
+		if i%2 == 0 {
+			ttl = 10 * time.Millisecond
+		}
+		err := cache.PutWithTTL(element, ttl)
+		assert.NoError(t, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the expired elements are not part of a snapshot
+	snapshot := new(bytes.Buffer)
+	err := cache.Snapshot(snapshot)
+	assert.NoError(t, err)
+	restored, err := store.ReadSnapshot(snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, len(elements)/2, len(restored))
+
+	// nor are they counted in the metadata, before they are swept
+	assert.Equal(t, uint64(len(elements)/2), cache.Metadata().Size)
+
+	assert.Equal(t, len(elements)/2, cache.Sweep())
+	assert.Equal(t, uint64(len(elements)/2), cache.Metadata().Size)
+	assert.Equal(t, 0, cache.Sweep())
+
+}
@@ -0,0 +1,303 @@
+package mem
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// Policy selects the elements that a bounded cache evicts, when it runs out of capacity
+type Policy int
+
+const (
+	// LRU evicts the least recently used element
+	LRU Policy = iota
+	// LFU evicts the least frequently used element
+	LFU
+	// TinyLFU evicts according to the W-TinyLFU policy
+	// new elements enter a small LRU window, and move to the main LRU segments
+	// only if their estimated access frequency is higher than the one of the element they would evict.
+	TinyLFU
+)
+
+// String returns the name of the policy
+func (p Policy) String() string {
+	switch p {
+	case LRU:
+		return "LRU"
+	case LFU:
+		return "LFU"
+	case TinyLFU:
+		return "TinyLFU"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// evictor keeps track of the accesses to the keys of a bounded cache, and selects the ones to evict
+type evictor interface {
+	// add registers a new key with the given cost
+	add(key string, cost int)
+	// update registers a write with the given cost to a key that is already there
+	update(key string, cost int)
+	// access registers a read of the key, whether it is in the cache or not
+	access(key string)
+	// remove drops the key
+	remove(key string)
+	// victim returns the key to evict next
+	victim() string
+}
+
+// newEvictor creates the evictor for the policy, for a cache with the given capacity
+func newEvictor(policy Policy, capacity Capacity) evictor {
+	switch policy {
+	case LFU:
+		return newLFU()
+	case TinyLFU:
+		return newWTinyLFU(capacity)
+	default:
+		return newLRU()
+	}
+}
+
+// lru keeps the keys in the order of their last access
+type lru struct {
+	order *list.List
+	nodes map[string]*list.Element
+}
+
+func newLRU() *lru {
+	return &lru{
+		order: list.New(),
+		nodes: make(map[string]*list.Element),
+	}
+}
+
+func (p *lru) add(key string, cost int) {
+	p.nodes[key] = p.order.PushFront(key)
+}
+
+func (p *lru) update(key string, cost int) {
+	p.access(key)
+}
+
+func (p *lru) access(key string) {
+	if node, ok := p.nodes[key]; ok {
+		p.order.MoveToFront(node)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if node, ok := p.nodes[key]; ok {
+		p.order.Remove(node)
+		delete(p.nodes, key)
+	}
+}
+
+func (p *lru) victim() string {
+	return p.order.Back().Value.(string)
+}
+
+// lfu keeps the keys in buckets of the same access count
+// within a bucket, the least recently used key is evicted first.
+type lfu struct {
+	buckets map[int]*list.List
+	nodes   map[string]*list.Element
+	counts  map[string]int
+	// min is a lower bound for the access count of the keys
+	min int
+}
+
+func newLFU() *lfu {
+	return &lfu{
+		buckets: make(map[int]*list.List),
+		nodes:   make(map[string]*list.Element),
+		counts:  make(map[string]int),
+	}
+}
+
+func (p *lfu) add(key string, cost int) {
+	p.push(key, 1)
+	p.min = 1
+}
+
+func (p *lfu) update(key string, cost int) {
+	p.access(key)
+}
+
+func (p *lfu) access(key string) {
+	count, ok := p.counts[key]
+	if !ok {
+		return
+	}
+	p.remove(key)
+	p.push(key, count+1)
+}
+
+func (p *lfu) remove(key string) {
+	count, ok := p.counts[key]
+	if !ok {
+		return
+	}
+	bucket := p.buckets[count]
+	bucket.Remove(p.nodes[key])
+	if bucket.Len() == 0 {
+		delete(p.buckets, count)
+	}
+	delete(p.nodes, key)
+	delete(p.counts, key)
+}
+
+func (p *lfu) victim() string {
+	for {
+		if bucket, ok := p.buckets[p.min]; ok {
+			return bucket.Back().Value.(string)
+		}
+		p.min++
+	}
+}
+
+func (p *lfu) push(key string, count int) {
+	bucket, ok := p.buckets[count]
+	if !ok {
+		bucket = list.New()
+		p.buckets[count] = bucket
+	}
+	p.nodes[key] = bucket.PushFront(key)
+	p.counts[key] = count
+}
+
+const (
+	window = iota
+	probation
+	protected
+)
+
+// segment is an LRU list of keys, along with their total cost
+type segment struct {
+	order *list.List
+	cost  int
+}
+
+// node is an entry of a W-TinyLFU segment
+type node struct {
+	key     string
+	cost    int
+	segment int
+}
+
+// wTinyLFU implements the W-TinyLFU policy
+// it consists of a window LRU for the new keys, taking 1% of the capacity,
+// and a main segmented LRU with a probation and a protected segment, taking 20% and 80% of the rest.
+// A key is promoted from probation to protected on its next access.
+type wTinyLFU struct {
+	segments [3]segment
+	nodes    map[string]*list.Element
+	sketch   *sketch
+	// windowLimit and protectedLimit are the maximum costs of the window and the protected segment
+	windowLimit    int
+	protectedLimit int
+}
+
+func newWTinyLFU(capacity Capacity) *wTinyLFU {
+	keys := capacity.limit
+	if capacity.bytes {
+		// assume elements of a few dozen bytes
+		keys /= 32
+	}
+	p := &wTinyLFU{
+		nodes: make(map[string]*list.Element),
+		// a sketch with ten times the counters of the keys keeps the collisions low
+		sketch:         newSketch(10 * keys),
+		windowLimit:    capacity.limit / 100,
+		protectedLimit: (capacity.limit - capacity.limit/100) * 8 / 10,
+	}
+	for i := range p.segments {
+		p.segments[i].order = list.New()
+	}
+	return p
+}
+
+func (p *wTinyLFU) add(key string, cost int) {
+	p.sketch.increment(key)
+	p.push(key, cost, window)
+	// the keys overflowing the window move to the main segments, where they compete for staying in the cache
+	for p.segments[window].cost > p.windowLimit && p.segments[window].order.Len() > 1 {
+		n := p.segments[window].order.Back().Value.(*node)
+		p.move(n.key, probation)
+	}
+}
+
+func (p *wTinyLFU) update(key string, cost int) {
+	element, ok := p.nodes[key]
+	if !ok {
+		return
+	}
+	n := element.Value.(*node)
+	p.segments[n.segment].cost += cost - n.cost
+	n.cost = cost
+	p.access(key)
+}
+
+func (p *wTinyLFU) access(key string) {
+	p.sketch.increment(key)
+	element, ok := p.nodes[key]
+	if !ok {
+		return
+	}
+	n := element.Value.(*node)
+	switch n.segment {
+	case probation:
+		p.move(key, protected)
+		// the keys overflowing the protected segment get another chance in probation
+		for p.segments[protected].cost > p.protectedLimit && p.segments[protected].order.Len() > 1 {
+			demoted := p.segments[protected].order.Back().Value.(*node)
+			p.move(demoted.key, probation)
+		}
+	default:
+		p.segments[n.segment].order.MoveToFront(element)
+	}
+}
+
+func (p *wTinyLFU) remove(key string) {
+	element, ok := p.nodes[key]
+	if !ok {
+		return
+	}
+	n := element.Value.(*node)
+	p.segments[n.segment].order.Remove(element)
+	p.segments[n.segment].cost -= n.cost
+	delete(p.nodes, key)
+}
+
+// victim picks between the candidate that most recently entered probation from the window,
+// and the least recently used key of the main segments, the one with the lower estimated frequency.
+func (p *wTinyLFU) victim() string {
+	main := p.segments[probation].order
+	if main.Len() == 0 {
+		main = p.segments[protected].order
+	}
+	if main.Len() == 0 {
+		return p.segments[window].order.Back().Value.(*node).key
+	}
+	victim := main.Back().Value.(*node).key
+	if p.segments[probation].order.Len() < 2 {
+		return victim
+	}
+	candidate := p.segments[probation].order.Front().Value.(*node).key
+	if p.sketch.estimate(candidate) > p.sketch.estimate(victim) {
+		return victim
+	}
+	return candidate
+}
+
+// push adds the key to the front of the given segment
+func (p *wTinyLFU) push(key string, cost, s int) {
+	p.nodes[key] = p.segments[s].order.PushFront(&node{key: key, cost: cost, segment: s})
+	p.segments[s].cost += cost
+}
+
+// move moves the key to the front of the given segment
+func (p *wTinyLFU) move(key string, s int) {
+	n := p.nodes[key].Value.(*node)
+	p.remove(key)
+	p.push(key, n.cost, s)
+}
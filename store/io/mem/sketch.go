@@ -0,0 +1,143 @@
+package mem
+
+import (
+	"hash/maphash"
+)
+
+const (
+	// sketchDepth is the number of counter rows of the frequency sketch
+	sketchDepth = 4
+	// maxCount is the value, that the 4-bit counters of the sketch saturate at
+	maxCount = 15
+)
+
+// sketch is a count-min sketch, that estimates the access frequency of the keys in little space
+// it follows the TinyLFU design, as implemented by ristretto,
+// with a doorkeeper that absorbs the first access of every key, so that the one-hit wonders do not pollute the counters,
+// and a periodic reset that halves all counters, so that the estimates follow the recent accesses.
+type sketch struct {
+	seed maphash.Seed
+	// rows hold the counters, packed two 4-bit counters per byte
+	rows [sketchDepth][]byte
+	mask uint64
+	// doorkeeper is a bloom filter of the keys accessed since the last reset
+	doorkeeper []uint64
+	// samples is the number of increments since the last reset
+	samples int
+	// resetAt is the number of increments that trigger a reset
+	resetAt int
+}
+
+// newSketch creates a sketch, sized for the given number of keys
+func newSketch(keys int) *sketch {
+	width := 16
+	for width < keys && width < 1<<20 {
+		width <<= 1
+	}
+	s := &sketch{
+		seed:       maphash.MakeSeed(),
+		mask:       uint64(width - 1),
+		doorkeeper: make([]uint64, width/8),
+		resetAt:    10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]byte, width/2)
+	}
+	return s
+}
+
+// increment records an access to the key
+func (s *sketch) increment(key string) {
+	h := s.hash(key)
+	s.samples++
+	if s.samples >= s.resetAt {
+		s.reset()
+	}
+	if !s.admit(h) {
+		return
+	}
+	for i := range s.rows {
+		s.inc(i, s.index(h, i))
+	}
+}
+
+// estimate returns the estimated number of accesses to the key
+func (s *sketch) estimate(key string) int {
+	h := s.hash(key)
+	min := maxCount
+	for i := range s.rows {
+		if c := s.count(i, s.index(h, i)); c < min {
+			min = c
+		}
+	}
+	if s.contains(h) {
+		min++
+	}
+	return min
+}
+
+// reset halves all counters and clears the doorkeeper
+func (s *sketch) reset() {
+	s.samples = 0
+	for _, row := range s.rows {
+		for j := range row {
+			// halve both 4-bit counters of the byte at once
+			row[j] = (row[j] >> 1) & 0x77
+		}
+	}
+	for i := range s.doorkeeper {
+		s.doorkeeper[i] = 0
+	}
+}
+
+func (s *sketch) hash(key string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	_, _ = h.WriteString(key)
+	return h.Sum64()
+}
+
+// index returns the position of the counter of the hash in the given row
+// the positions are derived from the two halves of the hash, with double hashing.
+func (s *sketch) index(h uint64, row int) uint64 {
+	return ((h & 0xffffffff) + uint64(row)*(h>>32)) & s.mask
+}
+
+func (s *sketch) count(row int, i uint64) int {
+	return int(s.rows[row][i/2]>>((i&1)*4)) & 0x0f
+}
+
+func (s *sketch) inc(row int, i uint64) {
+	shift := (i & 1) * 4
+	if (s.rows[row][i/2]>>shift)&0x0f < maxCount {
+		s.rows[row][i/2] += 1 << shift
+	}
+}
+
+// admit adds the hash to the doorkeeper
+// it returns true, if the hash was already there.
+func (s *sketch) admit(h uint64) bool {
+	if s.contains(h) {
+		return true
+	}
+	for _, bit := range s.bits(h) {
+		s.doorkeeper[bit/64] |= 1 << (bit % 64)
+	}
+	return false
+}
+
+// contains checks if the hash is in the doorkeeper
+func (s *sketch) contains(h uint64) bool {
+	for _, bit := range s.bits(h) {
+		if s.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bits returns the positions of the hash in the doorkeeper
+func (s *sketch) bits(h uint64) [2]uint64 {
+	size := uint64(len(s.doorkeeper) * 64)
+	return [2]uint64{h % size, (h >> 32) % size}
+}
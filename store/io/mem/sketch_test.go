@@ -0,0 +1,52 @@
+package mem
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch_Estimate(t *testing.T) {
+
+	s := newSketch(100)
+
+	for i := 0; i < 10; i++ {
+		s.increment("hot")
+	}
+	s.increment("once")
+
+	assert.Equal(t, 10, s.estimate("hot"))
+	// the first access is only recorded in the doorkeeper
+	assert.Equal(t, 1, s.estimate("once"))
+	assert.Equal(t, 0, s.estimate("never"))
+
+	// the counters saturate
+	for i := 0; i < 2*maxCount; i++ {
+		s.increment("hot")
+	}
+	assert.Equal(t, maxCount+1, s.estimate("hot"))
+
+}
+
+func TestSketch_Reset(t *testing.T) {
+
+	s := newSketch(16)
+	for i := 0; i < 9; i++ {
+		s.increment("hot")
+	}
+	assert.Equal(t, 9, s.estimate("hot"))
+
+	// the counters are halved, and the doorkeeper is cleared
+	s.reset()
+	assert.Equal(t, 4, s.estimate("hot"))
+
+	// enough increments trigger the reset
+	for i := 0; i < s.resetAt-1; i++ {
+		s.increment(fmt.Sprintf("key-%d", i))
+	}
+	assert.Equal(t, s.resetAt-1, s.samples)
+	s.increment("hot")
+	assert.Equal(t, 0, s.samples)
+
+}
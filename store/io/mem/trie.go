@@ -1,7 +1,8 @@
 package mem
 
 import (
-	"fmt"
+	"io"
+
 	"github.com/drakos74/lachesis/store/store"
 
 	"github.com/drakos74/lachesis/store/store/datastruct/trie"
@@ -14,7 +15,7 @@ type Trie struct {
 
 // NewTrie creates a new Cache instance
 func NewTrie() *Trie {
-	return &Trie{storage: trie.NewTrie(byte(' '))}
+	return &Trie{storage: trie.NewTrie()}
 }
 
 // TrieFactory generates a Trie storage implementation
@@ -32,7 +33,42 @@ func (t *Trie) Get(key store.Key) (store.Element, error) {
 	if data, ok := t.storage.Read(key); ok {
 		return store.NewElement(key, data), nil
 	}
-	return store.Nil, fmt.Errorf(store.NoValue, key)
+	return store.Nil, store.NotFound(key)
+}
+
+// Delete removes the element for the given key from the trie
+func (t *Trie) Delete(key store.Key) error {
+	if ok := t.storage.Remove(key); !ok {
+		return store.NotFound(key)
+	}
+	return nil
+}
+
+// NewBatch creates a batch of writes for the trie
+func (t *Trie) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		return store.Apply(t, writes)
+	})
+}
+
+// Snapshot writes all the elements of the trie to the writer
+func (t *Trie) Snapshot(w io.Writer) error {
+	return store.WriteSnapshot(w, store.NewCursor(walk(t.storage, nil, nil)))
+}
+
+// Restore adds the elements of the snapshot in the reader to the trie
+func (t *Trie) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(t, r)
+}
+
+// Scan returns the elements with keys in the range [from, to) in key order
+func (t *Trie) Scan(from, to store.Key) (store.Cursor, error) {
+	return store.NewCursor(walk(t.storage, from, to)), nil
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+func (t *Trie) Prefix(p store.Key) (store.Cursor, error) {
+	return store.NewCursor(prefix(t.storage, p)), nil
 }
 
 // Close will run any maintenance operations
@@ -45,3 +81,23 @@ func (t *Trie) Close() error {
 func (t *Trie) Metadata() store.Metadata {
 	return trie.Metadata(t.storage)
 }
+
+// walk collects in key order the elements of the trie within the range [from, to)
+func walk(storage *trie.Trie, from, to store.Key) []store.Element {
+	elements := make([]store.Element, 0)
+	storage.Walk(from, to, func(key []byte, value []byte) bool {
+		elements = append(elements, store.NewElement(key, value))
+		return true
+	})
+	return elements
+}
+
+// prefix collects in key order the elements of the trie with keys starting with the given prefix
+func prefix(storage *trie.Trie, p store.Key) []store.Element {
+	elements := make([]store.Element, 0)
+	storage.Prefix(p, func(key []byte, value []byte) bool {
+		elements = append(elements, store.NewElement(key, value))
+		return true
+	})
+	return elements
+}
@@ -1,8 +1,8 @@
 package mem
 
 import (
-	"fmt"
 	"github.com/drakos74/lachesis/store/store"
+	"io"
 	"sync"
 
 	"github.com/drakos74/lachesis/store/store/datastruct/trie"
@@ -17,7 +17,7 @@ type SyncTrie struct {
 
 // NewSyncTrie creates a new Cache instance
 func NewSyncTrie() *SyncTrie {
-	return &SyncTrie{storage: trie.NewTrie(byte(' '))}
+	return &SyncTrie{storage: trie.NewTrie()}
 }
 
 // SyncTrieFactory generates a SyncTrie storage implementation
@@ -39,7 +39,56 @@ func (st *SyncTrie) Get(key store.Key) (store.Element, error) {
 	if data, ok := st.storage.Read(key); ok {
 		return store.NewElement(key, data), nil
 	}
-	return store.Element{}, fmt.Errorf(store.NoValue, key)
+	return store.Element{}, store.NotFound(key)
+}
+
+// Delete removes the element for the given key from the trie
+func (st *SyncTrie) Delete(key store.Key) error {
+	st.Lock()
+	defer st.Unlock()
+	if ok := st.storage.Remove(key); !ok {
+		return store.NotFound(key)
+	}
+	return nil
+}
+
+// NewBatch creates a batch of writes for the trie
+// the batch is applied while holding the write lock, so readers see either all or none of its writes
+func (st *SyncTrie) NewBatch() store.Batch {
+	return store.NewWriteBatch(func(writes []store.Write) error {
+		st.Lock()
+		defer st.Unlock()
+		trie := &Trie{storage: st.storage}
+		return store.Apply(trie, writes)
+	})
+}
+
+// Snapshot writes all the elements of the trie to the writer
+// the elements are collected while holding the read lock, so that the snapshot is consistent
+func (st *SyncTrie) Snapshot(w io.Writer) error {
+	st.RLock()
+	elements := walk(st.storage, nil, nil)
+	st.RUnlock()
+	return store.WriteSnapshot(w, store.NewCursor(elements))
+}
+
+// Restore adds the elements of the snapshot in the reader to the trie
+func (st *SyncTrie) Restore(r io.Reader) error {
+	return store.RestoreSnapshot(st, r)
+}
+
+// Scan returns the elements with keys in the range [from, to) in key order
+func (st *SyncTrie) Scan(from, to store.Key) (store.Cursor, error) {
+	st.RLock()
+	defer st.RUnlock()
+	return store.NewCursor(walk(st.storage, from, to)), nil
+}
+
+// Prefix returns the elements with keys starting with the given prefix in key order
+func (st *SyncTrie) Prefix(p store.Key) (store.Cursor, error) {
+	st.RLock()
+	defer st.RUnlock()
+	return store.NewCursor(prefix(st.storage, p)), nil
 }
 
 // Close will run any maintainance operations
@@ -50,5 +99,7 @@ func (st *SyncTrie) Close() error {
 // Metadata returns internal statistics about the storage
 // It s not meant to serve anny functionality, but used only for testing
 func (st *SyncTrie) Metadata() store.Metadata {
+	st.RLock()
+	defer st.RUnlock()
 	return trie.Metadata(st.storage)
 }
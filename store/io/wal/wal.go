@@ -0,0 +1,361 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/rs/zerolog/log"
+)
+
+// indexSize is the size of the index stored as the key of every record
+const indexSize = 8
+
+// tmpSuffix is the suffix of the file, that the log is rewritten into while compacting
+const tmpSuffix = ".tmp"
+
+// Entry is a sequenced entry of the log
+type Entry struct {
+	Index uint64
+	Data  []byte
+}
+
+// Log is a write-ahead log, that appends sequenced entries to a file.
+// The entries are stored with the record format of the file pads, so that they carry a checksum,
+// and an entry that was only partially written before a crash is dropped when the log is reopened.
+// A compacted log starts with a tombstone record, that carries the index of the last compacted entry.
+// It is safe for concurrent use.
+type Log struct {
+	mutex sync.RWMutex
+	file  *os.File
+	// first is the index of the first entry in the log, or the next one to be appended if the log is empty
+	first uint64
+	// offsets holds the position of every entry in the file, starting from the first one
+	offsets []int64
+	size    int64
+	closed  bool
+}
+
+// Open opens the log in the given file, creating it if it does not exist.
+// The entries already in the file are scanned, in order to restore the log.
+func Open(name string) (*Log, error) {
+	// a compaction that did not complete leaves its temporary file behind, while the log itself is intact
+	if err := os.Remove(name + tmpSuffix); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not remove stale compaction of log '%s' %w", name, err)
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file for log '%s' %w", name, err)
+	}
+	l := &Log{file: file, first: 1, offsets: make([]int64, 0)}
+	err = l.restore()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("could not restore log '%s' %w", name, err)
+	}
+	log.Debug().
+		Str("filename", name).
+		Uint64("first", l.first).
+		Int("entries", len(l.offsets)).
+		Msg("Open Log")
+	return l, nil
+}
+
+// restore indexes the entries of the file
+// a torn entry at the end of the file is the result of an interrupted write, and is truncated.
+func (l *Log) restore() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return fmt.Errorf("could not read size of log %w", err)
+	}
+	reader := bufio.NewReader(io.NewSectionReader(l.file, 0, math.MaxInt64))
+	for {
+		record, n, err := bytes.ReadRecordWithin(reader, info.Size()-l.size)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.Warn().
+				Str("filename", l.file.Name()).
+				Int64("offset", l.size).
+				Int("size", n).
+				Msg("Truncate torn entry")
+			return l.truncate(l.size)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read entry at '%d' %w", l.size, err)
+		}
+		if len(record.Key) != indexSize {
+			return fmt.Errorf("%w: invalid entry index at '%d'", store.ErrCorrupted, l.size)
+		}
+		index := binary.BigEndian.Uint64(record.Key)
+		if record.Tombstone {
+			if l.size != 0 {
+				return fmt.Errorf("%w: compaction marker at '%d' is not at the start of the log", store.ErrCorrupted, l.size)
+			}
+			l.first = index + 1
+			l.size += int64(n)
+			continue
+		}
+		if len(l.offsets) == 0 {
+			l.first = index
+		} else if next := l.next(); index != next {
+			return fmt.Errorf("%w: entry at '%d' has index %d instead of %d", store.ErrCorrupted, l.size, index, next)
+		}
+		l.offsets = append(l.offsets, l.size)
+		l.size += int64(n)
+	}
+}
+
+// next returns the index for the next entry
+func (l *Log) next() uint64 {
+	return l.first + uint64(len(l.offsets))
+}
+
+// First returns the index of the first entry, or zero if the log is empty
+func (l *Log) First() uint64 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if len(l.offsets) == 0 {
+		return 0
+	}
+	return l.first
+}
+
+// Last returns the index of the last entry, or of the last compacted one if the log is empty,
+// or zero if the log never had any entries
+func (l *Log) Last() uint64 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.next() - 1
+}
+
+// Append adds the data to the end of the log, and returns the index of the new entry
+// the entry is not synced to disk, until Sync is called.
+func (l *Log) Append(data []byte) (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return 0, store.ErrClosed
+	}
+	index := l.next()
+	key := make([]byte, indexSize)
+	binary.BigEndian.PutUint64(key, index)
+	b, err := bytes.EncodeRecord(bytes.Record{Key: key, Value: data})
+	if err != nil {
+		return 0, fmt.Errorf("could not serialize entry '%d' %w", index, err)
+	}
+	n, err := l.file.Write(b)
+	if err == nil && n != len(b) {
+		err = fmt.Errorf("write failed '%d' != %d", n, len(b))
+	}
+	if err != nil {
+		// drop the partial entry
+		if truncErr := l.file.Truncate(l.size); truncErr != nil {
+			log.Error().Err(truncErr).Str("filename", l.file.Name()).Msg("could not truncate log")
+		}
+		return 0, fmt.Errorf("could not write entry '%d' %w", index, err)
+	}
+	l.offsets = append(l.offsets, l.size)
+	l.size += int64(n)
+	return index, nil
+}
+
+// Get returns the entry for the given index
+func (l *Log) Get(index uint64) (Entry, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		return Entry{}, store.ErrClosed
+	}
+	if index < l.first || index >= l.next() {
+		return Entry{}, fmt.Errorf("%w: no entry at index %d", store.ErrNotFound, index)
+	}
+	i := index - l.first
+	end := l.size
+	if int(i) < len(l.offsets)-1 {
+		end = l.offsets[i+1]
+	}
+	b := make([]byte, end-l.offsets[i])
+	_, err := l.file.ReadAt(b, l.offsets[i])
+	if err != nil {
+		return Entry{}, fmt.Errorf("could not read entry '%d' %w", index, err)
+	}
+	record, err := bytes.DecodeRecord(b)
+	if err != nil {
+		return Entry{}, fmt.Errorf("could not decode entry '%d' %w", index, err)
+	}
+	return Entry{Index: index, Data: record.Value}, nil
+}
+
+// Truncate removes all the entries from the given index onwards
+// the next entry to be appended gets the given index.
+func (l *Log) Truncate(index uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return store.ErrClosed
+	}
+	if index < l.first {
+		return fmt.Errorf("%w: cannot truncate log at %d before its first entry %d", store.ErrNotFound, index, l.first)
+	}
+	if index >= l.next() {
+		return nil
+	}
+	i := index - l.first
+	err := l.truncate(l.offsets[i])
+	if err != nil {
+		return err
+	}
+	l.offsets = l.offsets[:i]
+	return nil
+}
+
+// truncate drops the content of the file after the given offset
+func (l *Log) truncate(offset int64) error {
+	err := l.file.Truncate(offset)
+	if err != nil {
+		return fmt.Errorf("could not truncate log '%s' at '%d' %w", l.file.Name(), offset, err)
+	}
+	l.size = offset
+	return nil
+}
+
+// Replay calls the given function for all the entries starting from the given index, in order
+// the writes are blocked while replaying, so the function must not modify the log.
+func (l *Log) Replay(from uint64, f func(entry Entry) error) error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		return store.ErrClosed
+	}
+	if from < l.first {
+		from = l.first
+	}
+	if from >= l.next() {
+		return nil
+	}
+	offset := l.offsets[from-l.first]
+	reader := bufio.NewReader(io.NewSectionReader(l.file, offset, l.size-offset))
+	for index := from; index < l.next(); index++ {
+		record, _, err := bytes.ReadRecord(reader)
+		if err != nil {
+			return fmt.Errorf("could not read entry '%d' %w", index, err)
+		}
+		err = f(Entry{Index: index, Data: record.Value})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact removes all the entries up to and including the given index, e.g. once they are part of a snapshot
+// the log continues after the given index, even if it did not reach it before.
+// The remaining entries are rewritten to a new file behind a compaction marker, which replaces the log with a rename,
+// so that a crash leaves either the old or the new log in place.
+func (l *Log) Compact(index uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return store.ErrClosed
+	}
+	if index < l.first {
+		return nil
+	}
+
+	key := make([]byte, indexSize)
+	binary.BigEndian.PutUint64(key, index)
+	marker, err := bytes.EncodeRecord(bytes.Record{Key: key, Tombstone: true})
+	if err != nil {
+		return fmt.Errorf("could not serialize compaction marker '%d' %w", index, err)
+	}
+	// the entries after the index are kept as they are
+	offset := l.size
+	remaining := make([]int64, 0)
+	if index+1 < l.next() {
+		i := index + 1 - l.first
+		offset = l.offsets[i]
+		for _, o := range l.offsets[i:] {
+			remaining = append(remaining, o-offset+int64(len(marker)))
+		}
+	}
+
+	name := l.file.Name()
+	tmp, err := os.OpenFile(name+tmpSuffix, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("could not create compaction of log '%s' %w", name, err)
+	}
+	err = l.rewrite(tmp, marker, offset)
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("could not compact log '%s' up to %d %w", name, index, err)
+	}
+	// the new file has been synced, so the old one can be dropped
+	_ = l.file.Close()
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_RDWR, 0644)
+	_ = tmp.Close()
+	if err != nil {
+		l.closed = true
+		return fmt.Errorf("could not reopen compacted log '%s' %w", name, err)
+	}
+	l.file = file
+	l.first = index + 1
+	l.offsets = remaining
+	l.size = l.size - offset + int64(len(marker))
+	log.Debug().
+		Str("filename", name).
+		Uint64("first", l.first).
+		Int("entries", len(l.offsets)).
+		Msg("Compact Log")
+	return nil
+}
+
+// rewrite writes the marker followed by the content of the log from the given offset into the file, and syncs it
+func (l *Log) rewrite(file *os.File, marker []byte, offset int64) error {
+	_, err := file.Write(marker)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, io.NewSectionReader(l.file, offset, l.size-offset))
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Sync commits the entries of the log to disk
+func (l *Log) Sync() error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		return store.ErrClosed
+	}
+	return l.file.Sync()
+}
+
+// Close syncs and closes the file of the log
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return store.ErrClosed
+	}
+	l.closed = true
+	syncErr := l.file.Sync()
+	closeErr := l.file.Close()
+	if syncErr != nil || closeErr != nil {
+		return fmt.Errorf("could not close log [%v,%v]", syncErr, closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/bytes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog_AppendGet(t *testing.T) {
+
+	l, err := Open(filepath.Join(t.TempDir(), "wal"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), l.First())
+	assert.Equal(t, uint64(0), l.Last())
+
+	for i := 1; i <= 10; i++ {
+		index, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i), index)
+	}
+	assert.Equal(t, uint64(1), l.First())
+	assert.Equal(t, uint64(10), l.Last())
+
+	for i := 1; i <= 10; i++ {
+		entry, err := l.Get(uint64(i))
+		assert.NoError(t, err)
+		assert.Equal(t, Entry{Index: uint64(i), Data: []byte(fmt.Sprintf("entry-%d", i))}, entry)
+	}
+
+	_, err = l.Get(0)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = l.Get(11)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = l.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestLog_Truncate(t *testing.T) {
+
+	l, err := Open(filepath.Join(t.TempDir(), "wal"))
+	assert.NoError(t, err)
+
+	for i := 1; i <= 10; i++ {
+		_, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+	}
+
+	err = l.Truncate(6)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), l.Last())
+	_, err = l.Get(6)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// the next entry takes the place of the truncated ones
+	index, err := l.Append([]byte("new-entry-6"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), index)
+	entry, err := l.Get(6)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new-entry-6"), entry.Data)
+
+	// truncating after the end is a no-op
+	err = l.Truncate(10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), l.Last())
+
+	err = l.Truncate(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), l.Last())
+
+	err = l.Truncate(0)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = l.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestLog_Replay(t *testing.T) {
+
+	l, err := Open(filepath.Join(t.TempDir(), "wal"))
+	assert.NoError(t, err)
+
+	for i := 1; i <= 10; i++ {
+		_, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+	}
+
+	for _, from := range []uint64{0, 1, 5, 10, 11} {
+		expected := from
+		if expected == 0 {
+			expected = 1
+		}
+		err = l.Replay(from, func(entry Entry) error {
+			assert.Equal(t, expected, entry.Index)
+			assert.Equal(t, []byte(fmt.Sprintf("entry-%d", expected)), entry.Data)
+			expected++
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(11), expected)
+	}
+
+	err = l.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestLog_Reopen(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "wal")
+
+	l, err := Open(name)
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+	}
+	err = l.Truncate(8)
+	assert.NoError(t, err)
+	err = l.Close()
+	assert.NoError(t, err)
+
+	// simulate an interrupted write
+	record, err := bytes.EncodeRecord(bytes.Record{Key: []byte("00000008"), Value: []byte("entry-8")})
+	assert.NoError(t, err)
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.Write(record[:len(record)-3])
+	assert.NoError(t, err)
+	err = file.Close()
+	assert.NoError(t, err)
+
+	l, err = Open(name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), l.First())
+	assert.Equal(t, uint64(7), l.Last())
+	for i := 1; i <= 7; i++ {
+		entry, err := l.Get(uint64(i))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("entry-%d", i)), entry.Data)
+	}
+
+	// new entries are appended after the truncated one
+	index, err := l.Append([]byte("entry-8"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), index)
+	err = l.Close()
+	assert.NoError(t, err)
+
+	l, err = Open(name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), l.Last())
+	err = l.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestLog_ReopenCorrupted(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "wal")
+
+	l, err := Open(name)
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+	}
+	err = l.Close()
+	assert.NoError(t, err)
+
+	// flip a byte in the middle of the file
+	file, err := os.OpenFile(name, os.O_RDWR, 0644)
+	assert.NoError(t, err)
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	b := make([]byte, 1)
+	_, err = file.ReadAt(b, info.Size()/2)
+	assert.NoError(t, err)
+	b[0]++
+	_, err = file.WriteAt(b, info.Size()/2)
+	assert.NoError(t, err)
+	err = file.Close()
+	assert.NoError(t, err)
+
+	_, err = Open(name)
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+
+}
+
+func TestLog_Compact(t *testing.T) {
+
+	name := filepath.Join(t.TempDir(), "wal")
+
+	l, err := Open(name)
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err := l.Append([]byte(fmt.Sprintf("entry-%d", i)))
+		assert.NoError(t, err)
+	}
+
+	err = l.Compact(4)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), l.First())
+	assert.Equal(t, uint64(10), l.Last())
+	_, err = l.Get(4)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// compacting before the first entry is a no-op
+	err = l.Compact(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), l.First())
+
+	index, err := l.Append([]byte("entry-11"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), index)
+	err = l.Close()
+	assert.NoError(t, err)
+
+	// a stale compaction is discarded on a reopen
+	err = os.WriteFile(name+tmpSuffix, []byte("partial"), 0644)
+	assert.NoError(t, err)
+
+	l, err = Open(name)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, name+tmpSuffix)
+	assert.Equal(t, uint64(5), l.First())
+	assert.Equal(t, uint64(11), l.Last())
+	for i := 5; i <= 11; i++ {
+		entry, err := l.Get(uint64(i))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("entry-%d", i)), entry.Data)
+	}
+
+	// the log continues after the compacted index, even beyond its end
+	err = l.Compact(20)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), l.First())
+	assert.Equal(t, uint64(20), l.Last())
+	err = l.Close()
+	assert.NoError(t, err)
+
+	l, err = Open(name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), l.Last())
+	index, err = l.Append([]byte("entry-21"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21), index)
+	err = l.Truncate(21)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(20), l.Last())
+	err = l.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestLog_Closed(t *testing.T) {
+
+	l, err := Open(filepath.Join(t.TempDir(), "wal"))
+	assert.NoError(t, err)
+	_, err = l.Append([]byte("entry"))
+	assert.NoError(t, err)
+
+	err = l.Close()
+	assert.NoError(t, err)
+
+	_, err = l.Append([]byte("entry"))
+	assert.ErrorIs(t, err, store.ErrClosed)
+	_, err = l.Get(1)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = l.Truncate(1)
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = l.Replay(1, func(entry Entry) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = l.Sync()
+	assert.ErrorIs(t, err, store.ErrClosed)
+	err = l.Close()
+	assert.ErrorIs(t, err, store.ErrClosed)
+
+}
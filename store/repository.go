@@ -1,90 +1,233 @@
 package store
 
 import (
-	"encoding/json"
 	"fmt"
+	"sync"
 )
 
-// KV is a generic key-value structure
-type KV struct {
-	Key   interface{}
-	Value interface{}
+// KV is a typed key-value pair
+type KV[K, V any] struct {
+	Key   K
+	Value V
 }
 
-// Encoder is the implementation transforming the incoming objects to the byte slice
-type Encoder func(v KV) (Element, error)
-
-// Decoder is the implementation for transforming the byte slice to the appropriate struct
-type Decoder func(element Element) (KV, error)
-
-// ValueConstructor re-creates the value object from the serialized form
-type ValueConstructor func() interface{}
-
-// Repository is the high level implementation  allowing to store arbitrary key value pairs
-type Repository struct {
-	encoder Encoder
-	decoder Decoder
+// Repository is the high level implementation allowing to store typed key value pairs
+// the keys and values are transformed to the byte slices of the underlying storage with the given codecs.
+type Repository[K, V any] struct {
+	keys    Codec[K]
+	values  Codec[V]
 	storage Storage
+	// mutex serializes the writes, so that the secondary indexes follow the values of the storage,
+	// and the index lookups read them under the read lock.
+	mutex   sync.RWMutex
+	indexes []indexer[V]
 }
 
-// NewRepository creates a new repository
-func NewRepository(constructor ValueConstructor, storage Storage) *Repository {
-	return &Repository{
-		encoder: encode,
-		decoder: decode(constructor),
+// NewRepository creates a new repository on top of the given storage
+func NewRepository[K, V any](storage Storage, keys Codec[K], values Codec[V]) *Repository[K, V] {
+	return &Repository[K, V]{
+		keys:    keys,
+		values:  values,
 		storage: storage,
 	}
 }
 
 // Put puts a key value pair into the repository
-func (repo *Repository) Put(kv KV) error {
-	element, err := repo.encoder(kv)
+// the secondary indexes are updated after the pair has been stored.
+// If one of them fails, the indexes and the pair are rolled back to the previous value of the key.
+func (repo *Repository[K, V]) Put(kv KV[K, V]) error {
+	element, err := repo.encode(kv)
 	if err != nil {
 		return fmt.Errorf("could not put %v: %w", kv, err)
 	}
-	return repo.storage.Put(element)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if len(repo.indexes) == 0 {
+		return repo.storage.Put(element)
+	}
+	undo, previous, err := repo.previous(element.Key)
+	if err != nil {
+		return err
+	}
+	err = repo.storage.Put(element)
+	if err != nil {
+		return err
+	}
+	return repo.index(element.Key, previous, &kv.Value, undo)
+}
+
+// Get retrieves the key value pair from the repository for the given key
+func (repo *Repository[K, V]) Get(k K) (KV[K, V], error) {
+	key, err := repo.keys.Encode(k)
+	if err != nil {
+		return KV[K, V]{}, fmt.Errorf("could not encode key %v: %w", k, err)
+	}
+	element, err := repo.storage.Get(key)
+	if err != nil {
+		return KV[K, V]{}, fmt.Errorf("could not retrieve element for key %v: %w", k, err)
+	}
+	return repo.decode(element)
+}
+
+// Delete removes the key value pair for the given key from the repository
+// as for Put, a failed index update restores the pair.
+func (repo *Repository[K, V]) Delete(k K) error {
+	key, err := repo.keys.Encode(k)
+	if err != nil {
+		return fmt.Errorf("could not encode key %v: %w", k, err)
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if len(repo.indexes) == 0 {
+		return repo.storage.Delete(key)
+	}
+	undo, previous, err := repo.previous(key)
+	if err != nil {
+		return err
+	}
+	err = repo.storage.Delete(key)
+	if err != nil {
+		return err
+	}
+	return repo.index(key, previous, nil, undo)
+}
+
+// previous returns the write that restores the current state of the key,
+// and the value currently stored for the key, or nil if there is none
+func (repo *Repository[K, V]) previous(key Key) (Write, *V, error) {
+	undo, err := previous(repo.storage, key)
+	if err != nil {
+		return Write{}, nil, fmt.Errorf("could not retrieve previous element for key %v: %w", key, err)
+	}
+	if undo.Delete {
+		return undo, nil, nil
+	}
+	kv, err := repo.decode(undo.Element)
+	if err != nil {
+		return Write{}, nil, err
+	}
+	return undo, &kv.Value, nil
 }
 
-// Get retrieves a value from the repository for the given key
-func (repo *Repository) Get(k interface{}) (KV, error) {
-	key, err := encode(KV{Key: k})
+// index updates the secondary indexes for the change of the value of the key
+// if one of them fails, the indexes updated so far, including the partial update of the failed one,
+// are moved back to the previous value, and the undo write restores it in the storage.
+func (repo *Repository[K, V]) index(key Key, previous, current *V, undo Write) error {
+	for i, index := range repo.indexes {
+		if err := index.update(key, previous, current); err != nil {
+			for j := i; j >= 0; j-- {
+				_ = repo.indexes[j].update(key, current, previous)
+			}
+			rollback(repo.storage, []Write{undo})
+			return fmt.Errorf("could not update index for key %v: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Scan returns the key value pairs with keys in the range [from, to)
+// a nil from or to key leaves the corresponding side of the range unbounded.
+// The range and the order of the pairs follow the encoded keys,
+// so they only match the order of the keys for a codec that preserves it.
+// It fails with ErrNotSupported, if the underlying storage is not Iterable.
+func (repo *Repository[K, V]) Scan(from, to *K) (*KVCursor[K, V], error) {
+	iterable, ok := repo.storage.(Iterable)
+	if !ok {
+		return nil, fmt.Errorf("could not scan storage %T: %w", repo.storage, ErrNotSupported)
+	}
+	fromKey, err := repo.bound(from)
 	if err != nil {
-		return KV{}, fmt.Errorf("could not encode key %v: %w", k, err)
+		return nil, err
 	}
-	// TODO : fix this
-	element, err := repo.storage.Get(key.Key)
+	toKey, err := repo.bound(to)
 	if err != nil {
-		return KV{}, fmt.Errorf("could not retrieve element for key %v: %w", k, err)
+		return nil, err
 	}
-	return repo.decoder(element)
+	cursor, err := iterable.Scan(fromKey, toKey)
+	if err != nil {
+		return nil, err
+	}
+	return &KVCursor[K, V]{repo: repo, cursor: cursor}, nil
 }
 
 // Metadata returns the repository metadata
-func (repo *Repository) Metadata() Metadata {
+func (repo *Repository[K, V]) Metadata() Metadata {
 	return repo.storage.Metadata()
 }
 
-// Close closes the repository
-func (repo *Repository) Close() error {
-	return repo.storage.Close()
+// Close closes the repository, along with the storage of its secondary indexes
+func (repo *Repository[K, V]) Close() error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	err := repo.storage.Close()
+	for _, index := range repo.indexes {
+		if indexErr := index.close(); err == nil {
+			err = indexErr
+		}
+	}
+	return err
 }
 
-func encode(kv KV) (Element, error) {
-	bk, err := json.Marshal(kv.Key)
+// bound encodes the key for one side of a range
+func (repo *Repository[K, V]) bound(k *K) (Key, error) {
+	if k == nil {
+		return nil, nil
+	}
+	key, err := repo.keys.Encode(*k)
 	if err != nil {
-		return Element{}, fmt.Errorf("could not marshall key %v: %v", kv.Key, err)
+		return nil, fmt.Errorf("could not encode key %v: %w", *k, err)
 	}
-	bv, err := json.Marshal(kv.Value)
+	return key, nil
+}
+
+func (repo *Repository[K, V]) encode(kv KV[K, V]) (Element, error) {
+	bk, err := repo.keys.Encode(kv.Key)
 	if err != nil {
-		return Element{}, fmt.Errorf("could not marshall value %v: %v", kv.Value, err)
+		return Element{}, fmt.Errorf("could not encode key %v: %w", kv.Key, err)
+	}
+	bv, err := repo.values.Encode(kv.Value)
+	if err != nil {
+		return Element{}, fmt.Errorf("could not encode value %v: %w", kv.Value, err)
 	}
 	return NewElement(bk, bv), nil
 }
 
-func decode(constr ValueConstructor) func(element Element) (KV, error) {
-	return func(element Element) (kv KV, e error) {
-		response := constr()
-		err := json.Unmarshal(element.Value, response)
-		return KV{Value: response}, err
+func (repo *Repository[K, V]) decode(element Element) (KV[K, V], error) {
+	k, err := repo.keys.Decode(element.Key)
+	if err != nil {
+		return KV[K, V]{}, fmt.Errorf("could not decode key %v: %w", element.Key, err)
+	}
+	v, err := repo.values.Decode(element.Value)
+	if err != nil {
+		return KV[K, V]{}, fmt.Errorf("could not decode value for key %v: %w", k, err)
 	}
+	return KV[K, V]{Key: k, Value: v}, nil
+}
+
+// KVCursor iterates over the decoded key value pairs of a storage cursor
+type KVCursor[K, V any] struct {
+	repo   *Repository[K, V]
+	cursor Cursor
+	kv     KV[K, V]
+	err    error
+}
+
+// Next moves the cursor to the next key value pair, returning false if there are no more pairs,
+// or the pair could not be decoded
+func (c *KVCursor[K, V]) Next() bool {
+	if c.err != nil || !c.cursor.Next() {
+		return false
+	}
+	c.kv, c.err = c.repo.decode(c.cursor.Element())
+	return c.err == nil
+}
+
+// KV returns the key value pair at the current cursor position
+func (c *KVCursor[K, V]) KV() KV[K, V] {
+	return c.kv
+}
+
+// Err returns the error that stopped the iteration, if any
+func (c *KVCursor[K, V]) Err() error {
+	return c.err
 }
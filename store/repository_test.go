@@ -0,0 +1,270 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+// message is a hand-written protocol buffer message
+// the vendored protobuf library serializes it through the struct tags, as it would for a generated one.
+type message struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Age  int64  `protobuf:"varint,2,opt,name=age,proto3"`
+}
+
+func (m *message) Reset()         { *m = message{} }
+func (m *message) String() string { return proto.CompactTextString(m) }
+func (*message) ProtoMessage()    {}
+
+func TestCodec(t *testing.T) {
+
+	testCodec[user](t, store.JSONCodec[user]{}, user{Name: "json", Age: 1})
+	testCodec[int](t, store.JSONCodec[int]{}, 42)
+	testCodec[user](t, store.GobCodec[user]{}, user{Name: "gob", Age: 2})
+	testCodec[[]string](t, store.GobCodec[[]string]{}, []string{"a", "b"})
+	testCodec[*message](t, store.NewProtoCodec(func() *message {
+		return new(message)
+	}), &message{Name: "proto", Age: 3})
+	testCodec[string](t, store.RawCodec[string]{}, "raw")
+	testCodec[store.Key](t, store.RawCodec[store.Key]{}, store.Key("raw"))
+
+	_, err := store.JSONCodec[user]{}.Decode([]byte("{"))
+	assert.Error(t, err)
+	_, err = store.GobCodec[user]{}.Decode([]byte("{"))
+	assert.Error(t, err)
+
+}
+
+func testCodec[T any](t *testing.T, codec store.Codec[T], v T) {
+	b, err := codec.Encode(v)
+	assert.NoError(t, err)
+	decoded, err := codec.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, v, decoded)
+}
+
+func TestRepository(t *testing.T) {
+
+	repo := store.NewRepository[string, user](mem.BTreeFactory(), store.RawCodec[string]{}, store.JSONCodec[user]{})
+
+	for i := 0; i < 10; i++ {
+		err := repo.Put(store.KV[string, user]{Key: fmt.Sprintf("user-%d", i), Value: user{Name: fmt.Sprintf("name-%d", i), Age: i}})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(10), repo.Metadata().Size)
+
+	kv, err := repo.Get("user-5")
+	assert.NoError(t, err)
+	assert.Equal(t, store.KV[string, user]{Key: "user-5", Value: user{Name: "name-5", Age: 5}}, kv)
+
+	err = repo.Delete("user-5")
+	assert.NoError(t, err)
+	_, err = repo.Get("user-5")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	from, to := "user-3", "user-7"
+	cursor, err := repo.Scan(&from, &to)
+	assert.NoError(t, err)
+	keys := make([]string, 0)
+	for cursor.Next() {
+		kv := cursor.KV()
+		assert.Equal(t, fmt.Sprintf("user-%d", kv.Value.Age), kv.Key)
+		keys = append(keys, kv.Key)
+	}
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, []string{"user-3", "user-4", "user-6"}, keys)
+
+	cursor, err = repo.Scan(nil, nil)
+	assert.NoError(t, err)
+	count := 0
+	for cursor.Next() {
+		count++
+	}
+	assert.Equal(t, 9, count)
+
+	err = repo.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestRepository_Codecs(t *testing.T) {
+
+	// the decoded key is returned along with the value for every codec
+	testRepository(t, store.NewRepository[int, user](mem.NewCache(), store.JSONCodec[int]{}, store.GobCodec[user]{}),
+		7, user{Name: "gob", Age: 7})
+	testRepository(t, store.NewRepository[user, *message](mem.NewCache(), store.GobCodec[user]{}, store.NewProtoCodec(func() *message {
+		return new(message)
+	})), user{Name: "key"}, &message{Name: "proto", Age: 8})
+	testRepository(t, store.NewRepository[store.Key, store.Value](mem.NewCache(), store.RawCodec[store.Key]{}, store.RawCodec[store.Value]{}),
+		store.Key("key"), store.Value("value"))
+
+}
+
+func testRepository[K, V any](t *testing.T, repo *store.Repository[K, V], k K, v V) {
+	err := repo.Put(store.KV[K, V]{Key: k, Value: v})
+	assert.NoError(t, err)
+	kv, err := repo.Get(k)
+	assert.NoError(t, err)
+	assert.Equal(t, store.KV[K, V]{Key: k, Value: v}, kv)
+}
+
+func TestRepository_Errors(t *testing.T) {
+
+	repo := store.NewRepository[string, string](mem.NewCache(), store.RawCodec[string]{}, store.RawCodec[string]{})
+	_, err := repo.Scan(nil, nil)
+	assert.ErrorIs(t, err, store.ErrNotSupported)
+
+	// a value that cannot be decoded stops the iteration
+	raw := mem.BTreeFactory()
+	err = raw.Put(store.NewElement([]byte("a"), []byte(`{"Name":"a"}`)))
+	assert.NoError(t, err)
+	err = raw.Put(store.NewElement([]byte("b"), []byte("{")))
+	assert.NoError(t, err)
+	users := store.NewRepository[string, user](raw, store.RawCodec[string]{}, store.JSONCodec[user]{})
+	_, err = users.Get("b")
+	assert.Error(t, err)
+	cursor, err := users.Scan(nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, cursor.Next())
+	assert.Equal(t, "a", cursor.KV().Key)
+	assert.False(t, cursor.Next())
+	assert.Error(t, cursor.Err())
+
+	err = users.Close()
+	assert.NoError(t, err)
+
+}
+
+// flaky is a storage that rejects the writes while it is set to fail
+type flaky struct {
+	store.Storage
+	fail bool
+}
+
+var errFlaky = errors.New("flaky write")
+
+func (f *flaky) Put(element store.Element) error {
+	if f.fail {
+		return errFlaky
+	}
+	return f.Storage.Put(element)
+}
+
+func (f *flaky) Delete(key store.Key) error {
+	if f.fail {
+		return errFlaky
+	}
+	return f.Storage.Delete(key)
+}
+
+func (f *flaky) Prefix(p store.Key) (store.Cursor, error) {
+	return f.Storage.(store.Iterable).Prefix(p)
+}
+
+func (f *flaky) Scan(from, to store.Key) (store.Cursor, error) {
+	return f.Storage.(store.Iterable).Scan(from, to)
+}
+
+func names[K any](t *testing.T, cursor *store.KVCursor[K, user], err error) []string {
+	assert.NoError(t, err)
+	names := make([]string, 0)
+	for cursor.Next() {
+		names = append(names, cursor.KV().Value.Name)
+	}
+	assert.NoError(t, cursor.Err())
+	return names
+}
+
+func TestRepository_IndexRollback(t *testing.T) {
+
+	indexStorage := &flaky{Storage: mem.BTreeFactory()}
+	repo := store.NewRepository[string, user](mem.BTreeFactory(), store.RawCodec[string]{}, store.JSONCodec[user]{})
+	index := store.NewIndex[string, user, string](repo, indexStorage, store.RawCodec[string]{}, func(value user) []string {
+		return []string{value.Name}
+	})
+
+	err := repo.Put(store.KV[string, user]{Key: "key", Value: user{Name: "a", Age: 1}})
+	assert.NoError(t, err)
+
+	// a failed index update leaves both the value and the index as they were
+	indexStorage.fail = true
+	err = repo.Put(store.KV[string, user]{Key: "key", Value: user{Name: "b", Age: 2}})
+	assert.ErrorIs(t, err, errFlaky)
+	err = repo.Delete("key")
+	assert.ErrorIs(t, err, errFlaky)
+	err = repo.Put(store.KV[string, user]{Key: "other", Value: user{Name: "c", Age: 3}})
+	assert.ErrorIs(t, err, errFlaky)
+	indexStorage.fail = false
+
+	kv, err := repo.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, user{Name: "a", Age: 1}, kv.Value)
+	_, err = repo.Get("other")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	cursor, err := index.Find("a")
+	assert.Equal(t, []string{"a"}, names(t, cursor, err))
+	cursor, err = index.Find("b")
+	assert.Empty(t, names(t, cursor, err))
+
+	err = repo.Close()
+	assert.NoError(t, err)
+
+}
+
+func TestRepository_IndexConcurrentDelete(t *testing.T) {
+
+	storage := mem.SyncBTreeFactory()
+	repo := store.NewRepository[string, user](storage, store.RawCodec[string]{}, store.JSONCodec[user]{})
+	index := store.NewIndex[string, user, int](repo, mem.SyncBTreeFactory(), store.JSONCodec[int]{}, func(value user) []int {
+		return []int{value.Age}
+	})
+
+	for i := 0; i < 100; i++ {
+		err := repo.Put(store.KV[string, user]{Key: fmt.Sprintf("key-%d", i), Value: user{Name: fmt.Sprintf("user-%d", i), Age: 1}})
+		assert.NoError(t, err)
+	}
+
+	// a value removed from the storage without going through the repository is skipped
+	err := storage.Delete([]byte("key-0"))
+	assert.NoError(t, err)
+	cursor, err := index.Find(1)
+	assert.Equal(t, 99, len(names(t, cursor, err)))
+
+	// the lookups see every value either before or after it is deleted
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i < 100; i++ {
+			err := repo.Delete(fmt.Sprintf("key-%d", i))
+			assert.NoError(t, err)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		cursor, err := index.Find(1)
+		assert.NoError(t, err)
+		for cursor.Next() {
+		}
+		assert.NoError(t, cursor.Err())
+	}
+	wg.Wait()
+
+	cursor, err = index.Find(1)
+	assert.Empty(t, names(t, cursor, err))
+
+	err = repo.Close()
+	assert.NoError(t, err)
+
+}
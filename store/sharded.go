@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// shard is one of the partitions of a sharded storage, along with its own lock
+type shard struct {
+	storage Storage
+	// the lock is exclusive for the reads as well,
+	// as some implementations e.g. the bounded caches update their state on every read
+	sync.Mutex
+}
+
+// ShardedStorage hash-partitions the keys across a number of independent storage instances
+// every shard is guarded by its own lock, so that operations on keys of different shards do not contend.
+// Any storage implementation can be used for the shards, whether thread-safe or not.
+type ShardedStorage struct {
+	shards []*shard
+}
+
+// NewShardedStorage creates a sharded storage with the given number of shards
+// every shard is created with a separate call to the factory,
+// so the factories of persistent implementations need to make sure they do not share their files.
+func NewShardedStorage(factory StorageFactory, shards int) (*ShardedStorage, error) {
+	if shards <= 0 {
+		return nil, fmt.Errorf("invalid number of shards %d", shards)
+	}
+	s := &ShardedStorage{
+		shards: make([]*shard, shards),
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard{storage: factory()}
+	}
+	return s, nil
+}
+
+// ShardedStorageFactory generates a sharded storage implementation
+func ShardedStorageFactory(factory StorageFactory, shards int) StorageFactory {
+	return func() Storage {
+		storage, err := NewShardedStorage(factory, shards)
+		if err != nil {
+			panic(fmt.Sprintf("error during store creation: %v", err))
+		}
+		return storage
+	}
+}
+
+// shard returns the shard responsible for the given key
+// the keys are hashed with fnv, so that they end up in the same shard across restarts.
+func (s *ShardedStorage) shard(key Key) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Put adds an element to the shard of its key
+func (s *ShardedStorage) Put(element Element) error {
+	sh := s.shard(element.Key)
+	sh.Lock()
+	defer sh.Unlock()
+	return sh.storage.Put(element)
+}
+
+// Get retrieves the element for the given key from its shard
+func (s *ShardedStorage) Get(key Key) (Element, error) {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	return sh.storage.Get(key)
+}
+
+// Delete removes the element for the given key from its shard
+func (s *ShardedStorage) Delete(key Key) error {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	return sh.storage.Delete(key)
+}
+
+// Metadata merges the metadata of all the shards
+// the shards are visited one after the other, so the result is not a consistent view under concurrent writes.
+func (s *ShardedStorage) Metadata() Metadata {
+	metadata := NewMetadata()
+	for _, sh := range s.shards {
+		sh.Lock()
+		m := sh.storage.Metadata()
+		sh.Unlock()
+		metadata.Merge(m)
+		for _, err := range m.Errors {
+			metadata.Error(err)
+		}
+	}
+	return metadata
+}
+
+// Close closes all the shards
+// every shard is closed, even if some of them fail, and the first error is returned.
+func (s *ShardedStorage) Close() error {
+	var err error
+	for i, sh := range s.shards {
+		sh.Lock()
+		closeErr := sh.storage.Close()
+		sh.Unlock()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("could not close shard %d: %w", i, closeErr)
+		}
+	}
+	return err
+}
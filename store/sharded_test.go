@@ -0,0 +1,171 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/file"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/drakos74/lachesis/store/store/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedStorage_KeyValueImplementation(t *testing.T) {
+	new(test.ConsistencyWithMeta).Run(t, store.ShardedStorageFactory(mem.CacheFactory, 8))
+}
+
+func TestShardedStorage_SyncImplementation(t *testing.T) {
+	// the shards are not thread-safe on their own
+	new(test.Concurrency).Run(t, store.ShardedStorageFactory(mem.BTreeFactory, 8))
+}
+
+func TestShardedStorage_InvalidShards(t *testing.T) {
+	_, err := store.NewShardedStorage(mem.CacheFactory, 0)
+	assert.Error(t, err)
+}
+
+func TestShardedStorage_Partitioning(t *testing.T) {
+
+	shards := make([]store.Storage, 0)
+	sharded, err := store.NewShardedStorage(func() store.Storage {
+		shard := mem.NewCache()
+		shards = append(shards, shard)
+		return shard
+	}, 4)
+	assert.NoError(t, err)
+
+	elements := test.Elements(1000, test.Random(10, 20))
+	for _, element := range elements {
+		err := sharded.Put(element)
+		assert.NoError(t, err)
+	}
+
+	// every key ends up in exactly one shard, and all shards get a share of the keys
+	for _, element := range elements {
+		found := 0
+		for _, shard := range shards {
+			if _, err := shard.Get(element.Key); err == nil {
+				found++
+			}
+		}
+		assert.Equal(t, 1, found)
+	}
+	total := store.NewMetadata()
+	for _, shard := range shards {
+		metadata := shard.Metadata()
+		assert.Greater(t, metadata.Size, uint64(0))
+		total.Merge(metadata)
+	}
+	assert.Equal(t, total, sharded.Metadata())
+	assert.Equal(t, uint64(1000), total.Size)
+
+	err = sharded.Close()
+	assert.NoError(t, err)
+
+}
+
+// closing is a storage that fails to close
+type closing struct {
+	store.Storage
+}
+
+var errClosing = errors.New("failing close")
+
+func (closing) Close() error {
+	return errClosing
+}
+
+func TestShardedStorage_Close(t *testing.T) {
+
+	created := 0
+	sharded, err := store.NewShardedStorage(func() store.Storage {
+		created++
+		if created%2 == 0 {
+			return closing{mem.NewCache()}
+		}
+		return mem.NewCache()
+	}, 4)
+	assert.NoError(t, err)
+
+	err = sharded.Close()
+	assert.ErrorIs(t, err, errClosing)
+
+}
+
+// benchmarkShards is the number of shards for the sharded storage benchmarks
+const benchmarkShards = 16
+
+// BenchmarkShardedStorage compares the sharded storage with the thread-safe implementations,
+// for an even mix of reads and writes from a growing number of goroutines
+func BenchmarkShardedStorage(b *testing.B) {
+	factories := []struct {
+		name    string
+		factory func(b *testing.B) store.StorageFactory
+	}{
+		{"sync-cache", func(b *testing.B) store.StorageFactory { return mem.SyncCacheFactory }},
+		{"sharded-cache", func(b *testing.B) store.StorageFactory {
+			return store.ShardedStorageFactory(mem.CacheFactory, benchmarkShards)
+		}},
+		{"sync-btree", func(b *testing.B) store.StorageFactory { return mem.SyncBTreeFactory }},
+		{"sharded-btree", func(b *testing.B) store.StorageFactory {
+			return store.ShardedStorageFactory(mem.BTreeFactory, benchmarkShards)
+		}},
+		{"sync-trie", func(b *testing.B) store.StorageFactory { return mem.SyncTrieFactory }},
+		{"sharded-trie", func(b *testing.B) store.StorageFactory {
+			return store.ShardedStorageFactory(mem.TrieFactory, benchmarkShards)
+		}},
+		{"sync-pad", func(b *testing.B) store.StorageFactory { return file.SyncScratchPadFactory(b.TempDir()) }},
+		{"sharded-pad", func(b *testing.B) store.StorageFactory {
+			return store.ShardedStorageFactory(file.TriePadFactory(b.TempDir()), benchmarkShards)
+		}},
+	}
+	for _, f := range factories {
+		for _, goroutines := range []int{1, 8, 64} {
+			b.Run(fmt.Sprintf("%s|goroutines:%d", f.name, goroutines), func(b *testing.B) {
+				benchmarkConcurrentReadWrite(b, f.factory(b)(), goroutines)
+			})
+		}
+	}
+}
+
+// benchmarkConcurrentReadWrite splits the operations across the goroutines
+// every goroutine alternates between reading and overwriting the elements that are already there.
+func benchmarkConcurrentReadWrite(b *testing.B, storage store.Storage, goroutines int) {
+	elements := test.Elements(b.N, test.Random(10, 100))
+	for _, element := range elements {
+		err := storage.Put(element)
+		if err != nil {
+			b.Fatalf("error : %v", err)
+		}
+	}
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < b.N; i += goroutines {
+				if i%2 == 0 {
+					_, err := storage.Get(elements[i].Key)
+					if err != nil {
+						b.Errorf("error : %v", err)
+					}
+					continue
+				}
+				err := storage.Put(elements[i])
+				if err != nil {
+					b.Errorf("error : %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	b.StopTimer()
+	err := storage.Close()
+	if err != nil {
+		b.Fatalf("error : %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Snapshotter is implemented by the storage implementations that can export all their elements to a stream,
+// and import them back, possibly into a different implementation
+type Snapshotter interface {
+	// Snapshot writes a consistent copy of all the elements of the storage to the writer
+	Snapshot(w io.Writer) error
+	// Restore adds the elements of the snapshot in the reader to the storage
+	// the snapshot is verified before any element is added, so an invalid snapshot leaves the storage untouched.
+	Restore(r io.Reader) error
+}
+
+// The snapshot stream format is backend-neutral and consists of
+// the header [magic:4][version:2],
+// the records [key size:4][key][value size:4][value],
+// and the trailer [end of records:4][count:8][checksum:4],
+// where the checksum is the crc32 of everything that precedes it.
+// All numbers are little endian.
+const (
+	// SnapshotVersion is the version of the snapshot format written by this package
+	SnapshotVersion = 1
+	snapshotMagic   = "LACS"
+	// endOfRecords is the key size that marks the end of the records
+	endOfRecords = math.MaxUint32
+)
+
+// WriteSnapshot writes the elements of the cursor to the writer in the snapshot format
+func WriteSnapshot(w io.Writer, elements Cursor) error {
+	buffer := bufio.NewWriter(w)
+	checksum := crc32.NewIEEE()
+	out := io.MultiWriter(buffer, checksum)
+
+	header := make([]byte, 6)
+	copy(header, snapshotMagic)
+	binary.LittleEndian.PutUint16(header[4:], SnapshotVersion)
+	if _, err := out.Write(header); err != nil {
+		return fmt.Errorf("could not write snapshot header %w", err)
+	}
+
+	var count uint64
+	size := make([]byte, 4)
+	for elements.Next() {
+		element := elements.Element()
+		for _, field := range [][]byte{element.Key, element.Value} {
+			binary.LittleEndian.PutUint32(size, uint32(len(field)))
+			if _, err := out.Write(size); err != nil {
+				return fmt.Errorf("could not write snapshot record for '%v' %w", element.Key, err)
+			}
+			if _, err := out.Write(field); err != nil {
+				return fmt.Errorf("could not write snapshot record for '%v' %w", element.Key, err)
+			}
+		}
+		count++
+	}
+
+	trailer := make([]byte, 12)
+	binary.LittleEndian.PutUint32(trailer, endOfRecords)
+	binary.LittleEndian.PutUint64(trailer[4:], count)
+	if _, err := out.Write(trailer); err != nil {
+		return fmt.Errorf("could not write snapshot trailer %w", err)
+	}
+	binary.LittleEndian.PutUint32(size, checksum.Sum32())
+	if _, err := buffer.Write(size); err != nil {
+		return fmt.Errorf("could not write snapshot checksum %w", err)
+	}
+	return buffer.Flush()
+}
+
+// ReadSnapshot reads all the elements of the snapshot in the reader, and verifies them against the trailer
+func ReadSnapshot(r io.Reader) ([]Element, error) {
+	buffer := bufio.NewReader(r)
+	checksum := crc32.NewIEEE()
+	in := io.TeeReader(buffer, checksum)
+
+	header := make([]byte, 6)
+	if err := readFull(in, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot stream", ErrCorrupted)
+	}
+	if version := binary.LittleEndian.Uint16(header[4:]); version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	elements := make([]Element, 0)
+	size := make([]byte, 4)
+	for {
+		if err := readFull(in, size); err != nil {
+			return nil, err
+		}
+		keySize := binary.LittleEndian.Uint32(size)
+		if keySize == endOfRecords {
+			break
+		}
+		key, err := readField(in, keySize)
+		if err != nil {
+			return nil, err
+		}
+		if err := readFull(in, size); err != nil {
+			return nil, err
+		}
+		value, err := readField(in, binary.LittleEndian.Uint32(size))
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, NewElement(key, value))
+	}
+
+	count := make([]byte, 8)
+	if err := readFull(in, count); err != nil {
+		return nil, err
+	}
+	sum := checksum.Sum32()
+	// the checksum is not part of the checksum, so we read it from the buffer directly
+	if err := readFull(buffer, size); err != nil {
+		return nil, err
+	}
+	if expected := binary.LittleEndian.Uint32(size); expected != sum {
+		return nil, fmt.Errorf("%w: snapshot checksum mismatch %d vs %d", ErrCorrupted, expected, sum)
+	}
+	if n := binary.LittleEndian.Uint64(count); n != uint64(len(elements)) {
+		return nil, fmt.Errorf("%w: snapshot count mismatch %d vs %d", ErrCorrupted, n, len(elements))
+	}
+	return elements, nil
+}
+
+// RestoreSnapshot reads the snapshot and adds its elements to the storage
+// if the storage supports batches, the elements are added atomically.
+func RestoreSnapshot(storage Storage, r io.Reader) error {
+	elements, err := ReadSnapshot(r)
+	if err != nil {
+		return fmt.Errorf("could not read snapshot %w", err)
+	}
+	if batcher, ok := storage.(Batcher); ok {
+		batch := batcher.NewBatch()
+		for _, element := range elements {
+			batch.Put(element)
+		}
+		return batch.Commit()
+	}
+	for _, element := range elements {
+		err := storage.Put(element)
+		if err != nil {
+			return fmt.Errorf("could not restore element '%v' %w", element.Key, err)
+		}
+	}
+	return nil
+}
+
+// readFull fills the given slice from the reader
+func readFull(r io.Reader, b []byte) error {
+	_, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated snapshot", ErrCorrupted)
+	}
+	return err
+}
+
+// readField reads a field of the given size from the reader
+// the buffer grows along with the data read, so that a corrupted size does not cause a huge allocation
+func readField(r io.Reader, size uint32) ([]byte, error) {
+	field := new(bytes.Buffer)
+	n, err := io.CopyN(field, r, int64(size))
+	if err == io.EOF || n < int64(size) {
+		return nil, fmt.Errorf("%w: truncated snapshot", ErrCorrupted)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return field.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshotVector is the snapshot of the elements {a:1} and {bc:}
+// it pins down the stream format, that is shared with the benchmark adapters
+const snapshotVector = "4c41435301000100000061010000003102000000626300000000ffffffff020000000000000094c5cc38"
+
+func TestSnapshot_Format(t *testing.T) {
+
+	elements := []Element{
+		NewElement(Key("a"), Value("1")),
+		NewElement(Key("bc"), Value{}),
+	}
+
+	buffer := new(bytes.Buffer)
+	err := WriteSnapshot(buffer, NewCursor(elements))
+	assert.NoError(t, err)
+	assert.Equal(t, snapshotVector, hex.EncodeToString(buffer.Bytes()))
+
+	restored, err := ReadSnapshot(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, elements, restored)
+
+}
+
+func TestSnapshot_Empty(t *testing.T) {
+
+	buffer := new(bytes.Buffer)
+	err := WriteSnapshot(buffer, NewCursor(nil))
+	assert.NoError(t, err)
+
+	restored, err := ReadSnapshot(buffer)
+	assert.NoError(t, err)
+	assert.Empty(t, restored)
+
+}
+
+func TestSnapshot_Invalid(t *testing.T) {
+
+	snapshot, err := hex.DecodeString(snapshotVector)
+	assert.NoError(t, err)
+
+	// truncated at every possible position
+	for i := 0; i < len(snapshot); i++ {
+		_, err := ReadSnapshot(bytes.NewReader(snapshot[:i]))
+		assert.ErrorIs(t, err, ErrCorrupted, "truncated at %d", i)
+	}
+
+	// a single flipped bit anywhere in the stream
+	for i := 0; i < len(snapshot); i++ {
+		corrupted := make([]byte, len(snapshot))
+		copy(corrupted, snapshot)
+		corrupted[i] ^= 0x01
+		_, err := ReadSnapshot(bytes.NewReader(corrupted))
+		assert.Error(t, err, "corrupted at %d", i)
+	}
+
+	// a newer version
+	newer := make([]byte, len(snapshot))
+	copy(newer, snapshot)
+	newer[4] = SnapshotVersion + 1
+	_, err = ReadSnapshot(bytes.NewReader(newer))
+	assert.EqualError(t, err, "unsupported snapshot version 2")
+
+}
@@ -7,6 +7,7 @@ import (
 
 const (
 	// NoValue represents an error message string in the case where there is no value for a given key
+	// Deprecated : use NotFound, so that the error can be checked against ErrNotFound
 	NoValue = "could not find element for key %v"
 	// NoIndex represents the error message string in the case where no index was found for a given key
 	NoIndex = "could not find index for key %v"
@@ -18,10 +19,29 @@ const (
 type Storage interface {
 	Put(element Element) error
 	Get(key Key) (Element, error)
+	Delete(key Key) error
 	Metadata() Metadata
 	Close() error
 }
 
+// Iterable is implemented by the storage implementations that keep their keys in order
+// and can return them back as a sorted sequence
+type Iterable interface {
+	// Scan returns the elements with keys in the range [from, to)
+	// an empty from or to key leaves the corresponding side of the range unbounded
+	Scan(from, to Key) (Cursor, error)
+	// Prefix returns the elements with keys starting with the given prefix
+	Prefix(p Key) (Cursor, error)
+}
+
+// Cursor iterates over a sequence of elements
+type Cursor interface {
+	// Next moves the cursor to the next element, returning false if there are no more elements
+	Next() bool
+	// Element returns the element at the current cursor position
+	Element() Element
+}
+
 // Key identifies the byte arrays used as keys of the storage
 type Key []byte
 
@@ -60,7 +80,11 @@ type Metadata struct {
 	Size        uint64
 	KeysBytes   uint64
 	ValuesBytes uint64
-	Errors      errors
+	// Hits, Misses and Evictions are reported by the bounded caches
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Errors    errorList
 }
 
 // NewMetadata create a new metadata struct
@@ -75,6 +99,9 @@ func (m *Metadata) Merge(metadata Metadata) {
 	m.Size += metadata.Size
 	m.KeysBytes += metadata.KeysBytes
 	m.ValuesBytes += metadata.ValuesBytes
+	m.Hits += metadata.Hits
+	m.Misses += metadata.Misses
+	m.Evictions += metadata.Evictions
 }
 
 // Add increments the metadata state for an extra element
@@ -84,6 +111,15 @@ func (m *Metadata) Add(element Element) {
 	m.ValuesBytes += uint64(len(element.Value))
 }
 
+// HitRatio returns the ratio of the reads served by the cache
+func (m Metadata) HitRatio() float64 {
+	total := m.Hits + m.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.Hits) / float64(total)
+}
+
 // Error adds the provided error to the metadata instance
 func (m *Metadata) Error(err error) {
 	if err != nil {
@@ -91,13 +127,45 @@ func (m *Metadata) Error(err error) {
 	}
 }
 
-type errors []error
+type errorList []error
 
 // TODO : test
-func (err *errors) append(currentErr error) {
+func (err *errorList) append(currentErr error) {
 	*err = append(*err, currentErr)
 }
 
+// cursor
+
+// SliceCursor is a cursor over an in-memory slice of elements
+type SliceCursor struct {
+	elements []Element
+	index    int
+}
+
+// NewCursor creates a new cursor for the given elements
+func NewCursor(elements []Element) *SliceCursor {
+	return &SliceCursor{
+		elements: elements,
+		index:    -1,
+	}
+}
+
+// Next moves the cursor to the next element
+func (c *SliceCursor) Next() bool {
+	if c.index < len(c.elements) {
+		c.index++
+	}
+	return c.index < len(c.elements)
+}
+
+// Element returns the element at the current cursor position
+func (c *SliceCursor) Element() Element {
+	if c.index < 0 || c.index >= len(c.elements) {
+		return Nil
+	}
+	return c.elements[c.index]
+}
+
 // handle nil
 
 // NilBytes represents an empty byte array
@@ -129,3 +197,29 @@ func IsEqual(a, b Element) bool {
 func IsLess(a, b Element) bool {
 	return bytes.Compare(a.Key, b.Key) < 0
 }
+
+// InRange checks if the key falls into the range [from, to)
+// an empty from or to key leaves the corresponding side of the range unbounded
+func InRange(key, from, to Key) bool {
+	if len(from) > 0 && bytes.Compare(key, from) < 0 {
+		return false
+	}
+	if len(to) > 0 && bytes.Compare(key, to) >= 0 {
+		return false
+	}
+	return true
+}
+
+// PrefixEnd returns the smallest key that is bigger than all the keys starting with the given prefix
+// it returns an empty key if there is no such key e.g. the prefix consists only of 0xff bytes
+func PrefixEnd(p Key) Key {
+	end := make(Key, len(p))
+	copy(end, p)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return Key{}
+}
@@ -1,10 +1,13 @@
 package test
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/drakos74/lachesis/store/store"
 
@@ -20,7 +23,7 @@ func VoidReadOperation(t *testing.T, storage store.Storage, checkMeta bool) {
 	// read path
 	key := RandomBytes(10)
 	testElement, err := storage.Get(key)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, store.ErrNotFound)
 	assert.Equal(t, store.Element{}, testElement)
 
 	if checkMeta {
@@ -116,8 +119,478 @@ func ReadOverwriteOperation(t *testing.T, storage store.Storage, generator Rando
 	assert.NoError(t, err)
 }
 
+// DeleteOperation performs a write, a delete and a following read on the same key
+// it asserts that the element is not reachable any more after the removal
+func DeleteOperation(t *testing.T, storage store.Storage, generator RandomFactory, checkMeta bool) {
+
+	element := generator.ElementFactory()
+
+	// delete path on a non-existing key
+	err := storage.Delete(element.Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// write path
+	err = storage.Put(element)
+	assert.NoError(t, err)
+
+	IntermediateReadOperation(t, storage, element.Key, element.Value)
+
+	// delete path
+	err = storage.Delete(element.Key)
+	assert.NoError(t, err)
+
+	// read path
+	testElement, err := storage.Get(element.Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	assert.Equal(t, store.Element{}, testElement)
+
+	// second delete should fail
+	err = storage.Delete(element.Key)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	if checkMeta {
+		assertMeta(t, 0, 0, 0, storage.Metadata())
+	} else {
+		log.Info().Msg(fmt.Sprintf("metadata = %v", storage.Metadata()))
+	}
+
+	// re-write path
+	err = storage.Put(element)
+	assert.NoError(t, err)
+
+	IntermediateReadOperation(t, storage, element.Key, element.Value)
+
+	if checkMeta {
+		assert.Equal(t, uint64(1), storage.Metadata().Size)
+	}
+
+	// wrap up
+	err = storage.Close()
+	assert.NoError(t, err)
+}
+
+// ScanOperation performs multiple writes and range scans on the storage
+// it asserts that the elements are returned in key order and within the requested range
+func ScanOperation(t *testing.T, storage store.Iterable, generator RandomFactory) {
+
+	elements := Elements(num, generator)
+
+	//  write path
+	for _, element := range elements {
+		err := storage.(store.Storage).Put(element)
+		assert.NoError(t, err)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return store.IsLess(elements[i], elements[j])
+	})
+
+	from := num / 4
+	to := 3 * num / 4
+
+	// full scan
+	assertCursor(t, elements, func() (store.Cursor, error) {
+		return storage.Scan(nil, nil)
+	})
+
+	// range scan
+	assertCursor(t, elements[from:to], func() (store.Cursor, error) {
+		return storage.Scan(elements[from].Key, elements[to].Key)
+	})
+
+	// open-ended scans
+	assertCursor(t, elements[from:], func() (store.Cursor, error) {
+		return storage.Scan(elements[from].Key, nil)
+	})
+	assertCursor(t, elements[:to], func() (store.Cursor, error) {
+		return storage.Scan(nil, elements[to].Key)
+	})
+
+	// wrap up
+	err := storage.(store.Storage).Close()
+	assert.NoError(t, err)
+}
+
+// PrefixOperation performs multiple writes and prefix scans on the storage
+// it asserts that only the elements starting with the prefix are returned in key order
+func PrefixOperation(t *testing.T, storage store.Iterable, generator RandomFactory) {
+
+	elements := Elements(num, generator)
+
+	//  write path
+	for i, element := range elements {
+		// make sure we have a few shared prefixes
+		element.Key[0] = byte(i % 4)
+		err := storage.(store.Storage).Put(element)
+		assert.NoError(t, err)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return store.IsLess(elements[i], elements[j])
+	})
+
+	for _, prefix := range []store.Key{{2}, elements[num/2].Key[:2], elements[num/2].Key, {4}} {
+		expected := make([]store.Element, 0)
+		for _, element := range elements {
+			if bytes.HasPrefix(element.Key, prefix) {
+				expected = append(expected, element)
+			}
+		}
+		assertCursor(t, expected, func() (store.Cursor, error) {
+			return storage.Prefix(prefix)
+		})
+	}
+
+	// wrap up
+	err := storage.(store.Storage).Close()
+	assert.NoError(t, err)
+}
+
 const num = 1000
 
+// MultiDeleteOperations executes multiple write operations and deletes half of the elements
+// it asserts that only the deleted elements are missing from the store
+func MultiDeleteOperations(t *testing.T, storage store.Storage, generator RandomFactory, checkMeta bool) {
+
+	metadata := store.NewMetadata()
+
+	elements := Elements(num, generator)
+
+	//  write path
+	for _, element := range elements {
+		err := storage.Put(element)
+		assert.NoError(t, err)
+	}
+
+	// delete path
+	for i, element := range elements {
+		if i%2 == 0 {
+			err := storage.Delete(element.Key)
+			assert.NoError(t, err)
+		} else {
+			metadata.Add(element)
+		}
+	}
+
+	// read path
+	for i, element := range elements {
+		value, err := storage.Get(element.Key)
+		if i%2 == 0 {
+			assert.ErrorIs(t, err, store.ErrNotFound)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, element.Value, value.Value)
+		}
+	}
+
+	if checkMeta {
+		// assert internal stats
+		assert.Equal(t, metadata.Size, storage.Metadata().Size)
+	} else {
+		// print just the metadata
+		log.Info().Msg(fmt.Sprintf("metadata = %v", storage.Metadata()))
+	}
+
+	// wrap up
+	err := storage.Close()
+	assert.NoError(t, err)
+}
+
+// BatchOperation writes and deletes multiple elements through a batch
+// it asserts that none of the writes is visible before the commit, and all of them after it
+func BatchOperation(t *testing.T, storage store.Batcher, generator RandomFactory, checkMeta bool) {
+
+	elements := Elements(num, generator)
+
+	//  write path for the first half
+	for _, element := range elements[:num/2] {
+		err := storage.(store.Storage).Put(element)
+		assert.NoError(t, err)
+	}
+
+	batch := storage.NewBatch()
+	// new elements
+	for _, element := range elements[num/2:] {
+		batch.Put(element)
+	}
+	// removal of existing elements
+	for i, element := range elements[:num/2] {
+		if i%2 == 0 {
+			batch.Delete(element.Key)
+		}
+	}
+	// removal of a non-existing element
+	batch.Delete(generator.ElementFactory().Key)
+	// removal of an element written within the batch
+	last := elements[num-1]
+	batch.Delete(last.Key)
+
+	// nothing is visible before the commit
+	for _, element := range elements[:num/2] {
+		IntermediateReadOperation(t, storage.(store.Storage), element.Key, element.Value)
+	}
+	for _, element := range elements[num/2:] {
+		_, err := storage.(store.Storage).Get(element.Key)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	}
+
+	err := batch.Commit()
+	assert.NoError(t, err)
+
+	// read path
+	metadata := store.NewMetadata()
+	for i, element := range elements {
+		value, err := storage.(store.Storage).Get(element.Key)
+		if (i < num/2 && i%2 == 0) || i == num-1 {
+			assert.ErrorIs(t, err, store.ErrNotFound)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, element.Value, value.Value)
+			metadata.Add(element)
+		}
+	}
+
+	if checkMeta {
+		// assert internal stats
+		assert.Equal(t, metadata.Size, storage.(store.Storage).Metadata().Size)
+	} else {
+		// print just the metadata
+		log.Info().Msg(fmt.Sprintf("metadata = %v", storage.(store.Storage).Metadata()))
+	}
+
+	// wrap up
+	err = storage.(store.Storage).Close()
+	assert.NoError(t, err)
+}
+
+// SnapshotOperation takes a snapshot of the storage and restores it into a second storage
+// it asserts that the second storage ends up with the same elements,
+// and that an invalid snapshot leaves the storage untouched
+func SnapshotOperation(t *testing.T, storage, target store.Snapshotter, generator RandomFactory) {
+
+	elements := Elements(num, generator)
+
+	//  write path
+	for _, element := range elements {
+		err := storage.(store.Storage).Put(element)
+		assert.NoError(t, err)
+	}
+
+	snapshot := new(bytes.Buffer)
+	err := storage.Snapshot(snapshot)
+	assert.NoError(t, err)
+
+	// an invalid snapshot is rejected before anything is written
+	corrupted := make([]byte, snapshot.Len()-1)
+	copy(corrupted, snapshot.Bytes())
+	err = target.Restore(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, store.ErrCorrupted)
+	assert.Equal(t, uint64(0), target.(store.Storage).Metadata().Size)
+
+	err = target.Restore(snapshot)
+	assert.NoError(t, err)
+
+	// read path
+	for _, element := range elements {
+		IntermediateReadOperation(t, target.(store.Storage), element.Key, element.Value)
+	}
+	assert.Equal(t, uint64(num), target.(store.Storage).Metadata().Size)
+
+	// wrap up
+	err = storage.(store.Storage).Close()
+	assert.NoError(t, err)
+	err = target.(store.Storage).Close()
+	assert.NoError(t, err)
+}
+
+// indexed is the value type for the index operations
+type indexed struct {
+	Value store.Value
+	Tags  []string
+}
+
+// IndexOperation writes, overwrites and deletes values through a repository with a secondary index
+// it asserts that the index follows every change of the values, including the ones that move a value to another index key
+func IndexOperation(t *testing.T, storage, indexStorage store.Storage, generator RandomFactory) {
+
+	repo := store.NewRepository[store.Key, indexed](storage, store.RawCodec[store.Key]{}, store.GobCodec[indexed]{})
+	index := store.NewIndex[store.Key, indexed, string](repo, indexStorage, store.RawCodec[string]{}, func(value indexed) []string {
+		return value.Tags
+	})
+
+	if _, ok := indexStorage.(store.Iterable); !ok {
+		// the index entries are looked up by prefix
+		_, err := index.Find("tag")
+		assert.ErrorIs(t, err, store.ErrNotSupported)
+		_, err = index.Scan(nil, nil)
+		assert.ErrorIs(t, err, store.ErrNotSupported)
+		err = repo.Close()
+		assert.NoError(t, err)
+		return
+	}
+
+	tag := func(i int) string {
+		return fmt.Sprintf("tag-%d", i%4)
+	}
+
+	// expected holds the keys for every tag
+	expected := make(map[string]map[string]store.Value)
+	add := func(tag string, element store.Element) {
+		if _, ok := expected[tag]; !ok {
+			expected[tag] = make(map[string]store.Value)
+		}
+		expected[tag][string(element.Key)] = element.Value
+	}
+	assertIndex := func() {
+		for i := 0; i < 5; i++ {
+			cursor, err := index.Find(tag(i))
+			assert.NoError(t, err)
+			actual := make(map[string]store.Value)
+			for cursor.Next() {
+				kv := cursor.KV()
+				actual[string(kv.Key)] = kv.Value.Value
+			}
+			assert.NoError(t, cursor.Err())
+			if len(expected[tag(i)]) == 0 {
+				assert.Empty(t, actual, "for %s", tag(i))
+			} else {
+				assert.Equal(t, expected[tag(i)], actual, "for %s", tag(i))
+			}
+		}
+	}
+
+	elements := Elements(num, generator)
+
+	//  write path, with every value under its own tag and the common one
+	for i, element := range elements {
+		err := repo.Put(store.KV[store.Key, indexed]{Key: element.Key, Value: indexed{Value: element.Value, Tags: []string{tag(i), "common"}}})
+		assert.NoError(t, err)
+		add(tag(i), element)
+	}
+	assertIndex()
+
+	// every value maps to two index keys, but is returned only once
+	cursor, err := index.Scan(nil, nil)
+	assert.NoError(t, err)
+	count := 0
+	for cursor.Next() {
+		count++
+	}
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, len(elements), count)
+
+	// overwrite path
+	expected = make(map[string]map[string]store.Value)
+	for i, element := range elements {
+		switch i % 3 {
+		case 0:
+			// move the value to the next tag
+			element.Value = generator.ElementFactory().Value
+			err := repo.Put(store.KV[store.Key, indexed]{Key: element.Key, Value: indexed{Value: element.Value, Tags: []string{tag(i + 1)}}})
+			assert.NoError(t, err)
+			add(tag(i+1), element)
+		case 1:
+			// change the value, but keep the tag
+			element.Value = generator.ElementFactory().Value
+			err := repo.Put(store.KV[store.Key, indexed]{Key: element.Key, Value: indexed{Value: element.Value, Tags: []string{tag(i)}}})
+			assert.NoError(t, err)
+			add(tag(i), element)
+		case 2:
+			// delete path
+			err := repo.Delete(element.Key)
+			assert.NoError(t, err)
+		}
+	}
+	assertIndex()
+
+	cursor, err = index.Find("common")
+	assert.NoError(t, err)
+	assert.False(t, cursor.Next())
+
+	// range path
+	from, to := tag(1), tag(3)
+	cursor, err = index.Scan(&from, &to)
+	assert.NoError(t, err)
+	count = 0
+	for cursor.Next() {
+		kv := cursor.KV()
+		assert.Contains(t, []string{tag(1), tag(2)}, kv.Value.Tags[0])
+		count++
+	}
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, len(expected[tag(1)])+len(expected[tag(2)]), count)
+
+	// wrap up
+	err = repo.Close()
+	assert.NoError(t, err)
+}
+
+// ExpiryOperation writes elements with a ttl, some of which are overwritten without one
+// it asserts that the elements behave as not found after their ttl, while the rest of them are still there
+func ExpiryOperation(t *testing.T, storage store.Expirer, generator RandomFactory, checkMeta bool) {
+
+	elements := Elements(num, generator)
+	ttl := 100 * time.Millisecond
+
+	//  write path
+	for i, element := range elements {
+		switch i % 3 {
+		case 0:
+			err := storage.PutWithTTL(element, ttl)
+			assert.NoError(t, err)
+			IntermediateReadOperation(t, storage.(store.Storage), element.Key, element.Value)
+		case 1:
+			err := storage.PutWithTTL(element, time.Hour)
+			assert.NoError(t, err)
+		case 2:
+			// a plain put removes the expiry
+			err := storage.PutWithTTL(element, ttl)
+			assert.NoError(t, err)
+			err = storage.(store.Storage).Put(element)
+			assert.NoError(t, err)
+		}
+	}
+
+	time.Sleep(ttl)
+
+	// read path
+	live := make([]store.Element, 0)
+	for i, element := range elements {
+		if i%3 != 0 {
+			IntermediateReadOperation(t, storage.(store.Storage), element.Key, element.Value)
+			live = append(live, element)
+			continue
+		}
+		if i%2 == 0 {
+			err := storage.(store.Storage).Delete(element.Key)
+			assert.ErrorIs(t, err, store.ErrNotFound)
+		}
+		_, err := storage.(store.Storage).Get(element.Key)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	}
+
+	if iterable, ok := storage.(store.Iterable); ok {
+		sort.Slice(live, func(i, j int) bool {
+			return bytes.Compare(live[i].Key, live[j].Key) < 0
+		})
+		assertCursor(t, live, func() (store.Cursor, error) {
+			return iterable.Scan(nil, nil)
+		})
+	}
+
+	if checkMeta {
+		// the expired elements have been removed on read
+		assert.Equal(t, uint64(len(live)), storage.(store.Storage).Metadata().Size)
+	} else {
+		// print just the metadata
+		log.Info().Msg(fmt.Sprintf("metadata = %v", storage.(store.Storage).Metadata()))
+	}
+
+	// wrap up
+	err := storage.(store.Storage).Close()
+	assert.NoError(t, err)
+}
+
 // MultiReadWriteOperations executes multiple read and write operations
 func MultiReadWriteOperations(t *testing.T, storage store.Storage, generator RandomFactory, checkMeta bool) {
 
@@ -290,3 +763,17 @@ func assertMeta(t *testing.T, size, keysSize, vaLuesSize uint64, meta store.Meta
 	//assert.Equal(t, vaLuesSize, meta.ValuesBytes)
 	assert.Equal(t, 0, len(meta.Errors))
 }
+
+func assertCursor(t *testing.T, expected []store.Element, scan func() (store.Cursor, error)) {
+	cursor, err := scan()
+	assert.NoError(t, err)
+	elements := make([]store.Element, 0)
+	for cursor.Next() {
+		elements = append(elements, cursor.Element())
+	}
+	assert.Equal(t, len(expected), len(elements))
+	for i := range elements {
+		assert.Equal(t, expected[i].Key, elements[i].Key)
+		assert.Equal(t, expected[i].Value, elements[i].Value)
+	}
+}
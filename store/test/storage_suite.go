@@ -33,6 +33,50 @@ func (s *Suite) SetupTest() {
 	// TODO : remove if nothing else todo here
 }
 
+// iterable returns the storage as an Iterable
+// it skips the current test if the storage does not support ordered iteration
+func (s *Suite) iterable(storage store.Storage) store.Iterable {
+	iterable, ok := storage.(store.Iterable)
+	if !ok {
+		s.NoError(storage.Close())
+		s.T().Skipf("storage %T does not support ordered iteration", storage)
+	}
+	return iterable
+}
+
+// batcher returns the storage as a Batcher
+// it skips the current test if the storage does not support batches
+func (s *Suite) batcher(storage store.Storage) store.Batcher {
+	batcher, ok := storage.(store.Batcher)
+	if !ok {
+		s.NoError(storage.Close())
+		s.T().Skipf("storage %T does not support batches", storage)
+	}
+	return batcher
+}
+
+// snapshotter returns the storage as a Snapshotter
+// it skips the current test if the storage does not support snapshots
+func (s *Suite) snapshotter(storage store.Storage) store.Snapshotter {
+	snapshotter, ok := storage.(store.Snapshotter)
+	if !ok {
+		s.NoError(storage.Close())
+		s.T().Skipf("storage %T does not support snapshots", storage)
+	}
+	return snapshotter
+}
+
+// expirer returns the storage as an Expirer
+// it skips the current test if the storage does not support expiry
+func (s *Suite) expirer(storage store.Storage) store.Expirer {
+	expirer, ok := storage.(store.Expirer)
+	if !ok {
+		s.NoError(storage.Close())
+		s.T().Skipf("storage %T does not support expiry", storage)
+	}
+	return expirer
+}
+
 // Consistency is the storage consistency test suite
 type Consistency struct {
 	Suite
@@ -56,6 +100,53 @@ func (s *Consistency) TestMultiReadWriteOperations() {
 	MultiReadWriteOperations(s.t, storage, Random(10, 20), false)
 }
 
+// TestDeleteOperation tests the given storage on a delete operation
+func (s *Consistency) TestDeleteOperation() {
+	storage := s.newStorage()
+	DeleteOperation(s.t, storage, Random(10, 20), false)
+}
+
+// TestMultiDeleteOperations tests the given storage on multiple write and delete operations
+func (s *Consistency) TestMultiDeleteOperations() {
+	storage := s.newStorage()
+	MultiDeleteOperations(s.t, storage, Random(10, 20), false)
+}
+
+// TestScanOperation tests the ordering of the range scans for the storage implementations that support it
+func (s *Consistency) TestScanOperation() {
+	storage := s.iterable(s.newStorage())
+	ScanOperation(s.t, storage, Random(10, 20))
+}
+
+// TestPrefixOperation tests the ordering of the prefix scans for the storage implementations that support it
+func (s *Consistency) TestPrefixOperation() {
+	storage := s.iterable(s.newStorage())
+	PrefixOperation(s.t, storage, Random(10, 20))
+}
+
+// TestBatchOperation tests the batch writes for the storage implementations that support them
+func (s *Consistency) TestBatchOperation() {
+	storage := s.batcher(s.newStorage())
+	BatchOperation(s.t, storage, Random(10, 20), false)
+}
+
+// TestSnapshotOperation tests the snapshot and restore for the storage implementations that support them
+func (s *Consistency) TestSnapshotOperation() {
+	storage := s.snapshotter(s.newStorage())
+	SnapshotOperation(s.t, storage, s.snapshotter(s.newStorage()), Random(10, 20))
+}
+
+// TestExpiryOperation tests the ttl of the elements for the storage implementations that support it
+func (s *Consistency) TestExpiryOperation() {
+	storage := s.expirer(s.newStorage())
+	ExpiryOperation(s.t, storage, Random(10, 20), false)
+}
+
+// TestIndexOperation tests the secondary indexes of a repository, kept in the storage implementation
+func (s *Consistency) TestIndexOperation() {
+	IndexOperation(s.t, s.newStorage(), s.newStorage(), Random(10, 20))
+}
+
 // Run executes the Consistency test suite
 func (s *Consistency) Run(t *testing.T, factory store.StorageFactory) {
 	s.t = t
@@ -93,6 +184,53 @@ func (s *ConsistencyWithMeta) TestMultiReadWriteOperations() {
 	MultiReadWriteOperations(s.t, storage, Random(10, 20), true)
 }
 
+// TestDeleteOperation executes a test for the delete operation
+func (s *ConsistencyWithMeta) TestDeleteOperation() {
+	storage := s.newStorage()
+	DeleteOperation(s.t, storage, Random(10, 20), true)
+}
+
+// TestMultiDeleteOperations executes tests on several write and delete operations
+func (s *ConsistencyWithMeta) TestMultiDeleteOperations() {
+	storage := s.newStorage()
+	MultiDeleteOperations(s.t, storage, Random(10, 20), true)
+}
+
+// TestScanOperation tests the ordering of the range scans for the storage implementations that support it
+func (s *ConsistencyWithMeta) TestScanOperation() {
+	storage := s.iterable(s.newStorage())
+	ScanOperation(s.t, storage, Random(10, 20))
+}
+
+// TestPrefixOperation tests the ordering of the prefix scans for the storage implementations that support it
+func (s *ConsistencyWithMeta) TestPrefixOperation() {
+	storage := s.iterable(s.newStorage())
+	PrefixOperation(s.t, storage, Random(10, 20))
+}
+
+// TestBatchOperation tests the batch writes for the storage implementations that support them
+func (s *ConsistencyWithMeta) TestBatchOperation() {
+	storage := s.batcher(s.newStorage())
+	BatchOperation(s.t, storage, Random(10, 20), true)
+}
+
+// TestSnapshotOperation tests the snapshot and restore for the storage implementations that support them
+func (s *ConsistencyWithMeta) TestSnapshotOperation() {
+	storage := s.snapshotter(s.newStorage())
+	SnapshotOperation(s.t, storage, s.snapshotter(s.newStorage()), Random(10, 20))
+}
+
+// TestExpiryOperation tests the ttl of the elements for the storage implementations that support it
+func (s *ConsistencyWithMeta) TestExpiryOperation() {
+	storage := s.expirer(s.newStorage())
+	ExpiryOperation(s.t, storage, Random(10, 20), true)
+}
+
+// TestIndexOperation tests the secondary indexes of a repository, kept in the storage implementation
+func (s *ConsistencyWithMeta) TestIndexOperation() {
+	IndexOperation(s.t, s.newStorage(), s.newStorage(), Random(10, 20))
+}
+
 // Run executes the ConsistencyWithMeta test suite
 func (s *ConsistencyWithMeta) Run(t *testing.T, factory store.StorageFactory) {
 	s.t = t
@@ -0,0 +1,92 @@
+package tuple
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Codec encodes the keys of a repository as tuples
+type Codec struct{}
+
+// Encode packs the tuple
+func (Codec) Encode(t Tuple) ([]byte, error) {
+	return Pack(t)
+}
+
+// Decode unpacks the tuple
+func (Codec) Decode(b []byte) (Tuple, error) {
+	return Unpack(b)
+}
+
+// KeyCodec encodes the keys of a repository, that consist of a single element, as one element tuples
+// so that e.g. integer keys sort in their numeric order.
+type KeyCodec[T any] struct{}
+
+// Encode packs the key
+func (KeyCodec[T]) Encode(v T) ([]byte, error) {
+	return Pack(Tuple{v})
+}
+
+// Decode unpacks the key, and converts it back to the key type
+func (KeyCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	t, err := Unpack(b)
+	if err != nil {
+		return v, err
+	}
+	if len(t) != 1 {
+		return v, fmt.Errorf("expected a single element tuple for key of type %T, but got %v", v, t)
+	}
+	return v, assign(reflect.ValueOf(&v).Elem(), t[0])
+}
+
+// assign sets the decoded element to the target value
+// the element is converted to the type of the target, as long as they are of the same kind of type.
+func assign(target reflect.Value, e interface{}) error {
+	if e == nil {
+		// nil leaves the target to its zero value
+		return nil
+	}
+	value := reflect.ValueOf(e)
+	if value.Type().AssignableTo(target.Type()) {
+		target.Set(value)
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := e.(int64); ok && !target.OverflowInt(i) {
+			target.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch i := e.(type) {
+		case int64:
+			if i >= 0 && !target.OverflowUint(uint64(i)) {
+				target.SetUint(uint64(i))
+				return nil
+			}
+		case uint64:
+			if !target.OverflowUint(i) {
+				target.SetUint(i)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch f := e.(type) {
+		case float32:
+			target.SetFloat(float64(f))
+			return nil
+		case float64:
+			if !target.OverflowFloat(f) {
+				target.SetFloat(f)
+				return nil
+			}
+		}
+	case reflect.String, reflect.Bool, reflect.Slice:
+		if value.Type().ConvertibleTo(target.Type()) && value.Kind() == target.Kind() {
+			target.Set(value.Convert(target.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("could not convert tuple element %v of type %T to %v", e, e, target.Type())
+}
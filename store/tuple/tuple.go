@@ -0,0 +1,350 @@
+// Package tuple encodes keys made of typed elements into byte slices,
+// that sort in the same order as the elements themselves.
+// It follows the tuple layer of FoundationDB, so that range scans over the ordered storage implementations
+// return typed keys in their logical order.
+package tuple
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+)
+
+// Tuple is an ordered sequence of elements
+// the supported element types are nil, []byte, string, the signed and unsigned integers, float32, float64,
+// bool, time.Time and nested Tuples, as well as named types based on them.
+// Tuples compare element by element, with the elements of different types ordered by their type code.
+type Tuple []interface{}
+
+// type codes, as defined by the FoundationDB tuple layer
+// time values use one of the codes the layer leaves for user types.
+const (
+	nilCode     = 0x00
+	bytesCode   = 0x01
+	stringCode  = 0x02
+	nestedCode  = 0x05
+	intZeroCode = 0x14
+	float32Code = 0x20
+	float64Code = 0x21
+	falseCode   = 0x26
+	trueCode    = 0x27
+	timeCode    = 0x40
+	// escape follows a nil byte within byte slices, strings and nested tuples,
+	// so that it is not taken for their terminator
+	escape = 0xFF
+	// intSize is the maximum number of bytes of an encoded integer
+	intSize = 8
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Pack encodes the tuple, so that the byte order of the result matches the order of the tuple
+func Pack(t Tuple) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	for _, e := range t {
+		if err := encode(buffer, e, false); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// Unpack decodes the tuple from its encoded form
+// integers are returned as int64, or as uint64 if they do not fit into an int64, and time values in UTC.
+func Unpack(b []byte) (Tuple, error) {
+	t := make(Tuple, 0)
+	for i := 0; i < len(b); {
+		e, n, err := decode(b[i:], false)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, e)
+		i += n
+	}
+	return t, nil
+}
+
+// encode writes a single element to the buffer
+// a nil element within a nested tuple is escaped, so that it is not taken for the end of the tuple.
+func encode(buffer *bytes.Buffer, e interface{}, nested bool) error {
+	switch v := e.(type) {
+	case nil:
+		buffer.WriteByte(nilCode)
+		if nested {
+			buffer.WriteByte(escape)
+		}
+	case []byte:
+		writeBytes(buffer, bytesCode, v)
+	case string:
+		writeBytes(buffer, stringCode, []byte(v))
+	case int:
+		writeInt(buffer, int64(v))
+	case int8:
+		writeInt(buffer, int64(v))
+	case int16:
+		writeInt(buffer, int64(v))
+	case int32:
+		writeInt(buffer, int64(v))
+	case int64:
+		writeInt(buffer, v)
+	case uint:
+		writeUint(buffer, uint64(v))
+	case uint8:
+		writeUint(buffer, uint64(v))
+	case uint16:
+		writeUint(buffer, uint64(v))
+	case uint32:
+		writeUint(buffer, uint64(v))
+	case uint64:
+		writeUint(buffer, v)
+	case float32:
+		buffer.WriteByte(float32Code)
+		bits := math.Float32bits(v)
+		if bits&(1<<31) != 0 {
+			bits = ^bits
+		} else {
+			bits ^= 1 << 31
+		}
+		_ = binary.Write(buffer, binary.BigEndian, bits)
+	case float64:
+		buffer.WriteByte(float64Code)
+		_ = binary.Write(buffer, binary.BigEndian, float64Bits(v))
+	case bool:
+		if v {
+			buffer.WriteByte(trueCode)
+		} else {
+			buffer.WriteByte(falseCode)
+		}
+	case time.Time:
+		buffer.WriteByte(timeCode)
+		_ = binary.Write(buffer, binary.BigEndian, uint64(v.Unix())^(1<<63))
+		_ = binary.Write(buffer, binary.BigEndian, uint32(v.Nanosecond()))
+	case Tuple:
+		buffer.WriteByte(nestedCode)
+		for _, element := range v {
+			if err := encode(buffer, element, true); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(nilCode)
+	default:
+		return encodeKind(buffer, e, nested)
+	}
+	return nil
+}
+
+// encodeKind writes an element of a named type, based on the kind of its underlying type
+func encodeKind(buffer *bytes.Buffer, e interface{}, nested bool) error {
+	v := reflect.ValueOf(e)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encode(buffer, v.Int(), nested)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encode(buffer, v.Uint(), nested)
+	case reflect.Float32:
+		return encode(buffer, float32(v.Float()), nested)
+	case reflect.Float64:
+		return encode(buffer, v.Float(), nested)
+	case reflect.String:
+		return encode(buffer, v.String(), nested)
+	case reflect.Bool:
+		return encode(buffer, v.Bool(), nested)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return encode(buffer, v.Bytes(), nested)
+		}
+	}
+	return fmt.Errorf("unsupported tuple element type %T", e)
+}
+
+// writeBytes writes the byte slice with the given type code, escaping its nil bytes
+func writeBytes(buffer *bytes.Buffer, code byte, b []byte) {
+	buffer.WriteByte(code)
+	for _, c := range b {
+		buffer.WriteByte(c)
+		if c == nilCode {
+			buffer.WriteByte(escape)
+		}
+	}
+	buffer.WriteByte(nilCode)
+}
+
+// writeInt writes the integer with the minimum number of bytes
+// the type code holds the number of bytes and the sign,
+// and negative integers are stored as the ones' complement of their absolute value, so that they sort before the positive ones.
+func writeInt(buffer *bytes.Buffer, v int64) {
+	if v >= 0 {
+		writeUint(buffer, uint64(v))
+		return
+	}
+	// the conversion of the negated value holds the absolute value even for math.MinInt64
+	u := uint64(-v)
+	n := intLength(u)
+	buffer.WriteByte(byte(intZeroCode - n))
+	writeIntBytes(buffer, u^mask(n), n)
+}
+
+// writeUint writes the unsigned integer with the minimum number of bytes
+func writeUint(buffer *bytes.Buffer, u uint64) {
+	n := intLength(u)
+	buffer.WriteByte(byte(intZeroCode + n))
+	writeIntBytes(buffer, u, n)
+}
+
+// writeIntBytes writes the n least significant bytes of the integer in big endian order
+func writeIntBytes(buffer *bytes.Buffer, u uint64, n int) {
+	b := make([]byte, intSize)
+	binary.BigEndian.PutUint64(b, u)
+	buffer.Write(b[intSize-n:])
+}
+
+// intLength returns the number of bytes needed for the integer
+func intLength(u uint64) int {
+	n := 0
+	for u > 0 {
+		n++
+		u >>= 8
+	}
+	return n
+}
+
+// mask returns the integer with the n least significant bytes set
+func mask(n int) uint64 {
+	if n == intSize {
+		return math.MaxUint64
+	}
+	return 1<<(8*uint(n)) - 1
+}
+
+// float64Bits returns the bits of the float, transformed so that they sort in the order of the floats
+// the sign bit of positive floats is flipped, and all the bits of the negative ones.
+func float64Bits(f float64) uint64 {
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits ^ (1 << 63)
+}
+
+// decode reads a single element from the start of the byte slice, and returns it along with its encoded size
+func decode(b []byte, nested bool) (interface{}, int, error) {
+	code := b[0]
+	switch {
+	case code == nilCode:
+		if nested {
+			// the terminator of the nested tuple is handled by the caller
+			return nil, 2, nil
+		}
+		return nil, 1, nil
+	case code == bytesCode:
+		v, n, err := readBytes(b)
+		return v, n, err
+	case code == stringCode:
+		v, n, err := readBytes(b)
+		return string(v), n, err
+	case code == nestedCode:
+		return readTuple(b)
+	case code >= intZeroCode-intSize && code <= intZeroCode+intSize:
+		return readInt(b)
+	case code == float32Code:
+		if len(b) < 5 {
+			return nil, 0, corrupted(code)
+		}
+		bits := binary.BigEndian.Uint32(b[1:])
+		if bits&(1<<31) != 0 {
+			bits ^= 1 << 31
+		} else {
+			bits = ^bits
+		}
+		return math.Float32frombits(bits), 5, nil
+	case code == float64Code:
+		if len(b) < 9 {
+			return nil, 0, corrupted(code)
+		}
+		bits := binary.BigEndian.Uint64(b[1:])
+		if bits&(1<<63) != 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits), 9, nil
+	case code == falseCode:
+		return false, 1, nil
+	case code == trueCode:
+		return true, 1, nil
+	case code == timeCode:
+		if len(b) < 13 {
+			return nil, 0, corrupted(code)
+		}
+		seconds := int64(binary.BigEndian.Uint64(b[1:]) ^ (1 << 63))
+		nanos := int64(binary.BigEndian.Uint32(b[9:]))
+		return time.Unix(seconds, nanos).UTC(), 13, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown tuple type code %#x", store.ErrCorrupted, code)
+}
+
+// readBytes reads an escaped byte slice up to its terminator
+func readBytes(b []byte) ([]byte, int, error) {
+	v := make([]byte, 0)
+	for i := 1; i < len(b); i++ {
+		if b[i] != nilCode {
+			v = append(v, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == escape {
+			v = append(v, nilCode)
+			i++
+			continue
+		}
+		return v, i + 1, nil
+	}
+	return nil, 0, corrupted(b[0])
+}
+
+// readTuple reads a nested tuple up to its terminator
+func readTuple(b []byte) (Tuple, int, error) {
+	t := make(Tuple, 0)
+	for i := 1; i < len(b); {
+		if b[i] == nilCode && (i+1 == len(b) || b[i+1] != escape) {
+			return t, i + 1, nil
+		}
+		e, n, err := decode(b[i:], true)
+		if err != nil {
+			return nil, 0, err
+		}
+		t = append(t, e)
+		i += n
+	}
+	return nil, 0, corrupted(b[0])
+}
+
+// readInt reads an integer, as an int64 if it fits, otherwise as an uint64
+func readInt(b []byte) (interface{}, int, error) {
+	n := int(b[0]) - intZeroCode
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	if len(b) < n+1 {
+		return nil, 0, corrupted(b[0])
+	}
+	v := make([]byte, intSize)
+	copy(v[intSize-n:], b[1:n+1])
+	u := binary.BigEndian.Uint64(v)
+	if negative {
+		return -int64(u ^ mask(n)), n + 1, nil
+	}
+	if u > math.MaxInt64 {
+		return u, n + 1, nil
+	}
+	return int64(u), n + 1, nil
+}
+
+func corrupted(code byte) error {
+	return fmt.Errorf("%w: truncated tuple element of type %#x", store.ErrCorrupted, code)
+}
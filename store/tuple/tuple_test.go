@@ -0,0 +1,255 @@
+package tuple
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/drakos74/lachesis/store/store"
+	"github.com/drakos74/lachesis/store/store/io/mem"
+	"github.com/stretchr/testify/assert"
+)
+
+// ordered lists tuples in their logical order
+var ordered = []Tuple{
+	{nil},
+	{[]byte{}},
+	{[]byte{0x00}},
+	{[]byte{0x00, 0x00}},
+	{[]byte{0x00, 0x01}},
+	{[]byte{0x01}},
+	{[]byte{0xFF}},
+	{""},
+	{"a"},
+	{"a\x00"},
+	{"a\x00b"},
+	{"ab"},
+	{"b"},
+	{Tuple{}},
+	{Tuple{nil}},
+	{Tuple{nil, nil}},
+	{Tuple{int64(1)}},
+	{Tuple{int64(1), "a"}},
+	{Tuple{int64(2)}},
+	{int64(math.MinInt64)},
+	{int64(math.MinInt64 + 1)},
+	{int64(-65536)},
+	{int64(-65535)},
+	{int64(-256)},
+	{int64(-255)},
+	{int64(-2)},
+	{int64(-1)},
+	{int64(0)},
+	{int64(1)},
+	{int64(1), nil},
+	{int64(1), "a"},
+	{int64(1), int64(0)},
+	{int64(1), int64(0), "a"},
+	{int64(1), int64(1)},
+	{int64(2)},
+	{int64(10)},
+	{int64(255)},
+	{int64(256)},
+	{int64(65535)},
+	{int64(65536)},
+	{int64(math.MaxInt64)},
+	{uint64(math.MaxInt64 + 1)},
+	{uint64(math.MaxUint64)},
+	{float32(math.Inf(-1))},
+	{float32(-1.5)},
+	{float32(0)},
+	{float32(1.5)},
+	{float32(math.Inf(1))},
+	{math.Inf(-1)},
+	{-math.MaxFloat64},
+	{-1.0},
+	{-math.SmallestNonzeroFloat64},
+	{0.0},
+	{math.SmallestNonzeroFloat64},
+	{1.0},
+	{math.MaxFloat64},
+	{math.Inf(1)},
+	{false},
+	{true},
+	{time.Unix(-1, 0).UTC()},
+	{time.Unix(0, 0).UTC()},
+	{time.Unix(0, 1).UTC()},
+	{time.Unix(1, 0).UTC()},
+	{time.Date(2262, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestPack_Order(t *testing.T) {
+
+	packed := make([][]byte, len(ordered))
+	for i, tuple := range ordered {
+		b, err := Pack(tuple)
+		assert.NoError(t, err)
+		packed[i] = b
+	}
+
+	for i := 1; i < len(packed); i++ {
+		assert.True(t, bytes.Compare(packed[i-1], packed[i]) < 0, "expected %v < %v", ordered[i-1], ordered[i])
+	}
+
+}
+
+func TestPack_RoundTrip(t *testing.T) {
+
+	for _, tuple := range ordered {
+		b, err := Pack(tuple)
+		assert.NoError(t, err)
+		unpacked, err := Unpack(b)
+		assert.NoError(t, err)
+		assert.Equal(t, tuple, unpacked)
+	}
+
+}
+
+func TestPack_Types(t *testing.T) {
+
+	type id int
+	type name string
+
+	// all integer types are packed the same way, and unpacked as int64
+	for _, v := range []interface{}{int(7), int8(7), int16(7), int32(7), int64(7), uint(7), uint8(7), uint16(7), uint32(7), uint64(7), id(7)} {
+		b, err := Pack(Tuple{v})
+		assert.NoError(t, err)
+		unpacked, err := Unpack(b)
+		assert.NoError(t, err)
+		assert.Equal(t, Tuple{int64(7)}, unpacked, "for %T", v)
+	}
+
+	b, err := Pack(Tuple{name("name"), store.Key("key")})
+	assert.NoError(t, err)
+	unpacked, err := Unpack(b)
+	assert.NoError(t, err)
+	assert.Equal(t, Tuple{"name", []byte("key")}, unpacked)
+
+	_, err = Pack(Tuple{struct{}{}})
+	assert.Error(t, err)
+
+	for _, invalid := range [][]byte{{0x03}, {stringCode, 'a'}, {0x16, 0x01}, {float64Code, 0x01}, {nestedCode, intZeroCode}} {
+		_, err := Unpack(invalid)
+		assert.ErrorIs(t, err, store.ErrCorrupted, "for %v", invalid)
+	}
+
+}
+
+func TestPack_RandomIntegers(t *testing.T) {
+
+	numbers := make([]int64, 1000)
+	for i := range numbers {
+		// spread the numbers over all encoded sizes
+		numbers[i] = rand.Int63() >> uint(rand.Intn(64))
+		if rand.Intn(2) == 0 {
+			numbers[i] = -numbers[i]
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i] < numbers[j]
+	})
+
+	var previous []byte
+	for _, n := range numbers {
+		b, err := Pack(Tuple{n})
+		assert.NoError(t, err)
+		assert.True(t, bytes.Compare(previous, b) <= 0, "expected %v to sort after %v", n, previous)
+		previous = b
+	}
+
+}
+
+func TestKeyCodec_Scan(t *testing.T) {
+
+	for name, factory := range map[string]store.StorageFactory{
+		"btree": mem.BTreeFactory,
+		"trie":  mem.TrieFactory,
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			repo := store.NewRepository[int, string](factory(), KeyCodec[int]{}, store.RawCodec[string]{})
+			keys := []int{10, -3, 2, 1000, 0, -300, 7}
+			for _, k := range keys {
+				err := repo.Put(store.KV[int, string]{Key: k, Value: "value"})
+				assert.NoError(t, err)
+			}
+
+			from, to := -3, 1000
+			cursor, err := repo.Scan(&from, &to)
+			assert.NoError(t, err)
+			scanned := make([]int, 0)
+			for cursor.Next() {
+				scanned = append(scanned, cursor.KV().Key)
+			}
+			assert.NoError(t, cursor.Err())
+			assert.Equal(t, []int{-3, 0, 2, 7, 10}, scanned)
+
+		})
+	}
+
+}
+
+func TestCodec_Scan(t *testing.T) {
+
+	repo := store.NewRepository[Tuple, string](mem.BTreeFactory(), Codec{}, store.RawCodec[string]{})
+	for _, k := range []Tuple{
+		{"user", int64(10), "b"},
+		{"user", int64(2)},
+		{"user", int64(2), "a"},
+		{"user", int64(10), "a"},
+		{"order", int64(1)},
+	} {
+		err := repo.Put(store.KV[Tuple, string]{Key: k, Value: "value"})
+		assert.NoError(t, err)
+	}
+
+	// all the keys of the users, from the second one on
+	from, to := Tuple{"user", int64(2)}, Tuple{"user", int64(math.MaxInt64)}
+	cursor, err := repo.Scan(&from, &to)
+	assert.NoError(t, err)
+	scanned := make([]Tuple, 0)
+	for cursor.Next() {
+		scanned = append(scanned, cursor.KV().Key)
+	}
+	assert.NoError(t, cursor.Err())
+	assert.Equal(t, []Tuple{
+		{"user", int64(2)},
+		{"user", int64(2), "a"},
+		{"user", int64(10), "a"},
+		{"user", int64(10), "b"},
+	}, scanned)
+
+}
+
+func TestKeyCodec_Decode(t *testing.T) {
+
+	type id uint16
+
+	testKeyCodec(t, KeyCodec[id]{}, id(42))
+	testKeyCodec(t, KeyCodec[int8]{}, int8(-42))
+	testKeyCodec(t, KeyCodec[uint64]{}, uint64(math.MaxUint64))
+	testKeyCodec(t, KeyCodec[float32]{}, float32(1.5))
+	testKeyCodec(t, KeyCodec[string]{}, "key")
+	testKeyCodec(t, KeyCodec[store.Key]{}, store.Key("key"))
+	testKeyCodec(t, KeyCodec[time.Time]{}, time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC))
+
+	// an element that does not fit into the key type
+	b, err := KeyCodec[int]{}.Encode(300)
+	assert.NoError(t, err)
+	_, err = KeyCodec[int8]{}.Decode(b)
+	assert.Error(t, err)
+	_, err = KeyCodec[string]{}.Decode(b)
+	assert.Error(t, err)
+
+}
+
+func testKeyCodec[T any](t *testing.T, codec KeyCodec[T], v T) {
+	b, err := codec.Encode(v)
+	assert.NoError(t, err)
+	decoded, err := codec.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, v, decoded)
+}